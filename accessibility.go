@@ -0,0 +1,106 @@
+package main
+
+import (
+	"image/color"
+
+	"darkzone/MultiTestServer/protocol"
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+const (
+	minUIScale  = 0.75
+	maxUIScale  = 1.25
+	uiScaleStep = 0.25
+)
+
+// Palette is the colors that tell sides and states apart at a glance: the
+// player's target, safe and PvP areas, and health.
+type Palette struct {
+	Target     color.RGBA
+	Safe       color.RGBA
+	PvP        color.RGBA
+	Health     color.RGBA
+	HealthBack color.RGBA
+}
+
+// paletteNames orders the palettes for the settings menu. The others keep
+// to blue, orange and yellow, which players with red-green colorblindness
+// still tell apart.
+var paletteNames = []string{"default", "deuteranopia", "protanopia"}
+
+var palettes = map[string]Palette{
+	"default": {
+		Target:     color.RGBA{255, 90, 40, 255},
+		Safe:       color.RGBA{40, 140, 70, 220},
+		PvP:        color.RGBA{170, 40, 40, 220},
+		Health:     color.RGBA{60, 220, 80, 255},
+		HealthBack: color.RGBA{80, 0, 0, 220},
+	},
+	"deuteranopia": {
+		Target:     color.RGBA{230, 159, 0, 255},
+		Safe:       color.RGBA{0, 114, 178, 220},
+		PvP:        color.RGBA{213, 94, 0, 220},
+		Health:     color.RGBA{86, 180, 233, 255},
+		HealthBack: color.RGBA{90, 50, 0, 220},
+	},
+	"protanopia": {
+		Target:     color.RGBA{240, 228, 66, 255},
+		Safe:       color.RGBA{0, 114, 178, 220},
+		PvP:        color.RGBA{160, 140, 20, 220},
+		Health:     color.RGBA{86, 180, 233, 255},
+		HealthBack: color.RGBA{60, 60, 60, 220},
+	},
+}
+
+// activePalette is the palette in use, as the settings choose.
+var activePalette = palettes["default"]
+
+func (p Palette) area(area string) color.RGBA {
+	if area == protocol.AreaPvP {
+		return p.PvP
+	}
+	return p.Safe
+}
+
+var (
+	defaultTagText = tagText
+	// highContrastTagText sets tags larger, in yellow on a solid backdrop.
+	highContrastTagText = TextStyle{Size: 13, Color: color.RGBA{255, 240, 0, 255}, Effect: TextBackdrop}
+)
+
+// hudWidth and hudHeight are the size the HUD and windows are laid out
+// at: the screen's, divided by the UI scale, so that scaled back up they
+// fill it.
+var hudWidth, hudHeight = screenWidth, screenHeight
+
+// applyAccessibility puts the palette, tag and UI scale settings into
+// effect.
+func applyAccessibility(a AccessibilitySettings) {
+	activePalette = palettes[a.Palette]
+	tagText = defaultTagText
+	if a.HighContrastTags {
+		tagText = highContrastTagText
+	}
+	hudWidth, hudHeight = int(screenWidth/a.UIScale), int(screenHeight/a.UIScale)
+}
+
+// hudLayer is the image the HUD is drawn to this frame, hudWidth by
+// hudHeight.
+func (g *Game) hudLayer() *ebiten.Image {
+	if g.hud == nil || g.hud.Bounds().Dx() != hudWidth || g.hud.Bounds().Dy() != hudHeight {
+		if g.hud != nil {
+			g.hud.Deallocate()
+		}
+		g.hud = ebiten.NewImage(hudWidth, hudHeight)
+	}
+	g.hud.Clear()
+	return g.hud
+}
+
+// drawHUD scales the HUD over the screen once it is drawn.
+func (g *Game) drawHUD(screen *ebiten.Image) {
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Scale(float64(screenWidth)/float64(hudWidth), float64(screenHeight)/float64(hudHeight))
+	op.Filter = ebiten.FilterLinear
+	screen.DrawImage(g.hud, op)
+}
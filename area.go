@@ -0,0 +1,34 @@
+package main
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+const areaBadgeWidth = 64
+
+// AreaIndicator shows whether the local player stands in a safe or a PvP
+// area, as the server reports it, and notes in chat when that changes.
+type AreaIndicator struct {
+	area string
+}
+
+func NewAreaIndicator(events *EventBus) *AreaIndicator {
+	a := &AreaIndicator{}
+	events.Subscribe(EventAreaChanged, func(e Event) {
+		area := e.Payload.(AreaChanged).Area
+		if a.area != "" && area != a.area {
+			events.Publish(EventChatReceived, ChatReceived{Channel: chatChannelSystem, From: "client", Text: T("area.entered." + area)})
+		}
+		a.area = area
+	})
+	return a
+}
+
+func (a *AreaIndicator) Draw(screen *ebiten.Image) {
+	if a.area == "" {
+		return
+	}
+	vector.DrawFilledRect(screen, 8, 8, areaBadgeWidth, 16, activePalette.area(a.area), false)
+	drawText(screen, T("area."+a.area), 12, 8, hudText)
+}
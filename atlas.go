@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"image"
+	"os"
+	"path/filepath"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+)
+
+// atlasPath is the index cmd/atlaspack writes from assets/sprites.
+const atlasPath = "assets/atlas.json"
+
+// Atlas holds sprites packed onto a few large pages by cmd/atlaspack, so
+// drawing many of them binds few textures. Sprites are looked up by their
+// path under assets/sprites without the extension, such as "item/torch".
+type Atlas struct {
+	sprites map[string]*ebiten.Image
+}
+
+// sprites is the client's atlas; it is empty until one is loaded, and
+// everything drawn from it has a fallback for sprites it lacks.
+var sprites = &Atlas{}
+
+type atlasIndex struct {
+	Pages   []string               `json:"pages"`
+	Sprites map[string]atlasSprite `json:"sprites"`
+}
+
+type atlasSprite struct {
+	Page int `json:"page"`
+	X    int `json:"x"`
+	Y    int `json:"y"`
+	W    int `json:"w"`
+	H    int `json:"h"`
+}
+
+// LoadAtlas reads an atlas index and its pages. A missing index is an empty
+// atlas, as a client built without running atlaspack has none.
+func LoadAtlas(path string) (*Atlas, error) {
+	a := &Atlas{sprites: make(map[string]*ebiten.Image)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return a, nil
+	}
+	if err != nil {
+		return a, err
+	}
+	var index atlasIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return a, err
+	}
+
+	pages := make([]*ebiten.Image, len(index.Pages))
+	for i, page := range index.Pages {
+		if pages[i], _, err = ebitenutil.NewImageFromFile(filepath.Join(filepath.Dir(path), page)); err != nil {
+			return a, err
+		}
+	}
+	for name, s := range index.Sprites {
+		if s.Page < 0 || s.Page >= len(pages) {
+			continue
+		}
+		a.sprites[name] = pages[s.Page].SubImage(image.Rect(s.X, s.Y, s.X+s.W, s.Y+s.H)).(*ebiten.Image)
+	}
+	return a, nil
+}
+
+// Sprite is the named sprite, false when the atlas has none by that name.
+func (a *Atlas) Sprite(name string) (*ebiten.Image, bool) {
+	img, ok := a.sprites[name]
+	return img, ok
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+const (
+	// ownedFollowDistance is how close an entity a local player owns keeps
+	// to them.
+	ownedFollowDistance = 48.0
+	// entityMoveInterval is how often, in seconds, the moves of an owned
+	// entity go to the server.
+	entityMoveInterval = 0.1
+)
+
+// owner is the local player with authority over the entity, or nil when
+// the server or another client drives it.
+func (g *Game) owner(e *WorldEntity) *LocalPlayer {
+	if e.Owner == protocol.OwnerServer {
+		return nil
+	}
+	return g.localByID(e.Owner)
+}
+
+// driveOwnedEntities simulates the entities the local players own instead
+// of waiting on the server for them: vehicles go where their driver steers
+// and anything else follows its owner, and their moves are sent on for the server to check and pass to everyone else. Entities
+// anyone else owns only ever move as the server reports.
+func (g *Game) driveOwnedEntities(deltaTime float64) {
+	g.entities.Each(func(id string, e *WorldEntity) {
+		local := g.owner(e)
+		if local == nil {
+			return
+		}
+		position := Vector2f{e.X, e.Y}
+		offset := Vector2f{local.position.X - e.X, local.position.Y - e.Y}
+		if e.Kind == protocol.EntityVehicle {
+			position, _ = PredictMove(g, position, e.steer, protocol.VehicleSpeed, deltaTime)
+		} else if distance := math.Hypot(offset.X, offset.Y); distance > ownedFollowDistance {
+			intent := Vector2f{offset.X / distance, offset.Y / distance}
+			position, _ = PredictMove(g, position, intent, g.moveSpeed(local), deltaTime)
+		}
+		e.sinceMove += deltaTime
+		if position != (Vector2f{e.X, e.Y}) {
+			e.X, e.Y = position.X, position.Y
+			if e.character != nil {
+				e.character.position = position
+			}
+			g.entities.Move(id, e.X, e.Y)
+			e.moved = true
+		}
+		if !e.moved || e.sinceMove < entityMoveInterval {
+			return
+		}
+		e.sinceMove, e.moved = 0, false
+		if _, err := fmt.Fprint(local.conn, protocol.Line(protocol.KindEntityMove, protocol.EncodeEntityMove(id, e.X, e.Y))); err != nil {
+			log.Println("Error sending entity move:", err)
+		}
+	})
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+const (
+	minZoom  = 0.25
+	maxZoom  = 4.0
+	zoomStep = 1.1
+)
+
+// FreeCamera detaches the view from the local player for inspecting maps.
+// It is only reachable in builds made with -tags dev, except while playing
+// a demo, when it is always on.
+type FreeCamera struct {
+	Active    bool
+	playback  bool
+	following bool
+	center    Vector2f
+	zoom      float64
+	dragging  bool
+	lastMouse Vector2f
+	target    *ebiten.Image
+}
+
+func NewFreeCamera() *FreeCamera {
+	return &FreeCamera{zoom: 1}
+}
+
+// StartPlayback turns the camera on for good to watch a demo, following the
+// recorded player until it is dragged away; Home goes back to following.
+func (f *FreeCamera) StartPlayback() {
+	f.Active = true
+	f.playback = true
+	f.following = true
+}
+
+func (f *FreeCamera) Update(follow Vector2f) {
+	if !devBuild && !f.playback {
+		return
+	}
+	if !f.playback && inpututil.IsKeyJustPressed(ebiten.KeyF8) {
+		f.Active = !f.Active
+		f.snapTo(follow)
+	}
+	if !f.Active {
+		return
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyHome) {
+		f.snapTo(follow)
+		f.following = f.playback
+	}
+	f.control()
+	if f.dragging {
+		f.following = false
+	}
+	if f.following {
+		f.center = follow
+	}
+}
+
+// control pans the camera while the middle mouse button drags and zooms it
+// with the wheel.
+func (f *FreeCamera) control() {
+	mx, my := ebiten.CursorPosition()
+	mouse := Vector2f{float64(mx), float64(my)}
+	if ebiten.IsMouseButtonPressed(ebiten.MouseButtonMiddle) {
+		if f.dragging {
+			f.center.X -= (mouse.X - f.lastMouse.X) / f.zoom
+			f.center.Y -= (mouse.Y - f.lastMouse.Y) / f.zoom
+		}
+		f.dragging = true
+	} else {
+		f.dragging = false
+	}
+	f.lastMouse = mouse
+
+	if _, wheel := ebiten.Wheel(); wheel != 0 {
+		f.zoom = math.Max(minZoom, math.Min(maxZoom, f.zoom*math.Pow(zoomStep, wheel)))
+	}
+}
+
+func (f *FreeCamera) snapTo(position Vector2f) {
+	f.center = position
+	f.zoom = 1
+}
+
+// worldAt converts a point on a screen of the given size to world
+// coordinates.
+func (f *FreeCamera) worldAt(p Vector2f, width, height int) Vector2f {
+	return Vector2f{
+		X: f.center.X + (p.X-float64(width)/2)/f.zoom,
+		Y: f.center.Y + (p.Y-float64(height)/2)/f.zoom,
+	}
+}
+
+// Draw renders the world through the free camera. The world is drawn at
+// native scale into an offscreen image covering the zoomed area, then scaled
+// onto the screen, so world drawing code never needs to know about zoom.
+func (f *FreeCamera) Draw(screen *ebiten.Image, drawWorld func(target *ebiten.Image, center Vector2f, width, height int)) {
+	width, height := screen.Bounds().Dx(), screen.Bounds().Dy()
+	worldWidth := int(math.Ceil(float64(width) / f.zoom))
+	worldHeight := int(math.Ceil(float64(height) / f.zoom))
+
+	if f.target == nil || f.target.Bounds().Dx() != worldWidth || f.target.Bounds().Dy() != worldHeight {
+		if f.target != nil {
+			f.target.Deallocate()
+		}
+		f.target = ebiten.NewImage(worldWidth, worldHeight)
+	}
+	f.target.Clear()
+	drawWorld(f.target, f.center, worldWidth, worldHeight)
+
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Scale(f.zoom, f.zoom)
+	op.Filter = ebiten.FilterLinear
+	screen.DrawImage(f.target, op)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+const (
+	captureDir = "captures"
+	// clipLength is how much of the recent past Shift+F12 saves as a GIF,
+	// sampled clipFPS times a second at clipScale of the window's size.
+	clipLength = 10 * time.Second
+	clipFPS    = 10
+	clipScale  = 0.5
+)
+
+// Capture saves what is on screen to the captures directory: a PNG
+// screenshot on F12, and on Shift+F12 a GIF of the last clipLength, kept in
+// a ring buffer of scaled-down frames for the purpose.
+type Capture struct {
+	events     *EventBus
+	screenshot bool
+	clip       bool
+	// frames holds the clip's RGBA pixels, the oldest at next once full.
+	frames    [][]byte
+	next      int
+	full      bool
+	lastFrame time.Time
+	scaled    *ebiten.Image
+}
+
+func NewCapture(events *EventBus) *Capture {
+	return &Capture{events: events, frames: make([][]byte, int(clipLength.Seconds()*clipFPS))}
+}
+
+func (c *Capture) Update() {
+	if !inpututil.IsKeyJustPressed(ebiten.KeyF12) {
+		return
+	}
+	if ebiten.IsKeyPressed(ebiten.KeyShift) {
+		c.clip = true
+	} else {
+		c.screenshot = true
+	}
+}
+
+// Draw runs once the frame is finished, to sample it for the clip and save
+// whatever was asked for. Encoding happens in the background.
+func (c *Capture) Draw(screen *ebiten.Image) {
+	if time.Since(c.lastFrame) >= time.Second/clipFPS {
+		c.lastFrame = time.Now()
+		c.sample(screen)
+	}
+	if c.screenshot {
+		c.screenshot = false
+		bounds := screen.Bounds()
+		img := image.NewRGBA(bounds)
+		screen.ReadPixels(img.Pix)
+		go c.save("screenshot", ".png", func(f *os.File) error { return png.Encode(f, img) })
+	}
+	if c.clip {
+		c.clip = false
+		frames, bounds := c.clipFrames(), c.scaled.Bounds()
+		go c.save("clip", ".gif", func(f *os.File) error { return gif.EncodeAll(f, encodeClip(frames, bounds)) })
+	}
+}
+
+// sample draws the screen into the scaled offscreen image and copies its
+// pixels into the ring buffer.
+func (c *Capture) sample(screen *ebiten.Image) {
+	width := int(float64(screen.Bounds().Dx()) * clipScale)
+	height := int(float64(screen.Bounds().Dy()) * clipScale)
+	if c.scaled == nil || c.scaled.Bounds().Dx() != width || c.scaled.Bounds().Dy() != height {
+		if c.scaled != nil {
+			c.scaled.Deallocate()
+		}
+		c.scaled = ebiten.NewImage(width, height)
+		c.next, c.full = 0, false
+	}
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Scale(clipScale, clipScale)
+	op.Filter = ebiten.FilterLinear
+	c.scaled.Clear()
+	c.scaled.DrawImage(screen, op)
+
+	if len(c.frames[c.next]) != width*height*4 {
+		c.frames[c.next] = make([]byte, width*height*4)
+	}
+	c.scaled.ReadPixels(c.frames[c.next])
+	c.next = (c.next + 1) % len(c.frames)
+	c.full = c.full || c.next == 0
+}
+
+// clipFrames copies the buffered frames, oldest first, so sampling can go
+// on while they are encoded.
+func (c *Capture) clipFrames() [][]byte {
+	var frames [][]byte
+	if c.full {
+		frames = append(frames, c.frames[c.next:]...)
+	}
+	frames = append(frames, c.frames[:c.next]...)
+	copies := make([][]byte, len(frames))
+	for i, frame := range frames {
+		copies[i] = append([]byte(nil), frame...)
+	}
+	return copies
+}
+
+// encodeClip reduces the frames to the web-safe palette for the GIF.
+func encodeClip(frames [][]byte, bounds image.Rectangle) *gif.GIF {
+	clip := &gif.GIF{}
+	for _, pix := range frames {
+		src := &image.RGBA{Pix: pix, Stride: bounds.Dx() * 4, Rect: bounds}
+		frame := image.NewPaletted(bounds, palette.WebSafe)
+		draw.FloydSteinberg.Draw(frame, bounds, src, bounds.Min)
+		clip.Image = append(clip.Image, frame)
+		clip.Delay = append(clip.Delay, 100/clipFPS)
+	}
+	return clip
+}
+
+// save writes a capture to a timestamped file in captureDir and reports
+// where it went in chat.
+func (c *Capture) save(prefix, ext string, encode func(f *os.File) error) {
+	path := filepath.Join(captureDir, fmt.Sprintf("%s-%s%s", prefix, time.Now().Format("20060102-150405.000"), ext))
+	err := os.MkdirAll(captureDir, 0o755)
+	if err == nil {
+		err = writeCapture(path, encode)
+	}
+	text := T("capture.saved", path)
+	if err != nil {
+		log.Println("Error saving capture:", err)
+		text = T("capture.failed", err)
+	}
+	c.events.Publish(EventChatReceived, ChatReceived{Channel: chatChannelSystem, From: "client", Text: text})
+}
+
+func writeCapture(path string, encode func(f *os.File) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := encode(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"darkzone/MultiTestServer/protocol"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+// animDurations lists the one-shot animation states and how long they play
+// before the character falls back to idle. States not listed loop until
+// something else changes them.
+var animDurations = map[protocol.AnimState]float64{
+	protocol.AnimAttack: 0.35,
+	protocol.AnimHurt:   0.3,
+}
+
+type Character struct {
+	bodyTexture        *ebiten.Image
+	headTexture        *ebiten.Image
+	position           Vector2f
+	moveSpeed          float64
+	animationSpeed     float64
+	frameIndex         int
+	direction          int
+	timeSinceLastFrame float64
+	anim               protocol.AnimState
+	animTime           float64
+	// idle is set from snapshots when the server reports the player away.
+	idle bool
+	// mount is what the character rides, from snapshots, empty on foot.
+	mount string
+	// terrain is what the character stands on, for swimming in water.
+	terrain protocol.Terrain
+	// level is the elevation level the character is at, 0 on the ground.
+	level int
+	// stepFrom is where the character's feet were at their last footstep,
+	// and leftFoot which foot that was.
+	stepFrom Vector2f
+	leftFoot bool
+	// outline is drawn around the sprite when its alpha is not zero.
+	outline color.RGBA
+}
+
+func NewCharacter(bodyTexture, headTexture *ebiten.Image, startPos Vector2f) *Character {
+	return &Character{
+		bodyTexture:    bodyTexture,
+		headTexture:    headTexture,
+		position:       startPos,
+		moveSpeed:      protocol.WalkSpeed,
+		animationSpeed: 0.1,
+		frameIndex:     0,
+		direction:      0,
+		anim:           protocol.AnimIdle,
+	}
+}
+
+func (c *Character) SetAnim(state protocol.AnimState) {
+	if state == c.anim {
+		return
+	}
+	c.anim = state
+	c.animTime = 0
+	c.frameIndex = 0
+	c.timeSinceLastFrame = 0
+}
+
+// Busy reports whether a one-shot animation is still playing and should not
+// be interrupted by movement.
+func (c *Character) Busy() bool {
+	duration, oneShot := animDurations[c.anim]
+	return c.anim == protocol.AnimDead || oneShot && c.animTime < duration
+}
+
+func (c *Character) isMoving() bool {
+	return c.anim == protocol.AnimWalk
+}
+
+func (c *Character) Update(deltaTime float64) {
+	c.animTime += deltaTime
+	if duration, oneShot := animDurations[c.anim]; oneShot && c.animTime >= duration {
+		c.SetAnim(protocol.AnimIdle)
+	}
+	c.updateAnimation(deltaTime)
+}
+
+func (c *Character) updateAnimation(deltaTime float64) {
+	c.timeSinceLastFrame += deltaTime
+
+	speed := c.animationSpeed
+	if c.anim == protocol.AnimAttack {
+		speed /= 2
+	}
+
+	switch c.anim {
+	case protocol.AnimWalk, protocol.AnimAttack:
+		if c.timeSinceLastFrame >= speed {
+			c.frameIndex = (c.frameIndex + 1) % 5
+			c.timeSinceLastFrame = 0
+		}
+	default:
+		c.frameIndex = 0
+	}
+}
+
+func (c *Character) Draw(screen *ebiten.Image, cameraOffset Vector2f) {
+	bodyOp := &ebiten.DrawImageOptions{}
+	headOp := &ebiten.DrawImageOptions{}
+
+	bodyRow := 0
+	if c.anim == protocol.AnimWalk || c.anim == protocol.AnimAttack {
+		bodyRow = c.frameIndex + 1
+	}
+
+	bodyRect := image.Rect(frameWidth*c.direction, frameHeight*bodyRow, frameWidth*(c.direction+1), frameHeight*(bodyRow+1))
+	headRect := image.Rect(0, frameHeight*c.direction, frameWidth, frameHeight*(c.direction+1))
+
+	if c.anim == protocol.AnimDead {
+		// Lay the body on its side, pivoting around the feet.
+		bodyOp.GeoM.Translate(-frameWidth/2, -frameHeight)
+		bodyOp.GeoM.Rotate(math.Pi / 2)
+		bodyOp.GeoM.Translate(frameWidth/2, frameHeight)
+		headOp.GeoM.Translate(-frameWidth/2, -frameHeight-16)
+		headOp.GeoM.Rotate(math.Pi / 2)
+		headOp.GeoM.Translate(frameWidth/2, frameHeight+16)
+		bodyOp.ColorScale.Scale(0.5, 0.5, 0.5, 1)
+		headOp.ColorScale.Scale(0.5, 0.5, 0.5, 1)
+	}
+	if c.anim == protocol.AnimHurt {
+		bodyOp.ColorScale.Scale(1, 0.4, 0.4, 1)
+		headOp.ColorScale.Scale(1, 0.4, 0.4, 1)
+	}
+	if c.idle {
+		bodyOp.ColorScale.Scale(0.5, 0.5, 0.5, 0.7)
+		headOp.ColorScale.Scale(0.5, 0.5, 0.5, 0.7)
+	}
+
+	rise := 0.0
+	if c.mount != "" && c.anim != protocol.AnimDead {
+		c.drawMount(screen, cameraOffset)
+		rise = mountRise
+	}
+	swimming := c.swimming()
+	if swimming {
+		// Only the top half shows above the water, bobbing.
+		bodyRect.Max.Y = bodyRect.Min.Y + frameHeight/2
+		rise = -swimDepth - math.Sin(c.animTime*swimBobRate)*swimBob
+	}
+	bodyOp.GeoM.Translate(c.position.X-cameraOffset.X, c.position.Y-rise-cameraOffset.Y)
+	headOp.GeoM.Translate(c.position.X-cameraOffset.X, c.position.Y-16-rise-cameraOffset.Y)
+
+	body := c.bodyTexture.SubImage(bodyRect).(*ebiten.Image)
+	head := c.headTexture.SubImage(headRect).(*ebiten.Image)
+	if c.outline.A > 0 {
+		drawOutline(screen, body, bodyOp, c.outline)
+		drawOutline(screen, head, headOp, c.outline)
+	}
+	screen.DrawImage(body, bodyOp)
+	screen.DrawImage(head, headOp)
+	if swimming {
+		c.drawWaterline(screen, cameraOffset, rise)
+	}
+
+	if c.anim == protocol.AnimAttack {
+		c.drawSwing(screen, cameraOffset)
+	}
+	if c.idle {
+		drawText(screen, T("player.idle"), int(c.position.X-cameraOffset.X), int(c.position.Y-cameraOffset.Y)-32, tagText)
+	}
+}
+
+const (
+	// Swimmers sink swimDepth into the water and bob swimBob up and down,
+	// swimBobRate radians a second.
+	swimDepth   = 12.0
+	swimBob     = 1.5
+	swimBobRate = 4.0
+)
+
+var waterlineColor = color.RGBA{170, 210, 255, 180}
+
+// swimming reports whether the character is drawn swimming: in water,
+// neither riding nor dead.
+func (c *Character) swimming() bool {
+	return c.terrain == protocol.TerrainWater && c.mount == "" && c.anim != protocol.AnimDead
+}
+
+// drawWaterline draws the ripple where a swimmer's body meets the water.
+func (c *Character) drawWaterline(screen *ebiten.Image, cameraOffset Vector2f, rise float64) {
+	x := float32(c.position.X - cameraOffset.X)
+	y := float32(c.position.Y-rise-cameraOffset.Y) + frameHeight/2
+	vector.DrawFilledRect(screen, x-4, y-1, frameWidth+8, 3, waterlineColor, false)
+}
+
+// facingVectors maps sprite directions (up, left, down, right) to unit vectors.
+var facingVectors = [4]Vector2f{{0, -1}, {-1, 0}, {0, 1}, {1, 0}}
+
+func (c *Character) drawSwing(screen *ebiten.Image, cameraOffset Vector2f) {
+	progress := c.animTime / animDurations[protocol.AnimAttack]
+	facing := facingVectors[c.direction%len(facingVectors)]
+	center := Vector2f{
+		X: c.position.X + frameWidth/2 + facing.X*20 - cameraOffset.X,
+		Y: c.position.Y + frameHeight/2 + facing.Y*20 - cameraOffset.Y,
+	}
+	base := math.Atan2(facing.Y, facing.X)
+	angle := base - math.Pi/3 + progress*2*math.Pi/3
+	x1 := center.X + math.Cos(angle)*14
+	y1 := center.Y + math.Sin(angle)*14
+	vector.StrokeLine(screen, float32(center.X), float32(center.Y), float32(x1), float32(y1), 3, color.RGBA{255, 255, 255, 220}, true)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"darkzone/MultiTestServer/protocol"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+type selectMode int
+
+const (
+	selectBrowse selectMode = iota
+	selectCreate
+	selectConfirmDelete
+)
+
+const characterNameLength = 16
+
+// CharacterSelect is the scene shown after an account login and before the
+// player enters the world. It lists the account's characters and lets the
+// player pick, create or delete one; the server owns the list and sends a
+// fresh copy after every change.
+type CharacterSelect struct {
+	conn       io.Writer
+	account    string
+	characters []protocol.CharacterSummary
+	loaded     bool
+	cursor     int
+	mode       selectMode
+	input      []rune
+	appearance int
+	status     string
+}
+
+func NewCharacterSelect(conn io.Writer, account string) *CharacterSelect {
+	return &CharacterSelect{conn: conn, account: account}
+}
+
+func (c *CharacterSelect) SetCharacters(chars []protocol.CharacterSummary) {
+	c.characters = chars
+	c.loaded = true
+	c.cursor = min(c.cursor, max(len(chars)-1, 0))
+	c.mode = selectBrowse
+	c.status = ""
+}
+
+func (c *CharacterSelect) SetStatus(text string) {
+	c.status = text
+}
+
+func (c *CharacterSelect) send(kind, payload string) error {
+	_, err := io.WriteString(c.conn, protocol.Line(kind, payload))
+	return err
+}
+
+func (c *CharacterSelect) Update() error {
+	switch c.mode {
+	case selectCreate:
+		return c.updateCreate()
+	case selectConfirmDelete:
+		if inpututil.IsKeyJustPressed(ebiten.KeyY) || menuPad.Pressed(MenuAccept) {
+			c.mode = selectBrowse
+			return c.send(protocol.KindCharacterDelete, c.characters[c.cursor].Name)
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyN) || inpututil.IsKeyJustPressed(ebiten.KeyEscape) || menuPad.Pressed(MenuBack) {
+			c.mode = selectBrowse
+		}
+		return nil
+	}
+
+	switch {
+	case (inpututil.IsKeyJustPressed(ebiten.KeyUp) || menuPad.Pressed(MenuUp)) && c.cursor > 0:
+		c.cursor--
+	case (inpututil.IsKeyJustPressed(ebiten.KeyDown) || menuPad.Pressed(MenuDown)) && c.cursor < len(c.characters)-1:
+		c.cursor++
+	case inpututil.IsKeyJustPressed(ebiten.KeyN), menuPad.Pressed(MenuAlt):
+		c.mode = selectCreate
+		c.input = c.input[:0]
+		c.status = ""
+	case len(c.characters) == 0:
+	case inpututil.IsKeyJustPressed(ebiten.KeyDelete), menuPad.Pressed(MenuExtra):
+		c.mode = selectConfirmDelete
+	case inpututil.IsKeyJustPressed(ebiten.KeyEnter), menuPad.Pressed(MenuAccept):
+		c.status = T("charselect.entering")
+		return c.send(protocol.KindCharacterSelect, c.characters[c.cursor].Name)
+	}
+	return nil
+}
+
+func (c *CharacterSelect) updateCreate() error {
+	c.input = ebiten.AppendInputChars(c.input)
+	if len(c.input) > characterNameLength {
+		c.input = c.input[:characterNameLength]
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyBackspace) && len(c.input) > 0 {
+		c.input = c.input[:len(c.input)-1]
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyLeft) || menuPad.Pressed(MenuLeft) {
+		c.appearance = (c.appearance + len(protocol.Appearances) - 1) % len(protocol.Appearances)
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyRight) || menuPad.Pressed(MenuRight) {
+		c.appearance = (c.appearance + 1) % len(protocol.Appearances)
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) || menuPad.Pressed(MenuBack) {
+		c.mode = selectBrowse
+		return nil
+	}
+	if !inpututil.IsKeyJustPressed(ebiten.KeyEnter) && !menuPad.Pressed(MenuAccept) {
+		return nil
+	}
+
+	name := strings.TrimSpace(string(c.input))
+	if name == "" {
+		return nil
+	}
+	c.status = T("charselect.creating", name)
+	return c.send(protocol.KindCharacterCreate, name+","+protocol.Appearances[c.appearance])
+}
+
+func (c *CharacterSelect) Draw(screen *ebiten.Image) {
+	var b strings.Builder
+	b.WriteString(T("charselect.title", c.account) + "\n\n")
+
+	switch {
+	case !c.loaded:
+		b.WriteString(T("charselect.loading") + "\n")
+	case len(c.characters) == 0:
+		b.WriteString(T("charselect.empty") + "\n")
+	}
+	for i, char := range c.characters {
+		marker := "  "
+		if i == c.cursor {
+			marker = "> "
+		}
+		fmt.Fprintf(&b, "%s%-16s %-8s %-12s %s\n", marker, char.Name, char.Appearance, char.Room, T("charselect.rating", char.Rating))
+	}
+	b.WriteString("\n")
+
+	switch c.mode {
+	case selectBrowse:
+		b.WriteString(menuPad.Hint("charselect.browse.help") + "\n")
+	case selectCreate:
+		b.WriteString(menuPad.Hint("charselect.create", string(c.input), protocol.Appearances[c.appearance]) + "\n")
+	case selectConfirmDelete:
+		b.WriteString(menuPad.Hint("charselect.delete", c.characters[c.cursor].Name) + "\n")
+	}
+	if c.status != "" {
+		b.WriteString("\n" + c.status + "\n")
+	}
+	drawText(screen, b.String(), screenWidth/2-160, screenHeight/2-120, tableText)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"io"
+	"strings"
+	"time"
+
+	"darkzone/MultiTestServer/protocol"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+const (
+	// chatHistory is how many wrapped rows of chat are kept to scroll back
+	// through, and chatRows how many are shown at once.
+	chatHistory   = 200
+	chatRows      = 8
+	chatMaxLength = 200
+	chatLineGap   = 16
+	// chatWidth is how wide the chat is; messages wrap to fit it.
+	chatWidth = 420
+)
+
+const chatChannelSystem = "system"
+
+var chatChannelTags = map[string]string{
+	protocol.ChannelLocal:  "L",
+	protocol.ChannelZone:   "Z",
+	protocol.ChannelGlobal: "G",
+	chatChannelSystem:      "!",
+}
+
+var chatChannelColors = map[string]color.RGBA{
+	protocol.ChannelLocal:  {255, 255, 255, 255},
+	protocol.ChannelZone:   {150, 220, 255, 255},
+	protocol.ChannelGlobal: {255, 210, 120, 255},
+	chatChannelSystem:      {255, 130, 130, 255},
+}
+
+// chatRow is one row of the chat as drawn, a whole message or part of a
+// long one wrapped to the chat's width.
+type chatRow struct {
+	text  string
+	color color.RGBA
+}
+
+// ChatBox shows the chat, each message stamped with the time it arrived
+// and colored by its channel, and lets the player scroll back through the
+// history with Page Up and Page Down.
+type ChatBox struct {
+	events *EventBus
+	rows   []chatRow
+	// scroll is how many rows up from the newest the view is.
+	scroll int
+	typing bool
+	input  []rune
+}
+
+func NewChatBox(events *EventBus) *ChatBox {
+	c := &ChatBox{events: events}
+	events.Subscribe(EventChatReceived, func(e Event) {
+		msg := e.Payload.(ChatReceived)
+		line := fmt.Sprintf("%s [%s] %s: %s", time.Now().Format("15:04"), chatChannelTags[msg.Channel], msg.From, msg.Text)
+		c.addLine(line, msg.Channel)
+	})
+	return c
+}
+
+func (c *ChatBox) addLine(line, channel string) {
+	tint, ok := chatChannelColors[channel]
+	if !ok {
+		tint = hudText.Color
+	}
+	rows := strings.Split(wrapText(line, chatWidth-16, hudText), "\n")
+	for _, row := range rows {
+		c.rows = append(c.rows, chatRow{text: row, color: tint})
+	}
+	if len(c.rows) > chatHistory {
+		c.rows = c.rows[len(c.rows)-chatHistory:]
+	}
+	// Keep a scrolled-back view where it is as new rows come in.
+	if c.scroll > 0 {
+		c.scroll = min(c.scroll+len(rows), c.maxScroll())
+	}
+}
+
+func (c *ChatBox) maxScroll() int {
+	return max(0, len(c.rows)-chatRows)
+}
+
+func (c *ChatBox) Typing() bool {
+	return c.typing
+}
+
+func (c *ChatBox) Update(w io.Writer) error {
+	if inpututil.IsKeyJustPressed(ebiten.KeyPageUp) {
+		c.scroll = min(c.scroll+chatRows-1, c.maxScroll())
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyPageDown) {
+		c.scroll = max(c.scroll-(chatRows-1), 0)
+	}
+	if !c.typing {
+		if inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
+			c.typing = true
+		}
+		return nil
+	}
+
+	c.input = ebiten.AppendInputChars(c.input)
+	if len(c.input) > chatMaxLength {
+		c.input = c.input[:chatMaxLength]
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyBackspace) && len(c.input) > 0 {
+		c.input = c.input[:len(c.input)-1]
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		c.typing = false
+		c.input = c.input[:0]
+		return nil
+	}
+	if !inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
+		return nil
+	}
+
+	text := strings.TrimSpace(string(c.input))
+	c.typing = false
+	c.input = c.input[:0]
+	if text == "" {
+		return nil
+	}
+	if line, ok := partyCommand(text); ok {
+		_, err := io.WriteString(w, line)
+		return err
+	}
+	if line, ok := matchCommand(text); ok {
+		_, err := io.WriteString(w, line)
+		return err
+	}
+	c.events.Publish(EventChatSent, ChatSent{Text: text})
+	_, err := io.WriteString(w, protocol.Line(protocol.KindChat, text))
+	return err
+}
+
+func (c *ChatBox) Draw(screen *ebiten.Image) {
+	end := len(c.rows) - c.scroll
+	rows := c.rows[max(0, end-chatRows):end]
+	shown := len(rows)
+	if c.scroll > 0 {
+		shown++
+	}
+	y := hudHeight - chatLineGap*(shown+2)
+	if c.typing || c.scroll > 0 {
+		drawPanel(screen, 2, float64(y-4), chatWidth, float64(chatLineGap*(shown+1)+8))
+	}
+	for _, row := range rows {
+		style := hudText
+		style.Color = row.color
+		drawText(screen, row.text, 8, y, style)
+		y += chatLineGap
+	}
+	if c.scroll > 0 {
+		drawText(screen, T("chat.newer", c.scroll), 8, y, hudText)
+		y += chatLineGap
+	}
+	if c.typing {
+		drawText(screen, "> "+string(c.input)+"_", 8, y, hudText)
+	}
+}
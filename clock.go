@@ -0,0 +1,102 @@
+package main
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+const (
+	clockSamples       = 8
+	clockBurstInterval = 0.2
+	clockInterval      = 5.0
+)
+
+type clockSample struct {
+	offset float64
+	rtt    float64
+}
+
+// ClockSync estimates the offset between the local clock and the server's
+// NTP-style: offset = serverTime + rtt/2 - receiveTime. The sample with the
+// lowest round trip of the recent window wins, since it was least distorted
+// by queueing delay.
+type ClockSync struct {
+	mu        sync.Mutex
+	samples   []clockSample
+	offset    float64
+	rtt       float64
+	sinceSend float64
+}
+
+func NewClockSync() *ClockSync {
+	return &ClockSync{sinceSend: clockInterval}
+}
+
+func nowMillis() float64 {
+	return float64(time.Now().UnixNano()) / float64(time.Millisecond)
+}
+
+// Update sends a clock request when one is due: in a quick burst until the
+// window is filled, then periodically to follow drift.
+func (c *ClockSync) Update(deltaTime float64, w io.Writer) error {
+	c.mu.Lock()
+	c.sinceSend += deltaTime
+	interval := clockInterval
+	if len(c.samples) < clockSamples {
+		interval = clockBurstInterval
+	}
+	due := c.sinceSend >= interval
+	if due {
+		c.sinceSend = 0
+	}
+	c.mu.Unlock()
+
+	if !due {
+		return nil
+	}
+	_, err := io.WriteString(w, protocol.Line(protocol.KindClock, protocol.EncodeClock(time.Now().UnixMilli(), 0)))
+	return err
+}
+
+func (c *ClockSync) HandleReply(clientTime, serverTime int64) {
+	now := nowMillis()
+	rtt := now - float64(clientTime)
+	sample := clockSample{
+		offset: float64(serverTime) + rtt/2 - now,
+		rtt:    rtt,
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.samples = append(c.samples, sample)
+	if len(c.samples) > clockSamples {
+		c.samples = c.samples[1:]
+	}
+	best := c.samples[0]
+	for _, s := range c.samples[1:] {
+		if s.rtt < best.rtt {
+			best = s
+		}
+	}
+	c.offset = best.offset
+	c.rtt = best.rtt
+}
+
+// ServerNow is the current server time in Unix milliseconds.
+func (c *ClockSync) ServerNow() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return nowMillis() + c.offset
+}
+
+func (c *ClockSync) RTT() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.rtt
+}
@@ -0,0 +1,161 @@
+// Command atlaspack packs individual sprite PNGs into atlas pages with a
+// JSON index the client loads its sprites from, so new sprites only need
+// dropping into the sprites directory instead of placing on a sheet by
+// hand. Run it from the client directory before building:
+//
+//	go run ./cmd/atlaspack
+//
+// Each sprite is named by its path under the input directory without the
+// extension, such as "item/torch" for sprites/item/torch.png.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Index is the atlas.json the client reads: the page images, relative to
+// the index, and where on which page each sprite is.
+type Index struct {
+	Pages   []string          `json:"pages"`
+	Sprites map[string]Sprite `json:"sprites"`
+}
+
+type Sprite struct {
+	Page int `json:"page"`
+	X    int `json:"x"`
+	Y    int `json:"y"`
+	W    int `json:"w"`
+	H    int `json:"h"`
+}
+
+type source struct {
+	name string
+	img  image.Image
+}
+
+func main() {
+	in := flag.String("in", "assets/sprites", "directory of sprite PNGs, searched recursively")
+	out := flag.String("out", "assets/atlas.json", "index to write; the pages are written next to it")
+	size := flag.Int("size", 1024, "width and height of each atlas page")
+	padding := flag.Int("padding", 1, "transparent pixels between sprites, so filtering does not bleed")
+	flag.Parse()
+
+	sources, err := readSprites(*in)
+	if err != nil {
+		log.Fatal("Error reading sprites: ", err)
+	}
+	if len(sources) == 0 {
+		log.Fatalf("No sprites in %s", *in)
+	}
+	pages, index, err := pack(sources, *size, *padding)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := write(*out, pages, index); err != nil {
+		log.Fatal("Error writing atlas: ", err)
+	}
+	log.Printf("Packed %d sprites into %d pages", len(sources), len(pages))
+}
+
+func readSprites(dir string) ([]source, error) {
+	var sources []source
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.EqualFold(filepath.Ext(path), ".png") {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		img, err := png.Decode(f)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(strings.TrimSuffix(rel, filepath.Ext(rel)))
+		sources = append(sources, source{name: name, img: img})
+		return nil
+	})
+	return sources, err
+}
+
+// pack places the sprites tallest first on shelves running across each
+// page, starting a new page when one fills up.
+func pack(sources []source, size, padding int) ([]*image.NRGBA, Index, error) {
+	sort.Slice(sources, func(i, j int) bool {
+		hi, hj := sources[i].img.Bounds().Dy(), sources[j].img.Bounds().Dy()
+		if hi != hj {
+			return hi > hj
+		}
+		return sources[i].name < sources[j].name
+	})
+
+	index := Index{Sprites: make(map[string]Sprite, len(sources))}
+	var pages []*image.NRGBA
+	x, y, shelf := 0, 0, 0
+	for _, s := range sources {
+		bounds := s.img.Bounds()
+		w, h := bounds.Dx(), bounds.Dy()
+		if w > size || h > size {
+			return nil, index, fmt.Errorf("sprite %s is %dx%d, larger than the %dx%d page", s.name, w, h, size, size)
+		}
+		if x+w > size {
+			x, y, shelf = 0, y+shelf+padding, 0
+		}
+		if len(pages) == 0 || y+h > size {
+			pages = append(pages, image.NewNRGBA(image.Rect(0, 0, size, size)))
+			x, y, shelf = 0, 0, 0
+		}
+		page := len(pages) - 1
+		draw.Draw(pages[page], image.Rect(x, y, x+w, y+h), s.img, bounds.Min, draw.Src)
+		index.Sprites[s.name] = Sprite{Page: page, X: x, Y: y, W: w, H: h}
+		x += w + padding
+		shelf = max(shelf, h)
+	}
+	// The last page only needs to be as tall as what is on it.
+	last := len(pages) - 1
+	pages[last] = pages[last].SubImage(image.Rect(0, 0, size, y+shelf)).(*image.NRGBA)
+	return pages, index, nil
+}
+
+func write(path string, pages []*image.NRGBA, index Index) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	for i, page := range pages {
+		name := fmt.Sprintf("%s-%d.png", base, i)
+		f, err := os.Create(filepath.Join(filepath.Dir(path), name))
+		if err != nil {
+			return err
+		}
+		err = png.Encode(f, page)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+		index.Pages = append(index.Pages, name)
+	}
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// The high-contrast overlay tells terrain apart by shape as well as color:
+// solid tiles get a bordered diagonal hatch, walkable tiles a sparse dot grid.
+var (
+	solidPattern    = newHatchPattern(tileSize, 24, 6, color.RGBA{255, 220, 0, 200}, color.RGBA{0, 0, 0, 200})
+	walkablePattern = newDotPattern(tileSize, 32, 3, color.RGBA{255, 255, 255, 150})
+)
+
+func newHatchPattern(size, spacing, thickness int, stripe, border color.RGBA) *ebiten.Image {
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			switch {
+			case x < thickness || y < thickness || x >= size-thickness || y >= size-thickness:
+				img.SetRGBA(x, y, border)
+			case (x+y)%spacing < thickness:
+				img.SetRGBA(x, y, stripe)
+			case (x+y)%spacing < thickness*2:
+				img.SetRGBA(x, y, border)
+			}
+		}
+	}
+	return ebiten.NewImageFromImage(img)
+}
+
+func newDotPattern(size, spacing, radius int, dot color.RGBA) *ebiten.Image {
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for cy := spacing / 2; cy < size; cy += spacing {
+		for cx := spacing / 2; cx < size; cx += spacing {
+			for y := -radius; y <= radius; y++ {
+				for x := -radius; x <= radius; x++ {
+					if x*x+y*y <= radius*radius {
+						img.SetRGBA(cx+x, cy+y, dot)
+					}
+				}
+			}
+		}
+	}
+	return ebiten.NewImageFromImage(img)
+}
+
+func (g *Game) drawContrastOverlay(screen *ebiten.Image, cameraOffset Vector2f) {
+	for i := 0; i < g.tileMap.Cells(); i++ {
+		op := &ebiten.DrawImageOptions{}
+		x := (i % g.tileMap.Width) * tileSize
+		y := (i / g.tileMap.Width) * tileSize
+		op.GeoM.Translate(float64(x)-cameraOffset.X, float64(y)-cameraOffset.Y)
+
+		if g.tileMap.Solid(i) {
+			screen.DrawImage(solidPattern, op)
+		} else {
+			screen.DrawImage(walkablePattern, op)
+		}
+	}
+}
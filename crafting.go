@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"darkzone/MultiTestServer/protocol"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+const (
+	craftingWidth     = 380
+	craftingRowGap    = 16
+	progressBarWidth  = 200
+	progressBarHeight = 8
+)
+
+// CraftingWindow lists the server's recipes with the ingredients the player
+// has, toggled with C. Up and Down pick a recipe and Space crafts it. While
+// something is being crafted a progress bar shows above the chat, whether
+// the window is open or not.
+type CraftingWindow struct {
+	open      bool
+	selected  int
+	recipes   []protocol.Recipe
+	inventory map[string]int
+	// crafting is the recipe in progress, elapsed of its seconds along.
+	crafting *protocol.Recipe
+	elapsed  float64
+	seconds  float64
+}
+
+func NewCraftingWindow(events *EventBus) *CraftingWindow {
+	w := &CraftingWindow{}
+	events.Subscribe(EventRecipesReceived, func(e Event) {
+		w.recipes = e.Payload.(RecipesReceived).Recipes
+		w.selected = 0
+	})
+	events.Subscribe(EventInventoryChanged, func(e Event) {
+		w.inventory = e.Payload.(InventoryChanged).Inventory
+	})
+	events.Subscribe(EventCraftUpdated, func(e Event) {
+		w.update(e.Payload.(CraftUpdated).Status, events)
+	})
+	return w
+}
+
+func (w *CraftingWindow) update(status protocol.CraftStatus, events *EventBus) {
+	if !status.Done && !status.Cancelled {
+		w.crafting, w.elapsed, w.seconds = w.recipe(status.Recipe), 0, status.Seconds
+		return
+	}
+	w.crafting = nil
+	recipe := w.recipe(status.Recipe)
+	if status.Done && recipe != nil {
+		events.Publish(EventChatReceived, ChatReceived{Channel: chatChannelSystem, From: "client", Text: T("craft.done", recipe.Count, recipe.Output)})
+	}
+}
+
+func (w *CraftingWindow) recipe(id string) *protocol.Recipe {
+	for i := range w.recipes {
+		if w.recipes[i].ID == id {
+			return &w.recipes[i]
+		}
+	}
+	return nil
+}
+
+func (w *CraftingWindow) Open() bool {
+	return w.open
+}
+
+// Update handles the crafting keys, sending craft requests on conn.
+func (w *CraftingWindow) Update(deltaTime float64, typing bool, conn io.Writer) error {
+	if w.crafting != nil {
+		w.elapsed = min(w.elapsed+deltaTime, w.seconds)
+	}
+	if typing {
+		return nil
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyC) || menuPad.Pressed(MenuSelect) {
+		w.open = !w.open
+	}
+	if w.open && (inpututil.IsKeyJustPressed(ebiten.KeyEscape) || menuPad.Pressed(MenuBack)) {
+		w.open = false
+	}
+	if !w.open || len(w.recipes) == 0 {
+		return nil
+	}
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyUp), menuPad.Pressed(MenuUp):
+		w.selected = (w.selected + len(w.recipes) - 1) % len(w.recipes)
+	case inpututil.IsKeyJustPressed(ebiten.KeyDown), menuPad.Pressed(MenuDown):
+		w.selected = (w.selected + 1) % len(w.recipes)
+	case inpututil.IsKeyJustPressed(ebiten.KeySpace), menuPad.Pressed(MenuAccept):
+		_, err := io.WriteString(conn, protocol.Line(protocol.KindCraft, w.recipes[w.selected].ID))
+		return err
+	}
+	return nil
+}
+
+func (w *CraftingWindow) Draw(screen *ebiten.Image) {
+	if w.crafting != nil {
+		drawProgressBar(screen, T("craft.progress", w.crafting.Output), w.elapsed, w.seconds, hudHeight-chatLineGap*10)
+	}
+	if !w.open {
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString(T("craft.title") + "\n\n")
+	if len(w.recipes) == 0 {
+		b.WriteString(T("craft.none") + "\n")
+	}
+	for i, r := range w.recipes {
+		marker := "  "
+		if i == w.selected {
+			marker = "> "
+		}
+		inputs := make([]string, 0, len(r.Inputs))
+		for _, item := range slices.Sorted(maps.Keys(r.Inputs)) {
+			inputs = append(inputs, fmt.Sprintf("%s %d/%d", item, w.inventory[item], r.Inputs[item]))
+		}
+		fmt.Fprintf(&b, "%s%d %s <- %s\n", marker, max(r.Count, 1), r.Output, strings.Join(inputs, ", "))
+	}
+	height := craftingRowGap*(max(len(w.recipes), 1)+2) + 36
+	x, y := (hudWidth-craftingWidth)/2, (hudHeight-height)/2
+	drawPanel(screen, float64(x), float64(y), craftingWidth, float64(height))
+	drawText(screen, b.String(), x+12, y+10, hudText)
+	drawText(screen, menuPad.Hint("craft.help"), x+12, y+height-20, hudText)
+}
+
+// drawProgressBar draws a labelled bar, centred at height y, filled by how
+// far elapsed is through seconds.
+func drawProgressBar(screen *ebiten.Image, label string, elapsed, seconds float64, y int) {
+	x := (hudWidth - progressBarWidth) / 2
+	filled := float32(progressBarWidth)
+	if seconds > 0 {
+		filled *= float32(elapsed / seconds)
+	}
+	vector.DrawFilledRect(screen, float32(x), float32(y), progressBarWidth, progressBarHeight, color.RGBA{40, 40, 40, 220}, false)
+	vector.DrawFilledRect(screen, float32(x), float32(y), filled, progressBarHeight, color.RGBA{230, 180, 60, 255}, false)
+	drawText(screen, label, x, y-16, hudText)
+}
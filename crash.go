@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+const (
+	// crashMessages is how many of the last network messages go in a crash
+	// report.
+	crashMessages = 50
+	// crashUploadTimeout bounds how long a crashing client waits on the
+	// report endpoint before giving up.
+	crashUploadTimeout = 5 * time.Second
+)
+
+// CrashReporter writes a report when the game panics: the panic and its
+// stack, the last network messages and the player's settings, to a
+// crash-*.log file next to the client, and optionally POSTs it to endpoint
+// so crashes in the field reach the developers.
+type CrashReporter struct {
+	packets  *PacketLog
+	settings *Settings
+	endpoint string
+	once     sync.Once
+}
+
+func NewCrashReporter(packets *PacketLog, settings *Settings, endpoint string) *CrashReporter {
+	return &CrashReporter{packets: packets, settings: settings, endpoint: endpoint}
+}
+
+// Recover, deferred by the code it guards, reports a panic and then lets
+// it go on to crash the client as it would have. Only the first panic is
+// reported.
+func (c *CrashReporter) Recover() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	stack := debug.Stack()
+	c.once.Do(func() { c.report(r, stack) })
+	panic(r)
+}
+
+func (c *CrashReporter) report(panicked any, stack []byte) {
+	report := c.build(panicked, stack)
+	path := fmt.Sprintf("crash-%s.log", time.Now().Format("20060102-150405"))
+	if err := os.WriteFile(path, report, 0o644); err != nil {
+		log.Println("Error writing crash report:", err)
+	} else {
+		log.Println("Crash report written to", path)
+	}
+	if c.endpoint == "" {
+		return
+	}
+	client := &http.Client{Timeout: crashUploadTimeout}
+	resp, err := client.Post(c.endpoint, "text/plain; charset=utf-8", bytes.NewReader(report))
+	if err != nil {
+		log.Println("Error sending crash report:", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Println("Error sending crash report:", resp.Status)
+	}
+}
+
+func (c *CrashReporter) build(panicked any, stack []byte) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "MultiTest crash report\ntime: %s\ngo: %s %s/%s\n\n", time.Now().Format(time.RFC3339), runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(&b, "panic: %v\n\n%s\n", panicked, stack)
+
+	b.WriteString("settings:\n")
+	if settings, err := json.MarshalIndent(c.settings, "", "  "); err != nil {
+		fmt.Fprintf(&b, "(%v)\n", err)
+	} else {
+		b.Write(settings)
+		b.WriteString("\n")
+	}
+
+	records := c.packets.Records()
+	records = records[max(0, len(records)-crashMessages):]
+	fmt.Fprintf(&b, "\nlast %d messages:\n", len(records))
+	for _, r := range records {
+		fmt.Fprintf(&b, "%s %c %s\n", r.Time.Format("15:04:05.000"), r.Direction, r.Text)
+	}
+	return b.Bytes()
+}
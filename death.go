@@ -0,0 +1,81 @@
+package main
+
+import (
+	"image/color"
+	"math"
+
+	"darkzone/MultiTestServer/protocol"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+// spectateSeconds is how long the camera follows the killer before
+// returning to the player's own body.
+const spectateSeconds = 3.0
+
+var deathOverlay = color.RGBA{40, 0, 0, 120}
+
+// Death is the wait between a defeat and the server's respawn: the player
+// lies dead, takes no input and sees a countdown, optionally watching
+// whoever defeated them for the first few seconds.
+type Death struct {
+	by        string
+	killer    string
+	remaining float64
+	spectate  float64
+}
+
+func NewDeath(defeat protocol.Defeat, spectate bool) *Death {
+	d := &Death{by: defeat.By, killer: defeat.Killer, remaining: defeat.Seconds}
+	if spectate && defeat.Killer != "" {
+		d.spectate = spectateSeconds
+	}
+	return d
+}
+
+func (d *Death) Update(deltaTime float64) {
+	d.remaining = math.Max(0, d.remaining-deltaTime)
+	d.spectate = math.Max(0, d.spectate-deltaTime)
+}
+
+// Watching returns the ID of the player the camera follows, if any.
+func (d *Death) Watching() (string, bool) {
+	if d == nil || d.spectate <= 0 {
+		return "", false
+	}
+	return d.killer, true
+}
+
+// Draw dims the view and shows who won and when the player respawns.
+func (d *Death) Draw(target *ebiten.Image) {
+	if d == nil {
+		return
+	}
+	width, height := target.Bounds().Dx(), target.Bounds().Dy()
+	vector.DrawFilledRect(target, 0, 0, float32(width), float32(height), deathOverlay, false)
+	lines := []string{T("death.defeated", d.by), T("death.respawn", int(math.Ceil(d.remaining)))}
+	if _, ok := d.Watching(); ok {
+		lines = append(lines, T("death.watching", d.by))
+	}
+	drawCentered(target, lines, width, height/3, titleText)
+}
+
+// revive ends the player's death once the server has respawned them.
+func (l *LocalPlayer) revive() {
+	if l.death == nil {
+		return
+	}
+	l.death = nil
+	l.SetAnim(protocol.AnimIdle)
+}
+
+// cameraCenter is where a player's view is centred: on them, or on their
+// killer while they watch.
+func (g *Game) cameraCenter(local *LocalPlayer) Vector2f {
+	if id, ok := local.death.Watching(); ok {
+		if position, ok := g.playerPosition(id); ok {
+			return position
+		}
+	}
+	return local.cameraCenter()
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"image/color"
+
+	"darkzone/MultiTestServer/protocol"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+// Colors of the collision overlay. Predicted positions are what this client
+// draws; server positions are the last ones the server sent for the same
+// player, so a gap between the two is the prediction or interpolation error.
+var (
+	debugSolid     = color.RGBA{255, 60, 60, 70}
+	debugSolidEdge = color.RGBA{255, 60, 60, 180}
+	debugBounds    = color.RGBA{255, 255, 255, 160}
+	debugEntity    = color.RGBA{255, 200, 0, 200}
+	debugInterest  = color.RGBA{80, 160, 255, 140}
+	debugPredicted = color.RGBA{0, 255, 120, 255}
+	debugServer    = color.RGBA{255, 0, 255, 255}
+)
+
+// debugMarker is the half-size of the cross marking a position.
+const debugMarker = 5
+
+// drawCollisionDebug draws solid tiles, bounding boxes, each local player's
+// interest radius and predicted against server positions over the world.
+func (g *Game) drawCollisionDebug(target *ebiten.Image, cameraOffset Vector2f, x0, y0, x1, y1 float64) {
+	for i := 0; i < g.tileMap.Cells(); i++ {
+		if !g.tileMap.Solid(i) {
+			continue
+		}
+		x := float64((i%g.tileMap.Width)*tileSize) - cameraOffset.X
+		y := float64((i/g.tileMap.Width)*tileSize) - cameraOffset.Y
+		if x+tileSize < 0 || y+tileSize < 0 || x > float64(target.Bounds().Dx()) || y > float64(target.Bounds().Dy()) {
+			continue
+		}
+		vector.DrawFilledRect(target, float32(x), float32(y), tileSize, tileSize, debugSolid, false)
+		vector.StrokeRect(target, float32(x), float32(y), tileSize, tileSize, 1, debugSolidEdge, false)
+	}
+
+	g.entities.InRect(x0, y0, x1, y1, func(_ string, entity *WorldEntity) {
+		size := float32(itemSize)
+		switch entity.Kind {
+		case protocol.EntityNPC:
+			size = frameWidth
+		case protocol.EntityResource:
+			size = resourceSize
+		case protocol.EntityDoor:
+			size = protocol.DoorSize
+		}
+		vector.StrokeRect(target, float32(entity.X-cameraOffset.X), float32(entity.Y-cameraOffset.Y), size, size, 1, debugEntity, false)
+	})
+	g.otherPlayers.InRect(x0, y0, x1, y1, func(_ string, player *RemotePlayer) {
+		drawDebugBounds(target, player.position, cameraOffset)
+		if latest, ok := player.Latest(); ok {
+			drawDebugError(target, player.position, latest, cameraOffset)
+		}
+	})
+	for _, local := range g.localPlayers {
+		drawDebugBounds(target, local.position, cameraOffset)
+		if !local.hasServerPosition {
+			continue
+		}
+		center := toScreen(local.serverPosition, cameraOffset)
+		vector.StrokeCircle(target, float32(center.X), float32(center.Y), protocol.InterestRadius, 2, debugInterest, true)
+		drawDebugError(target, local.position, local.serverPosition, cameraOffset)
+	}
+
+	drawText(target, T("debug.collision"), 8, target.Bounds().Dy()-20, hudText)
+}
+
+// drawDebugBounds outlines a character's sprite and marks the point the
+// tile collision checks, its top-left corner.
+func drawDebugBounds(target *ebiten.Image, position, cameraOffset Vector2f) {
+	p := toScreen(position, cameraOffset)
+	vector.StrokeRect(target, float32(p.X), float32(p.Y), frameWidth, frameHeight, 1, debugBounds, false)
+	vector.DrawFilledCircle(target, float32(p.X), float32(p.Y), 2, debugBounds, false)
+}
+
+// drawDebugError marks the predicted and server positions and joins them.
+func drawDebugError(target *ebiten.Image, predicted, server, cameraOffset Vector2f) {
+	p, s := toScreen(predicted, cameraOffset), toScreen(server, cameraOffset)
+	vector.StrokeLine(target, float32(p.X), float32(p.Y), float32(s.X), float32(s.Y), 1, debugServer, true)
+	drawDebugCross(target, p, debugPredicted)
+	drawDebugCross(target, s, debugServer)
+}
+
+func toScreen(position, cameraOffset Vector2f) Vector2f {
+	return Vector2f{position.X - cameraOffset.X, position.Y - cameraOffset.Y}
+}
+
+func drawDebugCross(target *ebiten.Image, at Vector2f, c color.Color) {
+	x, y := float32(at.X), float32(at.Y)
+	vector.StrokeLine(target, x-debugMarker, y-debugMarker, x+debugMarker, y+debugMarker, 2, c, true)
+	vector.StrokeLine(target, x-debugMarker, y+debugMarker, x+debugMarker, y-debugMarker, 2, c, true)
+}
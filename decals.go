@@ -0,0 +1,174 @@
+package main
+
+import (
+	"image/color"
+	"math"
+
+	"darkzone/MultiTestServer/protocol"
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+const (
+	// strideLength is how far a character walks between footsteps.
+	strideLength = 14.0
+	// maxDecals bounds the decals on the ground; the oldest go first.
+	maxDecals = 1024
+	// footOffset is how far each foot falls to the side of the path.
+	footOffset = 3.0
+)
+
+type decalKind int
+
+const (
+	decalFootprint decalKind = iota
+	decalSkid
+)
+
+type decalStyle struct {
+	sprite   *ebiten.Image
+	color    color.RGBA
+	lifetime float64
+}
+
+// decalStyles is indexed by decalKind, and drawn in that order.
+var decalStyles = [...]decalStyle{
+	decalFootprint: {sprite: decalSprite(5, 3), color: color.RGBA{60, 45, 30, 150}, lifetime: 10},
+	decalSkid:      {sprite: decalSprite(strideLength+2, 2), color: color.RGBA{235, 245, 255, 170}, lifetime: 5},
+}
+
+// snowPrints is the footprint colour when it is snowing, a pale blue
+// against the fallen snow.
+var snowPrints = color.RGBA{150, 170, 205, 150}
+
+func decalSprite(width, height int) *ebiten.Image {
+	img := ebiten.NewImage(width, height)
+	img.Fill(color.White)
+	return img
+}
+
+type decal struct {
+	position Vector2f
+	angle    float64
+	kind     decalKind
+	color    color.RGBA
+	age      float64
+}
+
+// Decals are the marks players leave on the ground as they move:
+// footprints in mud and falling snow, and skid marks on ice. Each fades
+// out over its style's lifetime. They come from EventFootstep, so remote
+// players leave them as well as local ones.
+type Decals struct {
+	decals   []decal
+	weather  protocol.Weather
+	vertices []ebiten.Vertex
+	indices  []uint16
+}
+
+func NewDecals(events *EventBus) *Decals {
+	d := &Decals{weather: protocol.WeatherClear}
+	events.Subscribe(EventWeatherChanged, func(e Event) {
+		d.weather = e.Payload.(WeatherChanged).Weather
+	})
+	events.Subscribe(EventFootstep, func(e Event) {
+		d.step(e.Payload.(Footstep))
+	})
+	return d
+}
+
+// step leaves the mark a footstep makes on the ground it lands on, if any.
+func (d *Decals) step(step Footstep) {
+	kind, tint := decalFootprint, decalStyles[decalFootprint].color
+	switch {
+	case step.Terrain == protocol.TerrainIce:
+		kind, tint = decalSkid, decalStyles[decalSkid].color
+	case step.Terrain == protocol.TerrainMud:
+	case step.Terrain != protocol.TerrainWater && d.weather == protocol.WeatherSnow:
+		tint = snowPrints
+	default:
+		return
+	}
+	if len(d.decals) >= maxDecals {
+		d.decals = append(d.decals[:0], d.decals[1:]...)
+	}
+	d.decals = append(d.decals, decal{position: step.Position, angle: step.Angle, kind: kind, color: tint})
+}
+
+func (d *Decals) Update(deltaTime float64) {
+	alive := d.decals[:0]
+	for _, decal := range d.decals {
+		decal.age += deltaTime
+		if decal.age < decalStyles[decal.kind].lifetime {
+			alive = append(alive, decal)
+		}
+	}
+	d.decals = alive
+}
+
+// Draw renders the decals within x0, y0 to x1, y1, a DrawTriangles call
+// for each kind, each sprite turned to the way its character was going.
+func (d *Decals) Draw(screen *ebiten.Image, cameraOffset Vector2f, x0, y0, x1, y1 float64) {
+	for i, style := range decalStyles {
+		kind := decalKind(i)
+		d.vertices = d.vertices[:0]
+		d.indices = d.indices[:0]
+		bounds := style.sprite.Bounds()
+		halfW, halfH := float64(bounds.Dx())/2, float64(bounds.Dy())/2
+		for _, decal := range d.decals {
+			if decal.kind != kind || decal.position.X < x0 || decal.position.X > x1 || decal.position.Y < y0 || decal.position.Y > y1 {
+				continue
+			}
+			cos, sin := math.Cos(decal.angle), math.Sin(decal.angle)
+			x, y := decal.position.X-cameraOffset.X, decal.position.Y-cameraOffset.Y
+			r := float32(decal.color.R) / 255
+			g := float32(decal.color.G) / 255
+			b := float32(decal.color.B) / 255
+			a := float32(decal.color.A) / 255 * float32(1-decal.age/style.lifetime)
+			base := uint16(len(d.vertices))
+			for _, corner := range [4][2]float64{{-1, -1}, {1, -1}, {-1, 1}, {1, 1}} {
+				cx, cy := corner[0]*halfW, corner[1]*halfH
+				dx, dy := float32(x+cx*cos-cy*sin), float32(y+cx*sin+cy*cos)
+				sx, sy := float32(bounds.Min.X)+float32(halfW*(corner[0]+1)), float32(bounds.Min.Y)+float32(halfH*(corner[1]+1))
+				d.vertices = append(d.vertices, ebiten.Vertex{DstX: dx, DstY: dy, SrcX: sx, SrcY: sy, ColorR: r, ColorG: g, ColorB: b, ColorA: a})
+			}
+			d.indices = append(d.indices, base, base+1, base+2, base+1, base+3, base+2)
+		}
+		if len(d.indices) > 0 {
+			screen.DrawTriangles(d.vertices, d.indices, style.sprite, nil)
+		}
+	}
+}
+
+// footstep reports where the character's next foot came down, once they
+// have walked strideLength since the last, left and right in turn. A jump
+// further than a few strides, a teleport or a correction, leaves none.
+func (c *Character) footstep() (Footstep, bool) {
+	feet := Vector2f{c.position.X + frameWidth/2, c.position.Y + frameHeight - 2}
+	dx, dy := feet.X-c.stepFrom.X, feet.Y-c.stepFrom.Y
+	distance := math.Hypot(dx, dy)
+	if distance < strideLength {
+		return Footstep{}, false
+	}
+	c.stepFrom = feet
+	if distance > strideLength*4 {
+		return Footstep{}, false
+	}
+	c.leftFoot = !c.leftFoot
+	angle := math.Atan2(dy, dx)
+	side := footOffset
+	if c.leftFoot {
+		side = -footOffset
+	}
+	at := Vector2f{feet.X - math.Sin(angle)*side, feet.Y + math.Cos(angle)*side}
+	return Footstep{Position: at, Angle: angle, Terrain: c.terrain}, true
+}
+
+// stepDecals publishes the footsteps of everyone walking on the ground;
+// bridge decks take no prints.
+func (g *Game) stepDecals(c *Character) {
+	step, ok := c.footstep()
+	if !ok || c.mount != "" || g.tileMap.ElevationAt(step.Position.X, step.Position.Y) == protocol.ElevationBridge {
+		return
+	}
+	g.events.Publish(EventFootstep, step)
+}
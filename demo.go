@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"darkzone/MultiTestServer/protocol"
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// demoHeader starts every demo file, followed by the Unix millisecond the
+// recording started at. Each line after it is a message: milliseconds since
+// the start, direction (< received, > sent) and the message, tab-separated.
+const demoHeader = "MTDEMO 1"
+
+// demoViewer is the ID a playing demo welcomes the client as, so the
+// recorded player arrives in snapshots like anyone else and can be watched.
+const demoViewer = "demo-viewer"
+
+// demoConn records every message that crosses conn to a demo file.
+type demoConn struct {
+	net.Conn
+	mu      sync.Mutex
+	file    *os.File
+	w       *bufio.Writer
+	start   time.Time
+	partial []byte
+}
+
+// NewDemoRecorder wraps conn to record what it receives and sends to a demo
+// file at path, for playing back later with -play.
+func NewDemoRecorder(conn net.Conn, path string) (net.Conn, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &demoConn{Conn: conn, file: file, w: bufio.NewWriter(file), start: time.Now()}
+	fmt.Fprintf(c.w, "%s %d\n", demoHeader, c.start.UnixMilli())
+	return c, nil
+}
+
+func (c *demoConn) record(direction PacketDirection, line []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(c.w, "%d\t%c\t%s\n", time.Since(c.start).Milliseconds(), direction, bytes.TrimRight(line, "\r\n"))
+}
+
+func (c *demoConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.partial = append(c.partial, p[:n]...)
+	for {
+		i := bytes.IndexByte(c.partial, '\n')
+		if i < 0 {
+			break
+		}
+		c.record(PacketIn, c.partial[:i+1])
+		c.partial = c.partial[i+1:]
+	}
+	return n, err
+}
+
+func (c *demoConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	for _, line := range bytes.SplitAfter(p[:n], []byte("\n")) {
+		if len(line) > 0 {
+			c.record(PacketOut, line)
+		}
+	}
+	return n, err
+}
+
+func (c *demoConn) Close() error {
+	c.mu.Lock()
+	err := c.w.Flush()
+	if closeErr := c.file.Close(); err == nil {
+		err = closeErr
+	}
+	c.mu.Unlock()
+	if closeErr := c.Conn.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+type demoEntry struct {
+	at   time.Duration
+	line string
+}
+
+// DemoPlayback replays a recorded demo in place of a server: what the
+// client received is fed back at the pace it arrived, and what it sends is
+// dropped, apart from clock requests, which are answered with the server's
+// time as it was in the recording so snapshots interpolate as they did.
+type DemoPlayback struct {
+	// Subject is the ID of the player who recorded the demo.
+	Subject  string
+	entries  []demoEntry
+	start    int64
+	offset   int64
+	began    time.Time
+	finished atomic.Bool
+}
+
+// LoadDemo reads a demo file written by NewDemoRecorder.
+func LoadDemo(path string) (*DemoPlayback, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<24)
+	if !scanner.Scan() {
+		return nil, fmt.Errorf("demo %s: empty file", path)
+	}
+	start, ok := strings.CutPrefix(scanner.Text(), demoHeader+" ")
+	if !ok {
+		return nil, fmt.Errorf("demo %s: not a demo file", path)
+	}
+	d := &DemoPlayback{}
+	if d.start, err = strconv.ParseInt(start, 10, 64); err != nil {
+		return nil, fmt.Errorf("demo %s: start time: %w", path, err)
+	}
+
+	bestRTT := int64(-1)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), "\t", 3)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("demo %s: malformed line %q", path, scanner.Text())
+		}
+		at, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("demo %s: time: %w", path, err)
+		}
+		if fields[1] != string(PacketIn) {
+			continue
+		}
+		kind, payload := protocol.Split(fields[2])
+		switch kind {
+		case protocol.KindWelcome:
+			d.Subject = payload
+		case protocol.KindClock:
+			// The server's clock is known from the reply that made the
+			// quickest round trip, the same way ClockSync estimates it.
+			clientTime, serverTime, err := protocol.DecodeClock(payload)
+			if err != nil {
+				continue
+			}
+			received := d.start + at
+			if rtt := received - clientTime; bestRTT < 0 || rtt < bestRTT {
+				bestRTT = rtt
+				d.offset = serverTime + rtt/2 - received
+			}
+			continue
+		case protocol.KindVision:
+			// Fog of war was the recording player's; the playback shows
+			// everything.
+			continue
+		}
+		d.entries = append(d.entries, demoEntry{at: time.Duration(at) * time.Millisecond, line: fields[2]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading demo %s: %w", path, err)
+	}
+	return d, nil
+}
+
+// Dial starts the playback and returns the client's end of it.
+func (d *DemoPlayback) Dial() (net.Conn, error) {
+	clientConn, demoConn := net.Pipe()
+	d.began = time.Now()
+	var mu sync.Mutex
+	send := func(line string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		_, err := io.WriteString(demoConn, line)
+		return err
+	}
+
+	go func() {
+		reader := bufio.NewReader(demoConn)
+		for {
+			message, err := protocol.ReadLine(reader)
+			if err != nil {
+				return
+			}
+			kind, payload := protocol.Split(message)
+			if kind != protocol.KindClock {
+				continue
+			}
+			clientTime, _, err := protocol.DecodeClock(payload)
+			if err != nil {
+				continue
+			}
+			if send(protocol.Line(protocol.KindClock, protocol.EncodeClock(clientTime, d.serverNow()))) != nil {
+				return
+			}
+		}
+	}()
+
+	go func() {
+		for _, entry := range d.entries {
+			time.Sleep(time.Until(d.began.Add(entry.at)))
+			line := entry.line
+			if kind, _ := protocol.Split(line); kind == protocol.KindWelcome {
+				line = protocol.Line(protocol.KindWelcome, demoViewer)
+			} else {
+				line += "\n"
+			}
+			if err := send(line); err != nil {
+				log.Println("Error playing demo:", err)
+				return
+			}
+		}
+		d.finished.Store(true)
+	}()
+	return clientConn, nil
+}
+
+// serverNow is the server time the recording had reached at this point of
+// the playback, in Unix milliseconds.
+func (d *DemoPlayback) serverNow() int64 {
+	return d.start + time.Since(d.began).Milliseconds() + d.offset
+}
+
+func (d *DemoPlayback) Draw(screen *ebiten.Image) {
+	status := T("demo.playing", clockText(time.Since(d.began).Seconds()), clockText(d.length().Seconds()))
+	if d.finished.Load() {
+		status = T("demo.finished")
+	}
+	drawText(screen, status, 8, screenHeight-24, hudText)
+}
+
+func (d *DemoPlayback) length() time.Duration {
+	if len(d.entries) == 0 {
+		return 0
+	}
+	return d.entries[len(d.entries)-1].at
+}
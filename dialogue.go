@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"darkzone/MultiTestServer/protocol"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+const (
+	dialogueWidth  = 420
+	dialogueHeight = 150
+)
+
+// DialogueBox shows what an NPC is saying along the bottom of the screen.
+// Up and Down pick a choice and Space answers with it; the number keys
+// answer directly and Escape walks away. The server decides what comes next,
+// so the box only ever shows the line it was last sent.
+type DialogueBox struct {
+	line     *protocol.DialogueLine
+	selected int
+}
+
+func NewDialogueBox(events *EventBus) *DialogueBox {
+	d := &DialogueBox{}
+	events.Subscribe(EventDialogueChanged, func(e Event) {
+		d.line, d.selected = e.Payload.(DialogueChanged).Line, 0
+	})
+	return d
+}
+
+func (d *DialogueBox) Open() bool {
+	return d.line != nil
+}
+
+// Update handles the dialogue keys, sending the player's answer on w.
+func (d *DialogueBox) Update(typing bool, w io.Writer) error {
+	if d.line == nil || typing {
+		return nil
+	}
+	choices := max(len(d.line.Choices), 1)
+	choice := -2
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyUp), menuPad.Pressed(MenuUp):
+		d.selected = (d.selected + choices - 1) % choices
+	case inpututil.IsKeyJustPressed(ebiten.KeyDown), menuPad.Pressed(MenuDown):
+		d.selected = (d.selected + 1) % choices
+	case inpututil.IsKeyJustPressed(ebiten.KeySpace), menuPad.Pressed(MenuAccept):
+		choice = d.selected
+	case inpututil.IsKeyJustPressed(ebiten.KeyEscape), menuPad.Pressed(MenuBack):
+		choice = -1
+	}
+	for i := range min(choices, 9) {
+		if inpututil.IsKeyJustPressed(ebiten.KeyDigit1 + ebiten.Key(i)) {
+			choice = i
+		}
+	}
+	if choice == -2 {
+		return nil
+	}
+	// The server answers with the next line; until then the box stays as
+	// it is, and closes straight away when walking off.
+	if choice == -1 {
+		d.line = nil
+	}
+	_, err := io.WriteString(w, protocol.Line(protocol.KindDialogueChoice, strconv.Itoa(choice)))
+	return err
+}
+
+func (d *DialogueBox) Draw(screen *ebiten.Image) {
+	if d.line == nil {
+		return
+	}
+	x, y := (hudWidth-dialogueWidth)/2, hudHeight-dialogueHeight-80
+	drawPanel(screen, float64(x), float64(y), dialogueWidth, dialogueHeight)
+
+	var b strings.Builder
+	b.WriteString(d.line.NPC + ":\n")
+	b.WriteString(wrapText(d.line.Text, dialogueWidth-24, hudText) + "\n\n")
+	choices := d.line.Choices
+	if len(choices) == 0 {
+		choices = []string{T("dialogue.continue")}
+	}
+	for i, choice := range choices {
+		marker := "  "
+		if i == d.selected {
+			marker = "> "
+		}
+		fmt.Fprintf(&b, "%s%d. %s\n", marker, i+1, choice)
+	}
+	drawText(screen, b.String(), x+12, y+10, hudText)
+	drawText(screen, menuPad.Hint("dialogue.help"), x+12, y+dialogueHeight-20, hudText)
+}
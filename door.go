@@ -0,0 +1,56 @@
+package main
+
+import (
+	"image/color"
+	"math"
+
+	"darkzone/MultiTestServer/protocol"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+var (
+	doorClosed = color.RGBA{120, 80, 40, 255}
+	doorOpen   = color.RGBA{120, 80, 40, 160}
+)
+
+func (w *WorldEntity) drawDoor(screen *ebiten.Image, x, y float64) {
+	if w.open {
+		vector.StrokeRect(screen, float32(x), float32(y), protocol.DoorSize, protocol.DoorSize, 2, doorOpen, false)
+		return
+	}
+	vector.DrawFilledRect(screen, float32(x), float32(y), protocol.DoorSize, protocol.DoorSize, doorClosed, false)
+}
+
+// Blocked makes the game the world prediction moves players through: solid
+// tiles, as the map has them, and closed doors, as the server last said.
+func (g *Game) Blocked(x, y float64) bool {
+	if g.tileMap.Blocked(x, y) {
+		return true
+	}
+	blocked := false
+	g.entities.Near(x, y, protocol.DoorSize*2, func(_ string, e *WorldEntity) {
+		blocked = blocked || e.Kind == protocol.EntityDoor && !e.open && protocol.DoorCovers(e.X, e.Y, x, y)
+	})
+	return blocked
+}
+
+// drawDoorPrompt shows what the interact key does to the nearest door in
+// reach of the local player.
+func (g *Game) drawDoorPrompt(target *ebiten.Image, local *LocalPlayer, cameraOffset Vector2f) {
+	var nearest *WorldEntity
+	best := protocol.InteractRange
+	g.entities.Near(local.position.X, local.position.Y, protocol.InteractRange, func(_ string, e *WorldEntity) {
+		if d := math.Hypot(e.X-local.position.X, e.Y-local.position.Y); e.Kind == protocol.EntityDoor && d <= best {
+			nearest, best = e, d
+		}
+	})
+	if nearest == nil {
+		return
+	}
+	prompt := T("door.open")
+	if nearest.open {
+		prompt = T("door.close")
+	}
+	drawText(target, prompt, int(nearest.X-cameraOffset.X), int(nearest.Y-cameraOffset.Y)-32, tagText)
+}
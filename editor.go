@@ -0,0 +1,623 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+	"os"
+	"time"
+
+	"darkzone/MultiTestServer/protocol"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+const (
+	paletteTile   = 48
+	editorPanStep = 12.0
+	// autosaveInterval is how often unsaved changes are written to the
+	// recovery file next to the map.
+	autosaveInterval = time.Minute
+	recoverySuffix   = ".recovery"
+	// cursorSendInterval limits how often a live editor reports its cursor.
+	cursorSendInterval = 100 * time.Millisecond
+)
+
+type editorTool int
+
+const (
+	toolPaint editorTool = iota
+	toolErase
+	toolCollision
+)
+
+var editorToolNames = map[editorTool]string{
+	toolPaint:     "editor.tool.paint",
+	toolErase:     "editor.tool.erase",
+	toolCollision: "editor.tool.collision",
+}
+
+var (
+	paletteBackground = color.RGBA{0, 0, 0, 200}
+	paletteSelected   = color.RGBA{255, 220, 0, 255}
+	editorCursor      = color.RGBA{255, 255, 255, 200}
+	otherEditorCursor = color.RGBA{0, 200, 255, 255}
+)
+
+// MapEditor is a scene for editing a map file in place, started with -edit
+// instead of connecting to a server. The left mouse button applies the
+// current tool to the cell under the cursor and the right one undoes it, so
+// painting and erasing, or setting and clearing collision, never need a
+// tool switch. Each stroke is one step for Ctrl+Z and Ctrl+Y, and unsaved
+// work is autosaved to a recovery file that Ctrl+R loads back.
+//
+// With a link the editor works on a server's shared map instead: every
+// change is sent to the server, changes from other editors are applied as
+// they arrive, their cursors are shown, and Ctrl+S saves on the server.
+type MapEditor struct {
+	path      string
+	tileMap   *TileMap
+	tiles     *ebiten.Image
+	renderer  *TileRenderer
+	scheduler *TaskScheduler
+	camera    *FreeCamera
+
+	tool   editorTool
+	layer  int
+	tile   int
+	status string
+
+	history EditHistory
+	// stroke collects the cells changed while a mouse button is held.
+	stroke editOp
+	// changes counts applied operations, so autosave can tell whether
+	// anything happened since autosaved.
+	changes      int
+	autosaved    int
+	lastAutosave time.Time
+	shownDirty   bool
+
+	// live is set for a shared map; link is dropped if the connection is
+	// lost, while live keeps the editor from saving over a local file.
+	live           bool
+	link           *EditorLink
+	cursors        map[string]Vector2f
+	lastCursor     Vector2f
+	lastCursorSend time.Time
+}
+
+func NewMapEditor(path string, tileMap *TileMap, tiles *ebiten.Image) *MapEditor {
+	if len(tileMap.Layers) == 0 {
+		tileMap.Layers = [][]int{make([]int, tileMap.Cells())}
+	}
+	scheduler := NewTaskScheduler(defaultFrameBudget)
+	rows := (tileMap.Cells() + tileMap.Width - 1) / tileMap.Width
+	width, height := float64(tileMap.Width*tileSize), float64(rows*tileSize)
+	camera := &FreeCamera{
+		Active: true,
+		center: Vector2f{width / 2, height / 2},
+		zoom:   max(minZoom, min(1, screenWidth/width, (screenHeight-paletteTile)/height)),
+	}
+	e := &MapEditor{
+		path:         path,
+		tileMap:      tileMap,
+		tiles:        tiles,
+		renderer:     NewTileRenderer(tileMap, tiles, scheduler),
+		scheduler:    scheduler,
+		camera:       camera,
+		lastAutosave: time.Now(),
+		cursors:      make(map[string]Vector2f),
+	}
+	if recovery, err := os.Stat(e.recoveryPath()); err == nil {
+		if saved, err := os.Stat(path); err != nil || recovery.ModTime().After(saved.ModTime()) {
+			e.status = T("editor.recoveryFound", e.recoveryPath())
+		}
+	}
+	return e
+}
+
+func (e *MapEditor) recoveryPath() string {
+	return e.path + recoverySuffix
+}
+
+// paletteSize is how many tiles the tile sheet holds.
+func (e *MapEditor) paletteSize() int {
+	bounds := e.tiles.Bounds()
+	return (bounds.Dx() / tileSize) * (bounds.Dy() / tileSize)
+}
+
+func (e *MapEditor) Update() error {
+	e.scheduler.Run()
+	e.drainLink()
+	e.camera.control()
+	e.sendCursor()
+
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.Key1):
+		e.tool = toolPaint
+	case inpututil.IsKeyJustPressed(ebiten.Key2):
+		e.tool = toolErase
+	case inpututil.IsKeyJustPressed(ebiten.Key3):
+		e.tool = toolCollision
+	case inpututil.IsKeyJustPressed(ebiten.KeyTab):
+		e.layer = (e.layer + 1) % len(e.tileMap.Layers)
+	case inpututil.IsKeyJustPressed(ebiten.KeyN):
+		e.addLayer()
+	case inpututil.IsKeyJustPressed(ebiten.KeyBracketLeft):
+		e.tile = (e.tile + e.paletteSize() - 1) % e.paletteSize()
+	case inpututil.IsKeyJustPressed(ebiten.KeyBracketRight):
+		e.tile = (e.tile + 1) % e.paletteSize()
+	case inpututil.IsKeyJustPressed(ebiten.KeyS) && ebiten.IsKeyPressed(ebiten.KeyControl):
+		e.save()
+	case inpututil.IsKeyJustPressed(ebiten.KeyR) && ebiten.IsKeyPressed(ebiten.KeyControl):
+		e.restore()
+	case inpututil.IsKeyJustPressed(ebiten.KeyZ) && ebiten.IsKeyPressed(ebiten.KeyControl):
+		if ebiten.IsKeyPressed(ebiten.KeyShift) {
+			e.redo()
+		} else {
+			e.undo()
+		}
+	case inpututil.IsKeyJustPressed(ebiten.KeyY) && ebiten.IsKeyPressed(ebiten.KeyControl):
+		e.redo()
+	}
+	e.autosave()
+	e.updateTitle()
+
+	if ebiten.IsKeyPressed(ebiten.KeyLeft) {
+		e.camera.center.X -= editorPanStep / e.camera.zoom
+	}
+	if ebiten.IsKeyPressed(ebiten.KeyRight) {
+		e.camera.center.X += editorPanStep / e.camera.zoom
+	}
+	if ebiten.IsKeyPressed(ebiten.KeyUp) {
+		e.camera.center.Y -= editorPanStep / e.camera.zoom
+	}
+	if ebiten.IsKeyPressed(ebiten.KeyDown) {
+		e.camera.center.Y += editorPanStep / e.camera.zoom
+	}
+
+	left := ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft)
+	right := ebiten.IsMouseButtonPressed(ebiten.MouseButtonRight)
+	if !left && !right {
+		e.endStroke()
+		return nil
+	}
+	mx, my := ebiten.CursorPosition()
+	if my >= screenHeight-paletteTile {
+		if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+			if tile := mx / paletteTile; tile < e.paletteSize() {
+				e.tile = tile
+			}
+		}
+		return nil
+	}
+	index, ok := e.cellAt(mx, my)
+	if !ok {
+		return nil
+	}
+	switch {
+	case e.tool == toolCollision:
+		e.setSolid(index, left)
+	case e.tool == toolPaint && left:
+		e.setTile(index, e.tile)
+	default:
+		e.setTile(index, -1)
+	}
+	return nil
+}
+
+// cellAt returns the map index of the cell under a screen position.
+func (e *MapEditor) cellAt(x, y int) (int, bool) {
+	p := e.camera.worldAt(Vector2f{float64(x), float64(y)}, screenWidth, screenHeight)
+	if p.X < 0 || p.Y < 0 {
+		return 0, false
+	}
+	col, row := int(p.X/tileSize), int(p.Y/tileSize)
+	index := row*e.tileMap.Width + col
+	if col >= e.tileMap.Width || index >= e.tileMap.Cells() {
+		return 0, false
+	}
+	return index, true
+}
+
+func (e *MapEditor) setTile(index, tile int) {
+	if before := e.cell(e.layer, index); before != tile {
+		e.stroke.edits = append(e.stroke.edits, cellEdit{layer: e.layer, index: index, before: before, after: tile})
+		e.change(e.layer, index, tile)
+	}
+}
+
+func (e *MapEditor) setSolid(index int, solid bool) {
+	value := 0
+	if solid {
+		value = 1
+	}
+	if before := e.cell(collisionLayer, index); before != value {
+		e.stroke.edits = append(e.stroke.edits, cellEdit{layer: collisionLayer, index: index, before: before, after: value})
+		e.change(collisionLayer, index, value)
+	}
+}
+
+// cell reads a tile, or a collision flag for collisionLayer, treating cells
+// past the end of a short layer as empty.
+func (e *MapEditor) cell(layer, index int) int {
+	if layer == collisionLayer {
+		if e.tileMap.Solid(index) {
+			return 1
+		}
+		return 0
+	}
+	if tiles := e.tileMap.Layers[layer]; index < len(tiles) {
+		return tiles[index]
+	}
+	return -1
+}
+
+// change sets a cell this editor changed, sharing it when live.
+func (e *MapEditor) change(layer, index, value int) {
+	e.setCell(layer, index, value)
+	if e.link != nil {
+		edit := protocol.MapEdit{Layer: layer, Index: index, Value: value}
+		e.link.Send(protocol.KindMapEdit, protocol.EncodeMapEdit(edit))
+	}
+}
+
+func (e *MapEditor) setCell(layer, index, value int) {
+	if layer == len(e.tileMap.Layers) {
+		// Another editor painted on a layer it added.
+		e.tileMap.Layers = append(e.tileMap.Layers, nil)
+	}
+	if layer == collisionLayer {
+		for len(e.tileMap.Collision) <= index {
+			e.tileMap.Collision = append(e.tileMap.Collision, 0)
+		}
+		e.tileMap.Collision[index] = value
+		return
+	}
+	tiles := e.tileMap.Layers[layer]
+	for len(tiles) <= index {
+		tiles = append(tiles, -1)
+	}
+	tiles[index] = value
+	e.tileMap.Layers[layer] = tiles
+	e.renderer.Invalidate(index)
+}
+
+// endStroke files the cells changed since the mouse went down as one step.
+func (e *MapEditor) endStroke() {
+	if len(e.stroke.edits) == 0 {
+		return
+	}
+	e.history.Push(e.stroke)
+	e.stroke = editOp{}
+	e.changes++
+}
+
+// addLayer puts an empty layer on top and selects it.
+func (e *MapEditor) addLayer() {
+	e.endStroke()
+	e.pushLayer()
+	e.history.Push(editOp{addLayer: true})
+	e.changes++
+}
+
+func (e *MapEditor) pushLayer() {
+	layer := make([]int, e.tileMap.Cells())
+	for i := range layer {
+		layer[i] = -1
+	}
+	e.tileMap.Layers = append(e.tileMap.Layers, layer)
+	e.layer = len(e.tileMap.Layers) - 1
+}
+
+// popLayer removes the top layer. Chunks may have it baked in, so the
+// renderer starts over.
+func (e *MapEditor) popLayer() {
+	e.tileMap.Layers = e.tileMap.Layers[:len(e.tileMap.Layers)-1]
+	e.layer = min(e.layer, len(e.tileMap.Layers)-1)
+	e.renderer = NewTileRenderer(e.tileMap, e.tiles, e.scheduler)
+}
+
+func (e *MapEditor) undo() {
+	e.endStroke()
+	op, ok := e.history.Undo()
+	if !ok {
+		return
+	}
+	// A shared map keeps added layers, since other editors may be using
+	// them; undoing leaves the layer empty instead.
+	if op.addLayer && !e.live {
+		e.popLayer()
+	}
+	for i := len(op.edits) - 1; i >= 0; i-- {
+		edit := op.edits[i]
+		e.change(edit.layer, edit.index, edit.before)
+	}
+	e.changes++
+}
+
+func (e *MapEditor) redo() {
+	e.endStroke()
+	op, ok := e.history.Redo()
+	if !ok {
+		return
+	}
+	if op.addLayer && !e.live {
+		e.pushLayer()
+	}
+	for _, edit := range op.edits {
+		e.change(edit.layer, edit.index, edit.after)
+	}
+	e.changes++
+}
+
+func (e *MapEditor) save() {
+	e.endStroke()
+	if e.live {
+		if e.link != nil {
+			e.link.Send(protocol.KindMapSave, "")
+		}
+		return
+	}
+	if err := e.tileMap.Save(e.path); err != nil {
+		log.Println("Error saving map:", err)
+		e.status = T("editor.saveFailed", err)
+		return
+	}
+	e.history.MarkSaved()
+	e.autosaved = e.changes
+	if err := os.Remove(e.recoveryPath()); err != nil && !os.IsNotExist(err) {
+		log.Println("Error removing recovery file:", err)
+	}
+	e.status = T("editor.saved", e.path)
+}
+
+// autosave writes unsaved changes to the recovery file every
+// autosaveInterval. The map file itself is only written by an explicit save.
+func (e *MapEditor) autosave() {
+	if e.live || time.Since(e.lastAutosave) < autosaveInterval {
+		return
+	}
+	e.lastAutosave = time.Now()
+	if e.changes == e.autosaved || !e.history.Dirty() {
+		return
+	}
+	if err := e.tileMap.saveOver(e.path, e.recoveryPath()); err != nil {
+		log.Println("Error autosaving map:", err)
+		return
+	}
+	e.autosaved = e.changes
+	e.status = T("editor.autosaved", time.Now().Format("15:04:05"))
+}
+
+// restore replaces the map with the recovery file's layers and collision.
+// The history is cleared, since its steps describe the map being replaced.
+func (e *MapEditor) restore() {
+	if e.live {
+		return
+	}
+	e.endStroke()
+	recovered, err := LoadTileMap(e.recoveryPath())
+	if err != nil {
+		log.Println("Error loading recovery file:", err)
+		e.status = T("editor.restoreFailed", err)
+		return
+	}
+	if recovered.Width != e.tileMap.Width || len(recovered.Layers) == 0 {
+		e.status = T("editor.restoreFailed", "map size changed")
+		return
+	}
+	e.tileMap.Layers, e.tileMap.Collision = recovered.Layers, recovered.Collision
+	e.layer = min(e.layer, len(e.tileMap.Layers)-1)
+	e.renderer = NewTileRenderer(e.tileMap, e.tiles, e.scheduler)
+	e.history = EditHistory{savedAt: -1}
+	e.changes++
+	e.status = T("editor.restored", e.recoveryPath())
+}
+
+// drainLink applies what the server sent since the last frame. Edits are
+// applied even when they are this editor's own, echoed back: the server's
+// order is the one every editor ends up with.
+func (e *MapEditor) drainLink() {
+	if e.link == nil {
+		return
+	}
+	for {
+		select {
+		case msg, ok := <-e.link.inbox:
+			if !ok {
+				e.status = T("editor.disconnected")
+				e.link = nil
+				return
+			}
+			e.handleLinkMessage(msg)
+		default:
+			return
+		}
+	}
+}
+
+func (e *MapEditor) handleLinkMessage(msg netMessage) {
+	switch msg.kind {
+	case protocol.KindMapEdit:
+		edit, err := protocol.DecodeMapEdit(msg.payload)
+		if err != nil {
+			log.Println("Error decoding map edit:", err)
+			return
+		}
+		if edit.Layer < collisionLayer || edit.Layer > len(e.tileMap.Layers) || edit.Index >= e.tileMap.Cells() {
+			return
+		}
+		if edit.Layer == len(e.tileMap.Layers) || e.cell(edit.Layer, edit.Index) != edit.Value {
+			e.setCell(edit.Layer, edit.Index, edit.Value)
+		}
+	case protocol.KindMapCursor:
+		cursor, err := protocol.DecodeMapCursor(msg.payload)
+		if err != nil {
+			log.Println("Error decoding map cursor:", err)
+			return
+		}
+		e.cursors[cursor.ID] = Vector2f{cursor.X, cursor.Y}
+	case protocol.KindMapLeave:
+		delete(e.cursors, msg.payload)
+	case protocol.KindMapSave:
+		e.history.MarkSaved()
+		e.status = T("editor.saved", msg.payload)
+	case protocol.KindError:
+		e.status = msg.payload
+	}
+}
+
+// sendCursor tells the other editors where this one is pointing.
+func (e *MapEditor) sendCursor() {
+	if e.link == nil || time.Since(e.lastCursorSend) < cursorSendInterval {
+		return
+	}
+	mx, my := ebiten.CursorPosition()
+	p := e.camera.worldAt(Vector2f{float64(mx), float64(my)}, screenWidth, screenHeight)
+	if p == e.lastCursor {
+		return
+	}
+	e.lastCursor, e.lastCursorSend = p, time.Now()
+	e.link.Send(protocol.KindMapCursor, protocol.EncodeMapCursor(protocol.MapCursor{X: p.X, Y: p.Y}))
+}
+
+// updateTitle marks the window title while there are unsaved changes.
+func (e *MapEditor) updateTitle() {
+	dirty := e.history.Dirty()
+	if dirty == e.shownDirty {
+		return
+	}
+	e.shownDirty = dirty
+	title := fmt.Sprintf("%s - %s", T("editor.title"), e.path)
+	if dirty {
+		title += " *"
+	}
+	ebiten.SetWindowTitle(title)
+}
+
+func (e *MapEditor) Draw(screen *ebiten.Image) {
+	e.camera.Draw(screen, e.drawMap)
+	e.drawPalette(screen)
+
+	tool := T(editorToolNames[e.tool])
+	info := T("editor.info", tool, e.layer+1, len(e.tileMap.Layers), e.tile)
+	if e.history.Dirty() || len(e.stroke.edits) > 0 {
+		info += "   " + T("editor.unsaved")
+	}
+	drawText(screen, info+"\n"+T("editor.help")+"\n"+e.status, 8, 8, hudText)
+}
+
+func (e *MapEditor) drawMap(target *ebiten.Image, center Vector2f, width, height int) {
+	cameraOffset := Vector2f{
+		X: center.X - float64(width)/2,
+		Y: center.Y - float64(height)/2,
+	}
+	e.renderer.Draw(target, cameraOffset, 0)
+
+	for i := 0; i < e.tileMap.Cells(); i++ {
+		if !e.tileMap.Solid(i) {
+			continue
+		}
+		x := float64((i%e.tileMap.Width)*tileSize) - cameraOffset.X
+		y := float64((i/e.tileMap.Width)*tileSize) - cameraOffset.Y
+		vector.DrawFilledRect(target, float32(x), float32(y), tileSize, tileSize, debugSolid, false)
+		vector.StrokeRect(target, float32(x), float32(y), tileSize, tileSize, 1, debugSolidEdge, false)
+	}
+
+	mx, my := ebiten.CursorPosition()
+	if index, ok := e.cellAt(mx, my); ok {
+		x := float64((index%e.tileMap.Width)*tileSize) - cameraOffset.X
+		y := float64((index/e.tileMap.Width)*tileSize) - cameraOffset.Y
+		vector.StrokeRect(target, float32(x), float32(y), tileSize, tileSize, 2/float32(e.camera.zoom), editorCursor, false)
+	}
+	for id, cursor := range e.cursors {
+		at := toScreen(cursor, cameraOffset)
+		drawDebugCross(target, at, otherEditorCursor)
+		drawText(target, id, int(at.X)+debugMarker+2, int(at.Y)-debugMarker, tagText)
+	}
+}
+
+// drawPalette shows the tile sheet as a strip along the bottom of the
+// screen, outlining the selected tile.
+func (e *MapEditor) drawPalette(screen *ebiten.Image) {
+	y := screenHeight - paletteTile
+	vector.DrawFilledRect(screen, 0, float32(y), screenWidth, paletteTile, paletteBackground, false)
+	for tile := 0; tile < e.paletteSize() && tile*paletteTile < screenWidth; tile++ {
+		sx := (tile % tileSheetColumns) * tileSize
+		sy := (tile / tileSheetColumns) * tileSize
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Scale(float64(paletteTile)/tileSize, float64(paletteTile)/tileSize)
+		op.GeoM.Translate(float64(tile*paletteTile), float64(y))
+		op.Filter = ebiten.FilterLinear
+		screen.DrawImage(e.tiles.SubImage(image.Rect(sx, sy, sx+tileSize, sy+tileSize)).(*ebiten.Image), op)
+		if tile == e.tile {
+			vector.StrokeRect(screen, float32(tile*paletteTile)+1, float32(y)+1, paletteTile-2, paletteTile-2, 2, paletteSelected, false)
+		}
+	}
+}
+
+func (e *MapEditor) Layout(outsideWidth, outsideHeight int) (int, int) {
+	return screenWidth, screenHeight
+}
+
+// runEditor opens the map at path in the map editor.
+func runEditor(path string) error {
+	tiles, err := loadEditorAssets()
+	if err != nil {
+		return err
+	}
+	tileMap, err := LoadTileMap(path)
+	if err != nil {
+		return err
+	}
+	return startEditor(NewMapEditor(path, tileMap, tiles))
+}
+
+// runLiveEditor logs in to the server as account and edits its shared map
+// together with everyone else editing it.
+func runLiveEditor(server, account, password string) error {
+	if account == "" {
+		return errors.New("live map editing needs an account; set -name")
+	}
+	tiles, err := loadEditorAssets()
+	if err != nil {
+		return err
+	}
+	link, data, err := DialEditor(server, account, password)
+	if err != nil {
+		return fmt.Errorf("joining the shared map on %s: %w", server, err)
+	}
+	defer link.Close()
+
+	tileMap := &TileMap{Width: data.Width, Layers: data.Layers, Collision: data.Collision}
+	if tileMap.Width <= 0 {
+		return fmt.Errorf("shared map on %s has no width", server)
+	}
+	editor := NewMapEditor(server, tileMap, tiles)
+	editor.live, editor.link = true, link
+	return startEditor(editor)
+}
+
+// loadEditorAssets applies the saved language and loads the tile sheet.
+func loadEditorAssets() (*ebiten.Image, error) {
+	settings, err := LoadSettings(settingsPath())
+	if err != nil {
+		log.Println("Error loading settings, using defaults:", err)
+	}
+	if err := chooseLanguage(settings.Language); err != nil {
+		log.Println("Error loading language:", err)
+	}
+	tiles, _, err := ebitenutil.NewImageFromFile("assets/tiles.png")
+	return tiles, err
+}
+
+func startEditor(editor *MapEditor) error {
+	ebiten.SetWindowSize(screenWidth, screenHeight)
+	ebiten.SetWindowTitle(fmt.Sprintf("%s - %s", T("editor.title"), editor.path))
+	return ebiten.RunGame(editor)
+}
@@ -0,0 +1,74 @@
+package main
+
+// collisionLayer stands for the collision flags in a cellEdit's layer field.
+const collisionLayer = -1
+
+// editorHistoryLimit caps how many operations undo can walk back through.
+const editorHistoryLimit = 500
+
+// cellEdit is one cell change: a tile on a layer, or a collision flag when
+// layer is collisionLayer.
+type cellEdit struct {
+	layer, index  int
+	before, after int
+}
+
+// editOp is one undoable step: every cell changed during a single mouse
+// stroke, or the addition of a layer.
+type editOp struct {
+	edits    []cellEdit
+	addLayer bool
+}
+
+// EditHistory holds the map editor's undo and redo stacks. It also tracks
+// how far the undo stack reached at the last save, so undoing back to the
+// saved state clears the dirty mark.
+type EditHistory struct {
+	undo, redo []editOp
+	savedAt    int
+}
+
+// Push records a finished operation, dropping anything that could have been
+// redone.
+func (h *EditHistory) Push(op editOp) {
+	if h.savedAt > len(h.undo) {
+		// The saved state was on the redo branch being discarded.
+		h.savedAt = -1
+	}
+	h.undo = append(h.undo, op)
+	h.redo = h.redo[:0]
+	if len(h.undo) > editorHistoryLimit {
+		h.undo = h.undo[1:]
+		h.savedAt--
+	}
+}
+
+func (h *EditHistory) Undo() (editOp, bool) {
+	if len(h.undo) == 0 {
+		return editOp{}, false
+	}
+	op := h.undo[len(h.undo)-1]
+	h.undo = h.undo[:len(h.undo)-1]
+	h.redo = append(h.redo, op)
+	return op, true
+}
+
+func (h *EditHistory) Redo() (editOp, bool) {
+	if len(h.redo) == 0 {
+		return editOp{}, false
+	}
+	op := h.redo[len(h.redo)-1]
+	h.redo = h.redo[:len(h.redo)-1]
+	h.undo = append(h.undo, op)
+	return op, true
+}
+
+// MarkSaved records the current state as the one on disk.
+func (h *EditHistory) MarkSaved() {
+	h.savedAt = len(h.undo)
+}
+
+// Dirty reports whether the map differs from the last save.
+func (h *EditHistory) Dirty() bool {
+	return h.savedAt != len(h.undo)
+}
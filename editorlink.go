@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+// EditorLink connects the map editor to a server's shared map document.
+// Like the game's connection, a goroutine only reads lines and queues them;
+// the editor applies them in Update.
+type EditorLink struct {
+	conn  net.Conn
+	id    string
+	inbox chan netMessage
+}
+
+// DialEditor logs in to the server as account and joins its shared map,
+// returning once the document has arrived.
+func DialEditor(addr, account, password string) (*EditorLink, protocol.MapData, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, protocol.MapData{}, err
+	}
+	fmt.Fprint(conn, protocol.Line(protocol.KindLogin, protocol.EncodeLogin(account, password)))
+	fmt.Fprint(conn, protocol.Line(protocol.KindMapJoin, ""))
+
+	link := &EditorLink{conn: conn, inbox: make(chan netMessage, 256)}
+	reader := bufio.NewReader(conn)
+	for {
+		message, err := protocol.ReadLine(reader)
+		if err != nil {
+			conn.Close()
+			return nil, protocol.MapData{}, err
+		}
+		kind, payload := protocol.Split(message)
+		switch kind {
+		case protocol.KindWelcome:
+			link.id = payload
+		case protocol.KindError, protocol.KindKick:
+			conn.Close()
+			return nil, protocol.MapData{}, errors.New(payload)
+		case protocol.KindMapData:
+			data, err := protocol.DecodeMapData(payload)
+			if err != nil {
+				conn.Close()
+				return nil, protocol.MapData{}, err
+			}
+			go link.receive(reader)
+			return link, data, nil
+		}
+	}
+}
+
+func (l *EditorLink) receive(reader *bufio.Reader) {
+	defer close(l.inbox)
+	for {
+		message, err := protocol.ReadLine(reader)
+		if err != nil {
+			log.Println("Error reading from server:", err)
+			return
+		}
+		kind, payload := protocol.Split(message)
+		l.inbox <- netMessage{kind: kind, payload: payload}
+	}
+}
+
+func (l *EditorLink) Send(kind, payload string) {
+	if _, err := fmt.Fprint(l.conn, protocol.Line(kind, payload)); err != nil {
+		log.Println("Error sending to server:", err)
+	}
+}
+
+func (l *EditorLink) Close() error {
+	return l.conn.Close()
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+const (
+	// maxShake is the offset in pixels at full shake; trauma decays by
+	// shakeDecay per second and the offset grows with its square, so small
+	// hits barely move the view.
+	maxShake   = 12.0
+	shakeDecay = 1.5
+	flashDecay = 3.0
+	fadeSpeed  = 2.5
+	// maxEffectStep caps one update's time step, so a long stall (or the
+	// first frame after the character select) does not skip the effects.
+	maxEffectStep = 0.1
+	// sceneChangeDistance is how far a teleport must move the player to be
+	// treated as a scene change and faded in.
+	sceneChangeDistance = screenWidth
+)
+
+var vignette = newVignette(screenWidth, screenHeight, 0.45, 160)
+
+// newVignette darkens the image towards its corners, starting at inner (as
+// a fraction of the half-diagonal) and reaching maxAlpha at the corners.
+func newVignette(width, height int, inner float64, maxAlpha uint8) *ebiten.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	cx, cy := float64(width)/2, float64(height)/2
+	radius := math.Hypot(cx, cy)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			d := math.Hypot(float64(x)-cx, float64(y)-cy) / radius
+			if d <= inner {
+				continue
+			}
+			t := (d - inner) / (1 - inner)
+			img.SetRGBA(x, y, color.RGBA{0, 0, 0, uint8(float64(maxAlpha) * t * t)})
+		}
+	}
+	return ebiten.NewImageFromImage(img)
+}
+
+// ScreenEffects are applied to the rendered world as a post step: camera
+// shake, a full-screen flash, fades for scene changes and a vignette. They
+// are driven by bus events and advance on wall-clock time, so they last as
+// long at any frame or tick rate. The HUD is drawn on top, unaffected.
+type ScreenEffects struct {
+	trauma     float64
+	flash      float64
+	flashColor color.NRGBA
+	fade       float64
+	last       time.Time
+	frame      *ebiten.Image
+}
+
+// NewScreenEffects starts faded out, so the world fades in the first time
+// it is shown.
+func NewScreenEffects(events *EventBus) *ScreenEffects {
+	s := &ScreenEffects{fade: 1}
+	events.Subscribe(EventHitLanded, func(Event) {
+		s.Shake(0.35)
+	})
+	events.Subscribe(EventDied, func(Event) {
+		s.Shake(1)
+		s.Flash(color.NRGBA{200, 0, 0, 255})
+	})
+	events.Subscribe(EventTeleported, func(e Event) {
+		t := e.Payload.(Teleported)
+		if math.Hypot(t.Position.X-t.From.X, t.Position.Y-t.From.Y) >= sceneChangeDistance {
+			s.FadeIn()
+		}
+	})
+	return s
+}
+
+// Shake adds trauma in [0, 1]; repeated hits stack up to full shake.
+func (s *ScreenEffects) Shake(trauma float64) {
+	s.trauma = math.Min(1, s.trauma+trauma)
+}
+
+func (s *ScreenEffects) Flash(c color.NRGBA) {
+	s.flash, s.flashColor = 1, c
+}
+
+// FadeIn starts from black and fades the world in.
+func (s *ScreenEffects) FadeIn() {
+	s.fade = 1
+}
+
+func (s *ScreenEffects) Update() {
+	now := time.Now()
+	dt := 0.0
+	if !s.last.IsZero() {
+		dt = math.Min(now.Sub(s.last).Seconds(), maxEffectStep)
+	}
+	s.last = now
+
+	s.trauma = math.Max(0, s.trauma-shakeDecay*dt)
+	s.flash = math.Max(0, s.flash-flashDecay*dt)
+	s.fade = math.Max(0, s.fade-fadeSpeed*dt)
+}
+
+// Draw renders the world through drawWorld into an offscreen frame and
+// composites it onto screen with the current effects.
+func (s *ScreenEffects) Draw(screen *ebiten.Image, drawWorld func(target *ebiten.Image)) {
+	width, height := screen.Bounds().Dx(), screen.Bounds().Dy()
+	if s.frame == nil || s.frame.Bounds().Dx() != width || s.frame.Bounds().Dy() != height {
+		if s.frame != nil {
+			s.frame.Deallocate()
+		}
+		s.frame = ebiten.NewImage(width, height)
+	}
+	s.frame.Clear()
+	drawWorld(s.frame)
+
+	op := &ebiten.DrawImageOptions{}
+	if s.trauma > 0 {
+		shake := maxShake * s.trauma * s.trauma
+		op.GeoM.Translate(shake*(rand.Float64()*2-1), shake*(rand.Float64()*2-1))
+	}
+	screen.DrawImage(s.frame, op)
+
+	screen.DrawImage(vignette, nil)
+	if s.flash > 0 {
+		c := s.flashColor
+		c.A = uint8(float64(c.A) * s.flash * 0.6)
+		vector.DrawFilledRect(screen, 0, 0, float32(width), float32(height), c, false)
+	}
+	if s.fade > 0 {
+		vector.DrawFilledRect(screen, 0, 0, float32(width), float32(height), color.RGBA{0, 0, 0, uint8(255 * s.fade)}, false)
+	}
+}
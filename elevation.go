@@ -0,0 +1,34 @@
+package main
+
+import "darkzone/MultiTestServer/protocol"
+
+// levelBlocker is the world as a player at level sees it while stepping
+// out of a cell of elevation from: cells their level keeps them out of
+// block them like walls.
+type levelBlocker struct {
+	world Blocker
+	tiles *TileMap
+	from  protocol.Elevation
+	level int
+}
+
+func (b levelBlocker) Blocked(x, y float64) bool {
+	return b.world.Blocked(x, y) || !protocol.CanEnter(b.from, b.tiles.ElevationAt(x, y), b.level)
+}
+
+// walker is the world as the local player sees it where they stand.
+func (g *Game) walker(local *LocalPlayer) levelBlocker {
+	return g.walkerAt(local.position, local.level)
+}
+
+func (g *Game) walkerAt(position Vector2f, level int) levelBlocker {
+	return levelBlocker{world: g, tiles: g.tileMap, from: g.tileMap.ElevationAt(position.X, position.Y), level: level}
+}
+
+// climb changes the local player's level as they step off a ramp, after a
+// move from from.
+func (g *Game) climb(local *LocalPlayer, from Vector2f) {
+	before := g.tileMap.ElevationAt(from.X, from.Y)
+	after := g.tileMap.ElevationAt(local.position.X, local.position.Y)
+	local.level = protocol.Climb(before, after, local.level)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"image/color"
+	"math"
+	"time"
+
+	"darkzone/MultiTestServer/protocol"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+const (
+	itemSize     = 12
+	resourceSize = 24
+)
+
+// resourceColors tints resource nodes by name; other names are brown.
+var resourceColors = map[string]color.RGBA{
+	"tree": {40, 140, 60, 255},
+	"rock": {130, 130, 140, 255},
+	"bush": {90, 170, 80, 255},
+}
+
+type WorldEntity struct {
+	protocol.Entity
+	character *Character
+	// gathering shakes a resource node while the local player gathers
+	// from it; open is whether a door is open.
+	gathering bool
+	open      bool
+	// sinceMove is the time since the entity's last move went to the
+	// server and moved whether it has moved since, while a local player
+	// owns it.
+	sinceMove float64
+	moved     bool
+	// steer is where the local player driving a vehicle steers it.
+	steer Vector2f
+}
+
+func NewWorldEntity(e protocol.Entity, bodyTexture, headTexture *ebiten.Image) *WorldEntity {
+	w := &WorldEntity{Entity: e}
+	if e.Kind == protocol.EntityNPC {
+		w.character = NewCharacter(bodyTexture, headTexture, Vector2f{e.X, e.Y})
+		w.character.direction = 2
+	}
+	return w
+}
+
+func (w *WorldEntity) Draw(screen *ebiten.Image, cameraOffset Vector2f) {
+	x, y := w.X-cameraOffset.X, w.Y-cameraOffset.Y
+	if w.character != nil {
+		w.character.Draw(screen, cameraOffset)
+		drawText(screen, w.Name, int(x), int(y)-32, tagText)
+		return
+	}
+
+	if w.Kind == protocol.EntityVehicle {
+		w.drawVehicle(screen, x, y)
+		drawText(screen, w.Name, int(x), int(y)-16, tagText)
+		return
+	}
+
+	if w.Kind == protocol.EntityDoor {
+		w.drawDoor(screen, x, y)
+		drawText(screen, w.Name, int(x), int(y)-16, tagText)
+		return
+	}
+
+	if w.Kind == protocol.EntityResource {
+		tint, ok := resourceColors[w.Name]
+		if !ok {
+			tint = color.RGBA{140, 100, 60, 255}
+		}
+		if w.gathering {
+			x += math.Sin(float64(time.Now().UnixMilli())/40) * 2
+		}
+		if w.drawSprite(screen, x, y) {
+			drawText(screen, w.Name, int(x), int(y)-16, tagText)
+			return
+		}
+		vector.DrawFilledRect(screen, float32(x), float32(y), resourceSize, resourceSize, tint, false)
+		drawText(screen, w.Name, int(x), int(y)-16, tagText)
+		return
+	}
+
+	if !w.drawSprite(screen, x, y) {
+		vector.DrawFilledRect(screen, float32(x), float32(y), itemSize, itemSize, color.RGBA{240, 200, 60, 255}, false)
+	}
+	drawText(screen, w.Name, int(x), int(y)-16, tagText)
+}
+
+// drawSprite draws the entity's sprite from the atlas, named by its kind and
+// name such as "item/torch", with its top-left at x, y on screen. It
+// reports false when the atlas has no sprite for it.
+func (w *WorldEntity) drawSprite(screen *ebiten.Image, x, y float64) bool {
+	sprite, ok := sprites.Sprite(w.Kind + "/" + w.Name)
+	if !ok {
+		return false
+	}
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Translate(x, y)
+	screen.DrawImage(sprite, op)
+	return true
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"sync"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+type EventType int
+
+const (
+	EventPlayerJoined EventType = iota
+	EventDamageTaken
+	EventItemPickedUp
+	EventLocalMoved
+	EventChatSent
+	EventDied
+	EventDisconnected
+	EventChatReceived
+	EventTeleported
+	EventWeatherChanged
+	EventPlayerLeft
+	EventKicked
+	EventSnapshotReceived
+	EventEntitySpawned
+	EventEntityDespawned
+	EventLeaderboardReceived
+	EventHitLanded
+	EventPartyChanged
+	EventQuestOffered
+	EventQuestUpdated
+	EventDialogueChanged
+	EventShopChanged
+	EventRecipesReceived
+	EventInventoryChanged
+	EventCraftUpdated
+	EventGatherUpdated
+	EventResourceHarvested
+	EventStatusChanged
+	EventDoorChanged
+	EventAreaChanged
+	EventFeedReceived
+	EventMatchUpdated
+	EventMatchEnded
+	EventMatchPhaseChanged
+	EventPauseChanged
+	EventAmbientChanged
+	EventVisionChanged
+	EventMOTDReceived
+	EventResyncReceived
+	EventReconnecting
+	EventReconnected
+	EventSeatChanged
+	EventFootstep
+)
+
+type Event struct {
+	Type    EventType
+	Payload any
+}
+
+type PlayerJoined struct {
+	ID string
+}
+
+type PlayerLeft struct {
+	ID string
+}
+
+type DamageTaken struct {
+	Amount int
+	Source string
+}
+
+type ItemPickedUp struct {
+	Item  string
+	Count int
+}
+
+type LocalMoved struct {
+	Distance float64
+}
+
+type ChatSent struct {
+	Text string
+}
+
+type ChatReceived struct {
+	Channel string
+	From    string
+	Text    string
+}
+
+type Teleported struct {
+	Player   *LocalPlayer
+	From     Vector2f
+	Position Vector2f
+}
+
+type WeatherChanged struct {
+	Weather protocol.Weather
+}
+
+type Died struct {
+	Killer string
+	// Seconds is how long until the player respawns.
+	Seconds float64
+}
+
+type HitLanded struct {
+	Target string
+}
+
+type Disconnected struct {
+	Err error
+}
+
+type Kicked struct {
+	Reason string
+}
+
+// Reconnecting is published before each attempt to reconnect a player
+// whose connection dropped, counting from 1.
+type Reconnecting struct {
+	Local   *LocalPlayer
+	Attempt int
+}
+
+type Reconnected struct {
+	Local *LocalPlayer
+}
+
+type SeatChanged struct {
+	Change protocol.SeatChange
+}
+
+// Footstep is published as a character's foot comes down, at where it
+// lands, for the ground to take a print of it. Angle is the way they were
+// going, in radians.
+type Footstep struct {
+	Position Vector2f
+	Angle    float64
+	Terrain  protocol.Terrain
+}
+
+type ResyncReceived struct {
+	Resync protocol.Resync
+}
+
+type SnapshotReceived struct {
+	Snapshot protocol.Snapshot
+}
+
+type EntitySpawned struct {
+	Entity protocol.Entity
+}
+
+type EntityDespawned struct {
+	ID string
+}
+
+type LeaderboardReceived struct {
+	Stat    string
+	Entries []protocol.LeaderboardEntry
+}
+
+// PartyChanged carries the local player's party; Members is empty when
+// they are in none.
+type PartyChanged struct {
+	Members []protocol.PartyMember
+}
+
+type QuestOffered struct {
+	Offer protocol.QuestOffer
+}
+
+type QuestUpdated struct {
+	Status protocol.QuestStatus
+}
+
+// DialogueChanged carries the NPC line to show; Line is nil when the
+// conversation is over.
+type DialogueChanged struct {
+	Line *protocol.DialogueLine
+}
+
+// ShopChanged carries the vendor shop to show; Shop is nil once it closes.
+type ShopChanged struct {
+	Shop *protocol.Shop
+}
+
+type RecipesReceived struct {
+	Recipes []protocol.Recipe
+}
+
+type InventoryChanged struct {
+	Inventory map[string]int
+}
+
+type CraftUpdated struct {
+	Status protocol.CraftStatus
+}
+
+type GatherUpdated struct {
+	Status protocol.GatherStatus
+}
+
+type ResourceHarvested struct {
+	ID string
+}
+
+type StatusChanged struct {
+	Status protocol.StatusEffects
+}
+
+type DoorChanged struct {
+	ID   string
+	Open bool
+}
+
+type AreaChanged struct {
+	Area string
+}
+
+type FeedReceived struct {
+	Event protocol.FeedEvent
+}
+
+type MatchUpdated struct {
+	Status protocol.MatchStatus
+}
+
+type MatchEnded struct {
+	Results protocol.MatchResults
+}
+
+type MatchPhaseChanged struct {
+	Phase protocol.MatchPhase
+}
+
+type PauseChanged struct {
+	Status protocol.PauseStatus
+}
+
+type AmbientChanged struct {
+	Ambient protocol.Ambient
+}
+
+type VisionChanged struct {
+	Vision protocol.Vision
+}
+
+type MOTDReceived struct {
+	MOTD protocol.MOTD
+}
+
+// EventBus decouples the network layer from client systems: the receive side
+// only decodes messages and publishes them, and the world, UI and session
+// tracking each subscribe to what they need. Events may be
+// published from any goroutine; handlers only run from Dispatch, which the
+// game calls once per Update so subscribers never need their own locking.
+type EventBus struct {
+	mu       sync.Mutex
+	handlers map[EventType][]func(Event)
+	pending  []Event
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{
+		handlers: make(map[EventType][]func(Event)),
+	}
+}
+
+func (b *EventBus) Subscribe(eventType EventType, handler func(Event)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.handlers[eventType] = append(b.handlers[eventType], handler)
+}
+
+func (b *EventBus) Publish(eventType EventType, payload any) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.pending = append(b.pending, Event{Type: eventType, Payload: payload})
+}
+
+func (b *EventBus) Dispatch() {
+	b.mu.Lock()
+	events := b.pending
+	b.pending = nil
+	b.mu.Unlock()
+
+	for _, event := range events {
+		b.mu.Lock()
+		handlers := b.handlers[event.Type]
+		b.mu.Unlock()
+
+		for _, handler := range handlers {
+			handler(event)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"image/color"
+
+	"darkzone/MultiTestServer/protocol"
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+const (
+	// Each feed entry shows for feedSeconds, fading out over the last
+	// feedFade of them, and at most feedLines show at once.
+	feedSeconds = 6.0
+	feedFade    = 1.5
+	feedLines   = 5
+	// The feed sits in the top-left corner, under the area badge.
+	feedX, feedY  = 8, 32
+	feedRowHeight = 18
+)
+
+var feedBack = color.RGBA{0, 0, 0, 140}
+
+type feedEntry struct {
+	// line is the entry's text, printed once so it can be drawn faded.
+	line *ebiten.Image
+	age  float64
+}
+
+// EventFeed lists what the server announces, such as defeats and players
+// coming and going, apart from chat, the newest entry at the bottom.
+type EventFeed struct {
+	entries []*feedEntry
+}
+
+func NewEventFeed(events *EventBus) *EventFeed {
+	f := &EventFeed{}
+	events.Subscribe(EventFeedReceived, func(e Event) {
+		f.add(feedText(e.Payload.(FeedReceived).Event))
+	})
+	return f
+}
+
+func feedText(e protocol.FeedEvent) string {
+	if e.Kind == protocol.FeedAnnounce {
+		return e.Text
+	}
+	args := []any{e.Player}
+	if e.Other != "" {
+		args = append(args, e.Other)
+	}
+	return T("feed."+e.Kind, args...)
+}
+
+func (f *EventFeed) add(text string) {
+	line := ebiten.NewImage(int(textWidth(text, hudText))+8, feedRowHeight-2)
+	line.Fill(feedBack)
+	drawText(line, text, 4, 0, hudText)
+	f.entries = append(f.entries, &feedEntry{line: line})
+	if len(f.entries) > feedLines {
+		f.entries = f.entries[len(f.entries)-feedLines:]
+	}
+}
+
+func (f *EventFeed) Update(deltaTime float64) {
+	kept := f.entries[:0]
+	for _, e := range f.entries {
+		if e.age += deltaTime; e.age < feedSeconds {
+			kept = append(kept, e)
+		}
+	}
+	f.entries = kept
+}
+
+func (f *EventFeed) Draw(screen *ebiten.Image) {
+	for i, e := range f.entries {
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Translate(feedX, float64(feedY+i*feedRowHeight))
+		op.ColorScale.ScaleAlpha(float32(min(1, (feedSeconds-e.age)/feedFade)))
+		screen.DrawImage(e.line, op)
+	}
+}
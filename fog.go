@@ -0,0 +1,114 @@
+package main
+
+import (
+	"image/color"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+var (
+	unexploredColor = color.RGBA{0, 0, 0, 255}
+	exploredColor   = color.RGBA{0, 0, 0, 150}
+)
+
+// FogOfWar hides the map cells the player has never seen and dims those
+// they have seen but cannot see now, when the server gives players a
+// vision radius. The player sees the cells within the radius of
+// themselves and of their party members, whose positions the server
+// sends along with it. Remote players out of sight are not drawn.
+type FogOfWar struct {
+	radius   float64
+	allies   []Vector2f
+	viewers  []Vector2f
+	explored map[[2]int]bool
+}
+
+func NewFogOfWar(events *EventBus) *FogOfWar {
+	f := &FogOfWar{explored: make(map[[2]int]bool)}
+	events.Subscribe(EventVisionChanged, func(e Event) {
+		vision := e.Payload.(VisionChanged).Vision
+		if vision.Radius <= 0 {
+			clear(f.explored)
+		}
+		f.radius = vision.Radius
+		f.allies = f.allies[:0]
+		for _, a := range vision.Allies {
+			f.allies = append(f.allies, spriteCenter(Vector2f{X: a[0], Y: a[1]}))
+		}
+	})
+	return f
+}
+
+// Active reports whether the server has the fog of war on.
+func (f *FogOfWar) Active() bool {
+	return f.radius > 0
+}
+
+// Update sees from the local players' positions and the party's, and
+// marks everything they see explored.
+func (f *FogOfWar) Update(locals []*LocalPlayer) {
+	if !f.Active() {
+		return
+	}
+	f.viewers = f.viewers[:0]
+	for _, local := range locals {
+		f.viewers = append(f.viewers, spriteCenter(local.position))
+	}
+	f.viewers = append(f.viewers, f.allies...)
+
+	reach := int(math.Ceil(f.radius / tileSize))
+	for _, v := range f.viewers {
+		col, row := int(math.Floor(v.X/tileSize)), int(math.Floor(v.Y/tileSize))
+		for r := row - reach; r <= row+reach; r++ {
+			for c := col - reach; c <= col+reach; c++ {
+				if f.cellVisible(c, r) {
+					f.explored[[2]int{c, r}] = true
+				}
+			}
+		}
+	}
+}
+
+// Visible reports whether the world position p is in sight; everything is
+// when the fog is off.
+func (f *FogOfWar) Visible(p Vector2f) bool {
+	if !f.Active() {
+		return true
+	}
+	for _, v := range f.viewers {
+		if math.Hypot(p.X-v.X, p.Y-v.Y) <= f.radius {
+			return true
+		}
+	}
+	return false
+}
+
+// cellVisible reports whether the center of the cell is in sight.
+func (f *FogOfWar) cellVisible(col, row int) bool {
+	return f.Visible(Vector2f{X: (float64(col) + 0.5) * tileSize, Y: (float64(row) + 0.5) * tileSize})
+}
+
+// Draw covers the cells of a view, width by height with its top-left at
+// cameraOffset in the world, that are out of sight.
+func (f *FogOfWar) Draw(target *ebiten.Image, cameraOffset Vector2f, width, height int) {
+	if !f.Active() {
+		return
+	}
+	col0, row0 := int(math.Floor(cameraOffset.X/tileSize)), int(math.Floor(cameraOffset.Y/tileSize))
+	col1, row1 := int(math.Floor((cameraOffset.X+float64(width))/tileSize)), int(math.Floor((cameraOffset.Y+float64(height))/tileSize))
+	for row := row0; row <= row1; row++ {
+		for col := col0; col <= col1; col++ {
+			if f.cellVisible(col, row) {
+				continue
+			}
+			fog := unexploredColor
+			if f.explored[[2]int{col, row}] {
+				fog = exploredColor
+			}
+			x, y := float64(col*tileSize)-cameraOffset.X, float64(row*tileSize)-cameraOffset.Y
+			vector.DrawFilledRect(target, float32(x), float32(y), tileSize, tileSize, fog, false)
+		}
+	}
+}
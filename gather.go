@@ -0,0 +1,77 @@
+package main
+
+import (
+	"darkzone/MultiTestServer/protocol"
+	"darkzone/MultiTestServer/spatial"
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+const harvestBurst = 24
+
+// Gathering shows the local player's channel on a resource node: the node
+// shakes and sheds chips while a progress bar fills above the crafting bar,
+// and it bursts apart when anyone empties it.
+type Gathering struct {
+	entities *spatial.Grid[string, *WorldEntity]
+	chips    *Emitter
+	// node is the node being gathered from, elapsed of its seconds along.
+	node    string
+	elapsed float64
+	seconds float64
+}
+
+func NewGathering(events *EventBus, particles *ParticleSystem, entities *spatial.Grid[string, *WorldEntity]) *Gathering {
+	g := &Gathering{
+		entities: entities,
+		chips:    particles.Add(NewEmitter(ChipsEmitterConfig(), Vector2f{})),
+	}
+	g.chips.Active = false
+	events.Subscribe(EventGatherUpdated, func(e Event) {
+		g.update(e.Payload.(GatherUpdated).Status)
+	})
+	events.Subscribe(EventResourceHarvested, func(e Event) {
+		if node, ok := entities.Get(e.Payload.(ResourceHarvested).ID); ok {
+			g.chips.Position = nodeCenter(node)
+			g.chips.Burst(harvestBurst)
+		}
+	})
+	return g
+}
+
+func (g *Gathering) update(status protocol.GatherStatus) {
+	if node, ok := g.entities.Get(g.node); ok {
+		node.gathering = false
+	}
+	g.node, g.chips.Active = "", false
+	if status.Done || status.Cancelled {
+		return
+	}
+	node, ok := g.entities.Get(status.ID)
+	if !ok {
+		return
+	}
+	node.gathering = true
+	g.node, g.elapsed, g.seconds = status.ID, 0, status.Seconds
+	g.chips.Position, g.chips.Active = nodeCenter(node), true
+}
+
+func nodeCenter(node *WorldEntity) Vector2f {
+	return Vector2f{node.X + resourceSize/2, node.Y + resourceSize/2}
+}
+
+func (g *Gathering) Update(deltaTime float64) {
+	if g.node != "" {
+		g.elapsed = min(g.elapsed+deltaTime, g.seconds)
+	}
+}
+
+func (g *Gathering) Draw(screen *ebiten.Image) {
+	if g.node == "" {
+		return
+	}
+	name := g.node
+	if node, ok := g.entities.Get(g.node); ok {
+		name = node.Name
+	}
+	drawProgressBar(screen, T("gather.progress", name), g.elapsed, g.seconds, hudHeight-chatLineGap*12)
+}
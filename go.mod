@@ -2,13 +2,24 @@ module darkzone/MultiTest
 
 go 1.23.2
 
-require github.com/hajimehoshi/ebiten/v2 v2.8.1
+require (
+	darkzone/MultiTestServer v0.0.0
+	github.com/hajimehoshi/ebiten/v2 v2.8.1
+	golang.org/x/image v0.20.0
+)
 
 require (
 	github.com/ebitengine/gomobile v0.0.0-20240911145611-4856209ac325 // indirect
 	github.com/ebitengine/hideconsole v1.0.0 // indirect
+	github.com/ebitengine/oto/v3 v3.3.1 // indirect
 	github.com/ebitengine/purego v0.8.0 // indirect
+	github.com/go-text/typesetting v0.2.0 // indirect
 	github.com/jezek/xgb v1.1.1 // indirect
-	golang.org/x/sync v0.8.0 // indirect
-	golang.org/x/sys v0.25.0 // indirect
+	go.starlark.net v0.0.0-20241125201518-c05ff208a98f // indirect
+	golang.org/x/crypto v0.31.0 // indirect
+	golang.org/x/sync v0.10.0 // indirect
+	golang.org/x/sys v0.28.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
 )
+
+replace darkzone/MultiTestServer => ./server
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	languageDir = "assets/lang"
+	// defaultLanguage is what every other language falls back to for the
+	// strings it does not translate yet.
+	defaultLanguage = "en"
+)
+
+// Catalog holds one language's user-facing strings, keyed by message ID.
+// The values are fmt formats.
+type Catalog struct {
+	Language string
+	messages map[string]string
+	fallback *Catalog
+}
+
+// catalog is the language the client currently draws in. Until a language
+// is loaded, T returns the message IDs themselves.
+var catalog = &Catalog{Language: defaultLanguage}
+
+// T formats the message with the given ID in the current language.
+func T(id string, args ...any) string {
+	return catalog.T(id, args...)
+}
+
+func (c *Catalog) T(id string, args ...any) string {
+	for ; c != nil; c = c.fallback {
+		if format, ok := c.messages[id]; ok {
+			return fmt.Sprintf(format, args...)
+		}
+	}
+	return id
+}
+
+// LoadCatalog reads dir/<language>.json, backed by the default language.
+func LoadCatalog(dir, language string) (*Catalog, error) {
+	c, err := readCatalog(dir, language)
+	if err != nil || language == defaultLanguage {
+		return c, err
+	}
+	if c.fallback, err = readCatalog(dir, defaultLanguage); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func readCatalog(dir, language string) (*Catalog, error) {
+	data, err := os.ReadFile(filepath.Join(dir, language+".json"))
+	if err != nil {
+		return nil, err
+	}
+	c := &Catalog{Language: language}
+	if err := json.Unmarshal(data, &c.messages); err != nil {
+		return nil, fmt.Errorf("language %s: %w", language, err)
+	}
+	return c, nil
+}
+
+// SetLanguage makes language the current one.
+func SetLanguage(language string) error {
+	c, err := LoadCatalog(languageDir, language)
+	if err != nil {
+		return err
+	}
+	catalog = c
+	return nil
+}
+
+// Languages lists the languages with a file in dir, sorted.
+func Languages(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	languages := make([]string, len(files))
+	for i, f := range files {
+		languages[i] = strings.TrimSuffix(filepath.Base(f), ".json")
+	}
+	sort.Strings(languages)
+	return languages, nil
+}
+
+// nextLanguage returns the language after the current one, wrapping around.
+func nextLanguage() (string, error) {
+	languages, err := Languages(languageDir)
+	if err != nil {
+		return "", err
+	}
+	for i, l := range languages {
+		if l == catalog.Language {
+			return languages[(i+1)%len(languages)], nil
+		}
+	}
+	if len(languages) == 0 {
+		return "", fmt.Errorf("no languages in %s", languageDir)
+	}
+	return languages[0], nil
+}
+
+// baseLanguage reduces a locale such as "de_DE.UTF-8" or "en-US" to its
+// language code.
+func baseLanguage(locale string) string {
+	locale = strings.ToLower(locale)
+	if i := strings.IndexAny(locale, "_-.@"); i >= 0 {
+		locale = locale[:i]
+	}
+	return locale
+}
+
+// chooseLanguage loads the configured language, then the OS one, then the
+// default, keeping the first that exists.
+func chooseLanguage(configured string) error {
+	var err error
+	for _, language := range []string{configured, baseLanguage(systemLocale()), defaultLanguage} {
+		if language == "" || language == "c" || language == "posix" {
+			continue
+		}
+		if err = SetLanguage(language); err == nil {
+			return nil
+		}
+	}
+	return err
+}
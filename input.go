@@ -0,0 +1,127 @@
+package main
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+const gamepadDeadZone = 0.25
+
+// InputSource reports a movement intent in the range [-1, 1] on each axis
+// and whether the attack or dash action was triggered this frame.
+type InputSource interface {
+	Movement() Vector2f
+	AttackPressed() bool
+	DashPressed() bool
+}
+
+type KeyboardInput struct {
+	Up, Down, Left, Right, Attack, Dash ebiten.Key
+}
+
+func ArrowKeys() KeyboardInput {
+	return KeyboardInput{Up: ebiten.KeyUp, Down: ebiten.KeyDown, Left: ebiten.KeyLeft, Right: ebiten.KeyRight, Attack: ebiten.KeySpace, Dash: ebiten.KeyShiftRight}
+}
+
+func WASDKeys() KeyboardInput {
+	return KeyboardInput{Up: ebiten.KeyW, Down: ebiten.KeyS, Left: ebiten.KeyA, Right: ebiten.KeyD, Attack: ebiten.KeyF, Dash: ebiten.KeyG}
+}
+
+func (k KeyboardInput) AttackPressed() bool {
+	return inpututil.IsKeyJustPressed(k.Attack)
+}
+
+func (k KeyboardInput) DashPressed() bool {
+	return inpututil.IsKeyJustPressed(k.Dash)
+}
+
+func (k KeyboardInput) Movement() Vector2f {
+	movement := Vector2f{0, 0}
+	if ebiten.IsKeyPressed(k.Up) {
+		movement.Y--
+	}
+	if ebiten.IsKeyPressed(k.Down) {
+		movement.Y++
+	}
+	if ebiten.IsKeyPressed(k.Left) {
+		movement.X--
+	}
+	if ebiten.IsKeyPressed(k.Right) {
+		movement.X++
+	}
+	return movement
+}
+
+// GamepadInput reads the first connected gamepad that is not already claimed
+// and falls back to the given keys when no gamepad is plugged in.
+type GamepadInput struct {
+	Index    int
+	Fallback KeyboardInput
+	ids      []ebiten.GamepadID
+}
+
+func (p *GamepadInput) gamepad() (ebiten.GamepadID, bool) {
+	p.ids = ebiten.AppendGamepadIDs(p.ids[:0])
+	if p.Index >= len(p.ids) {
+		return 0, false
+	}
+	return p.ids[p.Index], true
+}
+
+func (p *GamepadInput) AttackPressed() bool {
+	id, ok := p.gamepad()
+	if !ok {
+		return p.Fallback.AttackPressed()
+	}
+	if ebiten.IsStandardGamepadLayoutAvailable(id) {
+		return inpututil.IsStandardGamepadButtonJustPressed(id, ebiten.StandardGamepadButtonRightBottom)
+	}
+	return inpututil.IsGamepadButtonJustPressed(id, ebiten.GamepadButton0)
+}
+
+func (p *GamepadInput) DashPressed() bool {
+	id, ok := p.gamepad()
+	if !ok {
+		return p.Fallback.DashPressed()
+	}
+	if ebiten.IsStandardGamepadLayoutAvailable(id) {
+		return inpututil.IsStandardGamepadButtonJustPressed(id, ebiten.StandardGamepadButtonRightRight)
+	}
+	return inpututil.IsGamepadButtonJustPressed(id, ebiten.GamepadButton1)
+}
+
+func (p *GamepadInput) Movement() Vector2f {
+	id, ok := p.gamepad()
+	if !ok {
+		return p.Fallback.Movement()
+	}
+
+	movement := Vector2f{0, 0}
+	if ebiten.IsStandardGamepadLayoutAvailable(id) {
+		movement.X = ebiten.StandardGamepadAxisValue(id, ebiten.StandardGamepadAxisLeftStickHorizontal)
+		movement.Y = ebiten.StandardGamepadAxisValue(id, ebiten.StandardGamepadAxisLeftStickVertical)
+		if ebiten.IsStandardGamepadButtonPressed(id, ebiten.StandardGamepadButtonLeftTop) {
+			movement.Y = -1
+		}
+		if ebiten.IsStandardGamepadButtonPressed(id, ebiten.StandardGamepadButtonLeftBottom) {
+			movement.Y = 1
+		}
+		if ebiten.IsStandardGamepadButtonPressed(id, ebiten.StandardGamepadButtonLeftLeft) {
+			movement.X = -1
+		}
+		if ebiten.IsStandardGamepadButtonPressed(id, ebiten.StandardGamepadButtonLeftRight) {
+			movement.X = 1
+		}
+	} else if ebiten.GamepadAxisCount(id) >= 2 {
+		movement.X = ebiten.GamepadAxisValue(id, 0)
+		movement.Y = ebiten.GamepadAxisValue(id, 1)
+	}
+
+	if movement.X > -gamepadDeadZone && movement.X < gamepadDeadZone {
+		movement.X = 0
+	}
+	if movement.Y > -gamepadDeadZone && movement.Y < gamepadDeadZone {
+		movement.Y = 0
+	}
+	return movement
+}
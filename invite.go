@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// inviteScheme is the URI scheme of invite links, such as
+// darkzone://example.com:8080/arena. Registering it with the OS so that
+// opening a link launches the client with the URI as its argument is left
+// to the installer.
+const inviteScheme = "darkzone"
+
+// Invite is where an invite link points: a server and optionally a room to
+// join once the player is in the world.
+type Invite struct {
+	Server string
+	Room   string
+}
+
+// ParseInvite accepts an invite URI or the "host:port[:room]" shorthand used
+// by -connect.
+func ParseInvite(s string) (Invite, error) {
+	if strings.HasPrefix(s, inviteScheme+"://") {
+		u, err := url.Parse(s)
+		if err != nil {
+			return Invite{}, fmt.Errorf("invite link: %w", err)
+		}
+		if u.Host == "" {
+			return Invite{}, errors.New("invite link has no server")
+		}
+		return Invite{Server: serverAddress(u.Host), Room: strings.Trim(u.Path, "/")}, nil
+	}
+	if s == "" {
+		return Invite{}, errors.New("invite has no server")
+	}
+
+	// A trailing ":room" is only split off when what comes before it is a
+	// complete host:port, so bare IPv6 literals keep all their colons.
+	if i := strings.LastIndex(s, ":"); i > 0 {
+		if _, port, err := net.SplitHostPort(s[:i]); err == nil {
+			if _, err := strconv.Atoi(port); err == nil {
+				return Invite{Server: serverAddress(s[:i]), Room: s[i+1:]}, nil
+			}
+		}
+	}
+	return Invite{Server: serverAddress(s)}, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"darkzone/MultiTestServer/protocol"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+// leaderboardRefresh is how often an open leaderboard asks for fresh data.
+const leaderboardRefresh = 5.0
+
+var leaderboardStats = []string{"score", "rating", "xp", "gold", "kills", "deaths", "playtime", "distance"}
+
+// Leaderboard is the in-game ranking screen, toggled with L. Tab cycles the
+// stat it ranks by.
+type Leaderboard struct {
+	open    bool
+	stat    int
+	shown   string
+	entries []protocol.LeaderboardEntry
+	refresh float64
+}
+
+func NewLeaderboard(events *EventBus) *Leaderboard {
+	l := &Leaderboard{}
+	events.Subscribe(EventLeaderboardReceived, func(e Event) {
+		board := e.Payload.(LeaderboardReceived)
+		l.shown, l.entries = board.Stat, board.Entries
+	})
+	return l
+}
+
+func (l *Leaderboard) Open() bool {
+	return l.open
+}
+
+// Update handles the leaderboard keys, or Y and X on a gamepad, and
+// requests the board on w when it opens, changes stat or goes stale.
+func (l *Leaderboard) Update(deltaTime float64, typing bool, w io.Writer) error {
+	if !typing && (inpututil.IsKeyJustPressed(ebiten.KeyL) || menuPad.Pressed(MenuExtra)) {
+		l.open = !l.open
+		l.refresh = 0
+	}
+	if !l.open {
+		return nil
+	}
+	if !typing && (inpututil.IsKeyJustPressed(ebiten.KeyTab) || menuPad.Pressed(MenuAlt)) {
+		l.stat = (l.stat + 1) % len(leaderboardStats)
+		l.refresh = 0
+	}
+
+	l.refresh -= deltaTime
+	if l.refresh > 0 {
+		return nil
+	}
+	l.refresh = leaderboardRefresh
+	_, err := io.WriteString(w, protocol.Line(protocol.KindLeaderboard, leaderboardStats[l.stat]))
+	return err
+}
+
+func (l *Leaderboard) Draw(screen *ebiten.Image) {
+	if !l.open {
+		return
+	}
+	const width, height = 320, 240
+	x, y := (hudWidth-width)/2, (hudHeight-height)/2
+	drawPanel(screen, float64(x), float64(y), width, height)
+
+	var b strings.Builder
+	b.WriteString(menuPad.Hint("leaderboard.title", T("leaderboard.stat."+leaderboardStats[l.stat])) + "\n\n")
+	switch {
+	case l.shown != leaderboardStats[l.stat]:
+		b.WriteString(T("leaderboard.loading"))
+	case len(l.entries) == 0:
+		b.WriteString(T("leaderboard.empty"))
+	}
+	if l.shown == leaderboardStats[l.stat] {
+		for _, e := range l.entries {
+			fmt.Fprintf(&b, "%3d. %-16s %10.0f\n", e.Rank, e.Name, e.Value)
+		}
+	}
+	drawText(screen, b.String(), x+12, y+12, tableText)
+}
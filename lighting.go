@@ -0,0 +1,174 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"darkzone/MultiTestServer/protocol"
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+const (
+	// lightSpriteSize is the size of the light sprite, scaled to each
+	// light's radius.
+	lightSpriteSize = 128
+	// lightMargin is how far outside a view lights are still gathered,
+	// as the widest light reaches into it from there.
+	lightMargin = 160
+	// maxDarkness is how dark the darkness overlay gets at ambient 0; a
+	// little is always left to see by.
+	maxDarkness = 0.92
+	// glowStrength is how strongly lights tint what they light, at full
+	// darkness.
+	glowStrength = 0.35
+)
+
+var (
+	lightSprite   = newLightSprite(lightSpriteSize)
+	darknessColor = color.RGBA{2, 2, 12, 255}
+	// lanternLight is the lantern every player carries.
+	lanternLight = TileLight{Radius: 72, Color: [3]uint8{255, 220, 170}}
+	// entityLights are the lights of entities by name.
+	entityLights = map[string]TileLight{
+		"torch":    {Radius: 120, Color: [3]uint8{255, 170, 80}},
+		"campfire": {Radius: 160, Color: [3]uint8{255, 140, 60}},
+		"lantern":  {Radius: 96, Color: [3]uint8{255, 220, 170}},
+	}
+)
+
+// newLightSprite is a white disc fading out from its center, opaque in the
+// middle and transparent at its edge.
+func newLightSprite(size int) *ebiten.Image {
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	center := float64(size) / 2
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			d := math.Hypot(float64(x)+0.5-center, float64(y)+0.5-center) / center
+			if d >= 1 {
+				continue
+			}
+			a := uint8(255 * (1 - d) * (1 - d))
+			img.SetRGBA(x, y, color.RGBA{a, a, a, a})
+		}
+	}
+	return ebiten.NewImageFromImage(img)
+}
+
+type placedLight struct {
+	position Vector2f
+	light    TileLight
+}
+
+// Lighting darkens the world by the room's ambient light, as the day and
+// night cycle sets it, and lets the lights of tiles, entities and players'
+// lanterns shine through. Lights are gathered afresh for each view with
+// Reset and Add, then drawn over it.
+type Lighting struct {
+	ambient protocol.Ambient
+	lights  []placedLight
+	// layer is the darkness, with the lights cut out of it; it is sized
+	// to the view.
+	layer *ebiten.Image
+}
+
+func NewLighting(events *EventBus) *Lighting {
+	l := &Lighting{ambient: protocol.DefaultAmbient}
+	events.Subscribe(EventAmbientChanged, func(e Event) {
+		l.ambient = e.Payload.(AmbientChanged).Ambient
+	})
+	return l
+}
+
+func (l *Lighting) Reset() {
+	l.lights = l.lights[:0]
+}
+
+// Add places light with its center at position in the world.
+func (l *Lighting) Add(position Vector2f, light TileLight) {
+	l.lights = append(l.lights, placedLight{position: position, light: light})
+}
+
+// Draw darkens target, a view whose top-left is cameraOffset in the world,
+// for the server time in milliseconds, then lights it up again.
+func (l *Lighting) Draw(target *ebiten.Image, cameraOffset Vector2f, serverMillis int64) {
+	darkness := (1 - l.ambient.At(serverMillis)) * maxDarkness
+	if darkness <= 0.01 {
+		return
+	}
+	bounds := target.Bounds()
+	if l.layer == nil || l.layer.Bounds().Size() != bounds.Size() {
+		l.layer = ebiten.NewImage(bounds.Dx(), bounds.Dy())
+	}
+	l.layer.Fill(darknessColor)
+
+	for _, p := range l.lights {
+		op := l.lightOptions(p, cameraOffset)
+		op.Blend = ebiten.BlendDestinationOut
+		l.layer.DrawImage(lightSprite, op)
+	}
+	op := &ebiten.DrawImageOptions{}
+	op.ColorScale.ScaleAlpha(float32(darkness))
+	target.DrawImage(l.layer, op)
+
+	for _, p := range l.lights {
+		op := l.lightOptions(p, cameraOffset)
+		op.Blend = ebiten.BlendLighter
+		c, glow := p.light.Color, float32(darkness*glowStrength)
+		op.ColorScale.Scale(float32(c[0])/255*glow, float32(c[1])/255*glow, float32(c[2])/255*glow, glow)
+		target.DrawImage(lightSprite, op)
+	}
+}
+
+func (l *Lighting) lightOptions(p placedLight, cameraOffset Vector2f) *ebiten.DrawImageOptions {
+	op := &ebiten.DrawImageOptions{}
+	scale := p.light.Radius * 2 / lightSpriteSize
+	op.GeoM.Translate(-lightSpriteSize/2, -lightSpriteSize/2)
+	op.GeoM.Scale(scale, scale)
+	op.GeoM.Translate(p.position.X-cameraOffset.X, p.position.Y-cameraOffset.Y)
+	return op
+}
+
+// addLights gathers the lights shining into the world rectangle x0, y0 to
+// x1, y1: glowing tiles, lit entities and the lanterns of every player in
+// sight.
+func (g *Game) addLights(x0, y0, x1, y1 float64) {
+	x0, y0, x1, y1 = x0-lightMargin, y0-lightMargin, x1+lightMargin, y1+lightMargin
+	g.lighting.Reset()
+	if len(g.tileMap.Lights) > 0 {
+		col0, col1 := max(0, int(x0/tileSize)), min(g.tileMap.Width-1, int(x1/tileSize))
+		row0, row1 := max(0, int(y0/tileSize)), int(y1/tileSize)
+		for _, layer := range g.tileMap.Layers {
+			for row := row0; row <= row1; row++ {
+				for col := col0; col <= col1; col++ {
+					index := row*g.tileMap.Width + col
+					if index >= len(layer) {
+						continue
+					}
+					if light, ok := g.tileMap.Lights[layer[index]]; ok {
+						g.lighting.Add(Vector2f{X: (float64(col) + 0.5) * tileSize, Y: (float64(row) + 0.5) * tileSize}, light)
+					}
+				}
+			}
+		}
+	}
+	g.entities.InRect(x0, y0, x1, y1, func(_ string, entity *WorldEntity) {
+		if light, ok := entityLights[entity.Name]; ok {
+			g.lighting.Add(Vector2f{X: entity.X, Y: entity.Y}, light)
+		}
+	})
+	for _, local := range g.localPlayers {
+		g.lighting.Add(spriteCenter(local.position), lanternLight)
+	}
+	g.otherPlayers.InRect(x0, y0, x1, y1, func(_ string, player *RemotePlayer) {
+		if center := spriteCenter(player.position); g.fog.Visible(center) {
+			g.lighting.Add(center, lanternLight)
+		}
+	})
+}
+
+// spriteCenter is the middle of a character sprite drawn at position,
+// where a player's lantern hangs.
+func spriteCenter(position Vector2f) Vector2f {
+	return Vector2f{X: position.X + frameWidth/2, Y: position.Y + frameHeight/2}
+}
@@ -2,16 +2,20 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
-	"image"
 	"log"
+	"math"
 	"net"
 	"strconv"
 	"strings"
-	"sync"
+	"time"
 
+	"darkzone/MultiTestServer/protocol"
+	"darkzone/MultiTestServer/spatial"
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
 )
 
 const (
@@ -20,214 +24,1335 @@ const (
 	frameWidth   = 32
 	frameHeight  = 32
 	tileSize     = 256
+	defaultPort  = "8080"
+
+	// chunkSize is the cell size of the spatial index for remote players and
+	// entities; drawMargin keeps sprites straddling the view edge visible.
+	chunkSize  = 512
+	drawMargin = 64
+
+	netInboxSize = 1024
+	// snapshotAckInterval is how often a snapshot is acknowledged, for the
+	// server to tell how far behind the connection is.
+	snapshotAckInterval = 250 * time.Millisecond
 )
 
 type Vector2f struct {
 	X, Y float64
 }
 
-type Character struct {
-	bodyTexture        *ebiten.Image
-	headTexture        *ebiten.Image
-	position           Vector2f
-	moveSpeed          float64
-	animationSpeed     float64
-	frameIndex         int
-	direction          int
-	timeSinceLastFrame float64
-	isMoving           bool
+type LocalPlayer struct {
+	*Character
+	id        string
+	conn      *redialConn
+	input     InputSource
+	footsteps *Emitter
+	viewport  *ebiten.Image
+	sender    *StateSender
+	// account is the account the player logged in to, empty for a guest,
+	// and password what they log back in with after a reconnect.
+	account  string
+	password string
+	// queuePosition is this connection's place in the server's login
+	// queue, or 0 once it has been admitted.
+	queuePosition int
+	// reconnectAttempt counts the attempts to reconnect since the
+	// connection dropped, 0 while connected.
+	reconnectAttempt int
+	lastAck          time.Time
+	// selector is the character selection scene, shown until the account
+	// player picks a character. Guests never get one.
+	selector *CharacterSelect
+	// inviteRoom is the room an invite link asked to join, requested once
+	// the player enters the world and then cleared.
+	inviteRoom string
+	// inputs records recent frames of input so server corrections can be
+	// replayed forward; seq numbers the state reports sent so far.
+	inputs *InputBuffer
+	seq    int
+	// serverPosition is where the latest snapshot put this player, shown
+	// against the predicted position by the collision overlay, and in its
+	// place when predict is off.
+	serverPosition    Vector2f
+	hasServerPosition bool
+	predict           bool
+	// forced is the push the server is moving the player along, if any.
+	forced *ForcedMove
+	// slide is the movement the player's input has steered them into,
+	// which lags behind it on ice.
+	slide Vector2f
+	// death is set from the player's defeat until the server respawns them.
+	death *Death
 }
 
-func NewCharacter(bodyTexture, headTexture *ebiten.Image, startPos Vector2f) *Character {
-	return &Character{
-		bodyTexture:    bodyTexture,
-		headTexture:    headTexture,
-		position:       startPos,
-		moveSpeed:      200.0,
-		animationSpeed: 0.1,
-		frameIndex:     0,
-		direction:      0,
-		isMoving:       false,
+// shownPosition is where the player is drawn: the predicted position, or
+// with prediction off, the last one the server confirmed.
+func (l *LocalPlayer) shownPosition() Vector2f {
+	if l.predict || !l.hasServerPosition {
+		return l.position
 	}
+	return l.serverPosition
+}
+
+// cameraCenter keeps the original framing, with the sprite's top-left corner
+// at the middle of the view.
+func (l *LocalPlayer) cameraCenter() Vector2f {
+	return l.shownPosition()
 }
 
-func (c *Character) Update(deltaTime float64) {
-	c.updateAnimation(deltaTime)
+func (l *LocalPlayer) Draw(screen *ebiten.Image, cameraOffset Vector2f) {
+	shown := *l.Character
+	shown.position = l.shownPosition()
+	shown.Draw(screen, cameraOffset)
 }
 
-func (c *Character) updateAnimation(deltaTime float64) {
-	c.timeSinceLastFrame += deltaTime
+type Game struct {
+	localPlayers []*LocalPlayer
+	otherPlayers *spatial.Grid[string, *RemotePlayer]
+	entities     *spatial.Grid[string, *WorldEntity]
+	inbox        chan netMessage
+	bodyTexture  *ebiten.Image
+	headTexture  *ebiten.Image
+	tiles        *TileRenderer
+	tileMap      *TileMap
+	settings     *Settings
+	events       *EventBus
+	particles    *ParticleSystem
+	scheduler    *TaskScheduler
+	clock        *ClockSync
+	session      *SessionTracker
+	chat         *ChatBox
+	leaderboard  *Leaderboard
+	party        *PartyPanel
+	quests       *QuestLog
+	dialogue     *DialogueBox
+	shop         *ShopWindow
+	crafting     *CraftingWindow
+	gathering    *Gathering
+	statuses     *StatusEffects
+	area         *AreaIndicator
+	feed         *EventFeed
+	match        *MatchPanel
+	matchTimer   *MatchTimer
+	pause        *PauseVote
+	targeting    *Targeting
+	lighting     *Lighting
+	fog          *FogOfWar
+	results      *ResultsScreen
+	motd         *MOTDPanel
+	settingsMenu *SettingsMenu
+	touch        *TouchInput
+	effects      *ScreenEffects
+	// voice is nil unless proximity voice chat was enabled with -voice.
+	voice         *VoiceChat
+	freeCamera    *FreeCamera
+	weather       *Weather
+	packets       *PacketLog
+	crashes       *CrashReporter
+	capture       *Capture
+	showPackets   bool
+	showCollision bool
+	zoneWeather   protocol.Weather
+	disconnected  bool
+	kickReason    string
+	// mapMismatch is set once the player has been warned their map differs
+	// from the server's.
+	mapMismatch bool
+	// dial connects to the server again to reconnect; it is nil for demo
+	// playback, which cannot be reconnected.
+	dial func() (net.Conn, error)
+	// demo is the demo played back instead of a game, if one is.
+	demo *DemoPlayback
+	// seating is who rides in which vehicle.
+	seating *Seating
+	// decals are the footprints and skid marks on the ground.
+	decals *Decals
+	// hud is the HUD drawn at the UI scale, before it is scaled over the
+	// screen.
+	hud *ebiten.Image
+}
 
-	if c.isMoving {
-		if c.timeSinceLastFrame >= c.animationSpeed {
-			c.frameIndex = (c.frameIndex + 1) % 5
-			c.timeSinceLastFrame = 0
+func NewGame(conns []net.Conn, packets *PacketLog, bodyTexture, headTexture, tilesImage *ebiten.Image, tileMap *TileMap, settings *Settings) *Game {
+	g := &Game{
+		otherPlayers: spatial.NewGrid[string, *RemotePlayer](chunkSize),
+		entities:     spatial.NewGrid[string, *WorldEntity](chunkSize),
+		inbox:        make(chan netMessage, netInboxSize),
+		bodyTexture:  bodyTexture,
+		headTexture:  headTexture,
+		tileMap:      tileMap,
+		settings:     settings,
+		events:       NewEventBus(),
+		particles:    NewParticleSystem(),
+		scheduler:    NewTaskScheduler(defaultFrameBudget),
+		clock:        NewClockSync(),
+		freeCamera:   NewFreeCamera(),
+		packets:      packets,
+	}
+
+	g.tiles = NewTileRenderer(tileMap, tilesImage, g.scheduler)
+	g.session = NewSessionTracker(g.events)
+	g.chat = NewChatBox(g.events)
+	g.leaderboard = NewLeaderboard(g.events)
+	g.party = NewPartyPanel(g.events)
+	g.quests = NewQuestLog(g.events)
+	g.dialogue = NewDialogueBox(g.events)
+	g.capture = NewCapture(g.events)
+	g.shop = NewShopWindow(g.events)
+	g.crafting = NewCraftingWindow(g.events)
+	g.gathering = NewGathering(g.events, g.particles, g.entities)
+	g.statuses = NewStatusEffects(g.events)
+	g.area = NewAreaIndicator(g.events)
+	g.feed = NewEventFeed(g.events)
+	g.match = NewMatchPanel(g.events)
+	g.matchTimer = NewMatchTimer(g.events)
+	g.pause = NewPauseVote(g.events)
+	g.targeting = NewTargeting()
+	g.seating = NewSeating()
+	g.decals = NewDecals(g.events)
+	g.lighting = NewLighting(g.events)
+	g.fog = NewFogOfWar(g.events)
+	g.results = NewResultsScreen(g.events)
+	g.motd = NewMOTDPanel(g.events)
+	g.settingsMenu = NewSettingsMenu(settings, g.applySettings)
+	g.effects = NewScreenEffects(g.events)
+	g.events.Subscribe(EventDisconnected, func(Event) {
+		g.disconnected = true
+	})
+	g.events.Subscribe(EventKicked, func(e Event) {
+		g.kickReason = e.Payload.(Kicked).Reason
+	})
+	g.events.Subscribe(EventSnapshotReceived, func(e Event) {
+		g.applySnapshot(e.Payload.(SnapshotReceived).Snapshot)
+	})
+	g.events.Subscribe(EventResyncReceived, func(e Event) {
+		g.applyResync(e.Payload.(ResyncReceived).Resync)
+	})
+	g.events.Subscribe(EventReconnecting, func(e Event) {
+		reconnecting := e.Payload.(Reconnecting)
+		reconnecting.Local.reconnectAttempt = reconnecting.Attempt
+	})
+	g.events.Subscribe(EventReconnected, func(e Event) {
+		e.Payload.(Reconnected).Local.reconnectAttempt = 0
+	})
+	g.events.Subscribe(EventEntitySpawned, func(e Event) {
+		entity := e.Payload.(EntitySpawned).Entity
+		g.entities.Set(entity.ID, NewWorldEntity(entity, g.bodyTexture, g.headTexture), entity.X, entity.Y)
+	})
+	g.events.Subscribe(EventEntityDespawned, func(e Event) {
+		g.entities.Remove(e.Payload.(EntityDespawned).ID)
+	})
+	g.events.Subscribe(EventSeatChanged, func(e Event) {
+		g.seating.Set(e.Payload.(SeatChanged).Change)
+	})
+	g.events.Subscribe(EventDoorChanged, func(e Event) {
+		door := e.Payload.(DoorChanged)
+		if entity, ok := g.entities.Get(door.ID); ok {
+			entity.open = door.Open
 		}
-	} else {
-		c.frameIndex = 0
+	})
+
+	// Touch controls drive the first player, who keeps the keys bound in
+	// the settings.
+	g.touch = NewTouchInput(settings.Controls.Keys())
+	inputs := []InputSource{g.touch, &GamepadInput{Index: 0, Fallback: WASDKeys()}}
+	for i, conn := range conns {
+		local := &LocalPlayer{
+			Character: NewCharacter(bodyTexture, headTexture, Vector2f{400, 300}),
+			conn:      newRedialConn(conn),
+			input:     inputs[i%len(inputs)],
+			sender:    NewStateSender(defaultSendRate),
+			inputs:    NewInputBuffer(inputHistory),
+		}
+		local.footsteps = g.particles.Add(NewEmitter(DustEmitterConfig(), local.position))
+		if len(conns) > 1 {
+			local.viewport = ebiten.NewImage(screenWidth/len(conns), screenHeight)
+		}
+		g.localPlayers = append(g.localPlayers, local)
 	}
+	g.weather = NewWeather(g.events, g.particles, len(g.localPlayers))
+	return g
 }
 
-func (c *Character) Draw(screen *ebiten.Image, cameraOffset Vector2f) {
-	bodyOp := &ebiten.DrawImageOptions{}
-	headOp := &ebiten.DrawImageOptions{}
+func (g *Game) Update() error {
+	defer g.crashes.Recover()
+	deltaTime := 1.0 / 120.0
+	g.drainInbox()
+	g.events.Dispatch()
+	menuPad.Update()
+	if g.queued() != "" {
+		return nil
+	}
+	if selector := g.activeSelector(); selector != nil {
+		if err := selector.Update(); err != nil {
+			log.Println("Error sending character request:", err)
+		}
+		return nil
+	}
 
-	bodyRow := 0
-	if c.isMoving {
-		bodyRow = c.frameIndex + 1
+	g.capture.Update()
+	if inpututil.IsKeyJustPressed(ebiten.KeyF9) {
+		g.settings.Accessibility.HighContrastTiles = !g.settings.Accessibility.HighContrastTiles
+		if err := g.settings.Save(); err != nil {
+			log.Println("Error saving settings:", err)
+		}
 	}
 
-	bodyRect := image.Rect(frameWidth*c.direction, frameHeight*bodyRow, frameWidth*(c.direction+1), frameHeight*(bodyRow+1))
-	headRect := image.Rect(0, frameHeight*c.direction, frameWidth, frameHeight*(c.direction+1))
+	if inpututil.IsKeyJustPressed(ebiten.KeyF10) {
+		g.switchLanguage()
+	}
 
-	bodyOp.GeoM.Translate(c.position.X-cameraOffset.X, c.position.Y-cameraOffset.Y)
-	headOp.GeoM.Translate(c.position.X-cameraOffset.X, c.position.Y-16-cameraOffset.Y)
+	if inpututil.IsKeyJustPressed(ebiten.KeyF7) {
+		g.showPackets = !g.showPackets
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyF3) {
+		g.showCollision = !g.showCollision
+	}
+	if g.showPackets && inpututil.IsKeyJustPressed(ebiten.KeyF6) {
+		g.dumpPackets()
+		g.dumpInputs()
+	}
 
-	screen.DrawImage(c.bodyTexture.SubImage(bodyRect).(*ebiten.Image), bodyOp)
-	screen.DrawImage(c.headTexture.SubImage(headRect).(*ebiten.Image), headOp)
+	// Escape closes whatever else is open before it opens the settings.
+	escapeTaken := g.chat.Typing() || g.quests.Offering() || g.dialogue.Open() || g.shop.Open() || g.crafting.Open() || g.motd.Open()
+	if err := g.chat.Update(g.localPlayers[0].conn); err != nil {
+		log.Println("Error sending chat:", err)
+	}
+	if err := g.leaderboard.Update(deltaTime, g.chat.Typing(), g.localPlayers[0].conn); err != nil {
+		log.Println("Error requesting leaderboard:", err)
+	}
+	if err := g.quests.Update(deltaTime, g.chat.Typing(), g.localPlayers[0].conn); err != nil {
+		log.Println("Error accepting quest:", err)
+	}
+	if err := g.dialogue.Update(g.chat.Typing(), g.localPlayers[0].conn); err != nil {
+		log.Println("Error answering dialogue:", err)
+	}
+	if err := g.shop.Update(g.chat.Typing(), g.localPlayers[0].conn); err != nil {
+		log.Println("Error trading:", err)
+	}
+	if err := g.crafting.Update(deltaTime, g.chat.Typing(), g.localPlayers[0].conn); err != nil {
+		log.Println("Error sending craft request:", err)
+	}
+	g.gathering.Update(deltaTime)
+	g.statuses.Update(deltaTime)
+	g.feed.Update(deltaTime)
+	g.match.Update(deltaTime)
+	g.matchTimer.Update(deltaTime)
+	g.fog.Update(g.localPlayers)
+	if err := g.pause.Update(g.chat.Typing(), g.localPlayers[0].conn); err != nil {
+		log.Println("Error sending pause vote:", err)
+	}
+	cursor, onWorld := g.cursorWorld()
+	menus := g.settingsMenu.Open() || g.dialogue.Open() || g.shop.Open() || g.crafting.Open() || g.results.Open() || g.motd.Open()
+	if err := g.targeting.Update(cursor, onWorld, menus, g.otherPlayers, g.localPlayers[0].conn); err != nil {
+		log.Println("Error sending target:", err)
+	}
+	g.results.Update(deltaTime)
+	g.motd.Update()
+	if !g.chat.Typing() && !g.dialogue.Open() && !g.shop.Open() && inpututil.IsKeyJustPressed(ebiten.KeyE) {
+		if err := g.interact(g.localPlayers[0]); err != nil {
+			log.Println("Error sending interaction:", err)
+		}
+	}
+	if !g.chat.Typing() && !menus && !g.pause.Paused() && g.demo == nil && inpututil.IsKeyJustPressed(ebiten.KeyR) {
+		if err := g.toggleMount(g.localPlayers[0]); err != nil {
+			log.Println("Error sending mount:", err)
+		}
+	}
+
+	g.settingsMenu.Update(g.chat.Typing(), escapeTaken)
+	g.touch.Update()
+	if g.voice != nil {
+		talk := ebiten.IsKeyPressed(ebiten.KeyV) && !g.chat.Typing()
+		g.voice.Update(talk, g.localPlayers[0].position, g.playerPosition)
+	}
+	for _, local := range g.localPlayers {
+		local.predict = g.settings.Netcode.Prediction
+		if g.demo == nil {
+			g.handleInput(local, deltaTime)
+		}
+		local.terrain = g.tileMap.TerrainAt(local.position.X, local.position.Y)
+		local.Update(deltaTime)
+		if local.death != nil {
+			local.death.Update(deltaTime)
+		}
+
+		local.footsteps.Active = local.isMoving()
+		local.footsteps.Position = Vector2f{local.position.X + frameWidth/2, local.position.Y + frameHeight}
+		g.stepDecals(local.Character)
+	}
+	centers := make([]Vector2f, len(g.localPlayers))
+	for i, local := range g.localPlayers {
+		centers[i] = g.cameraCenter(local)
+	}
+	g.weather.Update(centers)
+	g.effects.Update()
+	g.particles.Update(deltaTime)
+	g.driveOwnedEntities(deltaTime)
+	g.freeCamera.Update(g.cameraFollow())
+
+	if err := g.clock.Update(deltaTime, g.localPlayers[0].conn); err != nil {
+		log.Println("Error sending clock sync:", err)
+	}
+
+	netcode := g.settings.Netcode
+	renderTime := g.clock.ServerNow() - netcode.InterpolationDelay
+	g.otherPlayers.Each(func(id string, player *RemotePlayer) {
+		player.Update(deltaTime, renderTime, netcode.MaxExtrapolation)
+		player.terrain = g.tileMap.TerrainAt(player.position.X, player.position.Y)
+		g.otherPlayers.Move(id, player.position.X, player.position.Y)
+	})
+	g.seatRiders()
+	g.otherPlayers.Each(func(_ string, player *RemotePlayer) {
+		g.stepDecals(player.Character)
+	})
+	g.decals.Update(deltaTime)
+
+	g.scheduler.Run()
+
+	return nil
 }
 
-type Game struct {
-	localPlayer  *Character
-	otherPlayers map[string]*Character
-	conn         net.Conn
-	mu           sync.Mutex
-	tilesImage   *ebiten.Image
-	layers       [][]int
+// queued describes any local connection still waiting in the login queue.
+// It is empty once every local player has been admitted.
+func (g *Game) queued() string {
+	var status strings.Builder
+	for i, local := range g.localPlayers {
+		if local.queuePosition > 0 {
+			status.WriteString(T("queue.position", i+1, local.queuePosition) + "\n")
+		}
+	}
+	return status.String()
 }
 
-func NewGame(conn net.Conn, bodyTexture, headTexture, tilesImage *ebiten.Image, layers [][]int) *Game {
-	return &Game{
-		localPlayer:  NewCharacter(bodyTexture, headTexture, Vector2f{400, 300}),
-		otherPlayers: make(map[string]*Character),
-		conn:         conn,
-		tilesImage:   tilesImage,
-		layers:       layers,
+// activeSelector returns the first local player still choosing a character,
+// so split-screen players pick theirs one after another.
+func (g *Game) activeSelector() *CharacterSelect {
+	for _, local := range g.localPlayers {
+		if local.selector != nil {
+			return local.selector
+		}
 	}
+	return nil
 }
 
-func (g *Game) Update() error {
-	deltaTime := 1.0 / 120.0
-	g.handleInput(deltaTime)
-	g.localPlayer.Update(deltaTime)
+// switchLanguage moves to the next available language and remembers it in
+// the settings.
+func (g *Game) switchLanguage() {
+	language, err := nextLanguage()
+	if err == nil {
+		err = SetLanguage(language)
+	}
+	if err != nil {
+		log.Println("Error switching language:", err)
+		return
+	}
+	g.settings.Language = language
+	if err := g.settings.Save(); err != nil {
+		log.Println("Error saving settings:", err)
+	}
+	ebiten.SetWindowTitle(T("window.title"))
+	g.events.Publish(EventChatReceived, ChatReceived{Channel: chatChannelSystem, From: "client", Text: T("settings.language", language)})
+}
 
-	g.mu.Lock()
-	for _, player := range g.otherPlayers {
-		player.Update(deltaTime)
+// applySettings puts the video, audio, control and accessibility settings
+// into effect, at startup and as the settings menu changes them.
+func (g *Game) applySettings() {
+	video := g.settings.Video
+	ebiten.SetVsyncEnabled(video.VSync)
+	ebiten.SetFullscreen(video.Fullscreen)
+	width, height := screenWidth*video.Scale, screenHeight*video.Scale
+	if w, h := ebiten.WindowSize(); !video.Fullscreen && (w != width || h != height) {
+		ebiten.SetWindowSize(width, height)
 	}
-	g.mu.Unlock()
+	if g.voice != nil {
+		g.voice.SetVolume(g.settings.Audio.Master * g.settings.Audio.Voice)
+	}
+	g.touch.Fallback = g.settings.Controls.Keys()
+	applyAccessibility(g.settings.Accessibility)
+}
 
-	return nil
+func (g *Game) dumpPackets() {
+	path := fmt.Sprintf("packets-%s.log", time.Now().Format("20060102-150405"))
+	text := T("packets.dumped", path)
+	if err := g.packets.Dump(path); err != nil {
+		log.Println("Error writing packet log:", err)
+		text = T("packets.dumpFailed", err)
+	}
+	g.events.Publish(EventChatReceived, ChatReceived{Channel: chatChannelSystem, From: "client", Text: text})
+}
+
+// dumpInputs writes the first player's input history and recent server
+// corrections next to the packet log, for chasing down mispredictions.
+func (g *Game) dumpInputs() {
+	path := fmt.Sprintf("inputs-%s.log", time.Now().Format("20060102-150405"))
+	text := T("inputs.dumped", path)
+	if err := g.localPlayers[0].inputs.Dump(path); err != nil {
+		log.Println("Error writing input log:", err)
+		text = T("inputs.dumpFailed", err)
+	}
+	g.events.Publish(EventChatReceived, ChatReceived{Channel: chatChannelSystem, From: "client", Text: text})
 }
 
-func (g *Game) handleInput(deltaTime float64) {
-	movement := Vector2f{0, 0}
-	g.localPlayer.isMoving = false
+func (g *Game) handleInput(local *LocalPlayer, deltaTime float64) {
+	intent := local.input.Movement()
+	if g.chat.Typing() || g.settingsMenu.Open() || g.dialogue.Open() || g.shop.Open() || g.crafting.Open() || g.results.Open() || g.motd.Open() || g.pause.Paused() || local.forced != nil || local.death != nil {
+		intent = Vector2f{0, 0}
+	}
+	if g.steer(local, intent) {
+		return
+	}
+	if g.dashPressed(local) {
+		g.dash(local, intent)
+	}
+	moving := intent.X != 0 || intent.Y != 0
+	if g.attackPressed(local) && !local.Busy() {
+		local.SetAnim(protocol.AnimAttack)
+	}
+	if !local.Busy() {
+		if moving {
+			local.SetAnim(protocol.AnimWalk)
+		} else {
+			local.SetAnim(protocol.AnimIdle)
+		}
+	}
 
-	if ebiten.IsKeyPressed(ebiten.KeyUp) {
-		movement.Y -= g.localPlayer.moveSpeed * deltaTime
-		g.localPlayer.direction = 0
-		g.localPlayer.isMoving = true
+	if intent.Y < 0 {
+		local.direction = 0
 	}
-	if ebiten.IsKeyPressed(ebiten.KeyDown) {
-		movement.Y += g.localPlayer.moveSpeed * deltaTime
-		g.localPlayer.direction = 2
-		g.localPlayer.isMoving = true
+	if intent.Y > 0 {
+		local.direction = 2
 	}
-	if ebiten.IsKeyPressed(ebiten.KeyLeft) {
-		movement.X -= g.localPlayer.moveSpeed * deltaTime
-		g.localPlayer.direction = 1
-		g.localPlayer.isMoving = true
+	if intent.X < 0 {
+		local.direction = 1
 	}
-	if ebiten.IsKeyPressed(ebiten.KeyRight) {
-		movement.X += g.localPlayer.moveSpeed * deltaTime
-		g.localPlayer.direction = 3
-		g.localPlayer.isMoving = true
+	if intent.X > 0 {
+		local.direction = 3
 	}
 
-	g.localPlayer.position.X += movement.X
-	g.localPlayer.position.Y += movement.Y
+	var velocity Vector2f
+	if local.forced != nil {
+		local.position, velocity = local.forced.Step(local.position, deltaTime)
+		if local.forced.Done() {
+			local.forced = nil
+		}
+	} else {
+		terrain := g.tileMap.TerrainAt(local.position.X, local.position.Y)
+		local.slide.X, local.slide.Y = terrain.Steer(local.slide.X, local.slide.Y, intent.X, intent.Y, deltaTime)
+		from := local.position
+		local.position, velocity = PredictMove(g.walker(local), local.position, local.slide, g.moveSpeed(local), deltaTime)
+		g.climb(local, from)
+	}
+	// The frame belongs to the next report; if that isn't sent this frame,
+	// the one after still carries its movement.
+	local.inputs.Add(InputFrame{
+		Time:      g.clock.ServerNow(),
+		Seq:       local.seq + 1,
+		DeltaTime: deltaTime,
+		Intent:    local.slide,
+		Attack:    local.anim == protocol.AnimAttack,
+		Position:  local.position,
+	})
+	if moving {
+		g.events.Publish(EventLocalMoved, LocalMoved{Distance: math.Hypot(velocity.X, velocity.Y) * deltaTime})
+	}
+
+	state := protocol.PlayerState{
+		X:         local.position.X,
+		Y:         local.position.Y,
+		VX:        velocity.X,
+		VY:        velocity.Y,
+		Direction: local.direction,
+		Anim:      local.anim,
+	}
+	if local.sender.Ready(deltaTime, state) {
+		local.seq++
+		state.Seq = local.seq
+		fmt.Fprint(local.conn, protocol.Line(protocol.KindState, protocol.EncodeReport(state)))
+	}
+}
 
-	fmt.Fprintf(g.conn, "%.2f,%.2f,%d,%v\n", g.localPlayer.position.X, g.localPlayer.position.Y, g.localPlayer.direction, g.localPlayer.isMoving)
+func (g *Game) attackPressed(local *LocalPlayer) bool {
+	if g.chat.Typing() || g.settingsMenu.Open() || g.dialogue.Open() || g.shop.Open() || g.crafting.Open() || g.results.Open() || g.motd.Open() || g.pause.Paused() || local.death != nil {
+		return false
+	}
+	return local.input.AttackPressed()
+}
+
+func (g *Game) dashPressed(local *LocalPlayer) bool {
+	if g.chat.Typing() || g.settingsMenu.Open() || g.dialogue.Open() || g.shop.Open() || g.crafting.Open() || g.results.Open() || g.motd.Open() || g.pause.Paused() || local.forced != nil || local.death != nil {
+		return false
+	}
+	return local.input.DashPressed()
 }
 
 func (g *Game) Draw(screen *ebiten.Image) {
-	cameraOffset := Vector2f{
-		X: g.localPlayer.position.X - screenWidth/2,
-		Y: g.localPlayer.position.Y - screenHeight/2,
+	defer g.crashes.Recover()
+	defer g.capture.Draw(screen)
+	if g.disconnected {
+		status := T("status.disconnected")
+		if g.kickReason != "" {
+			status = T("status.kicked", g.kickReason)
+		}
+		drawText(screen, status+"\n\n"+g.session.Summary(), screenWidth/2-100, screenHeight/2-60, hudText)
+		return
+	}
+
+	if status := g.queued(); status != "" {
+		drawText(screen, status, screenWidth/2-100, screenHeight/2-20, hudText)
+		return
+	}
+	if selector := g.activeSelector(); selector != nil {
+		selector.Draw(screen)
+		return
+	}
+
+	// The HUD is drawn at the UI scale, then scaled over the world.
+	hud := g.hudLayer()
+	defer g.drawHUD(screen)
+	defer g.chat.Draw(hud)
+	defer g.touch.Draw(screen)
+	defer g.leaderboard.Draw(hud)
+	defer g.party.Draw(hud)
+	defer g.quests.Draw(hud)
+	defer g.dialogue.Draw(hud)
+	defer g.shop.Draw(hud)
+	defer g.crafting.Draw(hud)
+	defer g.gathering.Draw(hud)
+	defer g.statuses.DrawBar(hud, g.localPlayers[0].id)
+	defer g.area.Draw(hud)
+	defer g.feed.Draw(hud)
+	defer g.match.Draw(hud)
+	defer g.matchTimer.Draw(hud)
+	defer g.pause.Draw(hud)
+	defer g.settingsMenu.Draw(hud)
+	defer g.results.Draw(hud)
+	defer g.motd.Draw(hud)
+	if g.voice != nil {
+		defer g.voice.Draw(hud)
+	}
+	if g.showPackets {
+		defer g.packets.Draw(screen)
+	}
+	g.effects.Draw(screen, g.drawViews)
+}
+
+// drawViews draws the world once per camera: the free camera, the single
+// player's view or each split-screen viewport side by side.
+func (g *Game) drawViews(screen *ebiten.Image) {
+	if g.demo != nil {
+		g.freeCamera.Draw(screen, g.drawWorld)
+		drawText(screen, T("demo.help"), 8, 8, hudText)
+		g.demo.Draw(screen)
+		return
+	}
+	if g.freeCamera.Active {
+		g.freeCamera.Draw(screen, g.drawWorld)
+		drawText(screen, T("camera.free.help"), 8, 8, hudText)
+		return
 	}
 
-	g.drawBackground(screen, cameraOffset)
-	g.localPlayer.Draw(screen, cameraOffset)
-	g.mu.Lock()
-	for _, player := range g.otherPlayers {
-		player.Draw(screen, cameraOffset)
+	if len(g.localPlayers) == 1 {
+		g.drawWorld(screen, g.cameraCenter(g.localPlayers[0]), screenWidth, screenHeight)
+		g.localPlayers[0].death.Draw(screen)
+		return
+	}
+
+	for i, local := range g.localPlayers {
+		width, height := local.viewport.Bounds().Dx(), local.viewport.Bounds().Dy()
+		local.viewport.Clear()
+		g.drawWorld(local.viewport, g.cameraCenter(local), width, height)
+		local.death.Draw(local.viewport)
+
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Translate(float64(i*width), 0)
+		screen.DrawImage(local.viewport, op)
 	}
-	g.mu.Unlock()
 }
 
-func (g *Game) drawBackground(screen *ebiten.Image, cameraOffset Vector2f) {
-	tileXCount := 400
+// cameraFollow is what the free camera snaps back to: the local player, or
+// the recorded player while a demo plays.
+func (g *Game) cameraFollow() Vector2f {
+	if g.demo != nil {
+		if subject, ok := g.otherPlayers.Get(g.demo.Subject); ok {
+			return subject.position
+		}
+	}
+	return g.cameraCenter(g.localPlayers[0])
+}
 
-	const xCount = screenWidth / tileSize
-	for _, layer := range g.layers {
-		for i, tile := range layer {
-			op := &ebiten.DrawImageOptions{}
-			x := (i % xCount) * tileSize
-			y := (i / xCount) * tileSize
-			op.GeoM.Translate(float64(x)-cameraOffset.X, float64(y)-cameraOffset.Y)
+func (g *Game) drawWorld(target *ebiten.Image, center Vector2f, width, height int) {
+	cameraOffset := Vector2f{
+		X: center.X - float64(width)/2,
+		Y: center.Y - float64(height)/2,
+	}
 
-			sx := (tile % tileXCount) * tileSize
-			sy := (tile / tileXCount) * tileSize
-			screen.DrawImage(g.tilesImage.SubImage(image.Rect(sx, sy, sx+tileSize, sy+tileSize)).(*ebiten.Image), op)
+	g.tileMap.DrawParallax(target, cameraOffset)
+	g.tiles.Draw(target, cameraOffset, g.clock.ServerNow()/1000)
+	if g.settings.Accessibility.HighContrastTiles {
+		g.drawContrastOverlay(target, cameraOffset)
+	}
+	x0, y0 := cameraOffset.X-drawMargin, cameraOffset.Y-drawMargin
+	x1, y1 := cameraOffset.X+float64(width)+drawMargin, cameraOffset.Y+float64(height)+drawMargin
+	g.decals.Draw(target, cameraOffset, x0, y0, x1, y1)
+	g.particles.Draw(target, cameraOffset)
+	// Vehicles go under everyone, riders included.
+	g.entities.InRect(x0, y0, x1, y1, func(_ string, entity *WorldEntity) {
+		if entity.Kind == protocol.EntityVehicle {
+			entity.Draw(target, cameraOffset)
 		}
+	})
+	g.entities.InRect(x0, y0, x1, y1, func(_ string, entity *WorldEntity) {
+		if entity.Kind != protocol.EntityVehicle {
+			entity.Draw(target, cameraOffset)
+		}
+	})
+	// Bridge decks go over the players under them and under those on top.
+	g.drawPlayers(target, cameraOffset, x0, y0, x1, y1, 0)
+	g.tiles.DrawDecks(target, cameraOffset, g.clock.ServerNow()/1000)
+	g.drawPlayers(target, cameraOffset, x0, y0, x1, y1, 1)
+	g.addLights(x0, y0, x1, y1)
+	g.lighting.Draw(target, cameraOffset, int64(g.clock.ServerNow()))
+	g.fog.Draw(target, cameraOffset, width, height)
+	g.statuses.DrawIcons(target, cameraOffset, g.playerPosition)
+	g.weather.Draw(target)
+	if g.showCollision {
+		g.drawCollisionDebug(target, cameraOffset, x0, y0, x1, y1)
 	}
 }
 
+// drawPlayers draws the players at level within x0, y0 to x1, y1.
+func (g *Game) drawPlayers(target *ebiten.Image, cameraOffset Vector2f, x0, y0, x1, y1 float64, level int) {
+	if g.demo == nil {
+		for _, local := range g.localPlayers {
+			if local.level == level {
+				local.Draw(target, cameraOffset)
+				g.drawDoorPrompt(target, local, cameraOffset)
+			}
+		}
+	}
+	g.otherPlayers.InRect(x0, y0, x1, y1, func(id string, player *RemotePlayer) {
+		if player.level != level || !g.fog.Visible(spriteCenter(player.position)) {
+			return
+		}
+		player.outline = g.targeting.Outline(id)
+		player.Draw(target, cameraOffset)
+	})
+}
+
 func (g *Game) Layout(outsideWidth, outsideHeight int) (int, int) {
 	return screenWidth, screenHeight
 }
 
-func (g *Game) receiveUpdates() {
-	reader := bufio.NewReader(g.conn)
+// playerPosition finds any player the client knows about, local or remote.
+func (g *Game) playerPosition(id string) (Vector2f, bool) {
+	if local := g.localByID(id); local != nil {
+		return local.position, true
+	}
+	if player, ok := g.otherPlayers.Get(id); ok {
+		return player.position, true
+	}
+	return Vector2f{}, false
+}
+
+// moveSpeed is how fast the local player walks, as sped up or slowed down
+// by their status effects.
+func (g *Game) moveSpeed(local *LocalPlayer) float64 {
+	terrain := g.tileMap.TerrainAt(local.position.X, local.position.Y)
+	return local.moveSpeed * terrain.Speed() * protocol.SpeedFactor(g.statuses.Of(local.id)) * protocol.MountSpeed(local.mount)
+}
+
+func (g *Game) isLocalID(id string) bool {
+	return g.localByID(id) != nil
+}
+
+func (g *Game) localByID(id string) *LocalPlayer {
+	for _, local := range g.localPlayers {
+		if local.id == id {
+			return local
+		}
+	}
+	return nil
+}
+
+// netMessage is one line read from a connection, waiting for the game
+// goroutine to apply it.
+type netMessage struct {
+	local   *LocalPlayer
+	primary bool
+	kind    string
+	payload string
+}
+
+// receiveUpdates only reads and splits lines; everything it receives is
+// queued on the inbox and applied by Update, so all game state is owned by
+// the game goroutine and needs no locking.
+//
+// When the connection drops it reconnects, unless the player was kicked or
+// the connection cannot be dialed again, logging back in to the character
+// selected last.
+func (g *Game) receiveUpdates(local *LocalPlayer, primary bool) {
+	var character string
+	kicked := false
+	reader := bufio.NewReader(local.conn)
 	for {
-		message, err := reader.ReadString('\n')
+		message, err := protocol.ReadLine(reader)
 		if err != nil {
 			log.Println("Error reading from server:", err)
+			if !kicked && g.dial != nil && g.reconnect(local, character) {
+				reader = bufio.NewReader(local.conn)
+				continue
+			}
+			g.events.Publish(EventDisconnected, Disconnected{Err: err})
 			return
 		}
 
-		players := strings.Split(strings.TrimSpace(message), ";")
-		g.mu.Lock()
-		for _, playerData := range players {
-			data := strings.Split(playerData, ",")
-			if len(data) == 5 {
-				id := data[0]
-				x, _ := strconv.ParseFloat(data[1], 64)
-				y, _ := strconv.ParseFloat(data[2], 64)
-				direction, _ := strconv.Atoi(data[3])
-				isMoving, _ := strconv.ParseBool(data[4])
-
-				if id != "local" {
-					if _, exists := g.otherPlayers[id]; !exists {
-						g.otherPlayers[id] = NewCharacter(g.localPlayer.bodyTexture, g.localPlayer.headTexture, Vector2f{x, y})
-					}
-					g.otherPlayers[id].position = Vector2f{x, y}
-					g.otherPlayers[id].direction = direction
-					g.otherPlayers[id].isMoving = isMoving
-				}
+		kind, payload := protocol.Split(message)
+		switch kind {
+		case protocol.KindKick:
+			kicked = true
+		case protocol.KindCharacterSelect:
+			character = payload
+		}
+		g.inbox <- netMessage{local: local, primary: primary, kind: kind, payload: payload}
+	}
+}
+
+func (g *Game) drainInbox() {
+	for {
+		select {
+		case msg := <-g.inbox:
+			g.handleMessage(msg)
+		default:
+			return
+		}
+	}
+}
+
+func (g *Game) handleMessage(msg netMessage) {
+	switch msg.kind {
+	case protocol.KindQueue:
+		position, err := strconv.Atoi(msg.payload)
+		if err != nil {
+			log.Println("Error decoding queue position:", err)
+			return
+		}
+		msg.local.queuePosition = position
+	case protocol.KindWelcome:
+		msg.local.queuePosition = 0
+		msg.local.id = msg.payload
+		g.otherPlayers.Remove(msg.payload)
+		if msg.local.selector == nil {
+			g.joinInviteRoom(msg.local)
+		}
+	case protocol.KindResync:
+		resync, err := protocol.DecodeResync(msg.payload)
+		if err != nil {
+			log.Println("Error decoding resync:", err)
+			return
+		}
+		if msg.primary {
+			g.events.Publish(EventResyncReceived, ResyncReceived{Resync: resync})
+		}
+	case protocol.KindSnapshot:
+		snap, err := protocol.DecodeSnapshot(msg.payload)
+		if err != nil {
+			log.Println("Error decoding snapshot:", err)
+			return
+		}
+		if time.Since(msg.local.lastAck) >= snapshotAckInterval {
+			msg.local.lastAck = time.Now()
+			if _, err := fmt.Fprint(msg.local.conn, protocol.Line(protocol.KindAck, strconv.FormatInt(snap.Time, 10))); err != nil {
+				log.Println("Error acknowledging snapshot:", err)
 			}
 		}
-		g.mu.Unlock()
+		if msg.primary {
+			g.events.Publish(EventSnapshotReceived, SnapshotReceived{Snapshot: snap})
+		}
+	case protocol.KindChat:
+		chat, err := protocol.DecodeChat(msg.payload)
+		if err != nil {
+			log.Println("Error decoding chat:", err)
+			return
+		}
+		if msg.primary {
+			g.events.Publish(EventChatReceived, ChatReceived{Channel: chat.Channel, From: chat.From, Text: chat.Text})
+		}
+	case protocol.KindCharacters:
+		chars, err := protocol.DecodeCharacters(msg.payload)
+		if err != nil {
+			log.Println("Error decoding character list:", err)
+			return
+		}
+		if msg.local.selector != nil {
+			msg.local.selector.SetCharacters(chars)
+		}
+	case protocol.KindCharacterSelect:
+		msg.local.selector = nil
+		g.joinInviteRoom(msg.local)
+	case protocol.KindError:
+		if msg.local.selector != nil {
+			msg.local.selector.SetStatus(msg.payload)
+		}
+		g.events.Publish(EventChatReceived, ChatReceived{Channel: chatChannelSystem, From: "server", Text: msg.payload})
+	case protocol.KindSpawn:
+		entity, err := protocol.DecodeEntity(msg.payload)
+		if err != nil {
+			log.Println("Error decoding entity:", err)
+			return
+		}
+		if msg.primary {
+			g.events.Publish(EventEntitySpawned, EntitySpawned{Entity: entity})
+		}
+	case protocol.KindDespawn:
+		if msg.primary {
+			g.events.Publish(EventEntityDespawned, EntityDespawned{ID: msg.payload})
+		}
+	case protocol.KindLeaderboard:
+		stat, entries, err := protocol.DecodeLeaderboard(msg.payload)
+		if err != nil {
+			log.Println("Error decoding leaderboard:", err)
+			return
+		}
+		if msg.primary {
+			g.events.Publish(EventLeaderboardReceived, LeaderboardReceived{Stat: stat, Entries: entries})
+		}
+	case protocol.KindHit:
+		g.events.Publish(EventHitLanded, HitLanded{Target: msg.payload})
+	case protocol.KindDefeated:
+		defeat, err := protocol.DecodeDefeat(msg.payload)
+		if err != nil {
+			log.Println("Error decoding defeat:", err)
+			return
+		}
+		msg.local.death = NewDeath(defeat, g.settings.Gameplay.SpectateKiller)
+		msg.local.SetAnim(protocol.AnimDead)
+		g.events.Publish(EventDied, Died{Killer: defeat.By, Seconds: defeat.Seconds})
+	case protocol.KindParty:
+		if !msg.primary {
+			return
+		}
+		members, err := protocol.DecodeParty(msg.payload)
+		if err != nil {
+			log.Println("Error decoding party:", err)
+			return
+		}
+		g.events.Publish(EventPartyChanged, PartyChanged{Members: members})
+	case protocol.KindPartyInvite:
+		if msg.primary {
+			g.events.Publish(EventChatReceived, ChatReceived{Channel: chatChannelSystem, From: "client", Text: T("party.invited", msg.payload, msg.payload)})
+		}
+	case protocol.KindQuestOffer:
+		offer, err := protocol.DecodeQuestOffer(msg.payload)
+		if err != nil {
+			log.Println("Error decoding quest offer:", err)
+			return
+		}
+		if msg.primary {
+			g.events.Publish(EventQuestOffered, QuestOffered{Offer: offer})
+		}
+	case protocol.KindQuest:
+		status, err := protocol.DecodeQuestStatus(msg.payload)
+		if err != nil {
+			log.Println("Error decoding quest:", err)
+			return
+		}
+		if msg.primary {
+			g.events.Publish(EventQuestUpdated, QuestUpdated{Status: status})
+		}
+	case protocol.KindDialogue:
+		if !msg.primary {
+			return
+		}
+		if msg.payload == "" {
+			g.events.Publish(EventDialogueChanged, DialogueChanged{})
+			return
+		}
+		line, err := protocol.DecodeDialogueLine(msg.payload)
+		if err != nil {
+			log.Println("Error decoding dialogue:", err)
+			return
+		}
+		g.events.Publish(EventDialogueChanged, DialogueChanged{Line: &line})
+	case protocol.KindShop:
+		if !msg.primary {
+			return
+		}
+		if msg.payload == "" {
+			g.events.Publish(EventShopChanged, ShopChanged{})
+			return
+		}
+		shop, err := protocol.DecodeShop(msg.payload)
+		if err != nil {
+			log.Println("Error decoding shop:", err)
+			return
+		}
+		g.events.Publish(EventShopChanged, ShopChanged{Shop: &shop})
+	case protocol.KindRecipes:
+		recipes, err := protocol.DecodeRecipes(msg.payload)
+		if err != nil {
+			log.Println("Error decoding recipes:", err)
+			return
+		}
+		if msg.primary {
+			g.events.Publish(EventRecipesReceived, RecipesReceived{Recipes: recipes})
+		}
+	case protocol.KindInventory:
+		inventory, err := protocol.DecodeInventory(msg.payload)
+		if err != nil {
+			log.Println("Error decoding inventory:", err)
+			return
+		}
+		if msg.primary {
+			g.events.Publish(EventInventoryChanged, InventoryChanged{Inventory: inventory})
+		}
+	case protocol.KindCraft:
+		status, err := protocol.DecodeCraftStatus(msg.payload)
+		if err != nil {
+			log.Println("Error decoding craft status:", err)
+			return
+		}
+		if msg.primary {
+			g.events.Publish(EventCraftUpdated, CraftUpdated{Status: status})
+		}
+	case protocol.KindGather:
+		status, err := protocol.DecodeGatherStatus(msg.payload)
+		if err != nil {
+			log.Println("Error decoding gather status:", err)
+			return
+		}
+		if msg.primary {
+			g.events.Publish(EventGatherUpdated, GatherUpdated{Status: status})
+		}
+	case protocol.KindStatus:
+		status, err := protocol.DecodeStatusEffects(msg.payload)
+		if err != nil {
+			log.Println("Error decoding status effects:", err)
+			return
+		}
+		if msg.primary {
+			g.events.Publish(EventStatusChanged, StatusChanged{Status: status})
+		}
+	case protocol.KindSeat:
+		change, err := protocol.DecodeSeat(msg.payload)
+		if err != nil {
+			log.Println("Error decoding seat:", err)
+			return
+		}
+		if msg.primary {
+			g.events.Publish(EventSeatChanged, SeatChanged{Change: change})
+		}
+	case protocol.KindDoor:
+		id, open, err := protocol.DecodeDoor(msg.payload)
+		if err != nil {
+			log.Println("Error decoding door:", err)
+			return
+		}
+		if msg.primary {
+			g.events.Publish(EventDoorChanged, DoorChanged{ID: id, Open: open})
+		}
+	case protocol.KindArea:
+		if msg.primary {
+			g.events.Publish(EventAreaChanged, AreaChanged{Area: msg.payload})
+		}
+	case protocol.KindFeed:
+		event, err := protocol.DecodeFeedEvent(msg.payload)
+		if err != nil {
+			log.Println("Error decoding feed event:", err)
+			return
+		}
+		if msg.primary {
+			g.events.Publish(EventFeedReceived, FeedReceived{Event: event})
+		}
+	case protocol.KindMatch:
+		status, err := protocol.DecodeMatchStatus(msg.payload)
+		if err != nil {
+			log.Println("Error decoding match status:", err)
+			return
+		}
+		if msg.primary {
+			g.events.Publish(EventMatchUpdated, MatchUpdated{Status: status})
+		}
+	case protocol.KindMatchPhase:
+		phase, err := protocol.DecodeMatchPhase(msg.payload)
+		if err != nil {
+			log.Println("Error decoding match phase:", err)
+			return
+		}
+		if msg.primary {
+			g.events.Publish(EventMatchPhaseChanged, MatchPhaseChanged{Phase: phase})
+		}
+	case protocol.KindAmbient:
+		ambient, err := protocol.DecodeAmbient(msg.payload)
+		if err != nil {
+			log.Println("Error decoding ambient light:", err)
+			return
+		}
+		if msg.primary {
+			g.events.Publish(EventAmbientChanged, AmbientChanged{Ambient: ambient})
+		}
+	case protocol.KindMOTD:
+		motd, err := protocol.DecodeMOTD(msg.payload)
+		if err != nil {
+			log.Println("Error decoding message of the day:", err)
+			return
+		}
+		if msg.primary {
+			g.events.Publish(EventMOTDReceived, MOTDReceived{MOTD: motd})
+		}
+	case protocol.KindVision:
+		vision, err := protocol.DecodeVision(msg.payload)
+		if err != nil {
+			log.Println("Error decoding vision:", err)
+			return
+		}
+		if msg.primary {
+			g.events.Publish(EventVisionChanged, VisionChanged{Vision: vision})
+		}
+	case protocol.KindPaused:
+		status, err := protocol.DecodePauseStatus(msg.payload)
+		if err != nil {
+			log.Println("Error decoding pause status:", err)
+			return
+		}
+		if msg.primary {
+			g.events.Publish(EventPauseChanged, PauseChanged{Status: status})
+		}
+	case protocol.KindMatchResults:
+		results, err := protocol.DecodeMatchResults(msg.payload)
+		if err != nil {
+			log.Println("Error decoding match results:", err)
+			return
+		}
+		if msg.primary {
+			g.events.Publish(EventMatchEnded, MatchEnded{Results: results})
+		}
+	case protocol.KindHarvest:
+		if msg.primary {
+			g.events.Publish(EventResourceHarvested, ResourceHarvested{ID: msg.payload})
+		}
+	case protocol.KindVoice:
+		if msg.primary && g.voice != nil {
+			g.connectVoice(msg.local, msg.payload)
+		}
+	case protocol.KindKick:
+		g.events.Publish(EventKicked, Kicked{Reason: msg.payload})
+	case protocol.KindTeleport:
+		x, y, seq, level, err := protocol.DecodeTeleport(msg.payload)
+		if err != nil {
+			log.Println("Error decoding teleport:", err)
+			return
+		}
+		// Without prediction there is nothing to replay; the player just
+		// lands where the server put them.
+		if !msg.local.predict {
+			seq = 0
+		}
+		from := msg.local.position
+		msg.local.forced = nil
+		msg.local.revive()
+		msg.local.level = level
+		world := g.walkerAt(Vector2f{x, y}, level)
+		msg.local.position = msg.local.inputs.Reconcile(world, from, Vector2f{x, y}, seq, g.moveSpeed(msg.local), g.clock.ServerNow())
+		msg.local.sender.Flush()
+		g.events.Publish(EventTeleported, Teleported{Player: msg.local, From: from, Position: msg.local.position})
+	case protocol.KindPush:
+		push, err := protocol.DecodePush(msg.payload)
+		if err != nil {
+			log.Println("Error decoding push:", err)
+			return
+		}
+		msg.local.forced = NewForcedMove(msg.local.position, push)
+	case protocol.KindClock:
+		clientTime, serverTime, err := protocol.DecodeClock(msg.payload)
+		if err != nil {
+			log.Println("Error decoding clock reply:", err)
+			return
+		}
+		if msg.primary {
+			g.clock.HandleReply(clientTime, serverTime)
+		}
 	}
 }
 
-func main() {
-	conn, err := net.Dial("tcp", "localhost:8080")
+// connectVoice dials the voice port the server offered, on the host the
+// game connection goes to.
+func (g *Game) connectVoice(local *LocalPlayer, payload string) {
+	port, token, key, err := protocol.DecodeVoiceOffer(payload)
+	if err != nil {
+		log.Println("Error decoding voice offer:", err)
+		return
+	}
+	host, _, err := net.SplitHostPort(local.conn.RemoteAddr().String())
 	if err != nil {
-		log.Fatal("Error connecting to server:", err)
+		log.Println("Error finding voice server:", err)
+		return
+	}
+	addr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err == nil {
+		err = g.voice.Connect(addr, token, key, local.conn)
+	}
+	if err != nil {
+		log.Println("Error connecting voice:", err)
+	}
+}
+
+// joinInviteRoom asks the server to move the player into the room from the
+// invite link, if any. Guests enter the world on welcome, account players
+// once their character is selected.
+func (g *Game) joinInviteRoom(local *LocalPlayer) {
+	if local.inviteRoom == "" {
+		return
+	}
+	if _, err := fmt.Fprint(local.conn, protocol.Line(protocol.KindRoom, local.inviteRoom)); err != nil {
+		log.Println("Error joining invite room:", err)
+	}
+	local.inviteRoom = ""
+}
+
+func (g *Game) applySnapshot(snap protocol.Snapshot) {
+	if snap.Weather != g.zoneWeather {
+		g.zoneWeather = snap.Weather
+		g.events.Publish(EventWeatherChanged, WeatherChanged{Weather: snap.Weather})
+	}
+	seen := make(map[string]bool, len(snap.Players))
+	for _, p := range snap.Players {
+		if local := g.localByID(p.ID); local != nil {
+			local.serverPosition, local.hasServerPosition = Vector2f{p.X, p.Y}, true
+			local.idle = p.Idle
+			local.mount = p.Mount
+			continue
+		}
+		seen[p.ID] = true
+		position := Vector2f{p.X, p.Y}
+		player, exists := g.otherPlayers.Get(p.ID)
+		if !exists {
+			player = NewRemotePlayer(g.bodyTexture, g.headTexture, position)
+			g.otherPlayers.Set(p.ID, player, p.X, p.Y)
+			g.events.Publish(EventPlayerJoined, PlayerJoined{ID: p.ID})
+		}
+		player.ApplyState(snap.Time, position, Vector2f{p.VX, p.VY}, p.Direction, p.Anim, p.Warp)
+		player.idle = p.Idle
+		player.mount = p.Mount
+		player.level = p.Level
+	}
+
+	// The server only sends players inside our interest radius, so anyone
+	// missing from the snapshot has left the room or moved out of range.
+	var gone []string
+	g.otherPlayers.Each(func(id string, _ *RemotePlayer) {
+		if !seen[id] {
+			gone = append(gone, id)
+		}
+	})
+	for _, id := range gone {
+		g.otherPlayers.Remove(id)
+		g.events.Publish(EventPlayerLeft, PlayerLeft{ID: id})
+	}
+}
+
+// serverAddress accepts "host", "host:port", IPv6 literals with or without
+// brackets ("::1", "[::1]", "[::1]:8080") and fills in the default port.
+func serverAddress(addr string) string {
+	if host, port, err := net.SplitHostPort(addr); err == nil {
+		return net.JoinHostPort(host, port)
+	}
+	host := strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+	return net.JoinHostPort(host, defaultPort)
+}
+
+func main() {
+	serverAddr := flag.String("server", "localhost:"+defaultPort, "server address as host, host:port or [ipv6]:port")
+	splitScreen := flag.Bool("splitscreen", false, "add a second local player (gamepad, or WASD without one)")
+	offline := flag.Bool("offline", false, "play offline against an in-process server")
+	name := flag.String("name", "", "account name; pick or create a character after logging in (joins as a guest when empty)")
+	password := flag.String("password", "", "password for -name; the first login to an account sets it")
+	syncSession := flag.Bool("sync-session", false, "send the session summary to the server on quit")
+	sendRate := flag.Int("send-rate", defaultSendRate, "state updates sent to the server per second")
+	voice := flag.Bool("voice", false, "talk to nearby players, holding V to speak (needs a client built with -tags voice)")
+	connect := flag.String("connect", "", "join a friend directly: host:port[:room] or an "+inviteScheme+":// invite link (overrides -server)")
+	edit := flag.String("edit", "", "open a map file such as assets/maps/world.json in the map editor instead of playing")
+	editLive := flag.Bool("edit-live", false, "edit the server's shared map (its -edit-map) together with other players instead of playing; needs -name")
+	crashReport := flag.String("crash-report", "", "URL to POST crash reports to, besides writing them to crash-*.log")
+	record := flag.String("record", "", "record what the client receives and sends to a demo file")
+	play := flag.String("play", "", "play back a demo file recorded with -record instead of joining a server")
+	flag.Parse()
+
+	if *edit != "" {
+		if err := runEditor(*edit); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Invite links opened through the OS arrive as the only argument.
+	if *connect == "" && strings.HasPrefix(flag.Arg(0), inviteScheme+"://") {
+		*connect = flag.Arg(0)
+	}
+	invite := Invite{Server: serverAddress(*serverAddr)}
+	if *connect != "" {
+		var err error
+		if invite, err = ParseInvite(*connect); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *editLive {
+		if err := runLiveEditor(invite.Server, *name, *password); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	dial := func() (net.Conn, error) {
+		return net.Dial("tcp", invite.Server)
+	}
+	if *offline {
+		dial = startLocalServer()
+	}
+	var demo *DemoPlayback
+	if *play != "" {
+		var err error
+		if demo, err = LoadDemo(*play); err != nil {
+			log.Fatal("Error loading demo: ", err)
+		}
+		dial = demo.Dial
+		*name, *splitScreen = "", false
+	}
+
+	localCount := 1
+	if *splitScreen {
+		localCount = 2
+	}
+	packets := NewPacketLog()
+	var conns []net.Conn
+	accounts := make([]string, localCount)
+	for i := 0; i < localCount; i++ {
+		rawConn, err := dial()
+		if err != nil {
+			log.Fatal("Error connecting to server:", err)
+		}
+		if *record != "" && i == 0 {
+			if rawConn, err = NewDemoRecorder(rawConn, *record); err != nil {
+				log.Fatal("Error recording demo: ", err)
+			}
+		}
+		defer rawConn.Close()
+		conn := NewPacketConn(rawConn, packets)
+		if demo != nil {
+			conns = append(conns, conn)
+			continue
+		}
+		if *name != "" {
+			accounts[i] = *name
+			if i > 0 {
+				accounts[i] = fmt.Sprintf("%s-%d", *name, i+1)
+			}
+		}
+		if err := login(conn, accounts[i], *password, ""); err != nil {
+			log.Fatal("Error logging in: ", err)
+		}
+		conns = append(conns, conn)
 	}
-	defer conn.Close()
 
 	bodyTexture, _, err := ebitenutil.NewImageFromFile("assets/character.png")
 	if err != nil {
@@ -242,19 +1367,60 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	layers := [][]int{
-		{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
-		{10, 11, 12, 13, 14, 15, 16, 17, 18, 19},
+	tileMap, err := LoadTileMap("assets/maps/world.json")
+	if err != nil {
+		log.Fatal(err)
+	}
+	settings, err := LoadSettings(settingsPath())
+	if err != nil {
+		log.Println("Error loading settings, using defaults:", err)
+	}
+	if err := chooseLanguage(settings.Language); err != nil {
+		log.Println("Error loading language:", err)
 	}
+	if sprites, err = LoadAtlas(atlasPath); err != nil {
+		log.Println("Error loading sprite atlas:", err)
+	}
+	loadPanelSkin(sprites)
 
-	game := NewGame(conn, bodyTexture, headTexture, tilesImage, layers)
+	game := NewGame(conns, packets, bodyTexture, headTexture, tilesImage, tileMap, settings)
+	game.crashes = NewCrashReporter(packets, settings, *crashReport)
+	if demo != nil {
+		game.demo = demo
+		game.freeCamera.StartPlayback()
+	} else {
+		game.dial = dial
+	}
+	if *voice {
+		if game.voice, err = NewVoiceChat(); err != nil {
+			log.Println("Error starting voice chat:", err)
+		} else {
+			defer game.voice.Close()
+		}
+	}
 
-	go game.receiveUpdates()
+	for i, local := range game.localPlayers {
+		local.sender = NewStateSender(*sendRate)
+		local.inviteRoom = invite.Room
+		local.account = accounts[i]
+		local.password = *password
+		if accounts[i] != "" {
+			local.selector = NewCharacterSelect(local.conn, accounts[i])
+		}
+		go game.receiveUpdates(local, i == 0)
+	}
 
-	ebiten.SetWindowSize(screenWidth, screenHeight)
-	ebiten.SetWindowTitle("Multiplayer Game")
+	game.applySettings()
+	ebiten.SetWindowTitle(T("window.title"))
 
 	if err := ebiten.RunGame(game); err != nil {
 		log.Fatal(err)
 	}
+
+	fmt.Println(game.session.Summary())
+	if *syncSession && !game.disconnected {
+		if err := game.session.Sync(game.localPlayers[0].conn); err != nil {
+			log.Println("Error syncing session:", err)
+		}
+	}
 }
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"image/color"
+	"math"
+	"strings"
+
+	"darkzone/MultiTestServer/protocol"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+const matchPanelWidth = 240
+
+// matchCommand turns the chat commands "/queue <mode>" and "/queue leave"
+// into protocol lines.
+func matchCommand(text string) (string, bool) {
+	fields := strings.Fields(text)
+	if len(fields) != 2 || fields[0] != "/queue" {
+		return "", false
+	}
+	if fields[1] == "leave" {
+		return protocol.Line(protocol.KindMatchQueue, ""), true
+	}
+	return protocol.Line(protocol.KindMatchQueue, fields[1]), true
+}
+
+// MatchPanel shows the local player's place in the matchmaking queue, and
+// once a match is found, who is in it and the countdown until it starts.
+type MatchPanel struct {
+	status  *protocol.MatchStatus
+	waited  float64
+	seconds float64
+}
+
+func NewMatchPanel(events *EventBus) *MatchPanel {
+	p := &MatchPanel{}
+	events.Subscribe(EventMatchUpdated, func(e Event) {
+		status := e.Payload.(MatchUpdated).Status
+		switch status.State {
+		case protocol.MatchLeft:
+			p.status = nil
+		case protocol.MatchQueued:
+			if p.status == nil || p.status.State != protocol.MatchQueued {
+				p.waited = 0
+			}
+			p.status = &status
+		case protocol.MatchFound:
+			p.status, p.seconds = &status, status.Seconds
+		}
+	})
+	return p
+}
+
+func (p *MatchPanel) Update(deltaTime float64) {
+	if p.status == nil {
+		return
+	}
+	p.waited += deltaTime
+	if p.status.State == protocol.MatchFound {
+		// The server moves the player once the countdown is up; the panel
+		// goes with it.
+		if p.seconds -= deltaTime; p.seconds <= 0 {
+			p.status = nil
+		}
+	}
+}
+
+func (p *MatchPanel) Draw(screen *ebiten.Image) {
+	if p.status == nil {
+		return
+	}
+	var lines []string
+	switch p.status.State {
+	case protocol.MatchFound:
+		lines = []string{
+			T("match.found", p.status.Mode, int(math.Ceil(p.seconds))),
+			strings.Join(p.status.Players, ", "),
+		}
+	default:
+		lines = []string{
+			T("match.queued", p.status.Mode, int(p.waited)),
+			T("match.waiting", p.status.Waiting),
+		}
+	}
+	x, y := (hudWidth-matchPanelWidth)/2, 32
+	vector.DrawFilledRect(screen, float32(x), float32(y), matchPanelWidth, 40, color.RGBA{0, 0, 0, 160}, false)
+	drawText(screen, strings.Join(lines, "\n"), x+8, y+4, hudText)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+
+	"darkzone/MultiTestServer/protocol"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+const matchTimerWidth = 200
+
+// MatchTimer shows which phase the match the local player is in has
+// reached, and counts down, from what the server last sent, to the next.
+// The results screen covers the intermission, so the timer hides then, and
+// once the countdown runs out without the server moving the match on, as
+// when the player has left it.
+type MatchTimer struct {
+	phase   *protocol.MatchPhase
+	seconds float64
+}
+
+func NewMatchTimer(events *EventBus) *MatchTimer {
+	t := &MatchTimer{}
+	events.Subscribe(EventMatchPhaseChanged, func(e Event) {
+		phase := e.Payload.(MatchPhaseChanged).Phase
+		t.phase, t.seconds = &phase, phase.Seconds
+	})
+	return t
+}
+
+func (t *MatchTimer) Update(deltaTime float64) {
+	if t.phase == nil {
+		return
+	}
+	if t.seconds -= deltaTime; t.seconds <= 0 {
+		t.phase = nil
+	}
+}
+
+func (t *MatchTimer) Draw(screen *ebiten.Image) {
+	if t.phase == nil {
+		return
+	}
+	clock := clockText(t.seconds)
+	var text string
+	switch t.phase.Phase {
+	case protocol.MatchWarmup:
+		text = T("phase.warmup", clock)
+	case protocol.MatchPlaying:
+		text = T("phase.playing", t.phase.Round, t.phase.Rounds, clock)
+	case protocol.MatchRoundEnd:
+		if t.phase.Winner == "" {
+			text = T("phase.draw", t.phase.Round, clock)
+		} else {
+			text = T("phase.roundend", t.phase.Round, t.phase.Winner, clock)
+		}
+	default:
+		return
+	}
+	x := (hudWidth - matchTimerWidth) / 2
+	vector.DrawFilledRect(screen, float32(x), 8, matchTimerWidth, 16, color.RGBA{0, 0, 0, 160}, false)
+	drawText(screen, text, x+8, 8, hudText)
+}
+
+// clockText formats a countdown as minutes and seconds, rounding up so it
+// reads 0:00 only once it is over.
+func clockText(seconds float64) string {
+	s := int(math.Ceil(seconds))
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
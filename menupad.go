@@ -0,0 +1,117 @@
+package main
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+// MenuAction is a gamepad's part in working the menus, alongside the keys
+// each menu takes.
+type MenuAction int
+
+const (
+	MenuUp MenuAction = iota
+	MenuDown
+	MenuLeft
+	MenuRight
+	// MenuAccept chooses what has focus.
+	MenuAccept
+	// MenuBack cancels, or closes the menu.
+	MenuBack
+	// MenuAlt and MenuExtra are a menu's other actions, like selling.
+	MenuAlt
+	MenuExtra
+	// MenuStart opens the settings and MenuSelect the crafting window.
+	MenuStart
+	MenuSelect
+)
+
+// menuButtons are the standard layout's buttons for each action: the d-pad,
+// A, B, X, Y, Start and Back.
+var menuButtons = [...]ebiten.StandardGamepadButton{
+	MenuUp:     ebiten.StandardGamepadButtonLeftTop,
+	MenuDown:   ebiten.StandardGamepadButtonLeftBottom,
+	MenuLeft:   ebiten.StandardGamepadButtonLeftLeft,
+	MenuRight:  ebiten.StandardGamepadButtonLeftRight,
+	MenuAccept: ebiten.StandardGamepadButtonRightBottom,
+	MenuBack:   ebiten.StandardGamepadButtonRightRight,
+	MenuAlt:    ebiten.StandardGamepadButtonRightLeft,
+	MenuExtra:  ebiten.StandardGamepadButtonRightTop,
+	MenuStart:  ebiten.StandardGamepadButtonCenterRight,
+	MenuSelect: ebiten.StandardGamepadButtonCenterLeft,
+}
+
+// menuStickThreshold is how far the left stick is pushed to move focus a
+// step, as the d-pad would.
+const menuStickThreshold = 0.5
+
+// MenuGamepad reads every connected gamepad for the menus: their buttons,
+// the left stick flicked like a d-pad, and whether a gamepad or the keyboard
+// and mouse were used last, so hints name the buttons in the player's hands.
+type MenuGamepad struct {
+	ids     []ebiten.GamepadID
+	keys    []ebiten.Key
+	pressed [len(menuButtons)]bool
+	// stick is which of Up, Down, Left and Right the stick is held to.
+	stick   [4]bool
+	gamepad bool
+}
+
+// menuPad is read by every menu; Game.Update updates it first thing each
+// frame.
+var menuPad MenuGamepad
+
+func (p *MenuGamepad) Update() {
+	p.pressed = [len(menuButtons)]bool{}
+	var stick [4]bool
+	p.ids = ebiten.AppendGamepadIDs(p.ids[:0])
+	for _, id := range p.ids {
+		var x, y float64
+		if ebiten.IsStandardGamepadLayoutAvailable(id) {
+			for action, button := range menuButtons {
+				p.pressed[action] = p.pressed[action] || inpututil.IsStandardGamepadButtonJustPressed(id, button)
+			}
+			x = ebiten.StandardGamepadAxisValue(id, ebiten.StandardGamepadAxisLeftStickHorizontal)
+			y = ebiten.StandardGamepadAxisValue(id, ebiten.StandardGamepadAxisLeftStickVertical)
+		} else {
+			// Other pads are only known to have buttons and a stick.
+			p.pressed[MenuAccept] = p.pressed[MenuAccept] || inpututil.IsGamepadButtonJustPressed(id, ebiten.GamepadButton0)
+			p.pressed[MenuBack] = p.pressed[MenuBack] || inpututil.IsGamepadButtonJustPressed(id, ebiten.GamepadButton1)
+			if ebiten.GamepadAxisCount(id) >= 2 {
+				x, y = ebiten.GamepadAxisValue(id, 0), ebiten.GamepadAxisValue(id, 1)
+			}
+		}
+		stick[MenuUp] = stick[MenuUp] || y < -menuStickThreshold
+		stick[MenuDown] = stick[MenuDown] || y > menuStickThreshold
+		stick[MenuLeft] = stick[MenuLeft] || x < -menuStickThreshold
+		stick[MenuRight] = stick[MenuRight] || x > menuStickThreshold
+	}
+	for dir, held := range stick {
+		if held && !p.stick[dir] {
+			p.pressed[dir] = true
+		}
+	}
+	p.stick = stick
+
+	for _, pressed := range p.pressed {
+		p.gamepad = p.gamepad || pressed
+	}
+	p.keys = inpututil.AppendJustPressedKeys(p.keys[:0])
+	if len(p.keys) > 0 || inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		p.gamepad = false
+	}
+}
+
+// Pressed reports whether action was pressed on any gamepad this frame.
+func (p *MenuGamepad) Pressed(action MenuAction) bool {
+	return p.pressed[action]
+}
+
+// Hint is the help text under id, or its gamepad version under id+".pad"
+// while a gamepad is the last thing used.
+func (p *MenuGamepad) Hint(id string, args ...any) string {
+	if p.gamepad {
+		id += ".pad"
+	}
+	return T(id, args...)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"darkzone/MultiTestServer/protocol"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+const (
+	motdWidth  = 440
+	motdHeight = 260
+)
+
+// MOTDPanel shows the server's message of the day as the player connects,
+// and holds them out of the world until they dismiss it with Escape or a
+// click.
+type MOTDPanel struct {
+	motd *protocol.MOTD
+}
+
+func NewMOTDPanel(events *EventBus) *MOTDPanel {
+	p := &MOTDPanel{}
+	events.Subscribe(EventMOTDReceived, func(e Event) {
+		motd := e.Payload.(MOTDReceived).MOTD
+		p.motd = &motd
+	})
+	return p
+}
+
+func (p *MOTDPanel) Open() bool {
+	return p.motd != nil
+}
+
+func (p *MOTDPanel) Update() {
+	if p.motd == nil {
+		return
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) || inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) || menuPad.Pressed(MenuAccept) || menuPad.Pressed(MenuBack) {
+		p.motd = nil
+	}
+}
+
+func (p *MOTDPanel) Draw(screen *ebiten.Image) {
+	if p.motd == nil {
+		return
+	}
+	x, y := (hudWidth-motdWidth)/2, (hudHeight-motdHeight)/2
+	drawPanel(screen, float64(x), float64(y), motdWidth, motdHeight)
+	drawText(screen, p.motd.Title, x+16, y+12, titleText)
+	drawText(screen, wrapText(p.motd.Text, motdWidth-32, hudText), x+16, y+48, hudText)
+	drawText(screen, menuPad.Hint("motd.dismiss"), x+16, y+motdHeight-24, hudText)
+}
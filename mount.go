@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+
+	"darkzone/MultiTestServer/protocol"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+// mountRise is how far a rider sits above where they would stand.
+const mountRise = 10.0
+
+var mountColor = color.RGBA{120, 80, 45, 255}
+
+// toggleMount asks the server to put the player on the default mount, or to
+// get them down when riding. Whether they ride arrives in snapshots.
+func (g *Game) toggleMount(local *LocalPlayer) error {
+	mount := protocol.DefaultMount
+	if local.mount != "" {
+		mount = ""
+	}
+	_, err := fmt.Fprint(local.conn, protocol.Line(protocol.KindMount, mount))
+	return err
+}
+
+// drawMount draws what the character rides under them: the atlas's sprite
+// for it, such as "mount/horse", with its top-left at the character's, or a
+// plain body and head facing the way the rider does without one.
+func (c *Character) drawMount(screen *ebiten.Image, cameraOffset Vector2f) {
+	x, y := c.position.X-cameraOffset.X, c.position.Y-cameraOffset.Y
+	if sprite, ok := sprites.Sprite("mount/" + c.mount); ok {
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Translate(x, y)
+		screen.DrawImage(sprite, op)
+		return
+	}
+	facing := facingVectors[c.direction%len(facingVectors)]
+	cx, cy := float32(x+frameWidth/2), float32(y+frameHeight-6)
+	width, height := float32(40), float32(12)
+	if facing.X == 0 {
+		width, height = 16, 28
+		cy -= 6
+	}
+	for _, dx := range []float32{-width/2 + 3, width/2 - 5} {
+		vector.DrawFilledRect(screen, cx+dx, cy+height/2-2, 2, 8, mountColor, false)
+	}
+	vector.DrawFilledRect(screen, cx-width/2, cy-height/2, width, height, mountColor, false)
+	head := Vector2f{float64(cx) + facing.X*float64(width/2+2), float64(cy) + facing.Y*float64(height/2+2)}
+	vector.DrawFilledCircle(screen, float32(head.X), float32(head.Y)-2, 6, mountColor, false)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+var (
+	panelFill   = color.RGBA{8, 8, 16, 210}
+	panelBorder = color.RGBA{120, 120, 150, 230}
+	// panelSkin is what UI panels are drawn with: the "ui/panel" sprite
+	// from the atlas, with 4 pixel borders, or a plain bordered panel
+	// without one.
+	panelSkin = newDefaultPanelSkin()
+)
+
+// NineSlice draws a small texture stretched to any size without stretching
+// its corners: the corners are drawn as they are, the edges stretched along
+// their length and the middle stretched both ways. Left, Top, Right and
+// Bottom are how far the border reaches in from each side of the texture.
+type NineSlice struct {
+	Image                    *ebiten.Image
+	Left, Top, Right, Bottom int
+}
+
+// Draw fills the rectangle at x, y on dst, width by height, which should be
+// at least as big as the borders.
+func (n NineSlice) Draw(dst *ebiten.Image, x, y, width, height float64) {
+	b := n.Image.Bounds()
+	// The columns and rows of the texture, and of the rectangle they
+	// stretch to.
+	srcX := [4]int{b.Min.X, b.Min.X + n.Left, b.Max.X - n.Right, b.Max.X}
+	srcY := [4]int{b.Min.Y, b.Min.Y + n.Top, b.Max.Y - n.Bottom, b.Max.Y}
+	dstX := [4]float64{x, x + float64(n.Left), x + width - float64(n.Right), x + width}
+	dstY := [4]float64{y, y + float64(n.Top), y + height - float64(n.Bottom), y + height}
+
+	for row := 0; row < 3; row++ {
+		for col := 0; col < 3; col++ {
+			sw, sh := srcX[col+1]-srcX[col], srcY[row+1]-srcY[row]
+			dw, dh := dstX[col+1]-dstX[col], dstY[row+1]-dstY[row]
+			if sw <= 0 || sh <= 0 || dw <= 0 || dh <= 0 {
+				continue
+			}
+			op := &ebiten.DrawImageOptions{}
+			op.GeoM.Scale(dw/float64(sw), dh/float64(sh))
+			op.GeoM.Translate(dstX[col], dstY[row])
+			dst.DrawImage(n.Image.SubImage(image.Rect(srcX[col], srcY[row], srcX[col+1], srcY[row+1])).(*ebiten.Image), op)
+		}
+	}
+}
+
+// newDefaultPanelSkin is a 12 pixel panel with a 1 pixel border and cut
+// corners, for clients without a skinned panel in their atlas.
+func newDefaultPanelSkin() NineSlice {
+	const size, border = 12, 4
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			edgeX, edgeY := min(x, size-1-x), min(y, size-1-y)
+			switch {
+			case edgeX+edgeY < 1:
+				// Cut corner.
+			case edgeX == 0 || edgeY == 0 || edgeX+edgeY == 1:
+				img.SetRGBA(x, y, panelBorder)
+			default:
+				img.SetRGBA(x, y, panelFill)
+			}
+		}
+	}
+	return NineSlice{Image: ebiten.NewImageFromImage(img), Left: border, Top: border, Right: border, Bottom: border}
+}
+
+// loadPanelSkin takes the panel skin from the atlas, if it has one.
+func loadPanelSkin(atlas *Atlas) {
+	if img, ok := atlas.Sprite("ui/panel"); ok {
+		panelSkin = NineSlice{Image: img, Left: 4, Top: 4, Right: 4, Bottom: 4}
+	}
+}
+
+// drawPanel draws a UI window's background.
+func drawPanel(screen *ebiten.Image, x, y, width, height float64) {
+	panelSkin.Draw(screen, x, y, width, height)
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"log"
+	"net"
+
+	"darkzone/MultiTestServer/gameserver"
+)
+
+// startLocalServer runs the game server inside the client process and returns
+// a dialer that connects to it over in-memory pipes instead of sockets.
+func startLocalServer() func() (net.Conn, error) {
+	world, err := gameserver.LoadWorldMap("assets/maps/world.json")
+	if err != nil {
+		log.Println("Error loading map for the local server, positions are unchecked:", err)
+	}
+	server := gameserver.NewServer(gameserver.Config{World: world})
+	server.Start()
+
+	return func() (net.Conn, error) {
+		clientConn, serverConn := net.Pipe()
+		go server.HandleConn(serverConn)
+		return clientConn, nil
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+const (
+	packetLogSize    = 4096
+	packetStatWindow = time.Second
+	// packetTextLimit is how much of each message the log keeps, enough to
+	// read what it was in a crash report without holding whole snapshots.
+	packetTextLimit = 160
+)
+
+type PacketDirection byte
+
+const (
+	PacketIn  PacketDirection = '<'
+	PacketOut PacketDirection = '>'
+)
+
+type PacketRecord struct {
+	Time      time.Time
+	Direction PacketDirection
+	Kind      string
+	Size      int
+	// Text is the start of the message, up to packetTextLimit bytes.
+	Text string
+}
+
+// PacketLog keeps the most recent messages sent and received on every
+// connection in a fixed-size ring buffer, for the stats overlay and dumps.
+type PacketLog struct {
+	mu      sync.Mutex
+	records []PacketRecord
+	next    int
+	full    bool
+}
+
+func NewPacketLog() *PacketLog {
+	return &PacketLog{records: make([]PacketRecord, packetLogSize)}
+}
+
+func (l *PacketLog) Record(direction PacketDirection, line []byte) {
+	kind, _, _ := bytes.Cut(line, []byte(","))
+	text := bytes.TrimSpace(line)
+	text = text[:min(len(text), packetTextLimit)]
+	record := PacketRecord{Time: time.Now(), Direction: direction, Kind: string(bytes.TrimSpace(kind)), Size: len(line), Text: string(text)}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.records[l.next] = record
+	l.next = (l.next + 1) % len(l.records)
+	l.full = l.full || l.next == 0
+}
+
+// Records returns the buffered records, oldest first.
+func (l *PacketLog) Records() []PacketRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.full {
+		return append([]PacketRecord(nil), l.records[:l.next]...)
+	}
+	return append(append([]PacketRecord(nil), l.records[l.next:]...), l.records[:l.next]...)
+}
+
+type PacketStat struct {
+	Kind      string
+	Direction PacketDirection
+	Count     int
+	Bytes     int
+}
+
+// Stats summarizes the records of the last packetStatWindow per message kind
+// and direction, which over a one-second window are per-second rates.
+func (l *PacketLog) Stats() []PacketStat {
+	cutoff := time.Now().Add(-packetStatWindow)
+	byKind := make(map[string]*PacketStat)
+	for _, r := range l.Records() {
+		if r.Time.Before(cutoff) {
+			continue
+		}
+		key := string(r.Direction) + r.Kind
+		stat, ok := byKind[key]
+		if !ok {
+			stat = &PacketStat{Kind: r.Kind, Direction: r.Direction}
+			byKind[key] = stat
+		}
+		stat.Count++
+		stat.Bytes += r.Size
+	}
+
+	stats := make([]PacketStat, 0, len(byKind))
+	for _, stat := range byKind {
+		stats = append(stats, *stat)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Direction != stats[j].Direction {
+			return stats[i].Direction < stats[j].Direction
+		}
+		return stats[i].Kind < stats[j].Kind
+	})
+	return stats
+}
+
+// Dump writes the buffer as tab-separated lines: RFC 3339 timestamp with
+// milliseconds, direction (< received, > sent), message kind and size.
+func (l *PacketLog) Dump(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, r := range l.Records() {
+		fmt.Fprintf(w, "%s\t%c\t%s\t%d\n", r.Time.Format("2006-01-02T15:04:05.000Z07:00"), r.Direction, r.Kind, r.Size)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (l *PacketLog) Draw(screen *ebiten.Image) {
+	var b strings.Builder
+	b.WriteString(T("packets.title") + "\n")
+	for _, stat := range l.Stats() {
+		fmt.Fprintf(&b, "%c %-8s %4d %7dB\n", stat.Direction, stat.Kind, stat.Count, stat.Bytes)
+	}
+	drawText(screen, b.String(), screenWidth-200, 8, tableText)
+}
+
+// packetConn records every newline-terminated message that crosses conn.
+// Received bytes are split into lines as they arrive, so the log sees whole
+// messages no matter how reads are chunked.
+type packetConn struct {
+	net.Conn
+	log     *PacketLog
+	partial []byte
+}
+
+func NewPacketConn(conn net.Conn, log *PacketLog) net.Conn {
+	return &packetConn{Conn: conn, log: log}
+}
+
+func (c *packetConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.partial = append(c.partial, p[:n]...)
+	for {
+		i := bytes.IndexByte(c.partial, '\n')
+		if i < 0 {
+			break
+		}
+		c.log.Record(PacketIn, c.partial[:i+1])
+		c.partial = c.partial[i+1:]
+	}
+	return n, err
+}
+
+func (c *packetConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	for _, line := range bytes.SplitAfter(p[:n], []byte("\n")) {
+		if len(line) > 0 {
+			c.log.Record(PacketOut, line)
+		}
+	}
+	return n, err
+}
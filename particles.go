@@ -0,0 +1,246 @@
+package main
+
+import (
+	"image/color"
+	"math/rand"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+const maxParticlesPerEmitter = 4096
+
+type EmitterConfig struct {
+	Rate           float64
+	Lifetime       float64
+	Velocity       Vector2f
+	VelocityJitter Vector2f
+	SpawnArea      Vector2f
+	Size           float64
+	Color          color.RGBA
+	Sprite         *ebiten.Image
+	MaxParticles   int
+}
+
+type particle struct {
+	position Vector2f
+	velocity Vector2f
+	age      float64
+	lifetime float64
+}
+
+type Emitter struct {
+	config      EmitterConfig
+	Position    Vector2f
+	Active      bool
+	particles   []particle
+	accumulator float64
+	vertices    []ebiten.Vertex
+	indices     []uint16
+}
+
+var defaultParticleSprite = func() *ebiten.Image {
+	img := ebiten.NewImage(4, 4)
+	img.Fill(color.White)
+	return img
+}()
+
+func NewEmitter(config EmitterConfig, position Vector2f) *Emitter {
+	if config.Sprite == nil {
+		config.Sprite = defaultParticleSprite
+	}
+	if config.MaxParticles <= 0 || config.MaxParticles > maxParticlesPerEmitter {
+		config.MaxParticles = maxParticlesPerEmitter
+	}
+	if config.Size <= 0 {
+		config.Size = float64(config.Sprite.Bounds().Dx())
+	}
+	return &Emitter{
+		config:   config,
+		Position: position,
+		Active:   true,
+	}
+}
+
+func (e *Emitter) Update(deltaTime float64) {
+	if e.Active {
+		e.accumulator += e.config.Rate * deltaTime
+		for e.accumulator >= 1 {
+			e.spawn()
+			e.accumulator--
+		}
+	}
+
+	alive := e.particles[:0]
+	for _, p := range e.particles {
+		p.age += deltaTime
+		if p.age >= p.lifetime {
+			continue
+		}
+		p.position.X += p.velocity.X * deltaTime
+		p.position.Y += p.velocity.Y * deltaTime
+		alive = append(alive, p)
+	}
+	e.particles = alive
+}
+
+func (e *Emitter) Burst(count int) {
+	for i := 0; i < count; i++ {
+		e.spawn()
+	}
+}
+
+func (e *Emitter) Idle() bool {
+	return !e.Active && len(e.particles) == 0
+}
+
+func (e *Emitter) spawn() {
+	if len(e.particles) >= e.config.MaxParticles {
+		return
+	}
+	e.particles = append(e.particles, particle{
+		position: Vector2f{
+			X: e.Position.X + (rand.Float64()-0.5)*e.config.SpawnArea.X,
+			Y: e.Position.Y + (rand.Float64()-0.5)*e.config.SpawnArea.Y,
+		},
+		velocity: Vector2f{
+			X: e.config.Velocity.X + (rand.Float64()-0.5)*e.config.VelocityJitter.X,
+			Y: e.config.Velocity.Y + (rand.Float64()-0.5)*e.config.VelocityJitter.Y,
+		},
+		lifetime: e.config.Lifetime,
+	})
+}
+
+// Draw renders every live particle of the emitter with a single
+// DrawTriangles call, so an emitter costs one draw call regardless of size.
+func (e *Emitter) Draw(screen *ebiten.Image, cameraOffset Vector2f) {
+	if len(e.particles) == 0 {
+		return
+	}
+
+	bounds := e.config.Sprite.Bounds()
+	sx0, sy0 := float32(bounds.Min.X), float32(bounds.Min.Y)
+	sx1, sy1 := float32(bounds.Max.X), float32(bounds.Max.Y)
+	half := float32(e.config.Size / 2)
+	r := float32(e.config.Color.R) / 255
+	g := float32(e.config.Color.G) / 255
+	b := float32(e.config.Color.B) / 255
+	a := float32(e.config.Color.A) / 255
+
+	e.vertices = e.vertices[:0]
+	e.indices = e.indices[:0]
+	for i, p := range e.particles {
+		x := float32(p.position.X - cameraOffset.X)
+		y := float32(p.position.Y - cameraOffset.Y)
+		fade := a * float32(1-p.age/p.lifetime)
+
+		e.vertices = append(e.vertices,
+			ebiten.Vertex{DstX: x - half, DstY: y - half, SrcX: sx0, SrcY: sy0, ColorR: r, ColorG: g, ColorB: b, ColorA: fade},
+			ebiten.Vertex{DstX: x + half, DstY: y - half, SrcX: sx1, SrcY: sy0, ColorR: r, ColorG: g, ColorB: b, ColorA: fade},
+			ebiten.Vertex{DstX: x - half, DstY: y + half, SrcX: sx0, SrcY: sy1, ColorR: r, ColorG: g, ColorB: b, ColorA: fade},
+			ebiten.Vertex{DstX: x + half, DstY: y + half, SrcX: sx1, SrcY: sy1, ColorR: r, ColorG: g, ColorB: b, ColorA: fade},
+		)
+		base := uint16(i * 4)
+		e.indices = append(e.indices, base, base+1, base+2, base+1, base+3, base+2)
+	}
+
+	screen.DrawTriangles(e.vertices, e.indices, e.config.Sprite, nil)
+}
+
+type ParticleSystem struct {
+	emitters []*Emitter
+}
+
+func NewParticleSystem() *ParticleSystem {
+	return &ParticleSystem{}
+}
+
+func (ps *ParticleSystem) Add(emitter *Emitter) *Emitter {
+	ps.emitters = append(ps.emitters, emitter)
+	return emitter
+}
+
+func (ps *ParticleSystem) Remove(emitter *Emitter) {
+	for i, e := range ps.emitters {
+		if e == emitter {
+			ps.emitters = append(ps.emitters[:i], ps.emitters[i+1:]...)
+			return
+		}
+	}
+}
+
+func (ps *ParticleSystem) Update(deltaTime float64) {
+	for _, e := range ps.emitters {
+		e.Update(deltaTime)
+	}
+}
+
+func (ps *ParticleSystem) Draw(screen *ebiten.Image, cameraOffset Vector2f) {
+	for _, e := range ps.emitters {
+		e.Draw(screen, cameraOffset)
+	}
+}
+
+func RainEmitterConfig() EmitterConfig {
+	return EmitterConfig{
+		Rate:           400,
+		Lifetime:       1.2,
+		Velocity:       Vector2f{-60, 520},
+		VelocityJitter: Vector2f{20, 80},
+		SpawnArea:      Vector2f{screenWidth * 1.5, 40},
+		Size:           2,
+		Color:          color.RGBA{170, 190, 255, 180},
+		MaxParticles:   1000,
+	}
+}
+
+func SnowEmitterConfig() EmitterConfig {
+	return EmitterConfig{
+		Rate:           90,
+		Lifetime:       4,
+		Velocity:       Vector2f{15, 45},
+		VelocityJitter: Vector2f{40, 20},
+		SpawnArea:      Vector2f{screenWidth * 1.5, screenHeight * 1.2},
+		Size:           3,
+		Color:          color.RGBA{245, 250, 255, 220},
+		MaxParticles:   600,
+	}
+}
+
+func DustEmitterConfig() EmitterConfig {
+	return EmitterConfig{
+		Rate:           25,
+		Lifetime:       0.45,
+		Velocity:       Vector2f{0, -12},
+		VelocityJitter: Vector2f{30, 10},
+		SpawnArea:      Vector2f{12, 4},
+		Size:           3,
+		Color:          color.RGBA{200, 180, 140, 160},
+		MaxParticles:   64,
+	}
+}
+
+func ChipsEmitterConfig() EmitterConfig {
+	return EmitterConfig{
+		Rate:           18,
+		Lifetime:       0.5,
+		Velocity:       Vector2f{0, -50},
+		VelocityJitter: Vector2f{90, 50},
+		SpawnArea:      Vector2f{resourceSize, resourceSize / 2},
+		Size:           3,
+		Color:          color.RGBA{170, 130, 80, 255},
+		MaxParticles:   96,
+	}
+}
+
+func SparksEmitterConfig() EmitterConfig {
+	return EmitterConfig{
+		Rate:           30,
+		Lifetime:       0.6,
+		Velocity:       Vector2f{0, -60},
+		VelocityJitter: Vector2f{50, 40},
+		SpawnArea:      Vector2f{4, 4},
+		Size:           2,
+		Color:          color.RGBA{255, 190, 80, 255},
+		MaxParticles:   128,
+	}
+}
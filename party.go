@@ -0,0 +1,69 @@
+package main
+
+import (
+	"image/color"
+	"strings"
+
+	"darkzone/MultiTestServer/protocol"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+const (
+	partyPanelWidth = 170
+	partyRowHeight  = 30
+	partyBarHeight  = 5
+)
+
+// partyCommand turns the chat commands "/party invite <name>",
+// "/party accept [name]" and "/party leave" into protocol lines.
+func partyCommand(text string) (string, bool) {
+	fields := strings.Fields(text)
+	if len(fields) < 2 || fields[0] != "/party" {
+		return "", false
+	}
+	arg := strings.Join(fields[2:], " ")
+	switch fields[1] {
+	case "invite":
+		return protocol.Line(protocol.KindPartyInvite, arg), arg != ""
+	case "accept":
+		return protocol.Line(protocol.KindPartyAccept, arg), true
+	case "leave":
+		return protocol.Line(protocol.KindPartyLeave, ""), true
+	}
+	return "", false
+}
+
+// PartyPanel lists the local player's party in the top right corner, with
+// each member's health, whether or not they are on screen.
+type PartyPanel struct {
+	members []protocol.PartyMember
+}
+
+func NewPartyPanel(events *EventBus) *PartyPanel {
+	p := &PartyPanel{}
+	events.Subscribe(EventPartyChanged, func(e Event) {
+		p.members = e.Payload.(PartyChanged).Members
+	})
+	return p
+}
+
+func (p *PartyPanel) Draw(screen *ebiten.Image) {
+	if len(p.members) == 0 {
+		return
+	}
+	x := hudWidth - partyPanelWidth - 8
+	y := 8
+	height := 20 + partyRowHeight*len(p.members)
+	vector.DrawFilledRect(screen, float32(x), float32(y), partyPanelWidth, float32(height), color.RGBA{0, 0, 0, 160}, false)
+	drawText(screen, T("party.title"), x+8, y+4, hudText)
+
+	for i, m := range p.members {
+		rowY := y + 20 + i*partyRowHeight
+		drawText(screen, m.Name, x+8, rowY, hudText)
+		barWidth := float32(partyPanelWidth - 16)
+		filled := barWidth * float32(max(0, min(m.Health, protocol.MaxHealth))) / protocol.MaxHealth
+		vector.DrawFilledRect(screen, float32(x+8), float32(rowY+18), barWidth, partyBarHeight, activePalette.HealthBack, false)
+		vector.DrawFilledRect(screen, float32(x+8), float32(rowY+18), filled, partyBarHeight, activePalette.Health, false)
+	}
+}
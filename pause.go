@@ -0,0 +1,58 @@
+package main
+
+import (
+	"image/color"
+	"io"
+	"strings"
+
+	"darkzone/MultiTestServer/protocol"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+var pauseOverlay = color.RGBA{0, 0, 20, 150}
+
+// PauseVote lets the player vote with P to pause a small co-op room. It
+// shows who has voted while the vote is open, and dims the screen while
+// everyone has and the server holds the room still.
+type PauseVote struct {
+	status protocol.PauseStatus
+}
+
+func NewPauseVote(events *EventBus) *PauseVote {
+	v := &PauseVote{}
+	events.Subscribe(EventPauseChanged, func(e Event) {
+		v.status = e.Payload.(PauseChanged).Status
+	})
+	return v
+}
+
+// Paused reports whether the server is holding the room still.
+func (v *PauseVote) Paused() bool {
+	return v.status.Paused
+}
+
+// Update casts or takes back the player's vote on conn.
+func (v *PauseVote) Update(typing bool, conn io.Writer) error {
+	if typing || !inpututil.IsKeyJustPressed(ebiten.KeyP) {
+		return nil
+	}
+	vote := protocol.PauseOn
+	if v.status.Voted {
+		vote = protocol.PauseOff
+	}
+	_, err := io.WriteString(conn, protocol.Line(protocol.KindPause, vote))
+	return err
+}
+
+func (v *PauseVote) Draw(screen *ebiten.Image) {
+	switch {
+	case v.status.Paused:
+		vector.DrawFilledRect(screen, 0, 0, float32(hudWidth), float32(hudHeight), pauseOverlay, false)
+		drawCentered(screen, []string{T("pause.paused"), T("pause.resume")}, hudWidth, hudHeight/3, titleText)
+	case len(v.status.Votes) > 0:
+		line := T("pause.votes", len(v.status.Votes), v.status.Players, strings.Join(v.status.Votes, ", "))
+		drawCentered(screen, []string{line}, hudWidth, 8, hudText)
+	}
+}
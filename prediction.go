@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+)
+
+const (
+	// inputHistory is how many update frames of local input are kept,
+	// about two seconds at 120 updates a second; reconciliation never needs
+	// more than a round trip's worth.
+	inputHistory = 256
+	// correctionHistory is how many reconciliations are kept for the
+	// debug dump.
+	correctionHistory = 16
+)
+
+// Blocker reports positions players cannot stand in; *TileMap is one.
+type Blocker interface {
+	Blocked(x, y float64) bool
+}
+
+// InputFrame is one update of local input and the position predicted from
+// it. Seq is the state report the frame first shows up in, so frames with
+// a Seq above what the server has applied are the ones it has not seen.
+type InputFrame struct {
+	Time      float64
+	Seq       int
+	DeltaTime float64
+	Intent    Vector2f
+	Attack    bool
+	Position  Vector2f
+}
+
+// Correction is a server teleport the local prediction was reconciled to.
+type Correction struct {
+	Time      float64
+	Seq       int
+	Predicted Vector2f
+	Server    Vector2f
+	Replayed  Vector2f
+}
+
+// PredictMove advances a position by one frame of input, moving each axis
+// separately so players slide along walls. Live play and replay share it, so
+// replaying recorded frames from the same start gives the same positions.
+func PredictMove(world Blocker, position, intent Vector2f, speed, deltaTime float64) (next, velocity Vector2f) {
+	velocity = Vector2f{intent.X * speed, intent.Y * speed}
+	next = position
+	if x := next.X + velocity.X*deltaTime; !world.Blocked(x, next.Y) {
+		next.X = x
+	} else {
+		velocity.X = 0
+	}
+	if y := next.Y + velocity.Y*deltaTime; !world.Blocked(next.X, y) {
+		next.Y = y
+	} else {
+		velocity.Y = 0
+	}
+	return next, velocity
+}
+
+// Replay re-applies frames from start and returns where they lead.
+func Replay(world Blocker, start Vector2f, frames []InputFrame, speed float64) Vector2f {
+	position := start
+	for _, f := range frames {
+		position, _ = PredictMove(world, position, f.Intent, speed, f.DeltaTime)
+	}
+	return position
+}
+
+// InputBuffer is a ring of the most recent input frames plus the latest
+// corrections, kept for reconciliation and the debug dump.
+type InputBuffer struct {
+	frames      []InputFrame
+	next        int
+	full        bool
+	corrections []Correction
+}
+
+func NewInputBuffer(size int) *InputBuffer {
+	return &InputBuffer{frames: make([]InputFrame, size)}
+}
+
+func (b *InputBuffer) Add(f InputFrame) {
+	b.frames[b.next] = f
+	b.next = (b.next + 1) % len(b.frames)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// Frames returns the buffered frames, oldest first.
+func (b *InputBuffer) Frames() []InputFrame {
+	if !b.full {
+		return append([]InputFrame(nil), b.frames[:b.next]...)
+	}
+	return append(append([]InputFrame(nil), b.frames[b.next:]...), b.frames[:b.next]...)
+}
+
+// Since returns the frames the server had not seen when it applied report
+// seq, oldest first.
+func (b *InputBuffer) Since(seq int) []InputFrame {
+	var frames []InputFrame
+	for _, f := range b.Frames() {
+		if f.Seq > seq {
+			frames = append(frames, f)
+		}
+	}
+	return frames
+}
+
+// Reconcile moves the prediction onto a server teleport: the player lands at
+// server, then the frames the server had not seen are replayed from there.
+// A seq of 0 means the server had no report to build on, so nothing is
+// replayed.
+func (b *InputBuffer) Reconcile(world Blocker, predicted, server Vector2f, seq int, speed float64, now float64) Vector2f {
+	position := server
+	if seq > 0 {
+		position = Replay(world, server, b.Since(seq), speed)
+	}
+	b.corrections = append(b.corrections, Correction{Time: now, Seq: seq, Predicted: predicted, Server: server, Replayed: position})
+	if len(b.corrections) > correctionHistory {
+		b.corrections = b.corrections[len(b.corrections)-correctionHistory:]
+	}
+	return position
+}
+
+// Dump writes the corrections and buffered frames as tab-separated text,
+// enough to replay a misprediction by hand or in a test.
+func (b *InputBuffer) Dump(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	fmt.Fprintln(w, "# corrections: time\tseq\tpredicted\tserver\treplayed")
+	for _, c := range b.corrections {
+		fmt.Fprintf(w, "%.0f\t%d\t%.2f,%.2f\t%.2f,%.2f\t%.2f,%.2f\n", c.Time, c.Seq,
+			c.Predicted.X, c.Predicted.Y, c.Server.X, c.Server.Y, c.Replayed.X, c.Replayed.Y)
+	}
+	fmt.Fprintln(w, "# frames: time\tseq\tdt\tintent\tattack\tposition")
+	for _, fr := range b.Frames() {
+		fmt.Fprintf(w, "%.0f\t%d\t%.5f\t%.2f,%.2f\t%t\t%.2f,%.2f\n", fr.Time, fr.Seq, fr.DeltaTime,
+			fr.Intent.X, fr.Intent.Y, fr.Attack, fr.Position.X, fr.Position.Y)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,134 @@
+package main
+
+import "testing"
+
+// wallAt blocks everything at or right of X.
+type wallAt struct{ X float64 }
+
+func (w wallAt) Blocked(x, _ float64) bool { return x >= w.X }
+
+const (
+	testSpeed     = 120.0
+	testDeltaTime = 1.0 / 120
+	// testReportEvery is how many update frames go into each state report.
+	testReportEvery = 4
+)
+
+// recordFrames plays intents from start the way the game loop does, adding
+// a frame per update to a buffer, and returns it with where they lead.
+func recordFrames(world Blocker, start Vector2f, intents []Vector2f, size int) (*InputBuffer, Vector2f) {
+	buffer := NewInputBuffer(size)
+	position := start
+	for i, intent := range intents {
+		position, _ = PredictMove(world, position, intent, testSpeed, testDeltaTime)
+		buffer.Add(InputFrame{
+			Time:      float64(i) * testDeltaTime * 1000,
+			Seq:       i/testReportEvery + 1,
+			DeltaTime: testDeltaTime,
+			Intent:    intent,
+			Position:  position,
+		})
+	}
+	return buffer, position
+}
+
+// walkIntoWall heads right into the wall, then down along it.
+func walkIntoWall() []Vector2f {
+	var intents []Vector2f
+	for range 40 {
+		intents = append(intents, Vector2f{1, 0})
+	}
+	for range 40 {
+		intents = append(intents, Vector2f{0.7, 0.7})
+	}
+	return intents
+}
+
+// lastPositionOf is where the frames of report seq left the player, as the
+// server would have applied it.
+func lastPositionOf(buffer *InputBuffer, seq int) Vector2f {
+	var position Vector2f
+	for _, f := range buffer.Frames() {
+		if f.Seq == seq {
+			position = f.Position
+		}
+	}
+	return position
+}
+
+func TestReconcileAgreesWithPrediction(t *testing.T) {
+	world := wallAt{X: 120}
+	buffer, predicted := recordFrames(world, Vector2f{100, 100}, walkIntoWall(), inputHistory)
+
+	for _, seq := range []int{1, 5, 10, 19} {
+		server := lastPositionOf(buffer, seq)
+		if got := buffer.Reconcile(world, predicted, server, seq, testSpeed, 0); got != predicted {
+			t.Errorf("reconciling to report %d: got %v, want the prediction %v", seq, got, predicted)
+		}
+	}
+}
+
+func TestReconcileReplaysFromServer(t *testing.T) {
+	world := wallAt{X: 120}
+	buffer, predicted := recordFrames(world, Vector2f{100, 100}, walkIntoWall(), inputHistory)
+
+	// The server knocked the player back from where report 10 put them.
+	seq := 10
+	server := lastPositionOf(buffer, seq)
+	server.X -= 30
+	got := buffer.Reconcile(world, predicted, server, seq, testSpeed, 0)
+
+	want := server
+	for _, f := range buffer.Frames() {
+		if f.Seq > seq {
+			want, _ = PredictMove(world, want, f.Intent, testSpeed, f.DeltaTime)
+		}
+	}
+	if got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if again := buffer.Reconcile(world, predicted, server, seq, testSpeed, 0); again != got {
+		t.Errorf("replaying again gave %v, first time %v", again, got)
+	}
+	if got.X >= world.X {
+		t.Errorf("replay walked through the wall to %v", got)
+	}
+}
+
+func TestReconcileWithoutSeqSnapsToServer(t *testing.T) {
+	world := wallAt{X: 120}
+	buffer, predicted := recordFrames(world, Vector2f{100, 100}, walkIntoWall(), inputHistory)
+
+	server := Vector2f{50, 60}
+	if got := buffer.Reconcile(world, predicted, server, 0, testSpeed, 0); got != server {
+		t.Errorf("got %v, want the server position %v", got, server)
+	}
+}
+
+func TestReconcileAfterBufferWraps(t *testing.T) {
+	world := wallAt{X: 120}
+	intents := walkIntoWall()
+	buffer, predicted := recordFrames(world, Vector2f{100, 100}, intents, 32)
+
+	if n := len(buffer.Frames()); n != 32 {
+		t.Fatalf("buffer holds %d frames, want 32", n)
+	}
+	seq := len(intents)/testReportEvery - 2
+	server := lastPositionOf(buffer, seq)
+	if got := buffer.Reconcile(world, predicted, server, seq, testSpeed, 0); got != predicted {
+		t.Errorf("got %v, want the prediction %v", got, predicted)
+	}
+}
+
+func TestReconcileKeepsRecentCorrections(t *testing.T) {
+	buffer := NewInputBuffer(inputHistory)
+	for i := range correctionHistory + 5 {
+		buffer.Reconcile(wallAt{X: 1000}, Vector2f{}, Vector2f{}, 0, testSpeed, float64(i))
+	}
+	if n := len(buffer.corrections); n != correctionHistory {
+		t.Fatalf("kept %d corrections, want %d", n, correctionHistory)
+	}
+	if first := buffer.corrections[0].Time; first != 5 {
+		t.Errorf("oldest correction kept is from %v, want 5", first)
+	}
+}
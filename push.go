@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+// ForcedMove is a server push the local player glides along, from wherever
+// prediction had them when it arrived, so the correction reads as a shove
+// rather than a snap back. Movement input is ignored until it ends.
+type ForcedMove struct {
+	from, to Vector2f
+	elapsed  float64
+	seconds  float64
+}
+
+func NewForcedMove(from Vector2f, push protocol.Push) *ForcedMove {
+	return &ForcedMove{from: from, to: Vector2f{push.X, push.Y}, seconds: push.Seconds}
+}
+
+// Step advances the glide, returning the new position and the velocity
+// that got there.
+func (f *ForcedMove) Step(position Vector2f, deltaTime float64) (Vector2f, Vector2f) {
+	f.elapsed += deltaTime
+	t := 1.0
+	if f.seconds > 0 {
+		t = f.elapsed / f.seconds
+	}
+	p := protocol.PushProgress(t)
+	next := Vector2f{f.from.X + (f.to.X-f.from.X)*p, f.from.Y + (f.to.Y-f.from.Y)*p}
+	return next, Vector2f{(next.X - position.X) / deltaTime, (next.Y - position.Y) / deltaTime}
+}
+
+func (f *ForcedMove) Done() bool {
+	return f.elapsed >= f.seconds
+}
+
+// dash asks the server to dash the player along their movement, or the way
+// they face when standing still.
+func (g *Game) dash(local *LocalPlayer, intent Vector2f) {
+	if intent.X == 0 && intent.Y == 0 {
+		intent = facingVectors[local.direction%len(facingVectors)]
+	}
+	fmt.Fprint(local.conn, protocol.Line(protocol.KindDash, protocol.EncodeDash(intent.X, intent.Y)))
+}
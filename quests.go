@@ -0,0 +1,136 @@
+package main
+
+import (
+	"io"
+	"math"
+	"strings"
+
+	"darkzone/MultiTestServer/protocol"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+// questCompleteShown is how many seconds the quest complete popup stays up.
+const questCompleteShown = 4.0
+
+// QuestLog tracks the local player's active quests down the left side of
+// the screen, and shows quest offers and completions in the middle of it.
+// The server owns all progress; the log only displays what it reports.
+type QuestLog struct {
+	offer     *protocol.QuestOffer
+	active    []protocol.QuestStatus
+	completed *protocol.QuestStatus
+	shownFor  float64
+}
+
+func NewQuestLog(events *EventBus) *QuestLog {
+	q := &QuestLog{}
+	events.Subscribe(EventQuestOffered, func(e Event) {
+		offer := e.Payload.(QuestOffered).Offer
+		q.offer = &offer
+	})
+	events.Subscribe(EventQuestUpdated, func(e Event) {
+		q.update(e.Payload.(QuestUpdated).Status)
+	})
+	return q
+}
+
+func (q *QuestLog) update(status protocol.QuestStatus) {
+	i := 0
+	for i < len(q.active) && q.active[i].ID != status.ID {
+		i++
+	}
+	if status.Done {
+		if i < len(q.active) {
+			q.active = append(q.active[:i], q.active[i+1:]...)
+		}
+		q.completed, q.shownFor = &status, questCompleteShown
+		return
+	}
+	if i < len(q.active) {
+		q.active[i] = status
+	} else {
+		q.active = append(q.active, status)
+	}
+}
+
+// Update answers an open offer, accepting it on w with Y and declining it
+// with N or Escape.
+// Offering reports whether a quest offer is waiting for an answer.
+func (q *QuestLog) Offering() bool {
+	return q.offer != nil
+}
+
+func (q *QuestLog) Update(deltaTime float64, typing bool, w io.Writer) error {
+	q.shownFor -= deltaTime
+	if q.shownFor <= 0 {
+		q.completed = nil
+	}
+	if q.offer == nil || typing {
+		return nil
+	}
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyY), menuPad.Pressed(MenuAccept):
+		id := q.offer.ID
+		q.offer = nil
+		_, err := io.WriteString(w, protocol.Line(protocol.KindQuestAccept, id))
+		return err
+	case inpututil.IsKeyJustPressed(ebiten.KeyN), inpututil.IsKeyJustPressed(ebiten.KeyEscape), menuPad.Pressed(MenuBack):
+		q.offer = nil
+	}
+	return nil
+}
+
+func (q *QuestLog) Draw(screen *ebiten.Image) {
+	y := 28
+	for _, s := range q.active {
+		drawText(screen, T("quest.tracker", s.Title, s.Step, s.Total, s.Objective), 8, y, hudText)
+		y += 32
+	}
+
+	var b strings.Builder
+	switch {
+	case q.offer != nil:
+		b.WriteString(T("quest.offer.title", q.offer.Giver, q.offer.Title) + "\n\n")
+		b.WriteString(q.offer.Description + "\n\n")
+		b.WriteString(menuPad.Hint("quest.offer.help"))
+	case q.completed != nil:
+		b.WriteString(T("quest.complete", q.completed.Title, q.completed.RewardXP))
+	default:
+		return
+	}
+	const width, height = 360, 120
+	x, top := (hudWidth-width)/2, hudHeight/2-height
+	drawPanel(screen, float64(x), float64(top), width, height)
+	drawText(screen, wrapText(b.String(), width-24, hudText), x+12, top+12, hudText)
+}
+
+// interact talks to the nearest NPC, opens or closes the nearest door,
+// gathers from the nearest resource node or boards the nearest vehicle
+// within reach of the local player.
+func (g *Game) interact(local *LocalPlayer) error {
+	// Riders get out of their vehicle, however far their seat is from it.
+	if vehicle, _, ok := g.seating.Of(local.id); ok {
+		_, err := io.WriteString(local.conn, protocol.Line(protocol.KindInteract, vehicle))
+		return err
+	}
+	var nearest *WorldEntity
+	best := protocol.InteractRange
+	g.entities.Near(local.position.X, local.position.Y, protocol.InteractRange, func(_ string, e *WorldEntity) {
+		if e.Kind != protocol.EntityNPC && e.Kind != protocol.EntityResource && e.Kind != protocol.EntityDoor && e.Kind != protocol.EntityVehicle {
+			return
+		}
+		if d := math.Hypot(e.X-local.position.X, e.Y-local.position.Y); d <= best {
+			nearest, best = e, d
+		}
+	})
+	if nearest == nil {
+		return nil
+	}
+	kind := protocol.KindInteract
+	if nearest.Kind == protocol.EntityResource {
+		kind = protocol.KindGather
+	}
+	_, err := io.WriteString(local.conn, protocol.Line(kind, nearest.ID))
+	return err
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+const (
+	reconnectAttempts = 5
+	// reconnectBackoff is the wait before the first attempt, doubled
+	// before each one after.
+	reconnectBackoff = time.Second
+)
+
+// redialConn is a player's connection to the server, which reconnecting
+// replaces underneath the game: reads and writes go to whichever
+// connection is current.
+type redialConn struct {
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func newRedialConn(conn net.Conn) *redialConn {
+	return &redialConn{conn: conn}
+}
+
+func (c *redialConn) current() net.Conn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn
+}
+
+func (c *redialConn) Read(p []byte) (int, error)  { return c.current().Read(p) }
+func (c *redialConn) Write(p []byte) (int, error) { return c.current().Write(p) }
+func (c *redialConn) Close() error                { return c.current().Close() }
+func (c *redialConn) RemoteAddr() net.Addr        { return c.current().RemoteAddr() }
+
+// swap makes conn the current connection and closes the one it replaces.
+func (c *redialConn) swap(conn net.Conn) {
+	c.mu.Lock()
+	old := c.conn
+	c.conn = conn
+	c.mu.Unlock()
+	old.Close()
+}
+
+// login logs a connection in: to the account with its password, or as a
+// guest without one, and straight into the character when one is given.
+func login(w io.Writer, account, password, character string) error {
+	if account == "" {
+		_, err := io.WriteString(w, protocol.Line(protocol.KindGuest, ""))
+		return err
+	}
+	if _, err := io.WriteString(w, protocol.Line(protocol.KindLogin, protocol.EncodeLogin(account, password))); err != nil {
+		return err
+	}
+	if character == "" {
+		return nil
+	}
+	_, err := io.WriteString(w, protocol.Line(protocol.KindCharacterSelect, character))
+	return err
+}
+
+// reconnect dials the server again after the player's connection dropped,
+// backing off between attempts, and logs them back in as they were. The
+// server resyncs the world as they enter it. It runs on the player's
+// receive goroutine and reports whether the player is connected again.
+func (g *Game) reconnect(local *LocalPlayer, character string) bool {
+	delay := reconnectBackoff
+	for attempt := 1; attempt <= reconnectAttempts; attempt++ {
+		g.events.Publish(EventReconnecting, Reconnecting{Local: local, Attempt: attempt})
+		time.Sleep(delay)
+		delay *= 2
+
+		raw, err := g.dial()
+		if err == nil {
+			conn := NewPacketConn(raw, g.packets)
+			if err = login(conn, local.account, local.password, character); err == nil {
+				local.conn.swap(conn)
+				g.events.Publish(EventReconnected, Reconnected{Local: local})
+				return true
+			}
+			raw.Close()
+		}
+		log.Printf("Reconnect attempt %d of %d failed: %v", attempt, reconnectAttempts, err)
+	}
+	return false
+}
+
+// applyResync replaces everything known about the world around the players
+// with the server's account of it, after a reconnect or a move between
+// rooms, so no players or entities linger from before.
+func (g *Game) applyResync(resync protocol.Resync) {
+	var players, entities []string
+	g.otherPlayers.Each(func(id string, _ *RemotePlayer) { players = append(players, id) })
+	g.entities.Each(func(id string, _ *WorldEntity) { entities = append(entities, id) })
+	for _, id := range players {
+		g.otherPlayers.Remove(id)
+		g.events.Publish(EventPlayerLeft, PlayerLeft{ID: id})
+	}
+	for _, id := range entities {
+		g.entities.Remove(id)
+	}
+	g.seating.Clear()
+	for _, entity := range resync.Entities {
+		g.entities.Set(entity.ID, NewWorldEntity(entity, g.bodyTexture, g.headTexture), entity.X, entity.Y)
+	}
+	g.applySnapshot(protocol.Snapshot{Time: int64(g.clock.ServerNow()), Weather: g.zoneWeather, Players: resync.Players})
+
+	if local := g.localByID(resync.Self.ID); local != nil {
+		local.serverPosition, local.hasServerPosition = Vector2f{resync.Self.X, resync.Self.Y}, true
+	}
+	if resync.MapHash != "" && resync.MapHash != g.tileMap.hash && !g.mapMismatch {
+		g.mapMismatch = true
+		log.Printf("Map differs from the server's: ours hashes to %s, the server's to %s", g.tileMap.hash, resync.MapHash)
+		g.events.Publish(EventChatReceived, ChatReceived{Channel: chatChannelSystem, From: "client", Text: T("map.mismatch")})
+	}
+}
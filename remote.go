@@ -0,0 +1,100 @@
+package main
+
+import (
+	"darkzone/MultiTestServer/protocol"
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+const maxRemoteSamples = 32
+
+type remoteSample struct {
+	time      float64
+	position  Vector2f
+	velocity  Vector2f
+	direction int
+	anim      protocol.AnimState
+	warp      int
+}
+
+// RemotePlayer renders another player at a fixed delay behind the server
+// clock, interpolating between buffered snapshots. When the buffer runs dry
+// it dead-reckons from the newest snapshot's velocity for up to
+// maxExtrapolation milliseconds. Both are player settings.
+type RemotePlayer struct {
+	*Character
+	samples []remoteSample
+}
+
+func NewRemotePlayer(bodyTexture, headTexture *ebiten.Image, position Vector2f) *RemotePlayer {
+	return &RemotePlayer{
+		Character: NewCharacter(bodyTexture, headTexture, position),
+	}
+}
+
+func (r *RemotePlayer) ApplyState(serverTime int64, position, velocity Vector2f, direction int, anim protocol.AnimState, warp int) {
+	t := float64(serverTime)
+	n := len(r.samples)
+	if n > 0 && t <= r.samples[n-1].time {
+		return
+	}
+	// A new warp count means the server teleported the player: drop the
+	// buffer and snap, rather than sliding across the whole jump.
+	if n > 0 && warp != r.samples[n-1].warp {
+		r.samples = r.samples[:0]
+		r.position = position
+	}
+	r.samples = append(r.samples, remoteSample{
+		time:      t,
+		position:  position,
+		velocity:  velocity,
+		direction: direction,
+		anim:      anim,
+		warp:      warp,
+	})
+	if len(r.samples) > maxRemoteSamples {
+		r.samples = r.samples[1:]
+	}
+}
+
+func (r *RemotePlayer) Update(deltaTime, renderTime, maxExtrapolation float64) {
+	for len(r.samples) >= 2 && r.samples[1].time <= renderTime {
+		r.samples = r.samples[1:]
+	}
+
+	switch {
+	case len(r.samples) == 0:
+	case renderTime <= r.samples[0].time:
+		r.apply(r.samples[0], r.samples[0].position)
+	case len(r.samples) >= 2:
+		from, to := r.samples[0], r.samples[1]
+		t := (renderTime - from.time) / (to.time - from.time)
+		r.apply(from, Vector2f{
+			X: from.position.X + (to.position.X-from.position.X)*t,
+			Y: from.position.Y + (to.position.Y-from.position.Y)*t,
+		})
+	default:
+		last := r.samples[0]
+		elapsed := min(renderTime-last.time, maxExtrapolation) / 1000
+		r.apply(last, Vector2f{
+			X: last.position.X + last.velocity.X*elapsed,
+			Y: last.position.Y + last.velocity.Y*elapsed,
+		})
+	}
+
+	r.Character.Update(deltaTime)
+}
+
+// Latest is the newest position the server sent for the player, ahead of
+// the interpolated position drawn.
+func (r *RemotePlayer) Latest() (Vector2f, bool) {
+	if len(r.samples) == 0 {
+		return Vector2f{}, false
+	}
+	return r.samples[len(r.samples)-1].position, true
+}
+
+func (r *RemotePlayer) apply(sample remoteSample, position Vector2f) {
+	r.position = position
+	r.direction = sample.direction
+	r.SetAnim(sample.anim)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"strings"
+
+	"darkzone/MultiTestServer/protocol"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+var resultsBack = color.RGBA{0, 0, 0, 220}
+
+// ResultsScreen shows how everyone did once a match ends, best first, and
+// counts down until the server sends the players back to the lobby. It
+// takes over the screen, and movement, until then.
+type ResultsScreen struct {
+	results *protocol.MatchResults
+	seconds float64
+}
+
+func NewResultsScreen(events *EventBus) *ResultsScreen {
+	s := &ResultsScreen{}
+	events.Subscribe(EventMatchEnded, func(e Event) {
+		results := e.Payload.(MatchEnded).Results
+		s.results, s.seconds = &results, results.Seconds
+	})
+	return s
+}
+
+func (s *ResultsScreen) Open() bool {
+	return s.results != nil
+}
+
+func (s *ResultsScreen) Update(deltaTime float64) {
+	if s.results == nil {
+		return
+	}
+	if s.seconds -= deltaTime; s.seconds <= 0 {
+		s.results = nil
+	}
+}
+
+func (s *ResultsScreen) Draw(screen *ebiten.Image) {
+	if s.results == nil {
+		return
+	}
+	vector.DrawFilledRect(screen, 0, 0, float32(hudWidth), float32(hudHeight), resultsBack, false)
+
+	var b strings.Builder
+	b.WriteString(T("results.title", s.results.Mode, s.results.Winner) + "\n")
+	b.WriteString(T("results.mvp", s.results.MVP) + "\n\n")
+	fmt.Fprintf(&b, "  %-16s %6s %6s %6s %12s\n", T("results.player"), T("results.kills"), T("results.deaths"), T("results.score"), T("results.rating"))
+	for _, p := range s.results.Players {
+		marker := "  "
+		if p.Name == s.results.MVP {
+			marker = "* "
+		}
+		rating := fmt.Sprintf("%d (%+d)", p.Rating, p.Change)
+		fmt.Fprintf(&b, "%s%-16s %6d %6d %6d %12s\n", marker, p.Name, p.Kills, p.Deaths, p.Score, rating)
+	}
+	b.WriteString("\n" + T("results.back", int(math.Ceil(s.seconds))))
+	drawText(screen, b.String(), hudWidth/2-180, hudHeight/2-120, tableText)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const defaultFrameBudget = 2 * time.Millisecond
+
+// TaskScheduler runs queued background work on the game thread, spending at
+// most budget per frame. At least one task runs each frame so the queue always
+// makes progress, even when a single task is larger than the budget.
+type TaskScheduler struct {
+	mu     sync.Mutex
+	queue  []func()
+	budget time.Duration
+}
+
+func NewTaskScheduler(budget time.Duration) *TaskScheduler {
+	return &TaskScheduler{
+		budget: budget,
+	}
+}
+
+func (s *TaskScheduler) Enqueue(task func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.queue = append(s.queue, task)
+}
+
+func (s *TaskScheduler) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.queue)
+}
+
+func (s *TaskScheduler) Run() {
+	start := time.Now()
+	for ran := 0; ran == 0 || time.Since(start) < s.budget; ran++ {
+		task := s.next()
+		if task == nil {
+			return
+		}
+		task()
+	}
+}
+
+func (s *TaskScheduler) next() func() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.queue) == 0 {
+		return nil
+	}
+	task := s.queue[0]
+	s.queue[0] = nil
+	s.queue = s.queue[1:]
+	return task
+}
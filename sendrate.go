@@ -0,0 +1,55 @@
+package main
+
+import "darkzone/MultiTestServer/protocol"
+
+const (
+	defaultSendRate = 20
+	// stateHeartbeat is how often an unchanged state is still resent, so the
+	// server keeps the player in its interest grid while they stand still.
+	stateHeartbeat = 1.0
+)
+
+// StateSender decides when a local player's state goes to the server,
+// decoupling the send rate from the frame rate. Movement accumulates
+// between sends and only the latest state is sent, at most rate times a
+// second; discrete changes such as facing or animation go out immediately
+// so attacks and turns aren't delayed.
+type StateSender struct {
+	interval  float64
+	elapsed   float64
+	sinceSent float64
+	last      protocol.PlayerState
+	sent      bool
+}
+
+func NewStateSender(rate int) *StateSender {
+	if rate <= 0 {
+		rate = defaultSendRate
+	}
+	return &StateSender{interval: 1 / float64(rate)}
+}
+
+func (s *StateSender) Ready(deltaTime float64, state protocol.PlayerState) bool {
+	s.elapsed += deltaTime
+	s.sinceSent += deltaTime
+
+	switch {
+	case !s.sent:
+	case state.Direction != s.last.Direction || state.Anim != s.last.Anim:
+	case s.elapsed < s.interval:
+		return false
+	case state == s.last && s.sinceSent < stateHeartbeat:
+		s.elapsed = 0
+		return false
+	}
+
+	s.last, s.sent = state, true
+	s.elapsed, s.sinceSent = 0, 0
+	return true
+}
+
+// Flush makes the next Ready send immediately, used after a teleport so the
+// server hears the new position as soon as possible.
+func (s *StateSender) Flush() {
+	s.sent = false
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+
+	"darkzone/MultiTestServer/gameserver"
+)
+
+// brokers opens a pub-sub client by URL scheme. Each client is linked in by
+// its own build tag (see nats.go and redis.go), like the SQLite driver.
+var brokers = map[string]func(url string) (gameserver.Broker, error){}
+
+func openBroker(rawURL string) (gameserver.Broker, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	open, ok := brokers[u.Scheme]
+	if !ok {
+		return nil, fmt.Errorf("no broker for %q URLs (is the server built with -tags %s?)", u.Scheme, u.Scheme)
+	}
+	return open(rawURL)
+}
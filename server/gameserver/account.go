@@ -0,0 +1,66 @@
+package gameserver
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// minPasswordLength is the shortest password an account can be created
+// with. bcrypt caps them at 72 bytes.
+const minPasswordLength = 8
+
+// maxLoginAttempts is how many wrong passwords a connection may send before
+// it is disconnected.
+const maxLoginAttempts = 3
+
+var (
+	ErrNoAccount     = errors.New("account not found")
+	ErrAccountExists = errors.New("account already exists")
+	errWrongPassword = errors.New("wrong account name or password")
+)
+
+// Account is what a player logs in to; its characters are the profiles
+// whose Account is its name. Only a salted hash of the password is kept.
+type Account struct {
+	Name         string
+	PasswordHash []byte
+}
+
+// NewAccount hashes password for a new account called name.
+func NewAccount(name, password string) (*Account, error) {
+	if len(password) < minPasswordLength {
+		return nil, fmt.Errorf("passwords need at least %d characters", minPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	return &Account{Name: name, PasswordHash: hash}, nil
+}
+
+// authenticate checks password against the named account. An account that
+// does not exist yet is created with it, so the first login to a name
+// claims it; that includes accounts whose characters predate passwords.
+func (s *Server) authenticate(name, password string) error {
+	account, err := s.profiles.LoadAccount(name)
+	if errors.Is(err, ErrNoAccount) {
+		if account, err = NewAccount(name, password); err != nil {
+			return err
+		}
+		err = s.profiles.CreateAccount(account)
+		if errors.Is(err, ErrAccountExists) {
+			// Someone else claimed it first; check against theirs.
+			return s.authenticate(name, password)
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if bcrypt.CompareHashAndPassword(account.PasswordHash, []byte(password)) != nil {
+		return errWrongPassword
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package gameserver
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFirstLoginClaimsAccount(t *testing.T) {
+	s := NewServer(Config{})
+	if err := s.authenticate("Alice", "short"); err == nil {
+		t.Error("created an account with a too-short password")
+	}
+	if err := s.authenticate("Alice", "correct horse"); err != nil {
+		t.Fatalf("first login: %v", err)
+	}
+	if err := s.authenticate("Alice", "battery staple"); !errors.Is(err, errWrongPassword) {
+		t.Errorf("logging in with another password: got %v, want %v", err, errWrongPassword)
+	}
+	if err := s.authenticate("Alice", "correct horse"); err != nil {
+		t.Errorf("logging back in: %v", err)
+	}
+}
+
+func TestRegisterStoresPassword(t *testing.T) {
+	s := NewServer(Config{})
+	register := func(body string) int {
+		w := httptest.NewRecorder()
+		s.handleRegister(w, httptest.NewRequest(http.MethodPost, "/api/accounts", strings.NewReader(body)))
+		return w.Code
+	}
+	if code := register(`{"account":"Bob","character":"Bobby"}`); code != http.StatusBadRequest {
+		t.Errorf("registering without a password: got %d, want %d", code, http.StatusBadRequest)
+	}
+	if code := register(`{"account":"Bob","password":"hunter2hunter2","character":"Bobby"}`); code != http.StatusCreated {
+		t.Fatalf("registering: got %d, want %d", code, http.StatusCreated)
+	}
+	if code := register(`{"account":"Bob","password":"something else","character":"Robert"}`); code != http.StatusConflict {
+		t.Errorf("registering a taken account: got %d, want %d", code, http.StatusConflict)
+	}
+
+	account, err := s.profiles.LoadAccount("Bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(account.PasswordHash), "hunter2") {
+		t.Error("stored the password in the clear")
+	}
+	if err := s.authenticate("Bob", "something else"); !errors.Is(err, errWrongPassword) {
+		t.Errorf("logging in with the wrong password: got %v, want %v", err, errWrongPassword)
+	}
+	if err := s.authenticate("Bob", "hunter2hunter2"); err != nil {
+		t.Errorf("logging in with the registered password: %v", err)
+	}
+}
@@ -0,0 +1,190 @@
+package gameserver
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+const (
+	defaultLeaderboardStat = "score"
+	defaultLeaderboardSize = 10
+	maxLeaderboardSize     = 100
+	maxAPIBodyBytes        = 4 << 10
+)
+
+// ServeAPI serves the JSON HTTP API for services outside the game, such as
+// a website or launcher: account registration, character lists,
+// leaderboards and server status.
+func (s *Server) ServeAPI(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/status", s.handleStatus)
+	mux.HandleFunc("POST /api/accounts", s.handleRegister)
+	mux.HandleFunc("GET /api/accounts/{account}/characters", s.handleCharacters)
+	mux.HandleFunc("GET /api/leaderboard", s.handleLeaderboard)
+
+	log.Println("API listening on", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Println("Error serving API:", err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("Error writing API response:", err)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+type roomStatus struct {
+	Name    string `json:"name"`
+	Players int    `json:"players"`
+}
+
+type serverStatus struct {
+	Players int `json:"players"`
+	// RemotePlayers counts players on other instances sharing the broker.
+	RemotePlayers int          `json:"remotePlayers"`
+	MaxPlayers    int          `json:"maxPlayers"`
+	Queue         int          `json:"queue"`
+	Uptime        int64        `json:"uptimeSeconds"`
+	Rooms         []roomStatus `json:"rooms"`
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	status := serverStatus{
+		Players:       len(s.snapshotClients()),
+		RemotePlayers: len(s.RemotePlayers()),
+		MaxPlayers:    s.maxPlayers,
+		Queue:         s.QueueLength(),
+		Uptime:        int64(time.Since(s.started).Seconds()),
+		Rooms:         []roomStatus{},
+	}
+	for _, room := range s.snapshotRooms() {
+		status.Rooms = append(status.Rooms, roomStatus{Name: room.name, Players: room.PlayerCount()})
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+type registration struct {
+	Account    string `json:"account"`
+	Password   string `json:"password"`
+	Character  string `json:"character"`
+	Appearance string `json:"appearance"`
+}
+
+// handleRegister creates an account with a salted hash of its password,
+// and its first character. An account that already exists, or that has
+// characters from before accounts had passwords, is taken. If only the
+// character cannot be made the account is kept, and its owner can create
+// one after logging in.
+func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
+	var req registration
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIBodyBytes)).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Appearance == "" {
+		req.Appearance = protocol.Appearances[0]
+	}
+	if !validName(req.Account) {
+		writeAPIError(w, http.StatusBadRequest, errors.New("invalid account name"))
+		return
+	}
+	account, err := NewAccount(req.Account, req.Password)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	existing, err := s.profiles.List(req.Account)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(existing) > 0 {
+		writeAPIError(w, http.StatusConflict, errors.New("account already registered"))
+		return
+	}
+	switch err := s.profiles.CreateAccount(account); {
+	case errors.Is(err, ErrAccountExists):
+		writeAPIError(w, http.StatusConflict, errors.New("account already registered"))
+		return
+	case err != nil:
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err := s.addCharacter(req.Account, req.Character, req.Appearance); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]string{"account": req.Account, "character": req.Character})
+}
+
+type characterInfo struct {
+	Name       string `json:"name"`
+	Appearance string `json:"appearance"`
+	Room       string `json:"room"`
+	Stats      Stats  `json:"stats"`
+}
+
+func (s *Server) handleCharacters(w http.ResponseWriter, r *http.Request) {
+	profiles, err := s.profiles.List(r.PathValue("account"))
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	chars := make([]characterInfo, len(profiles))
+	for i, p := range profiles {
+		chars[i] = characterInfo{Name: p.Name, Appearance: p.Appearance, Room: p.Room, Stats: p.Stats}
+	}
+	writeJSON(w, http.StatusOK, chars)
+}
+
+// handleLeaderboard serves /api/leaderboard?stat=score&limit=10.
+func (s *Server) handleLeaderboard(w http.ResponseWriter, r *http.Request) {
+	stat := r.URL.Query().Get("stat")
+	if stat == "" {
+		stat = defaultLeaderboardStat
+	}
+	if _, ok := LeaderboardStats[stat]; !ok {
+		writeAPIError(w, http.StatusBadRequest, errors.New("unknown stat "+strconv.Quote(stat)))
+		return
+	}
+	limit := defaultLeaderboardSize
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeAPIError(w, http.StatusBadRequest, errors.New("limit must be a positive number"))
+			return
+		}
+		limit = min(n, maxLeaderboardSize)
+	}
+
+	entries, err := s.leaderboard(stat, limit)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	board := make([]leaderboardEntry, len(entries))
+	for i, e := range entries {
+		board[i] = leaderboardEntry(e)
+	}
+	writeJSON(w, http.StatusOK, board)
+}
+
+type leaderboardEntry struct {
+	Rank  int     `json:"rank"`
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+}
@@ -0,0 +1,98 @@
+package gameserver
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+// maxEntityStep is the farthest an owned entity may move in one
+// KindEntityMove; owners send several a second, so anything farther is a
+// teleport the server does not allow.
+const maxEntityStep = 128.0
+
+// moveOwnedEntity applies a move the client sent for an entity, if the
+// client owns it and the move is a legal step, and passes it on to the
+// rest of the room. A refused move is answered with the entity as the
+// server has it.
+func (r *Room) moveOwnedEntity(c *Client, move protocol.Entity) {
+	e, ok := r.entities[move.ID]
+	if !ok {
+		c.Send(protocol.Line(protocol.KindDespawn, move.ID))
+		return
+	}
+	if e.Owner != c.id {
+		log.Printf("Refused move of %s from %s: owned by %q", e.ID, c.id, e.Owner)
+		c.Send(protocol.Line(protocol.KindError, fmt.Sprintf("%s is not yours to move", e.Name)))
+		c.Send(protocol.Line(protocol.KindSpawn, protocol.EncodeEntity(*e)))
+		return
+	}
+	x, y := move.X, move.Y
+	if r.world != nil {
+		x, y = r.world.Clamp(x, y)
+	}
+	if math.Hypot(x-e.X, y-e.Y) > maxEntityStep || r.world != nil && r.world.Solid(x, y) {
+		c.Send(protocol.Line(protocol.KindSpawn, protocol.EncodeEntity(*e)))
+		return
+	}
+	e.X, e.Y = x, y
+	r.carry(e)
+	line := protocol.Line(protocol.KindSpawn, protocol.EncodeEntity(*e))
+	for other := range r.players {
+		if other != c {
+			other.Send(line)
+		}
+	}
+}
+
+// setEntityOwner hands authority over an entity to a client in the room,
+// or back to the server when owner is nil, and tells everyone.
+func (r *Room) setEntityOwner(id string, owner *Client) {
+	e, ok := r.entities[id]
+	if !ok {
+		log.Printf("No entity %s in %s to change the owner of", id, r.name)
+		return
+	}
+	e.Owner = protocol.OwnerServer
+	if owner != nil {
+		if _, ok := r.players[owner]; !ok {
+			log.Printf("Cannot give %s to %s: not in %s", id, owner.id, r.name)
+			return
+		}
+		e.Owner = owner.id
+	}
+	r.broadcast(protocol.Line(protocol.KindSpawn, protocol.EncodeEntity(*e)))
+}
+
+// releaseEntities returns authority over everything the leaving client
+// owned to the server.
+func (r *Room) releaseEntities(c *Client) {
+	for _, e := range r.entities {
+		if e.Owner == c.id {
+			e.Owner = protocol.OwnerServer
+			r.broadcast(protocol.Line(protocol.KindSpawn, protocol.EncodeEntity(*e)))
+		}
+	}
+}
+
+// consoleOwner gives an entity to a player, or back to the server.
+func (s *Server) consoleOwner(args []string, out io.Writer) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+	var owner *Client
+	room := defaultRoom
+	if args[1] != "server" {
+		if owner = s.findClient(args[1]); owner == nil {
+			return fmt.Errorf("no player %q", args[1])
+		}
+		room = s.roomName(owner)
+	}
+	room = optionalArg(args, 2, room)
+	s.room(room).Send(roomMessage{kind: roomEntityOwner, client: owner, entity: protocol.Entity{ID: args[0]}})
+	fmt.Fprintf(out, "giving %s in %s to %s\n", args[0], room, args[1])
+	return nil
+}
@@ -0,0 +1,69 @@
+package gameserver
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// meteredConn counts the bytes moving through a client connection and, when
+// a cap is configured, delays reads so the client cannot push more than
+// capBytes per second upstream.
+type meteredConn struct {
+	net.Conn
+	bytesIn  atomic.Int64
+	bytesOut atomic.Int64
+
+	capBytes  int64
+	mu        sync.Mutex
+	allowance float64
+	lastCheck time.Time
+	throttled atomic.Int64
+}
+
+func newMeteredConn(conn net.Conn, capBytes int64) *meteredConn {
+	return &meteredConn{
+		Conn:      conn,
+		capBytes:  capBytes,
+		allowance: float64(capBytes),
+		lastCheck: time.Now(),
+	}
+}
+
+func (c *meteredConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.bytesIn.Add(int64(n))
+		c.throttle(n)
+	}
+	return n, err
+}
+
+func (c *meteredConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.bytesOut.Add(int64(n))
+	return n, err
+}
+
+func (c *meteredConn) throttle(n int) {
+	if c.capBytes <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	now := time.Now()
+	c.allowance += now.Sub(c.lastCheck).Seconds() * float64(c.capBytes)
+	if c.allowance > float64(c.capBytes) {
+		c.allowance = float64(c.capBytes)
+	}
+	c.lastCheck = now
+	c.allowance -= float64(n)
+	deficit := -c.allowance
+	c.mu.Unlock()
+
+	if deficit > 0 {
+		c.throttled.Add(1)
+		time.Sleep(time.Duration(deficit / float64(c.capBytes) * float64(time.Second)))
+	}
+}
@@ -0,0 +1,279 @@
+package gameserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+// worldTileSize matches the client's tile size; map cells are this many
+// pixels square.
+const worldTileSize = 256.0
+
+// Values of a map's zones, one per cell: a cell takes the map's default,
+// which is PvP unless the map is Peaceful, or is marked safe or PvP.
+const (
+	zoneDefault = iota
+	zoneSafe
+	zonePvP
+)
+
+// WorldMap is the part of the client's map file the server needs to keep
+// players inside the world and out of solid tiles, to tell where they may
+// fight and how fast they may move.
+type WorldMap struct {
+	Width     int     `json:"width"`
+	Layers    [][]int `json:"layers"`
+	Collision []int   `json:"collision"`
+	Zones     []int   `json:"zones"`
+	Terrain   []int   `json:"terrain"`
+	Elevation []int   `json:"elevation"`
+	Peaceful  bool    `json:"peaceful"`
+	// Spawns are where players enter the world and respawn; without any,
+	// everyone spawns at the default point.
+	Spawns []SpawnPoint `json:"spawns"`
+
+	cells int
+	// hash is the protocol.MapHash of the file the map was loaded from.
+	hash string
+}
+
+func LoadWorldMap(path string) (*WorldMap, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m WorldMap
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parsing map %s: %w", path, err)
+	}
+	if m.Width <= 0 {
+		return nil, fmt.Errorf("map %s: width must be positive", path)
+	}
+	m.cells = len(m.Collision)
+	m.hash = protocol.MapHash(data)
+	for _, layer := range m.Layers {
+		m.cells = max(m.cells, len(layer))
+	}
+	for _, zone := range m.Zones {
+		if zone < zoneDefault || zone > zonePvP {
+			return nil, fmt.Errorf("map %s: unknown zone %d", path, zone)
+		}
+	}
+	for _, terrain := range m.Terrain {
+		if !protocol.ValidTerrain(protocol.Terrain(terrain)) {
+			return nil, fmt.Errorf("map %s: unknown terrain %d", path, terrain)
+		}
+	}
+	for _, elevation := range m.Elevation {
+		if !protocol.ValidElevation(protocol.Elevation(elevation)) {
+			return nil, fmt.Errorf("map %s: unknown elevation %d", path, elevation)
+		}
+	}
+	width, height := m.Size()
+	for _, p := range m.Spawns {
+		if p.X < 0 || p.Y < 0 || p.X >= width || p.Y >= height || m.Solid(p.X, p.Y) {
+			return nil, fmt.Errorf("map %s: spawn point (%.0f, %.0f) is outside the world or in a solid tile", path, p.X, p.Y)
+		}
+	}
+	return &m, nil
+}
+
+// Hash identifies the map file for clients to check theirs against; it is
+// empty without a map.
+func (m *WorldMap) Hash() string {
+	if m == nil {
+		return ""
+	}
+	return m.hash
+}
+
+func (m *WorldMap) Size() (width, height float64) {
+	rows := (m.cells + m.Width - 1) / m.Width
+	return float64(m.Width) * worldTileSize, float64(rows) * worldTileSize
+}
+
+// Solid reports whether (x, y) is inside a solid tile or a cell the map does
+// not cover, such as the empty end of a partial last row.
+func (m *WorldMap) Solid(x, y float64) bool {
+	return m.solidCell(int(x/worldTileSize), int(y/worldTileSize))
+}
+
+func (m *WorldMap) solidCell(col, row int) bool {
+	if col < 0 || row < 0 || col >= m.Width {
+		return true
+	}
+	index := row*m.Width + col
+	if index >= m.cells {
+		return true
+	}
+	return index < len(m.Collision) && m.Collision[index] != 0
+}
+
+// LineOfSight reports whether the straight line from (x0, y0) to (x1, y1)
+// crosses no solid tile. It walks the cells the line passes through in
+// order, so a wall a single tile thick blocks it however the line meets
+// it.
+func (m *WorldMap) LineOfSight(x0, y0, x1, y1 float64) bool {
+	col, row := cellOf(x0), cellOf(y0)
+	endCol, endRow := cellOf(x1), cellOf(y1)
+	stepCol, tCol, tDeltaCol := lineSteps(x0, x1, col)
+	stepRow, tRow, tDeltaRow := lineSteps(y0, y1, row)
+	for n := abs(endCol-col) + abs(endRow-row); n > 0; n-- {
+		if tCol < tRow {
+			col, tCol = col+stepCol, tCol+tDeltaCol
+		} else {
+			row, tRow = row+stepRow, tRow+tDeltaRow
+		}
+		if m.solidCell(col, row) {
+			return false
+		}
+	}
+	return true
+}
+
+func cellOf(v float64) int {
+	return int(math.Floor(v / worldTileSize))
+}
+
+// lineSteps sets up walking one axis of the line from v0 to v1, starting in
+// cell: which way it steps, how far along the line, as a fraction of it,
+// the first cell boundary is, and how far apart the boundaries are.
+func lineSteps(v0, v1 float64, cell int) (step int, t, delta float64) {
+	d := v1 - v0
+	switch {
+	case d > 0:
+		return 1, (float64(cell+1)*worldTileSize - v0) / d, worldTileSize / d
+	case d < 0:
+		return -1, (float64(cell)*worldTileSize - v0) / d, -worldTileSize / d
+	}
+	return 0, math.Inf(1), math.Inf(1)
+}
+
+// PvP reports whether players at (x, y) may attack and be attacked.
+func (m *WorldMap) PvP(x, y float64) bool {
+	index := int(y/worldTileSize)*m.Width + int(x/worldTileSize)
+	zone := zoneDefault
+	if index >= 0 && index < len(m.Zones) {
+		zone = m.Zones[index]
+	}
+	switch zone {
+	case zoneSafe:
+		return false
+	case zonePvP:
+		return true
+	}
+	return !m.Peaceful
+}
+
+// TerrainAt is the terrain at (x, y), grass where the map gives none.
+func (m *WorldMap) TerrainAt(x, y float64) protocol.Terrain {
+	index := int(y/worldTileSize)*m.Width + int(x/worldTileSize)
+	if index < 0 || index >= len(m.Terrain) {
+		return protocol.TerrainGrass
+	}
+	return protocol.Terrain(m.Terrain[index])
+}
+
+// ElevationAt is the elevation at (x, y), ground where the map gives none.
+func (m *WorldMap) ElevationAt(x, y float64) protocol.Elevation {
+	index := int(y/worldTileSize)*m.Width + int(x/worldTileSize)
+	if index < 0 || index >= len(m.Elevation) {
+		return protocol.ElevationGround
+	}
+	return protocol.Elevation(m.Elevation[index])
+}
+
+// Clamp keeps (x, y) inside the map, just short of its far edges so the
+// point never lands in the next cell over.
+func (m *WorldMap) Clamp(x, y float64) (float64, float64) {
+	width, height := m.Size()
+	return math.Max(0, math.Min(x, width-1)), math.Max(0, math.Min(y, height-1))
+}
+
+// validateState checks a reported position against the world, the
+// player's level and how fast they may move. It returns the position the server accepts and
+// whether that differs from the report, in which case the client needs
+// correcting.
+func (r *Room) validateState(c *Client, state protocol.PlayerState) (float64, float64, bool) {
+	x, y := r.limitSpeed(c, state.X, state.Y, r.clock())
+	if r.world != nil {
+		x, y = r.world.Clamp(x, y)
+	}
+	if r.blocked(x, y) || !r.climb(c, x, y) {
+		if previous := r.players[c]; previous != nil {
+			x, y = previous.X, previous.Y
+		} else {
+			x, y = r.pickSpawn(c)
+		}
+	}
+	return x, y, x != state.X || y != state.Y
+}
+
+// blocked reports whether players may not stand at x, y: in a solid tile
+// or a closed door.
+func (r *Room) blocked(x, y float64) bool {
+	return r.world != nil && r.world.Solid(x, y) || r.closedDoorAt(x, y)
+}
+
+// lineOfSight reports whether nothing solid stands between x0, y0 and x1,
+// y1, for attacks, targeting and anything else that must see its mark.
+// Without a map nothing does.
+func (r *Room) lineOfSight(x0, y0, x1, y1 float64) bool {
+	return r.world == nil || r.world.LineOfSight(x0, y0, x1, y1)
+}
+
+// elevationAt is the elevation at x, y. Without a map it is all ground.
+func (r *Room) elevationAt(x, y float64) protocol.Elevation {
+	if r.world == nil {
+		return protocol.ElevationGround
+	}
+	return r.world.ElevationAt(x, y)
+}
+
+// climb moves the player's level along with a move to x, y, reporting
+// false when their level does not let them go there.
+func (r *Room) climb(c *Client, x, y float64) bool {
+	prev := r.players[c]
+	if prev == nil {
+		r.levels[c] = r.elevationAt(x, y).Level()
+		return true
+	}
+	from, to := r.elevationAt(prev.X, prev.Y), r.elevationAt(x, y)
+	if !protocol.CanEnter(from, to, r.levels[c]) {
+		return false
+	}
+	r.levels[c] = protocol.Climb(from, to, r.levels[c])
+	return true
+}
+
+// terrainAt is the terrain at x, y. Without a map it is all grass.
+func (r *Room) terrainAt(x, y float64) protocol.Terrain {
+	if r.world == nil {
+		return protocol.TerrainGrass
+	}
+	return r.world.TerrainAt(x, y)
+}
+
+// pvpAt reports whether players at x, y may fight. Without a map they may
+// anywhere.
+func (r *Room) pvpAt(x, y float64) bool {
+	return r.world == nil || r.world.PvP(x, y)
+}
+
+// updateArea tells the player when they cross into a different kind of
+// area, and which kind they are in when they first report.
+func (r *Room) updateArea(c *Client, x, y float64) {
+	area := protocol.AreaSafe
+	if r.pvpAt(x, y) {
+		area = protocol.AreaPvP
+	}
+	if r.areas[c] == area {
+		return
+	}
+	r.areas[c] = area
+	c.Send(protocol.Line(protocol.KindArea, area))
+}
@@ -0,0 +1,137 @@
+package gameserver
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"sort"
+	"time"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+const (
+	brokerChatSubject     = "multitest.chat"
+	brokerPresenceSubject = "multitest.presence"
+	// Every instance announces its players each presenceInterval; one that
+	// misses presenceExpiry worth of announcements is assumed gone.
+	presenceInterval = 10 * time.Second
+	presenceExpiry   = 3 * presenceInterval
+)
+
+// Broker is a pub-sub connection shared by server instances, such as NATS
+// or Redis. Handlers may run on any goroutine.
+type Broker interface {
+	Publish(subject string, data []byte) error
+	Subscribe(subject string, handler func(data []byte)) error
+	Close() error
+}
+
+type brokerChat struct {
+	Instance string               `json:"instance"`
+	Chat     protocol.ChatMessage `json:"chat"`
+}
+
+type brokerPresence struct {
+	Instance string   `json:"instance"`
+	Players  []string `json:"players"`
+}
+
+type remoteInstance struct {
+	players []string
+	seen    time.Time
+}
+
+func newInstanceID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// startBroker subscribes to chat and presence from the other instances and
+// starts announcing this one's players.
+func (s *Server) startBroker() error {
+	err := s.broker.Subscribe(brokerChatSubject, func(data []byte) {
+		var msg brokerChat
+		if err := json.Unmarshal(data, &msg); err != nil {
+			log.Println("Bad chat from broker:", err)
+			return
+		}
+		if msg.Instance == s.instance || msg.Chat.Channel != protocol.ChannelGlobal {
+			return
+		}
+		for _, room := range s.snapshotRooms() {
+			room.Send(roomMessage{kind: roomChat, chat: msg.Chat})
+		}
+	})
+	if err != nil {
+		return err
+	}
+	err = s.broker.Subscribe(brokerPresenceSubject, func(data []byte) {
+		var msg brokerPresence
+		if err := json.Unmarshal(data, &msg); err != nil {
+			log.Println("Bad presence from broker:", err)
+			return
+		}
+		if msg.Instance == s.instance {
+			return
+		}
+		s.mu.Lock()
+		s.remote[msg.Instance] = remoteInstance{players: msg.Players, seen: time.Now()}
+		s.mu.Unlock()
+	})
+	if err != nil {
+		return err
+	}
+	go s.announcePresenceEvery(presenceInterval)
+	return nil
+}
+
+// publishChat sends a global chat line to the other instances.
+func (s *Server) publishChat(chat protocol.ChatMessage) {
+	data, err := json.Marshal(brokerChat{Instance: s.instance, Chat: chat})
+	if err == nil {
+		err = s.broker.Publish(brokerChatSubject, data)
+	}
+	if err != nil {
+		log.Println("Error publishing chat:", err)
+	}
+}
+
+func (s *Server) announcePresenceEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for ; ; <-ticker.C {
+		presence := brokerPresence{Instance: s.instance, Players: []string{}}
+		for _, c := range s.snapshotClients() {
+			presence.Players = append(presence.Players, c.Name())
+		}
+		data, err := json.Marshal(presence)
+		if err == nil {
+			err = s.broker.Publish(brokerPresenceSubject, data)
+		}
+		if err != nil {
+			log.Println("Error publishing presence:", err)
+		}
+	}
+}
+
+// RemotePlayers lists the players other instances last announced, sorted,
+// dropping instances that have gone quiet.
+func (s *Server) RemotePlayers() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var players []string
+	for id, inst := range s.remote {
+		if time.Since(inst.seen) > presenceExpiry {
+			delete(s.remote, id)
+			continue
+		}
+		players = append(players, inst.players...)
+	}
+	sort.Strings(players)
+	return players
+}
@@ -0,0 +1,138 @@
+package gameserver
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+const maxCharacters = 3
+
+func (s *Server) handleCharacterMessage(client *Client, kind, payload string) {
+	if client.Account() == "" {
+		client.Send(protocol.Line(protocol.KindError, "log in to an account first"))
+		return
+	}
+
+	var err error
+	switch kind {
+	case protocol.KindCharacterCreate:
+		name, appearance, _ := strings.Cut(payload, ",")
+		err = s.createCharacter(client, name, appearance)
+	case protocol.KindCharacterDelete:
+		err = s.deleteCharacter(client, payload)
+	case protocol.KindCharacterSelect:
+		err = s.selectCharacter(client, payload)
+	}
+	if err != nil {
+		log.Printf("Character request from %s failed: %v", client.id, err)
+		client.Send(protocol.Line(protocol.KindError, err.Error()))
+	}
+}
+
+func (s *Server) sendCharacters(client *Client) error {
+	profiles, err := s.profiles.List(client.Account())
+	if err != nil {
+		return err
+	}
+	chars := make([]protocol.CharacterSummary, len(profiles))
+	for i, p := range profiles {
+		chars[i] = protocol.CharacterSummary{Name: p.Name, Appearance: p.Appearance, Room: p.Room, Rating: p.Stats.Rating}
+	}
+	client.Send(protocol.Line(protocol.KindCharacters, protocol.EncodeCharacters(chars)))
+	return nil
+}
+
+// ownedCharacter loads a character and checks it belongs to the client's
+// account.
+func (s *Server) ownedCharacter(client *Client, name string) (*Profile, error) {
+	profile, err := s.profiles.Load(name)
+	if errors.Is(err, ErrNoProfile) || err == nil && profile.Account != client.Account() {
+		return nil, fmt.Errorf("no character %q on this account", name)
+	}
+	return profile, err
+}
+
+func (s *Server) createCharacter(client *Client, name, appearance string) error {
+	if err := s.addCharacter(client.Account(), name, appearance); err != nil {
+		return err
+	}
+	return s.sendCharacters(client)
+}
+
+// addCharacter creates a character on an account, enforcing the name rules
+// and the slot limit. Both the game protocol and the HTTP API use it.
+func (s *Server) addCharacter(account, name, appearance string) error {
+	if !validName(name) || strings.HasPrefix(strings.ToLower(name), strings.ToLower(guestPrefix)) {
+		return fmt.Errorf("invalid name %q", name)
+	}
+	if !slices.Contains(protocol.Appearances, appearance) {
+		return fmt.Errorf("unknown appearance %q", appearance)
+	}
+	existing, err := s.profiles.List(account)
+	if err != nil {
+		return err
+	}
+	if len(existing) >= maxCharacters {
+		return fmt.Errorf("all %d character slots are in use", maxCharacters)
+	}
+	if _, err := s.profiles.Load(name); !errors.Is(err, ErrNoProfile) {
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("name %q is taken", name)
+	}
+
+	profile := NewProfile(name)
+	profile.Account = account
+	profile.Appearance = appearance
+	return s.profiles.Save(profile)
+}
+
+func (s *Server) deleteCharacter(client *Client, name string) error {
+	if _, err := s.ownedCharacter(client, name); err != nil {
+		return err
+	}
+	if strings.EqualFold(client.Name(), name) {
+		return errors.New("cannot delete the character you are playing")
+	}
+	if err := s.profiles.Delete(name); err != nil {
+		return err
+	}
+	return s.sendCharacters(client)
+}
+
+// selectCharacter attaches the character's profile to the client and puts
+// the player back where the character logged out.
+func (s *Server) selectCharacter(client *Client, name string) error {
+	client.mu.Lock()
+	playing := client.profile != nil
+	client.mu.Unlock()
+	if playing {
+		return errors.New("already playing a character")
+	}
+
+	profile, err := s.ownedCharacter(client, name)
+	if err != nil {
+		return err
+	}
+	if !s.claimName(client, name, profile) {
+		return fmt.Errorf("%s is already in the world", name)
+	}
+
+	client.Send(protocol.Line(protocol.KindCharacterSelect, name))
+	s.announce(protocol.FeedEvent{Kind: protocol.FeedJoined, Player: name})
+	s.sendQuests(client)
+	s.sendCrafting(client)
+	if !s.hostsRoom(profile.Room) {
+		s.handoff(client, Warp{Room: profile.Room, X: profile.X, Y: profile.Y})
+		return nil
+	}
+	s.moveToRoom(client, profile.Room)
+	client.room.Send(roomMessage{kind: roomTeleport, client: client, state: protocol.PlayerState{X: profile.X, Y: profile.Y}})
+	return nil
+}
@@ -0,0 +1,157 @@
+package gameserver
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+const (
+	// maxWhoNames is how many names /who lists before summing up the rest.
+	maxWhoNames = 30
+	maxDice     = 20
+	maxDieSides = 1000
+)
+
+// ChatCommand is a /command players can type in chat. Run gets the player
+// who typed it and the words after the command; what it returns is sent to
+// that player alone, a line at a time, and an error goes back to them as
+// one. An empty reply sends nothing, for commands that answer by other
+// means.
+type ChatCommand struct {
+	Usage string
+	Help  string
+	Run   func(client *Client, args []string) (string, error)
+}
+
+// RegisterChatCommand adds a /command under name, replacing any command of
+// that name, so game modes and plugins can add their own alongside the
+// built-in ones.
+func (s *Server) RegisterChatCommand(name string, command ChatCommand) {
+	s.mu.Lock()
+	s.chatCommands[strings.ToLower(name)] = command
+	s.mu.Unlock()
+}
+
+func (s *Server) registerChatCommands() {
+	s.RegisterChatCommand("help", ChatCommand{Usage: "/help", Help: "list the chat commands", Run: s.chatHelp})
+	s.RegisterChatCommand("who", ChatCommand{Usage: "/who", Help: "list who is online", Run: s.chatWho})
+	s.RegisterChatCommand("time", ChatCommand{Usage: "/time", Help: "show the server time and the time of day in the world", Run: chatTime})
+	s.RegisterChatCommand("roll", ChatCommand{Usage: "/roll [NdM|max]", Help: "roll dice, 1d100 by default", Run: chatRoll})
+}
+
+// runChatCommand runs input as a /command, reporting false when it is not
+// one and should be chatted as usual. The channel prefixes are not
+// commands, and script commands go on to the room, ahead of built-in ones
+// of the same name. Muted and rate-limited players cannot run commands.
+func (s *Server) runChatCommand(client *Client, input string) bool {
+	fields := strings.Fields(input)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return false
+	}
+	name := strings.ToLower(strings.TrimPrefix(fields[0], "/"))
+	switch name {
+	case "l", "z", "g":
+		return false
+	}
+	if _, _, ok := s.scripts.current().Command(strings.TrimSpace(input)); ok {
+		return false
+	}
+	if !s.mayChat(client) {
+		return true
+	}
+
+	s.mu.Lock()
+	command, ok := s.chatCommands[name]
+	s.mu.Unlock()
+	if !ok {
+		client.Send(protocol.Line(protocol.KindError, fmt.Sprintf("unknown command /%s, try /help", name)))
+		return true
+	}
+	reply, err := command.Run(client, fields[1:])
+	if err != nil {
+		client.Send(protocol.Line(protocol.KindError, err.Error()))
+		return true
+	}
+	for _, line := range strings.Split(reply, "\n") {
+		if line != "" {
+			chat := protocol.ChatMessage{Channel: protocol.ChannelZone, From: "server", Text: line}
+			client.Send(protocol.Line(protocol.KindChat, protocol.EncodeChat(chat)))
+		}
+	}
+	return true
+}
+
+func (s *Server) chatHelp(*Client, []string) (string, error) {
+	s.mu.Lock()
+	lines := make([]string, 0, len(s.chatCommands))
+	for _, command := range s.chatCommands {
+		lines = append(lines, command.Usage+" - "+command.Help)
+	}
+	s.mu.Unlock()
+	sort.Strings(lines)
+	return strings.Join(lines, "\n"), nil
+}
+
+func (s *Server) chatWho(*Client, []string) (string, error) {
+	var names []string
+	for _, c := range s.snapshotClients() {
+		if c.loggedIn() {
+			names = append(names, c.Name())
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return strings.ToLower(names[i]) < strings.ToLower(names[j]) })
+	reply := fmt.Sprintf("%d online", len(names))
+	if len(names) > maxWhoNames {
+		return fmt.Sprintf("%s: %s and %d more", reply, strings.Join(names[:maxWhoNames], ", "), len(names)-maxWhoNames), nil
+	}
+	if len(names) > 0 {
+		reply += ": " + strings.Join(names, ", ")
+	}
+	return reply, nil
+}
+
+func chatTime(*Client, []string) (string, error) {
+	now := time.Now()
+	day := float64(now.UnixMilli()%protocol.DayLength.Milliseconds()) / float64(protocol.DayLength.Milliseconds())
+	minutes := int(day * 24 * 60)
+	return fmt.Sprintf("Server time is %s; in the world it is %02d:%02d", now.UTC().Format("15:04 MST"), minutes/60, minutes%60), nil
+}
+
+// chatRoll rolls NdM dice, or one die with the given number of sides.
+func chatRoll(client *Client, args []string) (string, error) {
+	dice, sides := 1, 100
+	if len(args) > 0 {
+		n, m, isDice := strings.Cut(strings.ToLower(args[0]), "d")
+		var err error
+		if !isDice {
+			sides, err = strconv.Atoi(n)
+		} else {
+			if n != "" {
+				dice, err = strconv.Atoi(n)
+			}
+			if err == nil {
+				sides, err = strconv.Atoi(m)
+			}
+		}
+		if err != nil || dice < 1 || dice > maxDice || sides < 2 || sides > maxDieSides {
+			return "", fmt.Errorf("roll takes NdM or a number, up to %dd%d", maxDice, maxDieSides)
+		}
+	}
+	total := 0
+	rolls := make([]string, dice)
+	for i := range rolls {
+		roll := rand.Intn(sides) + 1
+		total += roll
+		rolls[i] = strconv.Itoa(roll)
+	}
+	if dice == 1 {
+		return fmt.Sprintf("%s rolls %d (1-%d)", client.Name(), total, sides), nil
+	}
+	return fmt.Sprintf("%s rolls %d (%dd%d: %s)", client.Name(), total, dice, sides, strings.Join(rolls, " + ")), nil
+}
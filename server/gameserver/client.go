@@ -0,0 +1,157 @@
+package gameserver
+
+import (
+	"crypto/ecdh"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+const clientSendQueue = 64
+
+type Client struct {
+	id   string
+	conn *meteredConn
+	send chan string
+	done chan struct{}
+	room *Room
+	// warpTo carries server-initiated room changes to the reader goroutine,
+	// which is the only one allowed to call moveToRoom.
+	warpTo chan Warp
+	warps  atomic.Int64
+	// voiceToken identifies the client's voice packets, and voiceAddr is
+	// where they come from; both are unset when voice is off. voiceKey is
+	// the server's half of the key exchange and voiceKeys what it yields,
+	// once the client answers; voiceSeq is only touched by ServeVoice.
+	voiceToken string
+	voiceConn  *net.UDPConn
+	voiceAddr  atomic.Pointer[net.UDPAddr]
+	voiceKey   *ecdh.PrivateKey
+	voiceKeys  atomic.Pointer[protocol.VoiceKeys]
+	voiceSeq   uint16
+	// lastActive is when the player last gave input, in Unix nanoseconds;
+	// idle marks them as away in snapshots. lastReport is only touched by
+	// the reader goroutine.
+	lastActive atomic.Int64
+	idle       atomic.Bool
+	idleWarned atomic.Bool
+	lastReport protocol.PlayerState
+	// chatAllowance and mapEditAllowance limit how fast the client may
+	// chat and edit the shared map; only the reader goroutine touches them.
+	chatAllowance    allowance
+	mapEditAllowance allowance
+	// connected is when the client connected, and chatLines and walked,
+	// in hundredths of a pixel, what the server has seen it do since: the
+	// most its session summaries may claim. reported is what they have
+	// claimed so far. Only the reader goroutine touches any but walked.
+	connected time.Time
+	chatLines int
+	walked    atomic.Int64
+	reported  Stats
+	// loginFailures is how many wrong passwords the client has sent; only
+	// the reader goroutine touches it.
+	loginFailures int
+	// health drops as the player is hit and is restored on respawn; party
+	// is the party they are in, if any.
+	health atomic.Int32
+	party  atomic.Pointer[Party]
+	// ackLatency is how late the client's snapshot acks arrive, smoothed,
+	// in nanoseconds; pacer is owned by the room the client is in.
+	ackLatency atomic.Int64
+	pacer      snapshotPacer
+
+	mu      sync.Mutex
+	account string
+	name    string
+	guest   bool
+	profile *Profile
+}
+
+// Name is what other players see: the login name, or the network ID for
+// clients that have not logged in.
+func (c *Client) Name() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.name == "" {
+		return c.id
+	}
+	return c.name
+}
+
+// updateProfile applies fn to the client's profile, if it has one.
+func (c *Client) updateProfile(fn func(p *Profile)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.profile != nil {
+		fn(c.profile)
+	}
+}
+
+func (c *Client) profileSnapshot() *Profile {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.profile == nil || c.guest {
+		return nil
+	}
+	return c.profile.Clone()
+}
+
+// Send queues a message for the client's writer goroutine. Rooms call it from
+// their tick, so a slow client drops messages instead of stalling the room.
+func (c *Client) Send(message string) bool {
+	select {
+	case <-c.done:
+		return false
+	case c.send <- message:
+		return true
+	default:
+		return false
+	}
+}
+
+// Kick tells the client why it is being removed and disconnects it once that
+// message is written, or straight away if its send queue is full.
+func (c *Client) Kick(reason string) {
+	if !c.Send(protocol.Line(protocol.KindKick, reason)) {
+		c.conn.Close()
+	}
+}
+
+func (c *Client) writeLoop() {
+	for {
+		select {
+		case <-c.done:
+			return
+		case message := <-c.send:
+			if _, err := fmt.Fprint(c.conn, message); err != nil {
+				log.Println("Error sending to client:", err)
+			}
+			if kind, _ := protocol.Split(message); kind == protocol.KindKick {
+				c.conn.Close()
+				return
+			}
+		}
+	}
+}
+
+func (c *Client) loggedIn() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.profile != nil || c.account != ""
+}
+
+func (c *Client) Account() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.account
+}
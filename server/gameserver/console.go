@@ -0,0 +1,450 @@
+package gameserver
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+type consoleCommand struct {
+	usage string
+	run   func(args []string, out io.Writer) error
+}
+
+func (s *Server) consoleCommands() map[string]consoleCommand {
+	return map[string]consoleCommand{
+		"players": {"players", func(args []string, out io.Writer) error {
+			for _, c := range s.snapshotClients() {
+				fmt.Fprintf(out, "%s %s name=%s room=%s\n", c.id, c.conn.RemoteAddr(), c.Name(), s.roomName(c))
+			}
+			for _, name := range s.RemotePlayers() {
+				fmt.Fprintf(out, "remote name=%s\n", name)
+			}
+			return nil
+		}},
+		"bandwidth": {"bandwidth", func(args []string, out io.Writer) error {
+			for _, c := range s.snapshotClients() {
+				fmt.Fprintf(out, "%s in=%dB out=%dB throttled=%d\n", c.id, c.conn.bytesIn.Load(), c.conn.bytesOut.Load(), c.conn.throttled.Load())
+			}
+			return nil
+		}},
+		"rooms": {"rooms", func(args []string, out io.Writer) error {
+			for _, r := range s.snapshotRooms() {
+				fmt.Fprintf(out, "%s players=%d ticks=%d overruns=%d dropped=%v step=%v\n", r.name, r.PlayerCount(), r.tickLoop.Ticks(), r.tickLoop.Overruns(), r.tickLoop.Dropped(), r.LastStep())
+			}
+			return nil
+		}},
+		"spawn": {"spawn <npc|item|resource|door|vehicle> <name> <x> <y> [room]", s.consoleSpawn},
+		"despawn": {"despawn <entity-id> [room]", func(args []string, out io.Writer) error {
+			if len(args) < 1 {
+				return errUsage
+			}
+			s.room(optionalArg(args, 1, defaultRoom)).Send(roomMessage{kind: roomDespawn, entity: protocol.Entity{ID: args[0]}})
+			return nil
+		}},
+		"owner":    {"owner <entity-id> <player|server> [room]", s.consoleOwner},
+		"teleport": {"teleport <player> <x> <y>", s.consoleTeleport},
+		"warp":     {"warp <player> <room> <x> <y>", s.consoleWarp},
+		"effect":   {"effect <player> <speed|slow|poison|invulnerable> <seconds>", s.consoleEffect},
+		"respawn": {"respawn <player>", func(args []string, out io.Writer) error {
+			if len(args) < 1 {
+				return errUsage
+			}
+			client := s.findClient(args[0])
+			if client == nil {
+				return fmt.Errorf("no player %q", args[0])
+			}
+			if !client.RequestWarp(Warp{Room: defaultRoom, Spawn: true}) {
+				return fmt.Errorf("%s has too many pending warps", args[0])
+			}
+			return nil
+		}},
+		"announce": {"announce <text...>", func(args []string, out io.Writer) error {
+			if len(args) < 1 {
+				return errUsage
+			}
+			s.announce(protocol.FeedEvent{Kind: protocol.FeedAnnounce, Text: strings.Join(args, " ")})
+			return nil
+		}},
+		"kick": {"kick <player> [reason...]", func(args []string, out io.Writer) error {
+			if len(args) < 1 {
+				return errUsage
+			}
+			client := s.findClient(args[0])
+			if client == nil {
+				return fmt.Errorf("no player %q", args[0])
+			}
+			reason := strings.Join(args[1:], " ")
+			if reason == "" {
+				reason = "kicked by an administrator"
+			}
+			s.kick(client, reason)
+			return nil
+		}},
+		"mute": {"mute <player> <duration> [reason...]", func(args []string, out io.Writer) error {
+			if len(args) < 2 {
+				return errUsage
+			}
+			d, err := time.ParseDuration(args[1])
+			if err != nil || d <= 0 {
+				return fmt.Errorf("bad duration %q, e.g. 10m or 1h", args[1])
+			}
+			name := args[0]
+			if client := s.findClient(args[0]); client != nil {
+				name = client.Name()
+				text := fmt.Sprintf("You have been muted for %v", d)
+				if reason := strings.Join(args[2:], " "); reason != "" {
+					text += ": " + reason
+				}
+				chat := protocol.ChatMessage{Channel: protocol.ChannelZone, From: "server", Text: text}
+				client.Send(protocol.Line(protocol.KindChat, protocol.EncodeChat(chat)))
+			}
+			s.mute(name, d)
+			fmt.Fprintf(out, "muted %s for %v\n", name, d)
+			return nil
+		}},
+		"unmute": {"unmute <player>", func(args []string, out io.Writer) error {
+			if len(args) < 1 {
+				return errUsage
+			}
+			name := args[0]
+			if client := s.findClient(args[0]); client != nil {
+				name = client.Name()
+			}
+			if !s.unmute(name) {
+				return fmt.Errorf("%s is not muted", name)
+			}
+			return nil
+		}},
+		"score": {"score <player> <points>", func(args []string, out io.Writer) error {
+			if len(args) < 2 {
+				return errUsage
+			}
+			client := s.findClient(args[0])
+			if client == nil {
+				return fmt.Errorf("no player %q", args[0])
+			}
+			points, err := strconv.Atoi(args[1])
+			if err != nil {
+				return err
+			}
+			client.updateProfile(func(p *Profile) { p.Stats.Score += points })
+			return nil
+		}},
+		"save": {"save", func(args []string, out io.Writer) error {
+			if err := s.SaveWorld(); err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "world saved to %s\n", s.worldFile)
+			return nil
+		}},
+		"dump": {"dump <file>", func(args []string, out io.Writer) error {
+			if len(args) < 1 {
+				return errUsage
+			}
+			if err := s.DumpState(args[0]); err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "state dumped to %s\n", args[0])
+			return nil
+		}},
+		"diff": {"diff <file-a> <file-b>", func(args []string, out io.Writer) error {
+			if len(args) < 2 {
+				return errUsage
+			}
+			n, err := DiffStates(args[0], args[1], out)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "%d differences\n", n)
+			return nil
+		}},
+		"motd": {"motd", func(args []string, out io.Writer) error {
+			if s.motdFile == "" {
+				return errors.New("no message of the day file configured")
+			}
+			motd, err := s.ReloadMOTD()
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "message of the day reloaded: %s\n", motd.Title)
+			return nil
+		}},
+		"whitelist": {"whitelist <on|off|list|add <account>|remove <account>>", s.consoleWhitelist},
+		"editors":   {"editors <list|add <account>|remove <account>>", s.consoleEditors},
+		"portal":    {"portal <x> <y> <radius> <to-room> <to-x> <to-y> [room]", s.consolePortal},
+		"conveyor":  {"conveyor <x> <y> <width> <height> <dx> <dy> [room]", s.consoleConveyor},
+		"weather": {"weather <clear|rain|snow|fog> [room]", func(args []string, out io.Writer) error {
+			if len(args) < 1 {
+				return errUsage
+			}
+			weather, ok := protocol.ParseWeather(args[0])
+			if !ok {
+				return fmt.Errorf("unknown weather %q", args[0])
+			}
+			s.room(optionalArg(args, 1, defaultRoom)).Send(roomMessage{kind: roomWeather, weather: weather})
+			return nil
+		}},
+	}
+}
+
+var errUsage = errors.New("usage")
+
+func optionalArg(args []string, i int, fallback string) string {
+	if i < len(args) {
+		return args[i]
+	}
+	return fallback
+}
+
+func parseCoords(xs, ys string) (float64, float64, error) {
+	x, err := protocol.ParseFloat(xs)
+	if err != nil {
+		return 0, 0, err
+	}
+	y, err := protocol.ParseFloat(ys)
+	if err != nil {
+		return 0, 0, err
+	}
+	return x, y, nil
+}
+
+func (s *Server) consoleSpawn(args []string, out io.Writer) error {
+	if len(args) < 4 {
+		return errUsage
+	}
+	kind := args[0]
+	if kind != protocol.EntityNPC && kind != protocol.EntityItem && kind != protocol.EntityResource && kind != protocol.EntityDoor && kind != protocol.EntityVehicle {
+		return fmt.Errorf("unknown entity kind %q", kind)
+	}
+	if _, ok := protocol.VehicleSeats[args[1]]; kind == protocol.EntityVehicle && !ok {
+		return fmt.Errorf("unknown vehicle %q", args[1])
+	}
+	x, y, err := parseCoords(args[2], args[3])
+	if err != nil {
+		return err
+	}
+
+	entity := protocol.Entity{ID: s.newEntityID(), Kind: kind, Name: args[1], X: x, Y: y}
+	room := optionalArg(args, 4, defaultRoom)
+	s.room(room).Send(roomMessage{kind: roomSpawn, entity: entity})
+	fmt.Fprintf(out, "spawned %s in %s\n", entity.ID, room)
+	return nil
+}
+
+func (s *Server) consoleTeleport(args []string, out io.Writer) error {
+	if len(args) < 3 {
+		return errUsage
+	}
+	client := s.findClient(args[0])
+	if client == nil {
+		return fmt.Errorf("no player %q", args[0])
+	}
+	x, y, err := parseCoords(args[1], args[2])
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	room := client.room
+	s.mu.Unlock()
+	room.Send(roomMessage{kind: roomTeleport, client: client, state: protocol.PlayerState{X: x, Y: y}})
+	return nil
+}
+
+func (s *Server) consoleEffect(args []string, out io.Writer) error {
+	if len(args) < 3 {
+		return errUsage
+	}
+	client := s.findClient(args[0])
+	if client == nil {
+		return fmt.Errorf("no player %q", args[0])
+	}
+	if _, ok := effectRules[args[1]]; !ok {
+		return fmt.Errorf("unknown effect %q", args[1])
+	}
+	seconds, err := protocol.ParseFloat(args[2])
+	if err != nil || seconds <= 0 {
+		return fmt.Errorf("bad duration %q, e.g. 10", args[2])
+	}
+
+	s.mu.Lock()
+	room := client.room
+	s.mu.Unlock()
+	room.Send(roomMessage{kind: roomEffect, client: client, item: args[1], seconds: seconds})
+	return nil
+}
+
+func (s *Server) consoleWarp(args []string, out io.Writer) error {
+	if len(args) < 4 {
+		return errUsage
+	}
+	client := s.findClient(args[0])
+	if client == nil {
+		return fmt.Errorf("no player %q", args[0])
+	}
+	x, y, err := parseCoords(args[2], args[3])
+	if err != nil {
+		return err
+	}
+	if !client.RequestWarp(Warp{Room: args[1], X: x, Y: y}) {
+		return fmt.Errorf("%s has too many pending warps", args[0])
+	}
+	return nil
+}
+
+func (s *Server) consolePortal(args []string, out io.Writer) error {
+	if len(args) < 6 {
+		return errUsage
+	}
+	x, y, err := parseCoords(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	radius, err := protocol.ParseFloat(args[2])
+	if err != nil {
+		return err
+	}
+	toX, toY, err := parseCoords(args[4], args[5])
+	if err != nil {
+		return err
+	}
+
+	portal := Portal{X: x, Y: y, Radius: radius, To: Warp{Room: args[3], X: toX, Y: toY}}
+	room := optionalArg(args, 6, defaultRoom)
+	s.room(room).Send(roomMessage{kind: roomPortal, portal: portal})
+	fmt.Fprintf(out, "portal in %s at %.0f,%.0f leads to %s %.0f,%.0f\n", room, x, y, portal.To.Room, toX, toY)
+	return nil
+}
+
+func (s *Server) RunConsole(in io.Reader, out io.Writer) {
+	commands := s.consoleCommands()
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		if fields[0] == "help" {
+			names := make([]string, 0, len(commands))
+			for name := range commands {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				fmt.Fprintln(out, commands[name].usage)
+			}
+			continue
+		}
+
+		command, ok := commands[fields[0]]
+		if !ok {
+			fmt.Fprintf(out, "unknown command %q, try help\n", fields[0])
+			continue
+		}
+		if err := command.run(fields[1:], out); err == errUsage {
+			fmt.Fprintln(out, "usage:", command.usage)
+		} else if err != nil {
+			fmt.Fprintln(out, "error:", err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Println("Error reading console:", err)
+	}
+}
+
+func (s *Server) consoleConveyor(args []string, out io.Writer) error {
+	if len(args) < 6 {
+		return errUsage
+	}
+	x, y, err := parseCoords(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	width, height, err := parseCoords(args[2], args[3])
+	if err != nil {
+		return err
+	}
+	dx, dy, err := parseCoords(args[4], args[5])
+	if err != nil {
+		return err
+	}
+
+	conveyor := Conveyor{X: x, Y: y, Width: width, Height: height, DX: dx, DY: dy}
+	room := optionalArg(args, 6, defaultRoom)
+	s.room(room).Send(roomMessage{kind: roomConveyor, conveyor: conveyor})
+	fmt.Fprintf(out, "conveyor in %s at %.0f,%.0f moves players %.0f,%.0f per second\n", room, x, y, dx, dy)
+	return nil
+}
+
+func (s *Server) consoleWhitelist(args []string, out io.Writer) error {
+	if len(args) < 1 {
+		return errUsage
+	}
+	if s.whitelist == nil {
+		return errors.New("no whitelist file configured")
+	}
+	switch args[0] {
+	case "on", "off":
+		s.whitelist.SetEnabled(args[0] == "on")
+		fmt.Fprintf(out, "whitelist %s\n", args[0])
+	case "list":
+		state := "off"
+		if s.whitelist.Enabled() {
+			state = "on"
+		}
+		names := s.whitelist.Names()
+		fmt.Fprintf(out, "whitelist is %s, %d accounts: %s\n", state, len(names), strings.Join(names, ", "))
+	case "add", "remove":
+		return editNameList(s.whitelist, "the whitelist", args)
+	default:
+		return errUsage
+	}
+	return nil
+}
+
+func (s *Server) consoleEditors(args []string, out io.Writer) error {
+	if len(args) < 1 {
+		return errUsage
+	}
+	if s.mapEditors == nil {
+		return errors.New("no map editors file configured")
+	}
+	switch args[0] {
+	case "list":
+		names := s.mapEditors.Names()
+		fmt.Fprintf(out, "%d map editors: %s\n", len(names), strings.Join(names, ", "))
+	case "add", "remove":
+		return editNameList(s.mapEditors, "the map editors", args)
+	default:
+		return errUsage
+	}
+	return nil
+}
+
+// editNameList runs an add or remove console command against list.
+func editNameList(list *Whitelist, what string, args []string) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+	if args[0] == "add" {
+		if !validName(args[1]) {
+			return fmt.Errorf("invalid name %q", args[1])
+		}
+		return list.Add(args[1])
+	}
+	ok, err := list.Remove(args[1])
+	if err == nil && !ok {
+		return fmt.Errorf("%q is not on %s", args[1], what)
+	}
+	return err
+}
@@ -0,0 +1,140 @@
+package gameserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+// RecipeBook holds the recipes loaded from a recipe file, a JSON array of
+// recipes. A nil RecipeBook has none.
+type RecipeBook struct {
+	recipes []protocol.Recipe
+	byID    map[string]*protocol.Recipe
+}
+
+func LoadRecipeBook(path string) (*RecipeBook, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b := &RecipeBook{}
+	if err := json.Unmarshal(data, &b.recipes); err != nil {
+		return nil, fmt.Errorf("parsing recipes %s: %w", path, err)
+	}
+	b.byID = make(map[string]*protocol.Recipe, len(b.recipes))
+	for i := range b.recipes {
+		r := &b.recipes[i]
+		if r.ID == "" || r.Output == "" || len(r.Inputs) == 0 {
+			return nil, fmt.Errorf("recipes %s: every recipe needs an id, an output and inputs", path)
+		}
+		for item, count := range r.Inputs {
+			if count <= 0 {
+				return nil, fmt.Errorf("recipes %s: %s needs a positive count of %s", path, r.ID, item)
+			}
+		}
+		if b.byID[r.ID] != nil {
+			return nil, fmt.Errorf("recipes %s: duplicate recipe %q", path, r.ID)
+		}
+		r.Count = max(r.Count, 1)
+		r.Seconds = max(r.Seconds, 0)
+		b.byID[r.ID] = r
+	}
+	return b, nil
+}
+
+func (b *RecipeBook) recipe(id string) *protocol.Recipe {
+	if b == nil {
+		return nil
+	}
+	return b.byID[id]
+}
+
+// craftJob is a recipe being crafted, whose ingredients are already taken.
+type craftJob struct {
+	recipe *protocol.Recipe
+	done   time.Time
+}
+
+// sendInventory tells the client what it carries.
+func (c *Client) sendInventory() {
+	var payload string
+	c.updateProfile(func(p *Profile) { payload = protocol.EncodeInventory(p.Inventory) })
+	c.Send(protocol.Line(protocol.KindInventory, payload))
+}
+
+// sendCrafting tells a player who just entered the world what they carry
+// and what they can craft.
+func (s *Server) sendCrafting(client *Client) {
+	client.sendInventory()
+	if s.recipes != nil {
+		client.Send(protocol.Line(protocol.KindRecipes, protocol.EncodeRecipes(s.recipes.recipes)))
+	}
+}
+
+// startCrafting takes the recipe's ingredients from the player and starts
+// the clock on it. A player crafts one thing at a time.
+func (r *Room) startCrafting(c *Client, id string) {
+	recipe := r.recipes.recipe(id)
+	var err error
+	switch {
+	case recipe == nil:
+		err = fmt.Errorf("there is no recipe %q", id)
+	case r.crafting[c] != nil:
+		err = fmt.Errorf("already crafting %s", r.crafting[c].recipe.Output)
+	default:
+		c.updateProfile(func(p *Profile) {
+			for item, count := range recipe.Inputs {
+				if p.Inventory[item] < count {
+					err = fmt.Errorf("%s needs %d %s", recipe.Output, count, item)
+					return
+				}
+			}
+			for item, count := range recipe.Inputs {
+				p.Inventory[item] -= count
+			}
+		})
+	}
+	if err != nil {
+		c.Send(protocol.Line(protocol.KindError, err.Error()))
+		return
+	}
+	r.crafting[c] = &craftJob{recipe: recipe, done: r.clock().Add(durationOf(recipe.Seconds))}
+	c.Send(protocol.Line(protocol.KindCraft, protocol.EncodeCraftStatus(protocol.CraftStatus{Recipe: id, Seconds: recipe.Seconds})))
+	c.sendInventory()
+}
+
+// finishCrafting hands out the results of every job whose time is up.
+func (r *Room) finishCrafting(now time.Time) {
+	for _, c := range inOrder(r.crafting) {
+		job := r.crafting[c]
+		if job == nil || now.Before(job.done) {
+			continue
+		}
+		delete(r.crafting, c)
+		c.updateProfile(func(p *Profile) { p.Inventory[job.recipe.Output] += job.recipe.Count })
+		c.Send(protocol.Line(protocol.KindCraft, protocol.EncodeCraftStatus(protocol.CraftStatus{Recipe: job.recipe.ID, Done: true})))
+		c.sendInventory()
+		r.advanceQuests(c, func(Objective) bool { return false })
+	}
+}
+
+// cancelCrafting gives back the ingredients of the player's unfinished job,
+// as when they leave the room before it is done.
+func (r *Room) cancelCrafting(c *Client) {
+	job := r.crafting[c]
+	if job == nil {
+		return
+	}
+	delete(r.crafting, c)
+	c.updateProfile(func(p *Profile) {
+		for item, count := range job.recipe.Inputs {
+			p.Inventory[item] += count
+		}
+	})
+	c.Send(protocol.Line(protocol.KindCraft, protocol.EncodeCraftStatus(protocol.CraftStatus{Recipe: job.recipe.ID, Cancelled: true})))
+	c.sendInventory()
+}
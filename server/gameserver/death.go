@@ -0,0 +1,67 @@
+package gameserver
+
+import (
+	"log"
+	"time"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+const (
+	// A defeated player lies dead for respawnDelay, then respawns
+	// invulnerable for invulnerableSeconds.
+	respawnDelay        = 5 * time.Second
+	invulnerableSeconds = 2.0
+)
+
+// kill lays the player down until their respawn timer runs out. by is what
+// defeated them, and killer the player to blame, if any. Dead players'
+// reports are ignored and nothing can hit them.
+func (r *Room) kill(c, killer *Client, by string) {
+	state := r.players[c]
+	if state == nil {
+		return
+	}
+	r.clearEffects(c)
+	r.cancelGathering(c)
+	delete(r.pushes, c)
+	delete(r.mounts, c)
+	r.unseat(c)
+	state.Anim = protocol.AnimDead
+	state.VX, state.VY = 0, 0
+	r.dead[c] = r.clock().Add(respawnDelay)
+	r.scoreMatchDeath(c)
+
+	defeat := protocol.Defeat{By: by, Seconds: respawnDelay.Seconds()}
+	if killer != nil {
+		defeat.Killer = killer.id
+	}
+	c.Send(protocol.Line(protocol.KindDefeated, protocol.EncodeDefeat(defeat)))
+}
+
+// reviveDead respawns the players whose timer has run out.
+func (r *Room) reviveDead(now time.Time) {
+	for _, c := range inOrder(r.dead) {
+		if at, ok := r.dead[c]; !ok || now.Before(at) {
+			continue
+		}
+		r.respawn(c)
+		if err := r.applyEffect(c, protocol.EffectInvulnerable, invulnerableSeconds); err != nil {
+			log.Println("Error applying effect:", err)
+		}
+	}
+}
+
+// vulnerable reports whether the player can be hit: alive and not just
+// respawned.
+func (r *Room) vulnerable(c *Client) bool {
+	if _, dead := r.dead[c]; dead {
+		return false
+	}
+	for _, e := range r.effects[c] {
+		if e.kind == protocol.EffectInvulnerable {
+			return false
+		}
+	}
+	return true
+}
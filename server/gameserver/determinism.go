@@ -0,0 +1,40 @@
+package gameserver
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Determinism makes the server's rooms play out the same way every time
+// they are given the same inputs, for the simulation harness: each room
+// draws its randomness from Seed and the room's name, and reads the time
+// from Clock. The rooms do not run on their own; whoever set them up steps
+// them, one at a time.
+type Determinism struct {
+	Seed  int64
+	Clock func() time.Time
+}
+
+// makeDeterministic reseeds the room and sets its clock, before anyone has
+// joined it.
+func (r *Room) makeDeterministic(d *Determinism) {
+	h := fnv.New64a()
+	h.Write([]byte(r.name))
+	r.rng = rand.New(rand.NewSource(d.Seed ^ int64(h.Sum64())))
+	r.clock = d.Clock
+	r.weather = NewWeatherCycle(r.rng)
+}
+
+// inOrder is the clients in m sorted by ID, for loops over players whose
+// outcome would otherwise depend on Go's random map order. Entries may be
+// removed while it is walked, so loops look each one up again.
+func inOrder[V any](m map[*Client]V) []*Client {
+	clients := make([]*Client, 0, len(m))
+	for c := range m {
+		clients = append(clients, c)
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].id < clients[j].id })
+	return clients
+}
@@ -0,0 +1,136 @@
+package gameserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+// DialogueChoice is one answer the player can give. Next names the node it
+// leads to; an empty Next ends the conversation.
+type DialogueChoice struct {
+	Text string `json:"text"`
+	Next string `json:"next,omitempty"`
+}
+
+// DialogueNode is one thing an NPC says. A node without choices ends the
+// conversation once the player continues.
+type DialogueNode struct {
+	Text    string           `json:"text"`
+	Choices []DialogueChoice `json:"choices,omitempty"`
+}
+
+// Dialogue is an NPC's dialogue tree, entered at the Start node.
+type Dialogue struct {
+	Start string                  `json:"start"`
+	Nodes map[string]DialogueNode `json:"nodes"`
+}
+
+// DialogueBook holds the dialogue trees loaded from a dialogue file, a JSON
+// object mapping NPC names to their trees. A nil DialogueBook has none.
+type DialogueBook struct {
+	byNPC map[string]*Dialogue
+}
+
+func LoadDialogueBook(path string) (*DialogueBook, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b := &DialogueBook{}
+	if err := json.Unmarshal(data, &b.byNPC); err != nil {
+		return nil, fmt.Errorf("parsing dialogue %s: %w", path, err)
+	}
+	for npc, d := range b.byNPC {
+		if err := d.validate(); err != nil {
+			return nil, fmt.Errorf("dialogue %s: %s: %w", path, npc, err)
+		}
+	}
+	return b, nil
+}
+
+// validate checks that the tree's start and every choice lead to a node.
+func (d *Dialogue) validate() error {
+	if _, ok := d.Nodes[d.Start]; !ok {
+		return fmt.Errorf("start node %q does not exist", d.Start)
+	}
+	for name, node := range d.Nodes {
+		for _, choice := range node.Choices {
+			if _, ok := d.Nodes[choice.Next]; choice.Next != "" && !ok {
+				return fmt.Errorf("node %q leads to missing node %q", name, choice.Next)
+			}
+		}
+	}
+	return nil
+}
+
+func (b *DialogueBook) dialogue(npc string) *Dialogue {
+	if b == nil {
+		return nil
+	}
+	return b.byNPC[npc]
+}
+
+// conversation is where a player is in an NPC's dialogue tree.
+type conversation struct {
+	npc  string
+	node string
+}
+
+// startDialogue opens the NPC's dialogue with the player, returning false
+// when the NPC has nothing to say.
+func (r *Room) startDialogue(c *Client, e *protocol.Entity) bool {
+	d := r.dialogues.dialogue(e.Name)
+	if d == nil {
+		return false
+	}
+	r.talking[c] = &conversation{npc: e.ID, node: d.Start}
+	r.sendDialogue(c, e.Name, d.Nodes[d.Start])
+	return true
+}
+
+// chooseDialogue follows the player's answer. A negative choice, an NPC that
+// is gone or out of reach, or a choice that leads nowhere ends the
+// conversation; only the last goes on to the NPC's shop or next quest.
+func (r *Room) chooseDialogue(c *Client, choice int) {
+	talk := r.talking[c]
+	if talk == nil {
+		return
+	}
+	e := r.entities[talk.npc]
+	if e == nil || !r.withinReach(c, e) {
+		r.endDialogue(c)
+		return
+	}
+	d := r.dialogues.dialogue(e.Name)
+	if d == nil || choice < 0 {
+		r.endDialogue(c)
+		return
+	}
+	node := d.Nodes[talk.node]
+	if choice >= max(len(node.Choices), 1) {
+		return
+	}
+	if len(node.Choices) == 0 || node.Choices[choice].Next == "" {
+		r.endDialogue(c)
+		r.finishTalking(c, e)
+		return
+	}
+	talk.node = node.Choices[choice].Next
+	r.sendDialogue(c, e.Name, d.Nodes[talk.node])
+}
+
+func (r *Room) sendDialogue(c *Client, npc string, node DialogueNode) {
+	line := protocol.DialogueLine{NPC: npc, Text: node.Text}
+	for _, choice := range node.Choices {
+		line.Choices = append(line.Choices, choice.Text)
+	}
+	c.Send(protocol.Line(protocol.KindDialogue, protocol.EncodeDialogueLine(line)))
+}
+
+func (r *Room) endDialogue(c *Client) {
+	delete(r.talking, c)
+	c.Send(protocol.Line(protocol.KindDialogue, ""))
+}
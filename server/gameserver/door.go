@@ -0,0 +1,115 @@
+package gameserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+// Lock is what it takes to open or close a door: carrying Key, or being on
+// Team. A lock that names both lets either through.
+type Lock struct {
+	Key  string `json:"key,omitempty"`
+	Team string `json:"team,omitempty"`
+}
+
+// DoorBook holds the locks loaded from a door file: a JSON object with
+// "teams", mapping team names to the characters on them, and "doors",
+// mapping door names to their locks. Doors it has no lock for, and every
+// door when the DoorBook is nil, open for anyone.
+type DoorBook struct {
+	Teams map[string][]string `json:"teams"`
+	Locks map[string]*Lock    `json:"doors"`
+}
+
+func LoadDoorBook(path string) (*DoorBook, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b := &DoorBook{}
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, fmt.Errorf("parsing doors %s: %w", path, err)
+	}
+	for name, lock := range b.Locks {
+		if lock.Key == "" && lock.Team == "" {
+			return nil, fmt.Errorf("doors %s: %s needs a key or a team", path, name)
+		}
+		if _, ok := b.Teams[lock.Team]; lock.Team != "" && !ok {
+			return nil, fmt.Errorf("doors %s: %s is locked to unknown team %q", path, name, lock.Team)
+		}
+	}
+	return b, nil
+}
+
+func (b *DoorBook) lock(door string) *Lock {
+	if b == nil {
+		return nil
+	}
+	return b.Locks[door]
+}
+
+// unlocks reports whether the player can get through the lock.
+func (b *DoorBook) unlocks(c *Client, lock *Lock) bool {
+	if lock.Team != "" && slices.Contains(b.Teams[lock.Team], c.Name()) {
+		return true
+	}
+	held := false
+	c.updateProfile(func(p *Profile) { held = lock.Key != "" && p.Inventory[lock.Key] > 0 })
+	return held
+}
+
+// toggleDoor opens or closes the door for the player, if its lock lets them
+// and, when closing, nobody stands in the doorway.
+func (r *Room) toggleDoor(c *Client, e *protocol.Entity) {
+	open := !r.openDoors[e.ID]
+	lock := r.doors.lock(e.Name)
+	var err error
+	switch {
+	case lock != nil && !r.doors.unlocks(c, lock) && lock.Key != "":
+		err = fmt.Errorf("%s is locked; it takes %s", e.Name, lock.Key)
+	case lock != nil && !r.doors.unlocks(c, lock):
+		err = fmt.Errorf("%s is locked to %s", e.Name, lock.Team)
+	case !open && r.doorwayTaken(e):
+		err = errors.New("someone is standing in the way")
+	}
+	if err != nil {
+		c.Send(protocol.Line(protocol.KindError, err.Error()))
+		return
+	}
+	if open {
+		r.openDoors[e.ID] = true
+	} else {
+		delete(r.openDoors, e.ID)
+	}
+	r.broadcast(protocol.Line(protocol.KindDoor, protocol.EncodeDoor(e.ID, open)))
+}
+
+func (r *Room) doorwayTaken(e *protocol.Entity) bool {
+	taken := false
+	r.grid.Near(e.X, e.Y, protocol.DoorSize*2, func(_ *Client, state *protocol.PlayerState) {
+		taken = taken || protocol.DoorCovers(e.X, e.Y, state.X, state.Y)
+	})
+	return taken
+}
+
+// closedDoorAt reports whether a closed door covers x, y.
+func (r *Room) closedDoorAt(x, y float64) bool {
+	for id, e := range r.entities {
+		if e.Kind == protocol.EntityDoor && !r.openDoors[id] && protocol.DoorCovers(e.X, e.Y, x, y) {
+			return true
+		}
+	}
+	return false
+}
+
+// sendDoors tells a player entering the room which doors are open.
+func (r *Room) sendDoors(c *Client) {
+	for id := range r.openDoors {
+		c.Send(protocol.Line(protocol.KindDoor, protocol.EncodeDoor(id, true)))
+	}
+}
@@ -0,0 +1,147 @@
+package gameserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// eventLogKeep is how many rotated event log files are kept besides the
+// current one, as path.1 (newest) to path.5 (oldest).
+const eventLogKeep = 5
+
+// Event types written to the event log.
+const (
+	eventJoin   = "join"
+	eventLeave  = "leave"
+	eventKick   = "kick"
+	eventChat   = "chat"
+	eventDeath  = "death"
+	eventMute   = "mute"
+	eventUnmute = "unmute"
+	eventQuest  = "quest"
+)
+
+// Event is one line of the event log. Other is the second player involved,
+// such as the killer in a death; Text is the chat line, kick reason or
+// completed quest.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Player  string    `json:"player"`
+	Room    string    `json:"room,omitempty"`
+	Other   string    `json:"other,omitempty"`
+	Channel string    `json:"channel,omitempty"`
+	Text    string    `json:"text,omitempty"`
+}
+
+// EventLog appends significant game events to a file as JSON lines, one
+// event per line, for auditing and external analytics. The file is never
+// rewritten; once it grows past maxSize it is rotated out and a new one
+// started. A nil EventLog discards events, so callers need not check.
+type EventLog struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	size    int64
+	maxSize int64
+}
+
+func OpenEventLog(path string, maxSize int64) (*EventLog, error) {
+	l := &EventLog{path: path, maxSize: maxSize}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *EventLog) open() error {
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	l.file, l.size = file, info.Size()
+	return nil
+}
+
+// Write appends e, stamping it with the current time.
+func (l *EventLog) Write(e Event) {
+	if l == nil {
+		return
+	}
+	e.Time = time.Now().UTC()
+	line, err := json.Marshal(e)
+	if err != nil {
+		log.Println("Error encoding event:", err)
+		return
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return
+	}
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			log.Println("Error rotating event log:", err)
+			if l.file == nil && l.open() != nil {
+				return
+			}
+		}
+	}
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		log.Println("Error writing event log:", err)
+	}
+}
+
+// rotate shifts path.1 through path.(eventLogKeep-1) up by one, dropping
+// the oldest, moves the current file to path.1 and opens a fresh one.
+func (l *EventLog) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	l.file = nil
+	for i := eventLogKeep - 1; i >= 1; i-- {
+		from := fmt.Sprintf("%s.%d", l.path, i)
+		if err := os.Rename(from, fmt.Sprintf("%s.%d", l.path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(l.path, l.path+".1"); err != nil {
+		return err
+	}
+	return l.open()
+}
+
+func (l *EventLog) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// kick disconnects the client with reason and records it.
+func (s *Server) kick(client *Client, reason string) {
+	s.events.Write(Event{Type: eventKick, Player: client.Name(), Text: reason})
+	client.Kick(reason)
+}
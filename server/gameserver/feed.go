@@ -0,0 +1,15 @@
+package gameserver
+
+import "darkzone/MultiTestServer/protocol"
+
+// announce adds e to the event feed of every player in the room.
+func (r *Room) announce(e protocol.FeedEvent) {
+	r.broadcast(protocol.Line(protocol.KindFeed, protocol.EncodeFeedEvent(e)))
+}
+
+// announce adds e to the event feed of every player on the server.
+func (s *Server) announce(e protocol.FeedEvent) {
+	for _, room := range s.snapshotRooms() {
+		room.Send(roomMessage{kind: roomFeed, feed: e})
+	}
+}
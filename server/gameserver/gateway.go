@@ -0,0 +1,108 @@
+package gameserver
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+	"time"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+const zoneDialTimeout = 5 * time.Second
+
+// Gateway accepts player connections and relays each one to the zone server
+// that simulates the player's room. When a zone hands a player off to a
+// room on another zone, the gateway reconnects them there; the client keeps
+// its one connection and only sees a new welcome and a teleport.
+type Gateway struct {
+	zones  *ZoneMap
+	secret string
+}
+
+func NewGateway(zones *ZoneMap, secret string) *Gateway {
+	return &Gateway{zones: zones, secret: secret}
+}
+
+func (g *Gateway) Serve(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Println("Error accepting connection:", err)
+			continue
+		}
+		go g.HandleConn(conn)
+	}
+}
+
+func (g *Gateway) HandleConn(conn net.Conn) {
+	defer conn.Close()
+
+	fromClient := readLines(conn)
+	addr := g.zones.ZoneFor(defaultRoom)
+	resume := ""
+	for {
+		zone, err := net.DialTimeout("tcp", addr, zoneDialTimeout)
+		if err != nil {
+			log.Printf("Error connecting to zone %s: %v", addr, err)
+			io.WriteString(conn, protocol.Line(protocol.KindKick, "zone unavailable"))
+			return
+		}
+		if _, err := io.WriteString(zone, protocol.Line(protocol.KindResume, g.secret+";"+resume)); err != nil {
+			log.Printf("Error handing player to zone %s: %v", addr, err)
+			zone.Close()
+			return
+		}
+
+		handoff, ok := g.relay(conn, fromClient, zone)
+		zone.Close()
+		if !ok {
+			return
+		}
+		r, err := protocol.DecodeResume(handoff)
+		if err != nil {
+			log.Printf("Bad handoff from zone %s: %v", addr, err)
+			return
+		}
+		addr, resume = g.zones.ZoneFor(r.Room), handoff
+	}
+}
+
+// relay copies lines both ways until either side closes, or the zone hands
+// the player off, in which case it returns the handoff payload.
+func (g *Gateway) relay(client net.Conn, fromClient <-chan string, zone net.Conn) (handoff string, ok bool) {
+	fromZone := readLines(zone)
+	// Unblock the zone reader once the caller closes the connection.
+	defer func() {
+		go func() {
+			for range fromZone {
+			}
+		}()
+	}()
+
+	for {
+		select {
+		case line, open := <-fromClient:
+			if !open {
+				return "", false
+			}
+			if _, err := io.WriteString(zone, line); err != nil {
+				return "", false
+			}
+		case line, open := <-fromZone:
+			if !open {
+				return "", false
+			}
+			if kind, payload := protocol.Split(line); kind == protocol.KindHandoff {
+				return payload, true
+			}
+			if _, err := io.WriteString(client, line); err != nil {
+				return "", false
+			}
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package gameserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+// ResourceType is what gathering from a node yields: Count of Item after
+// Seconds of channelling, after which the node is gone for Respawn seconds.
+type ResourceType struct {
+	Item    string  `json:"item"`
+	Count   int     `json:"count,omitempty"`
+	Seconds float64 `json:"seconds,omitempty"`
+	Respawn float64 `json:"respawn,omitempty"`
+}
+
+// ResourceBook holds the resource types loaded from a resource file, a JSON
+// object mapping node names such as "tree" to what they yield. A nil
+// ResourceBook has none, and nodes cannot be gathered from.
+type ResourceBook struct {
+	byName map[string]*ResourceType
+}
+
+func LoadResourceBook(path string) (*ResourceBook, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b := &ResourceBook{}
+	if err := json.Unmarshal(data, &b.byName); err != nil {
+		return nil, fmt.Errorf("parsing resources %s: %w", path, err)
+	}
+	for name, t := range b.byName {
+		if t.Item == "" {
+			return nil, fmt.Errorf("resources %s: %s yields no item", path, name)
+		}
+		t.Count = max(t.Count, 1)
+		t.Seconds = max(t.Seconds, 0)
+		t.Respawn = max(t.Respawn, 0)
+	}
+	return b, nil
+}
+
+func (b *ResourceBook) resource(name string) *ResourceType {
+	if b == nil {
+		return nil
+	}
+	return b.byName[name]
+}
+
+// gatherJob is a player channelling on a node.
+type gatherJob struct {
+	node string
+	done time.Time
+}
+
+// depletedNode is an emptied node waiting to grow back.
+type depletedNode struct {
+	entity  protocol.Entity
+	respawn time.Time
+}
+
+func durationOf(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// startGathering begins channelling on the node for the player.
+func (r *Room) startGathering(c *Client, id string) {
+	e := r.entities[id]
+	if e == nil || e.Kind != protocol.EntityResource || !r.withinReach(c, e) {
+		return
+	}
+	t := r.resources.resource(e.Name)
+	var err error
+	switch {
+	case t == nil:
+		err = fmt.Errorf("nothing can be gathered from %s", e.Name)
+	case r.gathering[c] != nil:
+		err = errors.New("already gathering")
+	}
+	if err != nil {
+		c.Send(protocol.Line(protocol.KindError, err.Error()))
+		return
+	}
+	r.gathering[c] = &gatherJob{node: id, done: r.clock().Add(durationOf(t.Seconds))}
+	c.Send(protocol.Line(protocol.KindGather, protocol.EncodeGatherStatus(protocol.GatherStatus{ID: id, Seconds: t.Seconds})))
+}
+
+// cancelGathering stops the player's channel without a yield.
+func (r *Room) cancelGathering(c *Client) {
+	job := r.gathering[c]
+	if job == nil {
+		return
+	}
+	delete(r.gathering, c)
+	c.Send(protocol.Line(protocol.KindGather, protocol.EncodeGatherStatus(protocol.GatherStatus{ID: job.node, Cancelled: true})))
+}
+
+// checkGathering cancels the player's channel once they walk out of reach
+// of the node.
+func (r *Room) checkGathering(c *Client) {
+	if job := r.gathering[c]; job != nil {
+		if e := r.entities[job.node]; e == nil || !r.withinReach(c, e) {
+			r.cancelGathering(c)
+		}
+	}
+}
+
+// finishGathering empties the nodes whose channel is up into the gatherer's
+// inventory, cancelling anyone else gathering from the same node.
+func (r *Room) finishGathering(now time.Time) {
+	for _, c := range inOrder(r.gathering) {
+		job := r.gathering[c]
+		if job == nil || now.Before(job.done) {
+			continue
+		}
+		e := r.entities[job.node]
+		if e == nil {
+			r.cancelGathering(c)
+			continue
+		}
+		t := r.resources.resource(e.Name)
+		delete(r.gathering, c)
+		c.updateProfile(func(p *Profile) { p.Inventory[t.Item] += t.Count })
+		c.Send(protocol.Line(protocol.KindGather, protocol.EncodeGatherStatus(protocol.GatherStatus{ID: job.node, Done: true})))
+		c.sendInventory()
+		r.advanceQuests(c, func(Objective) bool { return false })
+
+		r.broadcast(protocol.Line(protocol.KindHarvest, job.node))
+		r.depleted[job.node] = depletedNode{entity: r.homes[job.node], respawn: now.Add(durationOf(t.Respawn))}
+		r.handle(roomMessage{kind: roomDespawn, entity: *e})
+		for other, otherJob := range r.gathering {
+			if otherJob.node == job.node {
+				r.cancelGathering(other)
+			}
+		}
+	}
+}
+
+// respawnResources brings back the nodes whose respawn time is up.
+func (r *Room) respawnResources(now time.Time) {
+	ids := make([]string, 0, len(r.depleted))
+	for id := range r.depleted {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		node := r.depleted[id]
+		if now.Before(node.respawn) {
+			continue
+		}
+		delete(r.depleted, id)
+		r.handle(roomMessage{kind: roomSpawn, entity: node.entity})
+	}
+}
@@ -0,0 +1,95 @@
+package gameserver
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+const guestPrefix = "Guest-"
+
+var (
+	guestAdjectives = []string{"brave", "calm", "clever", "eager", "fuzzy", "gentle", "happy", "jolly", "lucky", "mighty", "nimble", "proud", "quick", "quiet", "shy", "sly", "swift", "witty"}
+	guestAnimals    = []string{"badger", "bear", "crow", "deer", "eagle", "ferret", "fox", "hare", "heron", "lynx", "moose", "otter", "owl", "panda", "raven", "seal", "wolf", "yak"}
+)
+
+type action int
+
+const (
+	actionTrade action = iota
+	actionGlobalChat
+	actionCreateRoom
+)
+
+var guestRestricted = map[action]bool{
+	actionTrade:      true,
+	actionGlobalChat: true,
+	actionCreateRoom: true,
+}
+
+func (c *Client) IsGuest() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.guest
+}
+
+// Can reports whether the client may perform the action. Guests are kept
+// away from anything that affects other players beyond the current session.
+func (c *Client) Can(a action) bool {
+	return !c.IsGuest() || !guestRestricted[a]
+}
+
+func randomGuestName() string {
+	return fmt.Sprintf("%s%s-%s-%d", guestPrefix,
+		guestAdjectives[rand.Intn(len(guestAdjectives))],
+		guestAnimals[rand.Intn(len(guestAnimals))],
+		rand.Intn(90)+10)
+}
+
+// claimName gives the client name and profile, unless another client
+// already goes by it. s.mu is held from the check to the claim, so two
+// clients can never both take a name.
+func (s *Server) claimName(client *Client, name string, profile *Profile) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, c := range s.clients {
+		if c != client && strings.EqualFold(c.Name(), name) {
+			return false
+		}
+	}
+	client.mu.Lock()
+	client.name = name
+	client.profile = profile
+	client.mu.Unlock()
+	return true
+}
+
+// joinAsGuest gives the client a generated name and a throwaway profile that
+// is never written to the profile store.
+func (s *Server) joinAsGuest(client *Client) {
+	if client.loggedIn() {
+		return
+	}
+	// Guests have no account to put on a whitelist.
+	if s.whitelist != nil && s.whitelist.Enabled() {
+		log.Printf("Refused %s: guests cannot join while the whitelist is on", client.id)
+		client.Kick(whitelistRejection)
+		return
+	}
+
+	client.mu.Lock()
+	client.guest = true
+	client.mu.Unlock()
+	name := randomGuestName()
+	for !s.claimName(client, name, NewProfile(name)) {
+		name = randomGuestName()
+	}
+
+	client.Send(protocol.Line(protocol.KindLogin, name))
+	s.announce(protocol.FeedEvent{Kind: protocol.FeedJoined, Player: name})
+}
@@ -0,0 +1,75 @@
+package gameserver
+
+import (
+	"log"
+	"net/http"
+	"time"
+)
+
+// tickStallTimeout is how long a room may go without completing a tick
+// before the server is reported unhealthy.
+const tickStallTimeout = 5 * time.Second
+
+type healthStatus struct {
+	OK           bool     `json:"ok"`
+	Players      int      `json:"players"`
+	Listeners    int      `json:"listeners"`
+	StalledRooms []string `json:"stalledRooms,omitempty"`
+	Reason       string   `json:"reason,omitempty"`
+}
+
+// ServeHealth serves probes for orchestrators such as Docker or Kubernetes.
+// /healthz is liveness: every room's tick loop is still stepping. /readyz
+// is readiness: the server has started, is live and is accepting players
+// on at least one listener. Both answer 503 when the check fails.
+func (s *Server) ServeHealth(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", s.handleHealthz)
+	mux.HandleFunc("GET /readyz", s.handleReadyz)
+
+	log.Println("Health checks listening on", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Println("Error serving health checks:", err)
+	}
+}
+
+func (s *Server) health() healthStatus {
+	status := healthStatus{
+		OK:        true,
+		Players:   len(s.snapshotClients()),
+		Listeners: int(s.listening.Load()),
+	}
+	for _, room := range s.snapshotRooms() {
+		if time.Since(room.tickLoop.LastTick()) > tickStallTimeout {
+			status.StalledRooms = append(status.StalledRooms, room.name)
+		}
+	}
+	if len(status.StalledRooms) > 0 {
+		status.OK, status.Reason = false, "tick loop stalled"
+	}
+	return status
+}
+
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, s.health())
+}
+
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	status := s.health()
+	switch {
+	case !status.OK:
+	case !s.ready.Load():
+		status.OK, status.Reason = false, "starting"
+	case status.Listeners == 0:
+		status.OK, status.Reason = false, "not listening"
+	}
+	writeHealth(w, status)
+}
+
+func writeHealth(w http.ResponseWriter, status healthStatus) {
+	code := http.StatusOK
+	if !status.OK {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, status)
+}
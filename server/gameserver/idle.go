@@ -0,0 +1,65 @@
+package gameserver
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+const (
+	idleCheckInterval = 10 * time.Second
+	// idleWarning is how long before an idle kick the player is warned.
+	idleWarning = time.Minute
+)
+
+// markActive records input from the player, clearing any idle mark.
+func (c *Client) markActive() {
+	c.lastActive.Store(time.Now().UnixNano())
+	c.idle.Store(false)
+	c.idleWarned.Store(false)
+}
+
+func (c *Client) LastActive() time.Time {
+	return time.Unix(0, c.lastActive.Load())
+}
+
+// reportChanged reports whether a state report differs from the last one in
+// anything the player controls. Clients resend unchanged state as a
+// heartbeat, which must not count as activity. Only the reader goroutine
+// calls it.
+func (c *Client) reportChanged(state protocol.PlayerState) bool {
+	last := c.lastReport
+	c.lastReport = state
+	return state.X != last.X || state.Y != last.Y || state.Direction != last.Direction || state.Anim != last.Anim
+}
+
+// checkIdleEvery marks players idle after idleAfter without input, and
+// kicks them after idleKick, warning them idleWarning ahead. A zero duration
+// turns that step off.
+func (s *Server) checkIdleEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, c := range s.snapshotClients() {
+			idle := time.Since(c.LastActive())
+			if s.idleAfter > 0 && idle >= s.idleAfter {
+				c.idle.Store(true)
+			}
+			if s.idleKick <= 0 {
+				continue
+			}
+			switch {
+			case idle >= s.idleKick:
+				log.Printf("Kicking %s after %v idle", c.Name(), idle.Round(time.Second))
+				s.kick(c, "idle for too long")
+			case idle >= s.idleKick-idleWarning && !c.idleWarned.Swap(true):
+				text := fmt.Sprintf("You will be disconnected for inactivity in %v", (s.idleKick - idle).Round(time.Second))
+				chat := protocol.ChatMessage{Channel: protocol.ChannelZone, From: "server", Text: text}
+				c.Send(protocol.Line(protocol.KindChat, protocol.EncodeChat(chat)))
+			}
+		}
+	}
+}
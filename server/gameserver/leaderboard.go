@@ -0,0 +1,134 @@
+package gameserver
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+const (
+	killScore = 10
+	// attackRange is how close another player must be for an attack to land,
+	// and attackDamage is the health it takes. A player can start an
+	// attack once per attackCooldown, the length of the attack animation.
+	attackRange    = 40.0
+	attackDamage   = 34
+	attackCooldown = 350 * time.Millisecond
+)
+
+// readyToAttack reports whether the player's attack cooldown is over, and
+// starts the next one if it is. Clients decide when they attack, so
+// without it flipping the animation on every state update would hit each
+// time.
+func (r *Room) readyToAttack(c *Client) bool {
+	now := r.clock()
+	if now.Before(r.attackReady[c]) {
+		return false
+	}
+	r.attackReady[c] = now.Add(attackCooldown)
+	return true
+}
+
+// resolveAttack runs when a player starts an attack and hits the nearest
+// other player in range, if any, crediting a kill when that empties their
+// health. Players in safe areas can neither attack nor be hit, and neither
+// can the dead or those who just respawned.
+func (r *Room) resolveAttack(attacker *Client, state protocol.PlayerState) {
+	if !r.pvpAt(state.X, state.Y) {
+		return
+	}
+	var victim *Client
+	best := attackRange
+	r.grid.Near(state.X, state.Y, attackRange, func(c *Client, other *protocol.PlayerState) {
+		if c == attacker || r.levels[c] != r.levels[attacker] || !r.pvpAt(other.X, other.Y) || !r.vulnerable(c) || !r.lineOfSight(state.X, state.Y, other.X, other.Y) {
+			return
+		}
+		if d := math.Hypot(other.X-state.X, other.Y-state.Y); d <= best {
+			victim, best = c, d
+		}
+	})
+	if victim == nil {
+		return
+	}
+	if victim.health.Add(-attackDamage) > 0 {
+		attacker.Send(protocol.Line(protocol.KindHit, victim.Name()))
+		r.knockOff(victim)
+		r.knockBack(victim, state.X, state.Y)
+		return
+	}
+	r.recordKill(attacker, victim)
+}
+
+func (r *Room) recordKill(killer, victim *Client) {
+	killer.updateProfile(func(p *Profile) {
+		p.Stats.Kills++
+		p.Stats.Score += killScore
+	})
+	r.awardKillXP(killer)
+	victim.updateProfile(func(p *Profile) {
+		p.Stats.Deaths++
+	})
+
+	r.events.Write(Event{Type: eventDeath, Player: victim.Name(), Room: r.name, Other: killer.Name()})
+	killer.Send(protocol.Line(protocol.KindHit, victim.Name()))
+	r.announce(protocol.FeedEvent{Kind: protocol.FeedDefeated, Player: victim.Name(), Other: killer.Name()})
+	r.kill(victim, killer, killer.Name())
+	r.scoreMatchKill(killer, victim)
+}
+
+// leaderboard ranks the top n characters by stat. Stored profiles can lag
+// behind by up to a save interval, so online players' live stats replace
+// their stored ones before ranking.
+func (s *Server) leaderboard(stat string, n int) ([]protocol.LeaderboardEntry, error) {
+	value, ok := LeaderboardStats[stat]
+	if !ok {
+		return nil, fmt.Errorf("unknown stat %q", stat)
+	}
+	stored, err := s.profiles.Top(stat, n)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make(map[string]Stats, len(stored))
+	for _, p := range stored {
+		stats[p.Name] = p.Stats
+	}
+	for _, c := range s.snapshotClients() {
+		if p := c.profileSnapshot(); p != nil {
+			stats[p.Name] = p.Stats
+		}
+	}
+
+	entries := make([]protocol.LeaderboardEntry, 0, len(stats))
+	for name, st := range stats {
+		entries = append(entries, protocol.LeaderboardEntry{Name: name, Value: value(st)})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Value != entries[j].Value {
+			return entries[i].Value > entries[j].Value
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	entries = entries[:min(n, len(entries))]
+	for i := range entries {
+		entries[i].Rank = i + 1
+	}
+	return entries, nil
+}
+
+// sendLeaderboard answers a client's leaderboard request. An empty payload
+// asks for the default ranking.
+func (s *Server) sendLeaderboard(client *Client, stat string) error {
+	if stat == "" {
+		stat = defaultLeaderboardStat
+	}
+	entries, err := s.leaderboard(stat, defaultLeaderboardSize)
+	if err != nil {
+		return err
+	}
+	client.Send(protocol.Line(protocol.KindLeaderboard, protocol.EncodeLeaderboard(stat, entries)))
+	return nil
+}
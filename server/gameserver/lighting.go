@@ -0,0 +1,49 @@
+package gameserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+// LightBook holds the ambient light levels loaded from a lighting file, a
+// JSON object mapping room names to their levels by day and by night, such
+// as {"caves": {"day": 0.2, "night": 0.1}}. Rooms it does not list, and
+// every room when the LightBook is nil, get protocol.DefaultAmbient.
+type LightBook struct {
+	byRoom map[string]protocol.Ambient
+}
+
+func LoadLightBook(path string) (*LightBook, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var levels map[string]struct {
+		Day   float64 `json:"day"`
+		Night float64 `json:"night"`
+	}
+	if err := json.Unmarshal(data, &levels); err != nil {
+		return nil, fmt.Errorf("parsing lighting %s: %w", path, err)
+	}
+	b := &LightBook{byRoom: make(map[string]protocol.Ambient, len(levels))}
+	for room, l := range levels {
+		if l.Day < 0 || l.Day > 1 || l.Night < 0 || l.Night > 1 {
+			return nil, fmt.Errorf("lighting %s: %s needs levels between 0 and 1", path, room)
+		}
+		b.byRoom[room] = protocol.Ambient{Day: l.Day, Night: l.Night}
+	}
+	return b, nil
+}
+
+func (b *LightBook) ambient(room string) protocol.Ambient {
+	if b == nil {
+		return protocol.DefaultAmbient
+	}
+	if a, ok := b.byRoom[room]; ok {
+		return a
+	}
+	return protocol.DefaultAmbient
+}
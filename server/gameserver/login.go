@@ -0,0 +1,113 @@
+package gameserver
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+const (
+	minNameLength = 3
+	maxNameLength = 16
+)
+
+func validName(name string) bool {
+	if len(name) < minNameLength || len(name) > maxNameLength {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// login signs the client in to an account and sends its character list.
+// The player enters the world once they select one of the characters, and
+// cannot list, select or delete any before giving the account's password.
+func (s *Server) login(client *Client, payload string) error {
+	account, password := protocol.DecodeLogin(payload)
+	if !validName(account) || strings.HasPrefix(strings.ToLower(account), strings.ToLower(guestPrefix)) {
+		return fmt.Errorf("invalid name %q", account)
+	}
+	if client.loggedIn() {
+		return errors.New("already logged in")
+	}
+	if s.whitelist != nil && !s.whitelist.Allows(account) {
+		log.Printf("Refused %s: %s is not on the whitelist", client.id, account)
+		client.Kick(whitelistRejection)
+		return nil
+	}
+	if err := s.authenticate(account, password); err != nil {
+		if !errors.Is(err, errWrongPassword) {
+			return err
+		}
+		client.loginFailures++
+		if client.loginFailures >= maxLoginAttempts {
+			log.Printf("Disconnecting %s after %d wrong passwords for %s", client.id, client.loginFailures, account)
+			client.Kick("Too many wrong passwords.")
+			return nil
+		}
+		return err
+	}
+
+	client.mu.Lock()
+	client.account = account
+	client.mu.Unlock()
+
+	client.Send(protocol.Line(protocol.KindLogin, account))
+	return s.sendCharacters(client)
+}
+
+// recordSession adds the client's session summary to its profile. The
+// client's word is only taken up to what the server saw for itself: no
+// more seconds than it has been connected, no farther than it walked and
+// no more chat lines than it sent, less whatever earlier summaries from
+// the connection already claimed.
+func (s *Server) recordSession(client *Client, payload string) {
+	seconds, distance, chats, err := protocol.DecodeSession(payload)
+	if err != nil {
+		log.Printf("Bad session summary from %s: %v", client.id, err)
+		return
+	}
+	seen := client.reported
+	seconds = min(seconds, int64(time.Since(client.connected).Seconds())-seen.PlaySeconds)
+	distance = min(distance, float64(client.walked.Load())/100-seen.Distance)
+	chats = min(chats, client.chatLines-seen.ChatsSent)
+	seconds, distance, chats = max(seconds, 0), max(distance, 0), max(chats, 0)
+	client.reported.PlaySeconds += seconds
+	client.reported.Distance += distance
+	client.reported.ChatsSent += chats
+
+	client.updateProfile(func(p *Profile) {
+		p.Stats.PlaySeconds += seconds
+		p.Stats.Distance += distance
+		p.Stats.ChatsSent += chats
+	})
+}
+
+func (s *Server) saveProfile(client *Client) {
+	profile := client.profileSnapshot()
+	if profile == nil {
+		return
+	}
+	if err := s.profiles.Save(profile); err != nil {
+		log.Printf("Error saving profile %s: %v", profile.Name, err)
+	}
+}
+
+func (s *Server) saveProfilesEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, client := range s.snapshotClients() {
+			s.saveProfile(client)
+		}
+	}
+}
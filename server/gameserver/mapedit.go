@@ -0,0 +1,297 @@
+package gameserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+// mapEditRate is how many cells a second an editor may change, after
+// painting mapEditBurst of them in one go.
+const (
+	mapEditRate  = 30
+	mapEditBurst = 60
+)
+
+// mapKeyOrder matches the order the client's map editor writes map files
+// in, so saving from either side produces the same file.
+var mapKeyOrder = []string{"width", "parallax", "layers", "animations", "collision"}
+
+// MapDocument is the authoritative copy of a map that connected editors
+// change together. Edits are applied in arrival order and relayed to every
+// editor, which makes the last write to a cell the one that sticks.
+type MapDocument struct {
+	path string
+
+	mu      sync.Mutex
+	fields  map[string]json.RawMessage
+	data    protocol.MapData
+	editors map[*Client]*protocol.MapCursor
+}
+
+func LoadMapDocument(path string) (*MapDocument, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	d := &MapDocument{path: path, editors: make(map[*Client]*protocol.MapCursor)}
+	if err := json.Unmarshal(raw, &d.fields); err != nil {
+		return nil, fmt.Errorf("parsing map %s: %w", path, err)
+	}
+	if err := json.Unmarshal(raw, &d.data); err != nil {
+		return nil, fmt.Errorf("parsing map %s: %w", path, err)
+	}
+	if d.data.Width <= 0 {
+		return nil, fmt.Errorf("map %s: width must be positive", path)
+	}
+	return d, nil
+}
+
+func (d *MapDocument) cells() int {
+	cells := len(d.data.Collision)
+	for _, layer := range d.data.Layers {
+		cells = max(cells, len(layer))
+	}
+	return cells
+}
+
+// join sends the editor the document and the other editors' cursors.
+func (d *MapDocument) join(c *Client) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	payload, err := protocol.EncodeMapData(d.data)
+	if err != nil {
+		return err
+	}
+	c.Send(protocol.Line(protocol.KindMapData, payload))
+	for _, cursor := range d.editors {
+		if cursor != nil {
+			c.Send(protocol.Line(protocol.KindMapCursor, protocol.EncodeMapCursor(*cursor)))
+		}
+	}
+	d.editors[c] = nil
+	return nil
+}
+
+func (d *MapDocument) leave(c *Client) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.editors[c]; !ok {
+		return
+	}
+	delete(d.editors, c)
+	d.broadcast(protocol.Line(protocol.KindMapLeave, c.id))
+}
+
+func (d *MapDocument) joined(c *Client) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	_, ok := d.editors[c]
+	return ok
+}
+
+// apply sets one cell and relays the edit to every editor.
+func (d *MapDocument) apply(c *Client, e protocol.MapEdit) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if e.Index < 0 || e.Index >= d.cells() {
+		return fmt.Errorf("map edit: cell %d is outside the map", e.Index)
+	}
+	switch {
+	case e.Layer == protocol.MapCollisionLayer:
+		for len(d.data.Collision) <= e.Index {
+			d.data.Collision = append(d.data.Collision, 0)
+		}
+		d.data.Collision[e.Index] = min(max(e.Value, 0), 1)
+	case e.Layer >= 0 && e.Layer <= len(d.data.Layers):
+		if e.Layer == len(d.data.Layers) {
+			d.data.Layers = append(d.data.Layers, slices.Repeat([]int{-1}, d.cells()))
+		}
+		layer := d.data.Layers[e.Layer]
+		for len(layer) <= e.Index {
+			layer = append(layer, -1)
+		}
+		layer[e.Index] = max(e.Value, -1)
+		d.data.Layers[e.Layer] = layer
+	default:
+		return fmt.Errorf("map edit: no layer %d", e.Layer)
+	}
+	e.Author = c.id
+	d.broadcast(protocol.Line(protocol.KindMapEdit, protocol.EncodeMapEdit(e)))
+	return nil
+}
+
+// reject sends the editor the cell's value in place of an edit the server
+// dropped, so their copy goes back to matching the document.
+func (d *MapDocument) reject(c *Client, e protocol.MapEdit) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if e.Index < 0 || e.Index >= d.cells() {
+		return
+	}
+	switch {
+	case e.Layer == protocol.MapCollisionLayer:
+		e.Value = 0
+		if e.Index < len(d.data.Collision) {
+			e.Value = d.data.Collision[e.Index]
+		}
+	case e.Layer >= 0 && e.Layer < len(d.data.Layers):
+		e.Value = -1
+		if layer := d.data.Layers[e.Layer]; e.Index < len(layer) {
+			e.Value = layer[e.Index]
+		}
+	default:
+		return
+	}
+	c.Send(protocol.Line(protocol.KindMapEdit, protocol.EncodeMapEdit(e)))
+}
+
+// moveCursor records where the editor's cursor is and shows it to the others.
+func (d *MapDocument) moveCursor(c *Client, cursor protocol.MapCursor) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	cursor.ID = c.id
+	d.editors[c] = &cursor
+	line := protocol.Line(protocol.KindMapCursor, protocol.EncodeMapCursor(cursor))
+	for editor := range d.editors {
+		if editor != c {
+			editor.Send(line)
+		}
+	}
+}
+
+// broadcast sends a line to every editor; callers hold d.mu.
+func (d *MapDocument) broadcast(line string) {
+	for editor := range d.editors {
+		editor.Send(line)
+	}
+}
+
+// Save writes the document back to its map file, keeping the fields editors
+// cannot change, such as parallax layers and spawn points, as they were.
+func (d *MapDocument) Save() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var layers bytes.Buffer
+	layers.WriteString("[")
+	for i, layer := range d.data.Layers {
+		row, err := json.Marshal(layer)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			layers.WriteString(",")
+		}
+		layers.WriteString("\n    ")
+		layers.Write(row)
+	}
+	layers.WriteString("\n  ]")
+	d.fields["layers"] = layers.Bytes()
+	for key, value := range map[string]any{"width": d.data.Width, "collision": d.data.Collision} {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		d.fields[key] = data
+	}
+
+	keys := slices.Clone(mapKeyOrder)
+	for _, key := range slices.Sorted(maps.Keys(d.fields)) {
+		if !slices.Contains(mapKeyOrder, key) {
+			keys = append(keys, key)
+		}
+	}
+	var out bytes.Buffer
+	out.WriteString("{")
+	for _, key := range keys {
+		value, ok := d.fields[key]
+		if !ok {
+			continue
+		}
+		if key != "layers" {
+			var compact bytes.Buffer
+			if err := json.Compact(&compact, value); err != nil {
+				return err
+			}
+			value = compact.Bytes()
+		}
+		if out.Len() > 1 {
+			out.WriteString(",")
+		}
+		fmt.Fprintf(&out, "\n  %q: %s", key, value)
+	}
+	out.WriteString("\n}\n")
+	return os.WriteFile(d.path, out.Bytes(), 0o644)
+}
+
+// handleMapMessage serves live map editing. Only accounts on the map
+// editors list may join, edit and save the document, and each editor's
+// edits are rate-limited. The list is checked on every message, so taking
+// an account off it stops them straight away.
+func (s *Server) handleMapMessage(client *Client, kind, payload string) {
+	err := s.mapMessage(client, kind, payload)
+	if err != nil {
+		log.Printf("Map edit request from %s failed: %v", client.id, err)
+		client.Send(protocol.Line(protocol.KindError, err.Error()))
+	}
+}
+
+func (s *Server) mapMessage(client *Client, kind, payload string) error {
+	if s.mapDoc == nil {
+		return errors.New("live map editing is not enabled on this server")
+	}
+	if client.Account() == "" {
+		return errors.New("log in to an account to edit the map")
+	}
+	if s.mapEditors == nil || !s.mapEditors.Allows(client.Account()) {
+		return errors.New("your account is not a map editor on this server")
+	}
+	if kind == protocol.KindMapJoin {
+		return s.mapDoc.join(client)
+	}
+	if !s.mapDoc.joined(client) {
+		return errors.New("join the map before editing it")
+	}
+
+	switch kind {
+	case protocol.KindMapEdit:
+		edit, err := protocol.DecodeMapEdit(payload)
+		if err != nil {
+			return err
+		}
+		if !client.mapEditAllowance.spend(mapEditRate, mapEditBurst) {
+			s.mapDoc.reject(client, edit)
+			client.Send(protocol.Line(protocol.KindError, "editing too fast; slow down"))
+			return nil
+		}
+		return s.mapDoc.apply(client, edit)
+	case protocol.KindMapCursor:
+		cursor, err := protocol.DecodeMapCursor(payload)
+		if err != nil {
+			return err
+		}
+		s.mapDoc.moveCursor(client, cursor)
+	case protocol.KindMapSave:
+		if err := s.mapDoc.Save(); err != nil {
+			return fmt.Errorf("saving map: %w", err)
+		}
+		log.Printf("%s saved map %s", client.Name(), s.mapDoc.path)
+		client.Send(protocol.Line(protocol.KindMapSave, s.mapDoc.path))
+	}
+	return nil
+}
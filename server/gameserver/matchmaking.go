@@ -0,0 +1,260 @@
+package gameserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+const (
+	// matchInterval is how often the matcher looks for matches.
+	matchInterval = time.Second
+	// Queued players are bucketed by rating, ratingBucket points to a
+	// bucket. A player is first matched within their own bucket, and every
+	// bucketWiden they wait the search reaches one bucket further each way.
+	ratingBucket = 100
+	bucketWiden  = 10 * time.Second
+	// matchCountdown is how long matched players have to get ready before
+	// they are moved into the match, and back out once it is over.
+	matchCountdown = 5 * time.Second
+	// These are a mode's kills to win a round, rounds, round length and
+	// warmup when it does not say.
+	defaultMatchKills   = 5
+	defaultMatchRounds  = 1
+	defaultRoundSeconds = 180
+	defaultWarmup       = 10
+)
+
+// Mode is a kind of match players can queue for, played Size to a room.
+// Once everyone has had Warmup seconds to arrive, the match plays Rounds
+// rounds of up to Seconds each, a round won by the first to Kills kills,
+// or the most kills when time runs out. Whoever wins most of the rounds
+// wins the match.
+type Mode struct {
+	Size    int     `json:"size"`
+	Kills   int     `json:"kills,omitempty"`
+	Rounds  int     `json:"rounds,omitempty"`
+	Seconds float64 `json:"seconds,omitempty"`
+	Warmup  float64 `json:"warmup,omitempty"`
+}
+
+// ModeBook holds the modes loaded from a mode file, a JSON object mapping
+// mode names such as "duel" to their modes. A nil ModeBook has none, and
+// nobody can queue.
+type ModeBook struct {
+	byName map[string]*Mode
+}
+
+func LoadModeBook(path string) (*ModeBook, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b := &ModeBook{}
+	if err := json.Unmarshal(data, &b.byName); err != nil {
+		return nil, fmt.Errorf("parsing modes %s: %w", path, err)
+	}
+	for name, m := range b.byName {
+		if m.Size < 2 {
+			return nil, fmt.Errorf("modes %s: %s needs a size of at least 2", path, name)
+		}
+		if m.Kills <= 0 {
+			m.Kills = defaultMatchKills
+		}
+		if m.Rounds <= 0 {
+			m.Rounds = defaultMatchRounds
+		}
+		if m.Seconds <= 0 {
+			m.Seconds = defaultRoundSeconds
+		}
+		if m.Warmup <= 0 {
+			m.Warmup = defaultWarmup
+		}
+	}
+	return b, nil
+}
+
+func (b *ModeBook) mode(name string) *Mode {
+	if b == nil {
+		return nil
+	}
+	return b.byName[name]
+}
+
+// queuedPlayer is a player waiting in the queue for a mode.
+type queuedPlayer struct {
+	client *Client
+	mode   string
+	bucket int
+	since  time.Time
+}
+
+// reach is how many buckets either side of their own the player may be
+// matched across by now.
+func (q *queuedPlayer) reach(now time.Time) int {
+	return int(now.Sub(q.since) / bucketWiden)
+}
+
+func (s *Server) handleMatchQueue(client *Client, mode string) {
+	if mode == "" {
+		s.leaveMatchQueue(client)
+		return
+	}
+	if err := s.joinMatchQueue(client, mode); err != nil {
+		client.Send(protocol.Line(protocol.KindError, err.Error()))
+	}
+}
+
+func (s *Server) joinMatchQueue(client *Client, mode string) error {
+	if s.modes.mode(mode) == nil {
+		return fmt.Errorf("no match mode %q", mode)
+	}
+	var stats Stats
+	playing := false
+	client.updateProfile(func(p *Profile) { stats, playing = p.Stats, true })
+	if !playing {
+		return errors.New("choose a character before queueing")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if q := s.matchQueue[client]; q != nil {
+		return fmt.Errorf("already queued for %s", q.mode)
+	}
+	s.matchQueue[client] = &queuedPlayer{client: client, mode: mode, bucket: stats.Rating / ratingBucket, since: time.Now()}
+	client.Send(protocol.Line(protocol.KindMatch, protocol.EncodeMatchStatus(protocol.MatchStatus{Mode: mode, State: protocol.MatchQueued, Waiting: s.queuedFor(mode)})))
+	return nil
+}
+
+// queuedFor counts the players queued for mode. s.mu must be held.
+func (s *Server) queuedFor(mode string) int {
+	n := 0
+	for _, q := range s.matchQueue {
+		if q.mode == mode {
+			n++
+		}
+	}
+	return n
+}
+
+// leaveMatchQueue takes the player out of the queue they are in, if any.
+func (s *Server) leaveMatchQueue(client *Client) {
+	s.mu.Lock()
+	q := s.matchQueue[client]
+	delete(s.matchQueue, client)
+	s.mu.Unlock()
+
+	if q != nil {
+		client.Send(protocol.Line(protocol.KindMatch, protocol.EncodeMatchStatus(protocol.MatchStatus{Mode: q.mode, State: protocol.MatchLeft})))
+	}
+}
+
+func (s *Server) matchEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		s.matchPlayers(now)
+	}
+}
+
+// match is a group the matcher has taken out of the queue.
+type match struct {
+	mode    string
+	room    string
+	players []*queuedPlayer
+}
+
+// matchPlayers groups queued players into matches, longest waiting first,
+// each with the next players in line within their reach, and tells
+// everyone still waiting how many are queued with them.
+func (s *Server) matchPlayers(now time.Time) {
+	s.mu.Lock()
+	byMode := make(map[string][]*queuedPlayer)
+	for _, q := range s.matchQueue {
+		byMode[q.mode] = append(byMode[q.mode], q)
+	}
+	var matches []match
+	for mode, queued := range byMode {
+		size := s.modes.mode(mode).Size
+		sort.Slice(queued, func(i, j int) bool { return queued[i].since.Before(queued[j].since) })
+		for _, first := range queued {
+			if s.matchQueue[first.client] == nil {
+				continue
+			}
+			group := []*queuedPlayer{first}
+			for _, other := range queued {
+				if len(group) == size {
+					break
+				}
+				if other == first || s.matchQueue[other.client] == nil {
+					continue
+				}
+				if abs(other.bucket-first.bucket) <= max(first.reach(now), other.reach(now)) {
+					group = append(group, other)
+				}
+			}
+			if len(group) < size {
+				continue
+			}
+			for _, q := range group {
+				delete(s.matchQueue, q.client)
+			}
+			s.nextMatch++
+			matches = append(matches, match{mode: mode, room: fmt.Sprintf("%s-%d", mode, s.nextMatch), players: group})
+		}
+	}
+	waiting := make(map[*Client]protocol.MatchStatus, len(s.matchQueue))
+	for c, q := range s.matchQueue {
+		waiting[c] = protocol.MatchStatus{Mode: q.mode, State: protocol.MatchQueued, Waiting: s.queuedFor(q.mode)}
+	}
+	s.mu.Unlock()
+
+	for _, m := range matches {
+		s.startMatch(m)
+	}
+	for c, status := range waiting {
+		c.Send(protocol.Line(protocol.KindMatch, protocol.EncodeMatchStatus(status)))
+	}
+}
+
+// startMatch tells the players who they are matched with, readies the match
+// room and moves them into it once the countdown is up.
+func (s *Server) startMatch(m match) {
+	names := make([]string, len(m.players))
+	for i, q := range m.players {
+		names[i] = q.client.Name()
+	}
+	status := protocol.MatchStatus{Mode: m.mode, State: protocol.MatchFound, Room: m.room, Players: names, Seconds: matchCountdown.Seconds()}
+	line := protocol.Line(protocol.KindMatch, protocol.EncodeMatchStatus(status))
+	for _, q := range m.players {
+		q.client.Send(line)
+	}
+	log.Printf("Matched %v into %s", names, m.room)
+	if s.hostsRoom(m.room) {
+		players := make([]*Client, len(m.players))
+		for i, q := range m.players {
+			players[i] = q.client
+		}
+		s.room(m.room).Send(roomMessage{kind: roomMatch, match: newMatchState(m.mode, s.modes.mode(m.mode), players)})
+	}
+	time.AfterFunc(matchCountdown, func() {
+		for _, q := range m.players {
+			q.client.RequestWarp(Warp{Room: m.room, Spawn: true})
+		}
+	})
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,63 @@
+package gameserver
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+func (s *Server) ServeMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", s.handleMetrics)
+
+	log.Println("Metrics listening on", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Println("Error serving metrics:", err)
+	}
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	clients := s.snapshotClients()
+	fmt.Fprintf(w, "multitest_players %d\n", len(clients))
+	fmt.Fprintf(w, "multitest_login_queue %d\n", s.QueueLength())
+	for _, r := range s.snapshotRooms() {
+		fmt.Fprintf(w, "multitest_room_players{room=%q} %d\n", r.name, r.PlayerCount())
+		fmt.Fprintf(w, "multitest_room_ticks_total{room=%q} %d\n", r.name, r.tickLoop.Ticks())
+		fmt.Fprintf(w, "multitest_room_tick_overruns_total{room=%q} %d\n", r.name, r.tickLoop.Overruns())
+		fmt.Fprintf(w, "multitest_room_tick_dropped_seconds_total{room=%q} %f\n", r.name, r.tickLoop.Dropped().Seconds())
+		fmt.Fprintf(w, "multitest_room_tick_step_seconds{room=%q} %f\n", r.name, r.LastStep().Seconds())
+	}
+	for _, c := range clients {
+		fmt.Fprintf(w, "multitest_client_bytes_received_total{client=%q} %d\n", c.id, c.conn.bytesIn.Load())
+		fmt.Fprintf(w, "multitest_client_bytes_sent_total{client=%q} %d\n", c.id, c.conn.bytesOut.Load())
+		fmt.Fprintf(w, "multitest_client_throttled_total{client=%q} %d\n", c.id, c.conn.throttled.Load())
+		fmt.Fprintf(w, "multitest_client_ack_latency_seconds{client=%q} %f\n", c.id, time.Duration(c.ackLatency.Load()).Seconds())
+		fmt.Fprintf(w, "multitest_client_snapshot_divisor{client=%q} %d\n", c.id, c.pacer.Divisor())
+	}
+}
+
+func (s *Server) roomName(c *Client) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if c.room == nil {
+		return ""
+	}
+	return c.room.name
+}
+
+func (s *Server) snapshotClients() []*Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	clients := make([]*Client, 0, len(s.clients))
+	for _, c := range s.clients {
+		clients = append(clients, c)
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].id < clients[j].id })
+	return clients
+}
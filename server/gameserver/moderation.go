@@ -0,0 +1,186 @@
+package gameserver
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+// chatBurst is how many lines a player can send at once before the chat
+// rate limit applies.
+const chatBurst = 5
+
+// ChatFilter screens chat before it is delivered. Filter returns the text
+// to send, which may be altered, or false to drop the line altogether.
+type ChatFilter interface {
+	Filter(text string) (string, bool)
+}
+
+// WordlistFilter masks listed words with asterisks. Words match whole and
+// regardless of case.
+type WordlistFilter struct {
+	words map[string]bool
+}
+
+func NewWordlistFilter(words []string) *WordlistFilter {
+	f := &WordlistFilter{words: make(map[string]bool, len(words))}
+	for _, w := range words {
+		if w = strings.ToLower(strings.TrimSpace(w)); w != "" {
+			f.words[w] = true
+		}
+	}
+	return f
+}
+
+// LoadWordlistFilter reads a wordlist with one word per line. Blank lines
+// and lines starting with # are skipped.
+func LoadWordlistFilter(path string) (*WordlistFilter, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			words = append(words, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading wordlist %s: %w", path, err)
+	}
+	return NewWordlistFilter(words), nil
+}
+
+func (f *WordlistFilter) Filter(text string) (string, bool) {
+	runes := []rune(text)
+	for start := 0; start < len(runes); {
+		if !isWordRune(runes[start]) {
+			start++
+			continue
+		}
+		end := start
+		for end < len(runes) && isWordRune(runes[end]) {
+			end++
+		}
+		if f.words[strings.ToLower(string(runes[start:end]))] {
+			for i := start; i < end; i++ {
+				runes[i] = '*'
+			}
+		}
+		start = end
+	}
+	return string(runes), true
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// allowance rate-limits something a client does: each time spends one, and
+// it refills at a rate per second up to a burst. It starts full.
+type allowance struct {
+	left    float64
+	checked time.Time
+}
+
+func (a *allowance) spend(rate, burst float64) bool {
+	now := time.Now()
+	if a.checked.IsZero() {
+		a.left = burst
+	} else {
+		a.left = min(burst, a.left+now.Sub(a.checked).Seconds()*rate)
+	}
+	a.checked = now
+	if a.left < 1 {
+		return false
+	}
+	a.left--
+	return true
+}
+
+// allowChat spends one line of the client's chat allowance, which refills at
+// rate lines per second up to chatBurst. A rate of zero never limits. Only
+// the reader goroutine calls it.
+func (c *Client) allowChat(rate float64) bool {
+	if rate <= 0 {
+		return true
+	}
+	return c.chatAllowance.spend(rate, chatBurst)
+}
+
+// mute keeps the named player from chatting for d. Mutes are kept by name,
+// so reconnecting does not lift them.
+func (s *Server) mute(name string, d time.Duration) {
+	s.mu.Lock()
+	s.mutes[strings.ToLower(name)] = time.Now().Add(d)
+	s.mu.Unlock()
+	s.events.Write(Event{Type: eventMute, Player: name, Text: d.String()})
+}
+
+func (s *Server) unmute(name string) bool {
+	s.mu.Lock()
+	_, ok := s.mutes[strings.ToLower(name)]
+	delete(s.mutes, strings.ToLower(name))
+	s.mu.Unlock()
+	if ok {
+		s.events.Write(Event{Type: eventUnmute, Player: name})
+	}
+	return ok
+}
+
+// mutedFor returns how much longer the named player stays muted, or zero.
+func (s *Server) mutedFor(name string) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := strings.ToLower(name)
+	left := time.Until(s.mutes[key])
+	if left <= 0 {
+		delete(s.mutes, key)
+		return 0
+	}
+	return left
+}
+
+// moderateChat applies mutes, the rate limit and the chat filter to a line
+// the client wants to send, returning the text to deliver or false after
+// telling the client why it was refused.
+func (s *Server) moderateChat(client *Client, text string) (string, bool) {
+	if !s.mayChat(client) {
+		return "", false
+	}
+	if s.chatFilter != nil {
+		filtered, ok := s.chatFilter.Filter(text)
+		if !ok {
+			client.Send(protocol.Line(protocol.KindError, "message blocked by the chat filter"))
+			return "", false
+		}
+		text = filtered
+	}
+	return text, true
+}
+
+// mayChat applies mutes and the rate limit to anything the client types,
+// chat or /command, telling the client why when it refuses.
+func (s *Server) mayChat(client *Client) bool {
+	reason := ""
+	if left := s.mutedFor(client.Name()); left > 0 {
+		reason = fmt.Sprintf("you are muted for %v", left.Round(time.Second))
+	} else if !client.allowChat(s.chatRate) {
+		reason = "you are sending messages too fast"
+	}
+	if reason != "" {
+		client.Send(protocol.Line(protocol.KindError, reason))
+		return false
+	}
+	return true
+}
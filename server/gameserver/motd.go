@@ -0,0 +1,36 @@
+package gameserver
+
+import (
+	"os"
+	"strings"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+// LoadMOTD reads a message of the day file: its first line is the title
+// and the rest the text.
+func LoadMOTD(path string) (protocol.MOTD, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return protocol.MOTD{}, err
+	}
+	title, text, _ := strings.Cut(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	return protocol.MOTD{Title: strings.TrimSpace(title), Text: strings.TrimSpace(text)}, nil
+}
+
+// ReloadMOTD rereads the message of the day file, so players connecting
+// from now on see the new one.
+func (s *Server) ReloadMOTD() (protocol.MOTD, error) {
+	motd, err := LoadMOTD(s.motdFile)
+	if err != nil {
+		return protocol.MOTD{}, err
+	}
+	s.motd.Store(&motd)
+	return motd, nil
+}
+
+func (s *Server) sendMOTD(c *Client) {
+	if motd := s.motd.Load(); motd != nil && (motd.Title != "" || motd.Text != "") {
+		c.Send(protocol.Line(protocol.KindMOTD, protocol.EncodeMOTD(*motd)))
+	}
+}
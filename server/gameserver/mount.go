@@ -0,0 +1,43 @@
+package gameserver
+
+import (
+	"fmt"
+	"time"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+// mountCooldown is how long a player knocked off their mount must wait
+// before riding again.
+const mountCooldown = 3 * time.Second
+
+// mount puts the player on the named mount, or gets them down when it is
+// empty. The dead, the pushed and those just knocked off cannot mount.
+func (r *Room) mount(c *Client, mount string) error {
+	if _, ok := r.players[c]; !ok {
+		return nil
+	}
+	if mount == "" {
+		delete(r.mounts, c)
+		return nil
+	}
+	if _, ok := protocol.Mounts[mount]; !ok {
+		return fmt.Errorf("unknown mount %q", mount)
+	}
+	if _, dead := r.dead[c]; dead {
+		return fmt.Errorf("cannot mount while defeated")
+	}
+	if r.paused() || r.pushes[c] != nil || r.clock().Before(r.mountReady[c]) {
+		return fmt.Errorf("cannot mount right now")
+	}
+	r.mounts[c] = mount
+	return nil
+}
+
+// knockOff throws a hit player off their mount, if they were riding.
+func (r *Room) knockOff(c *Client) {
+	if _, riding := r.mounts[c]; riding {
+		delete(r.mounts, c)
+		r.mountReady[c] = r.clock().Add(mountCooldown)
+	}
+}
@@ -0,0 +1,211 @@
+package gameserver
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+const (
+	maxPartySize = 4
+	// partyShareRadius is how close to the killer party members must be to
+	// share the experience for a kill.
+	partyShareRadius = 800.0
+	// partyUpdateInterval is how often members are sent the party list, so
+	// health shown for far-away members stays current.
+	partyUpdateInterval = 500 * time.Millisecond
+	killXP              = 100
+)
+
+// Party is a group of players who share experience and see each other's
+// health. Parties span rooms; membership is changed only by the server
+// under s.mu, while rooms read it through Members.
+type Party struct {
+	mu      sync.Mutex
+	members []*Client
+}
+
+func (p *Party) Members() []*Client {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return slices.Clone(p.members)
+}
+
+func (p *Party) list() []protocol.PartyMember {
+	members := p.Members()
+	list := make([]protocol.PartyMember, len(members))
+	for i, m := range members {
+		list[i] = protocol.PartyMember{Name: m.Name(), Health: int(m.health.Load())}
+	}
+	return list
+}
+
+// send tells every member who is in the party.
+func (p *Party) send() {
+	line := protocol.Line(protocol.KindParty, protocol.EncodeParty(p.list()))
+	for _, m := range p.Members() {
+		m.Send(line)
+	}
+}
+
+func (s *Server) handlePartyMessage(client *Client, kind, payload string) {
+	var err error
+	switch kind {
+	case protocol.KindPartyInvite:
+		err = s.inviteToParty(client, payload)
+	case protocol.KindPartyAccept:
+		err = s.acceptParty(client, payload)
+	case protocol.KindPartyLeave:
+		s.leaveParty(client)
+	}
+	if err != nil {
+		client.Send(protocol.Line(protocol.KindError, err.Error()))
+	}
+}
+
+func (s *Server) clientNamed(name string) *Client {
+	for _, c := range s.snapshotClients() {
+		if strings.EqualFold(c.Name(), name) {
+			return c
+		}
+	}
+	return nil
+}
+
+func (s *Server) inviteToParty(client *Client, name string) error {
+	target := s.clientNamed(strings.TrimSpace(name))
+	if target == nil {
+		return fmt.Errorf("no player %q", name)
+	}
+	if target == client {
+		return errors.New("you cannot invite yourself")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if target.party.Load() != nil {
+		return fmt.Errorf("%s is already in a party", target.Name())
+	}
+	if p := client.party.Load(); p != nil && len(p.Members()) >= maxPartySize {
+		return errors.New("your party is full")
+	}
+	s.partyInvites[target] = client
+	target.Send(protocol.Line(protocol.KindPartyInvite, client.Name()))
+	return nil
+}
+
+// acceptParty joins the party of the player who last invited the client,
+// starting one if the inviter has none. name, when given, must match the
+// inviter so a late invite is not accepted by accident.
+func (s *Server) acceptParty(client *Client, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inviter, ok := s.partyInvites[client]
+	if !ok || (name != "" && !strings.EqualFold(inviter.Name(), name)) {
+		return errors.New("no pending party invite")
+	}
+	delete(s.partyInvites, client)
+	if client.party.Load() != nil {
+		return errors.New("leave your party first")
+	}
+	if _, online := s.clients[inviter.conn]; !online {
+		return fmt.Errorf("%s has left", inviter.Name())
+	}
+
+	p := inviter.party.Load()
+	if p == nil {
+		p = &Party{members: []*Client{inviter}}
+		inviter.party.Store(p)
+	}
+	p.mu.Lock()
+	full := len(p.members) >= maxPartySize
+	if !full {
+		p.members = append(p.members, client)
+	}
+	p.mu.Unlock()
+	if full {
+		return errors.New("that party is full")
+	}
+	client.party.Store(p)
+	p.send()
+	return nil
+}
+
+// leaveParty takes the client out of its party, if any. A party left with
+// one member is disbanded.
+func (s *Server) leaveParty(client *Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.partyInvites, client)
+	for invitee, inviter := range s.partyInvites {
+		if inviter == client {
+			delete(s.partyInvites, invitee)
+		}
+	}
+	p := client.party.Swap(nil)
+	if p == nil {
+		return
+	}
+	client.Send(protocol.Line(protocol.KindParty, ""))
+
+	p.mu.Lock()
+	p.members = slices.DeleteFunc(p.members, func(c *Client) bool { return c == client })
+	var last *Client
+	if len(p.members) == 1 {
+		last = p.members[0]
+		p.members = nil
+	}
+	p.mu.Unlock()
+
+	if last != nil {
+		last.party.Store(nil)
+		last.Send(protocol.Line(protocol.KindParty, ""))
+		return
+	}
+	p.send()
+}
+
+// sendPartiesEvery refreshes every party's member list, health included.
+func (s *Server) sendPartiesEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		sent := make(map[*Party]bool)
+		for _, c := range s.snapshotClients() {
+			if p := c.party.Load(); p != nil && !sent[p] {
+				sent[p] = true
+				p.send()
+			}
+		}
+	}
+}
+
+// awardKillXP splits killXP between the killer and the party members in the
+// room within partyShareRadius of them, rounding each share up.
+func (r *Room) awardKillXP(killer *Client) {
+	sharers := []*Client{killer}
+	origin := r.players[killer]
+	if p := killer.party.Load(); p != nil && origin != nil {
+		for _, m := range p.Members() {
+			state := r.players[m]
+			if m != killer && state != nil && math.Hypot(state.X-origin.X, state.Y-origin.Y) <= partyShareRadius {
+				sharers = append(sharers, m)
+			}
+		}
+	}
+	share := (killXP + len(sharers) - 1) / len(sharers)
+	for _, m := range sharers {
+		m.updateProfile(func(p *Profile) { p.Stats.XP += share })
+	}
+}
@@ -0,0 +1,99 @@
+package gameserver
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+// maxPausePlayers is the most players a room can have and still be
+// paused; bigger rooms are not co-op sessions among friends.
+const maxPausePlayers = 4
+
+func (r *Room) votePause(c *Client, on bool, now time.Time) {
+	if !on {
+		delete(r.pauseVotes, c)
+		r.updatePause(now)
+		return
+	}
+	if err := r.canPause(); err != nil {
+		c.Send(protocol.Line(protocol.KindError, err.Error()))
+		return
+	}
+	r.pauseVotes[c] = true
+	r.updatePause(now)
+}
+
+func (r *Room) canPause() error {
+	if r.match != nil {
+		return errors.New("matches cannot be paused")
+	}
+	if len(r.players) > maxPausePlayers {
+		return fmt.Errorf("only rooms of up to %d players can be paused", maxPausePlayers)
+	}
+	return nil
+}
+
+func (r *Room) paused() bool {
+	return !r.pausedAt.IsZero()
+}
+
+// updatePause pauses the room once everyone in it has voted to and resumes
+// it once they have not, then tells the room how the vote stands.
+func (r *Room) updatePause(now time.Time) {
+	all := len(r.players) > 0 && len(r.pauseVotes) == len(r.players) && r.canPause() == nil
+	switch {
+	case all && !r.paused():
+		r.pausedAt = now
+	case !all && r.paused():
+		r.resume(now.Sub(r.pausedAt))
+		r.pausedAt = time.Time{}
+	}
+	status := protocol.PauseStatus{Paused: r.paused(), Players: len(r.players)}
+	for c := range r.pauseVotes {
+		status.Votes = append(status.Votes, c.Name())
+	}
+	slices.Sort(status.Votes)
+	for c := range r.players {
+		status.Voted = r.pauseVotes[c]
+		c.Send(protocol.Line(protocol.KindPaused, protocol.EncodePauseStatus(status)))
+	}
+}
+
+// resume pushes every timer in the room back by how long it was paused,
+// so nothing runs out, respawns or finishes for time that did not pass.
+func (r *Room) resume(d time.Duration) {
+	for _, job := range r.crafting {
+		job.done = job.done.Add(d)
+	}
+	for _, job := range r.gathering {
+		job.done = job.done.Add(d)
+	}
+	for id, node := range r.depleted {
+		node.respawn = node.respawn.Add(d)
+		r.depleted[id] = node
+	}
+	for _, effects := range r.effects {
+		for _, e := range effects {
+			e.expires, e.nextTick = e.expires.Add(d), e.nextTick.Add(d)
+		}
+	}
+	for _, move := range r.pushes {
+		move.start = move.start.Add(d)
+	}
+	for c, at := range r.dead {
+		r.dead[c] = at.Add(d)
+	}
+	for c, at := range r.dashReady {
+		r.dashReady[c] = at.Add(d)
+	}
+	for c, at := range r.attackReady {
+		r.attackReady[c] = at.Add(d)
+	}
+	for c, at := range r.mountReady {
+		r.mountReady[c] = at.Add(d)
+	}
+}
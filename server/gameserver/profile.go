@@ -0,0 +1,198 @@
+package gameserver
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"sort"
+	"sync"
+)
+
+var ErrNoProfile = errors.New("profile not found")
+
+type Stats struct {
+	Score       int
+	Kills       int
+	Deaths      int
+	PlaySeconds int64
+	Distance    float64
+	ChatsSent   int
+	XP          int
+	Gold        int
+	// Rating is the character's matchmaking rating, which starts at
+	// baseRating and moves with each match they finish.
+	Rating int
+}
+
+// Profile is one character. Characters belong to an account, which can hold
+// up to maxCharacters of them.
+type Profile struct {
+	Account    string
+	Name       string
+	Appearance string
+	Room       string
+	X, Y       float64
+	Stats      Stats
+	Inventory  map[string]int
+	// Quests maps each quest the character has taken to how many of its
+	// objectives are done.
+	Quests map[string]int
+}
+
+func NewProfile(name string) *Profile {
+	return &Profile{
+		Name:       name,
+		Appearance: "default",
+		Room:       defaultRoom,
+		X:          spawnX,
+		Y:          spawnY,
+		Stats:      Stats{Rating: baseRating},
+		Inventory:  make(map[string]int),
+		Quests:     make(map[string]int),
+	}
+}
+
+func (p *Profile) Clone() *Profile {
+	c := *p
+	c.Inventory = maps.Clone(p.Inventory)
+	if c.Inventory == nil {
+		c.Inventory = make(map[string]int)
+	}
+	c.Quests = maps.Clone(p.Quests)
+	if c.Quests == nil {
+		c.Quests = make(map[string]int)
+	}
+	return &c
+}
+
+// LeaderboardStats are the Stats fields profiles can be ranked by, keyed by
+// the name used in the API.
+var LeaderboardStats = map[string]func(Stats) float64{
+	"score":    func(s Stats) float64 { return float64(s.Score) },
+	"kills":    func(s Stats) float64 { return float64(s.Kills) },
+	"deaths":   func(s Stats) float64 { return float64(s.Deaths) },
+	"playtime": func(s Stats) float64 { return float64(s.PlaySeconds) },
+	"distance": func(s Stats) float64 { return s.Distance },
+	"chats":    func(s Stats) float64 { return float64(s.ChatsSent) },
+	"xp":       func(s Stats) float64 { return float64(s.XP) },
+	"gold":     func(s Stats) float64 { return float64(s.Gold) },
+	"rating":   func(s Stats) float64 { return float64(s.Rating) },
+}
+
+// ProfileStore persists player profiles. Load returns ErrNoProfile for names
+// that have never been saved; List returns an account's characters sorted
+// by name; Top returns the n best profiles for one of LeaderboardStats.
+// LoadAccount returns ErrNoAccount for accounts that were never created, and
+// CreateAccount ErrAccountExists for names that already were.
+type ProfileStore interface {
+	Load(name string) (*Profile, error)
+	List(account string) ([]*Profile, error)
+	Top(stat string, n int) ([]*Profile, error)
+	Save(p *Profile) error
+	Delete(name string) error
+	LoadAccount(name string) (*Account, error)
+	CreateAccount(a *Account) error
+	Close() error
+}
+
+// MemoryProfileStore keeps profiles for the lifetime of the process only. It
+// backs offline play and servers started without a database.
+type MemoryProfileStore struct {
+	mu       sync.Mutex
+	profiles map[string]*Profile
+	accounts map[string]Account
+}
+
+func NewMemoryProfileStore() *MemoryProfileStore {
+	return &MemoryProfileStore{profiles: make(map[string]*Profile), accounts: make(map[string]Account)}
+}
+
+func (m *MemoryProfileStore) Load(name string) (*Profile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, ok := m.profiles[name]
+	if !ok {
+		return nil, ErrNoProfile
+	}
+	return p.Clone(), nil
+}
+
+func (m *MemoryProfileStore) Save(p *Profile) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.profiles[p.Name] = p.Clone()
+	return nil
+}
+
+func (m *MemoryProfileStore) List(account string) ([]*Profile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var profiles []*Profile
+	for _, p := range m.profiles {
+		if p.Account == account {
+			profiles = append(profiles, p.Clone())
+		}
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	return profiles, nil
+}
+
+func (m *MemoryProfileStore) Top(stat string, n int) ([]*Profile, error) {
+	value, ok := LeaderboardStats[stat]
+	if !ok {
+		return nil, fmt.Errorf("unknown stat %q", stat)
+	}
+
+	m.mu.Lock()
+	profiles := make([]*Profile, 0, len(m.profiles))
+	for _, p := range m.profiles {
+		profiles = append(profiles, p.Clone())
+	}
+	m.mu.Unlock()
+
+	sort.Slice(profiles, func(i, j int) bool {
+		a, b := value(profiles[i].Stats), value(profiles[j].Stats)
+		if a != b {
+			return a > b
+		}
+		return profiles[i].Name < profiles[j].Name
+	})
+	return profiles[:min(n, len(profiles))], nil
+}
+
+func (m *MemoryProfileStore) Delete(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.profiles, name)
+	return nil
+}
+
+func (m *MemoryProfileStore) LoadAccount(name string) (*Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	a, ok := m.accounts[name]
+	if !ok {
+		return nil, ErrNoAccount
+	}
+	return &a, nil
+}
+
+func (m *MemoryProfileStore) CreateAccount(a *Account) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.accounts[a.Name]; ok {
+		return ErrAccountExists
+	}
+	m.accounts[a.Name] = *a
+	return nil
+}
+
+func (m *MemoryProfileStore) Close() error {
+	return nil
+}
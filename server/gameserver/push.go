@@ -0,0 +1,155 @@
+package gameserver
+
+import (
+	"math"
+	"time"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+const (
+	// A hit knocks the victim knockbackDistance away from the attacker over
+	// knockbackSeconds.
+	knockbackDistance = 48.0
+	knockbackSeconds  = 0.15
+	// A dash carries the player dashDistance over dashSeconds, at most once
+	// per dashCooldown.
+	dashDistance = 120.0
+	dashSeconds  = 0.2
+	dashCooldown = time.Second
+	// conveyorStep is how long each push a conveyor gives lasts; a player
+	// still on the conveyor when it ends is pushed again.
+	conveyorStep = 0.25
+	// pushStep is how finely a push's path is checked against solid tiles.
+	pushStep = 8.0
+)
+
+// Conveyor carries players standing inside its rectangle along at DX, DY
+// pixels per second.
+type Conveyor struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+	DX     float64 `json:"dx"`
+	DY     float64 `json:"dy"`
+}
+
+func (c Conveyor) contains(x, y float64) bool {
+	return x >= c.X && x < c.X+c.Width && y >= c.Y && y < c.Y+c.Height
+}
+
+// forcedMove is a push in progress, which the room plays out tick by tick
+// while ignoring the player's own reports.
+type forcedMove struct {
+	fromX, fromY float64
+	toX, toY     float64
+	start        time.Time
+	seconds      float64
+}
+
+// push moves the player by dx, dy over seconds, stopping short of the first
+// solid tile, closed door or the world's edge on the way.
+func (r *Room) push(c *Client, dx, dy, seconds float64) {
+	state := r.players[c]
+	if state == nil || r.riding[c] != "" {
+		return
+	}
+	toX, toY := r.pushTarget(state.X, state.Y, dx, dy, r.levels[c])
+	r.pushes[c] = &forcedMove{fromX: state.X, fromY: state.Y, toX: toX, toY: toY, start: r.clock(), seconds: seconds}
+	c.Send(protocol.Line(protocol.KindPush, protocol.EncodePush(protocol.Push{X: toX, Y: toY, Seconds: seconds})))
+}
+
+// pushTarget is where a push by dx, dy from x, y ends for a player at
+// level. Pushes never carry players up or down a level.
+func (r *Room) pushTarget(x, y, dx, dy float64, level int) (float64, float64) {
+	steps := int(math.Ceil(math.Hypot(dx, dy) / pushStep))
+	for i := 1; i <= steps; i++ {
+		nx, ny := x+dx/float64(steps), y+dy/float64(steps)
+		if r.world != nil {
+			nx, ny = r.world.Clamp(nx, ny)
+		}
+		from, to := r.elevationAt(x, y), r.elevationAt(nx, ny)
+		if r.blocked(nx, ny) || !protocol.CanEnter(from, to, level) || protocol.Climb(from, to, level) != level {
+			break
+		}
+		x, y = nx, ny
+	}
+	return x, y
+}
+
+// knockBack pushes the victim of a hit away from the attacker.
+func (r *Room) knockBack(victim *Client, fromX, fromY float64) {
+	state := r.players[victim]
+	if state == nil {
+		return
+	}
+	dx, dy := state.X-fromX, state.Y-fromY
+	d := math.Hypot(dx, dy)
+	if d == 0 {
+		return
+	}
+	r.push(victim, dx/d*knockbackDistance, dy/d*knockbackDistance, knockbackSeconds)
+}
+
+// dash pushes the player in the direction they asked for, if their last
+// dash has cooled down and nothing else is moving them.
+func (r *Room) dash(c *Client, dx, dy float64) {
+	d := math.Hypot(dx, dy)
+	now := r.clock()
+	if d == 0 || r.paused() || r.pushes[c] != nil || now.Before(r.dashReady[c]) {
+		return
+	}
+	r.dashReady[c] = now.Add(dashCooldown)
+	r.push(c, dx/d*dashDistance, dy/d*dashDistance, dashSeconds)
+}
+
+// movePushed advances every push along its path, and starts a new one for
+// each player standing on a conveyor.
+func (r *Room) movePushed(now time.Time) {
+	for _, c := range inOrder(r.pushes) {
+		move, state := r.pushes[c], r.players[c]
+		if move == nil {
+			continue
+		}
+		if state == nil {
+			delete(r.pushes, c)
+			continue
+		}
+		t := 1.0
+		if move.seconds > 0 {
+			t = now.Sub(move.start).Seconds() / move.seconds
+		}
+		p := protocol.PushProgress(t)
+		x, y := move.fromX+(move.toX-move.fromX)*p, move.fromY+(move.toY-move.fromY)*p
+		// The velocity is the easing's slope, so snapshots extrapolate
+		// along the glide.
+		state.VX, state.VY = 0, 0
+		if t < 1 {
+			slope := 2 * (1 - t) / move.seconds
+			state.VX, state.VY = (move.toX-move.fromX)*slope, (move.toY-move.fromY)*slope
+		}
+		state.X, state.Y = x, y
+		r.grid.Move(c, x, y)
+		c.updateProfile(func(p *Profile) { p.X, p.Y = x, y })
+		r.updateArea(c, x, y)
+		if t >= 1 {
+			delete(r.pushes, c)
+			// Reports the client sent while still gliding are near the
+			// target; anything else predates the push.
+			r.warping[c] = pendingWarp{x: x, y: y, deadline: now.Add(warpTimeout)}
+		}
+	}
+
+	for c, state := range r.players {
+		if _, dead := r.dead[c]; state == nil || dead || r.pushes[c] != nil {
+			continue
+		}
+		for _, conveyor := range r.conveyors {
+			if conveyor.contains(state.X, state.Y) {
+				r.push(c, conveyor.DX*conveyorStep, conveyor.DY*conveyorStep, conveyorStep)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package gameserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+const (
+	// pickupRange is how close a player walks to an item to pick it up.
+	pickupRange = 24.0
+	// defaultReachRadius is how close a reach objective's location must be
+	// approached when the quest file gives no radius.
+	defaultReachRadius = 48.0
+)
+
+// Objective types.
+const (
+	objectiveReach   = "reach"
+	objectiveTalk    = "talk"
+	objectiveCollect = "collect"
+)
+
+// Objective is one step of a quest: reaching a location in a room, talking
+// to an NPC by name, or carrying Count of an item. Text is what the player
+// is shown while it is the current step.
+type Objective struct {
+	Type   string  `json:"type"`
+	Text   string  `json:"text"`
+	Room   string  `json:"room,omitempty"`
+	X      float64 `json:"x,omitempty"`
+	Y      float64 `json:"y,omitempty"`
+	Radius float64 `json:"radius,omitempty"`
+	NPC    string  `json:"npc,omitempty"`
+	Item   string  `json:"item,omitempty"`
+	Count  int     `json:"count,omitempty"`
+}
+
+func (o Objective) reached(room string, x, y float64) bool {
+	return o.Type == objectiveReach && o.Room == room && math.Hypot(x-o.X, y-o.Y) <= o.Radius
+}
+
+func (o Objective) collected(inventory map[string]int) bool {
+	return o.Type == objectiveCollect && inventory[o.Item] >= o.Count
+}
+
+// Quest is offered by the NPC named Giver. Its objectives are completed in
+// order, and finishing the last one awards RewardXP.
+type Quest struct {
+	ID          string      `json:"id"`
+	Title       string      `json:"title"`
+	Description string      `json:"description"`
+	Giver       string      `json:"giver"`
+	Objectives  []Objective `json:"objectives"`
+	RewardXP    int         `json:"rewardXp"`
+}
+
+func (q *Quest) status(step int) protocol.QuestStatus {
+	s := protocol.QuestStatus{ID: q.ID, Title: q.Title, Step: step, Total: len(q.Objectives), RewardXP: q.RewardXP}
+	if step < len(q.Objectives) {
+		s.Objective = q.Objectives[step].Text
+	} else {
+		s.Done = true
+	}
+	return s
+}
+
+// QuestBook is the set of quests loaded from a quest file, which holds a
+// JSON array of quests. A nil QuestBook has no quests.
+type QuestBook struct {
+	quests []*Quest
+	byID   map[string]*Quest
+}
+
+func LoadQuestBook(path string) (*QuestBook, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var quests []*Quest
+	if err := json.Unmarshal(data, &quests); err != nil {
+		return nil, fmt.Errorf("parsing quests %s: %w", path, err)
+	}
+	b := &QuestBook{quests: quests, byID: make(map[string]*Quest, len(quests))}
+	for _, q := range quests {
+		if err := q.validate(); err != nil {
+			return nil, fmt.Errorf("quests %s: %w", path, err)
+		}
+		if b.byID[q.ID] != nil {
+			return nil, fmt.Errorf("quests %s: duplicate quest %q", path, q.ID)
+		}
+		b.byID[q.ID] = q
+	}
+	return b, nil
+}
+
+// validate checks the quest is complete enough to be played and fills in
+// default radii and counts.
+func (q *Quest) validate() error {
+	if q.ID == "" || q.Giver == "" {
+		return errors.New("every quest needs an id and a giver")
+	}
+	if len(q.Objectives) == 0 {
+		return fmt.Errorf("quest %q has no objectives", q.ID)
+	}
+	for i := range q.Objectives {
+		o := &q.Objectives[i]
+		switch o.Type {
+		case objectiveReach:
+			if o.Room == "" {
+				return fmt.Errorf("quest %q: reach objective %d needs a room", q.ID, i+1)
+			}
+			if o.Radius <= 0 {
+				o.Radius = defaultReachRadius
+			}
+		case objectiveTalk:
+			if o.NPC == "" {
+				return fmt.Errorf("quest %q: talk objective %d needs an npc", q.ID, i+1)
+			}
+		case objectiveCollect:
+			if o.Item == "" {
+				return fmt.Errorf("quest %q: collect objective %d needs an item", q.ID, i+1)
+			}
+			o.Count = max(o.Count, 1)
+		default:
+			return fmt.Errorf("quest %q: objective %d has unknown type %q", q.ID, i+1, o.Type)
+		}
+	}
+	return nil
+}
+
+func (b *QuestBook) quest(id string) *Quest {
+	if b == nil {
+		return nil
+	}
+	return b.byID[id]
+}
+
+// offer returns the first quest the NPC gives that the player has not yet
+// taken, or nil.
+func (b *QuestBook) offer(giver string, taken map[string]int) *Quest {
+	if b == nil {
+		return nil
+	}
+	for _, q := range b.quests {
+		if _, ok := taken[q.ID]; !ok && q.Giver == giver {
+			return q
+		}
+	}
+	return nil
+}
+
+// sendQuests tells a player who just entered the world about their active
+// quests.
+func (s *Server) sendQuests(client *Client) {
+	var statuses []protocol.QuestStatus
+	client.updateProfile(func(p *Profile) {
+		for id, step := range p.Quests {
+			if q := s.quests.quest(id); q != nil && step < len(q.Objectives) {
+				statuses = append(statuses, q.status(step))
+			}
+		}
+	})
+	for _, status := range statuses {
+		client.Send(protocol.Line(protocol.KindQuest, protocol.EncodeQuestStatus(status)))
+	}
+}
+
+// interact runs when the player talks to an NPC: it counts toward talk
+// objectives and starts the NPC's dialogue, or goes straight to what the
+// conversation would end in when it has none.
+func (r *Room) interact(c *Client, id string) {
+	e := r.entities[id]
+	if e != nil && r.riding[c] == e.ID {
+		r.unseat(c)
+		return
+	}
+	if e == nil || !r.withinReach(c, e) {
+		return
+	}
+	if e.Kind == protocol.EntityVehicle {
+		r.board(c, e)
+		return
+	}
+	if e.Kind == protocol.EntityDoor {
+		r.toggleDoor(c, e)
+		return
+	}
+	if e.Kind != protocol.EntityNPC {
+		return
+	}
+	r.advanceQuests(c, func(o Objective) bool { return o.Type == objectiveTalk && o.NPC == e.Name })
+	if !r.startDialogue(c, e) {
+		r.finishTalking(c, e)
+	}
+}
+
+// finishTalking opens a vendor's shop, or else offers the player the next
+// quest the NPC gives.
+func (r *Room) finishTalking(c *Client, e *protocol.Entity) {
+	if !r.openShop(c, e) {
+		r.offerQuest(c, e.Name)
+	}
+}
+
+// withinReach reports whether the player stands close enough to talk to e.
+func (r *Room) withinReach(c *Client, e *protocol.Entity) bool {
+	state := r.players[c]
+	return state != nil && math.Hypot(e.X-state.X, e.Y-state.Y) <= protocol.InteractRange
+}
+
+// offerQuest offers the player the next quest the named NPC gives, if any.
+func (r *Room) offerQuest(c *Client, giver string) {
+	var q *Quest
+	c.updateProfile(func(p *Profile) { q = r.quests.offer(giver, p.Quests) })
+	if q == nil {
+		return
+	}
+	r.offers[c] = q.ID
+	offer := protocol.QuestOffer{ID: q.ID, Title: q.Title, Description: q.Description, Giver: giver}
+	c.Send(protocol.Line(protocol.KindQuestOffer, protocol.EncodeQuestOffer(offer)))
+}
+
+// acceptQuest starts the quest the player was last offered.
+func (r *Room) acceptQuest(c *Client, id string) {
+	q := r.quests.quest(id)
+	if q == nil || r.offers[c] != id {
+		c.Send(protocol.Line(protocol.KindError, "that quest was not offered to you"))
+		return
+	}
+	delete(r.offers, c)
+	c.updateProfile(func(p *Profile) {
+		if _, ok := p.Quests[id]; !ok {
+			p.Quests[id] = 0
+		}
+	})
+	c.Send(protocol.Line(protocol.KindQuest, protocol.EncodeQuestStatus(q.status(0))))
+	// Items the player already carries count straight away.
+	r.advanceQuests(c, func(Objective) bool { return false })
+}
+
+// pickUpItems moves the items within pickupRange of the player into their
+// inventory.
+func (r *Room) pickUpItems(c *Client, x, y float64) {
+	picked := false
+	for id, e := range r.entities {
+		if e.Kind != protocol.EntityItem || math.Hypot(e.X-x, e.Y-y) > pickupRange {
+			continue
+		}
+		delete(r.entities, id)
+		delete(r.homes, id)
+		r.broadcast(protocol.Line(protocol.KindDespawn, id))
+		c.updateProfile(func(p *Profile) { p.Inventory[e.Name]++ })
+		picked = true
+	}
+	if picked {
+		c.sendInventory()
+		r.advanceQuests(c, func(Objective) bool { return false })
+	}
+}
+
+// advanceQuests moves each of the player's active quests past every
+// objective that met reports done, along with collect objectives their
+// inventory already satisfies, and reports the new progress. Completing a
+// quest awards its XP.
+func (r *Room) advanceQuests(c *Client, met func(Objective) bool) {
+	if r.quests == nil {
+		return
+	}
+	var changed []protocol.QuestStatus
+	c.updateProfile(func(p *Profile) {
+		for id, step := range p.Quests {
+			q := r.quests.quest(id)
+			if q == nil {
+				continue
+			}
+			start := step
+			for step < len(q.Objectives) && (met(q.Objectives[step]) || q.Objectives[step].collected(p.Inventory)) {
+				step++
+			}
+			if step == start {
+				continue
+			}
+			p.Quests[id] = step
+			if step == len(q.Objectives) {
+				p.Stats.XP += q.RewardXP
+			}
+			changed = append(changed, q.status(step))
+		}
+	})
+	for _, status := range changed {
+		c.Send(protocol.Line(protocol.KindQuest, protocol.EncodeQuestStatus(status)))
+		if status.Done {
+			log.Printf("%s completed quest %s", c.Name(), status.ID)
+			r.events.Write(Event{Type: eventQuest, Player: c.Name(), Room: r.name, Text: status.ID})
+		}
+	}
+}
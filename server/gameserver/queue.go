@@ -0,0 +1,128 @@
+package gameserver
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+const (
+	queueUpdateInterval = 5 * time.Second
+	// maxPendingLines bounds what a queued client may send before it is
+	// admitted; the login line it sends on connect is what matters.
+	maxPendingLines = 32
+)
+
+type queuedClient struct {
+	client *Client
+	admit  chan struct{}
+}
+
+// waitForSlot admits the client straight away while the server is below
+// MaxPlayers. Otherwise the client waits in a FIFO queue and is told its
+// position when it joins, whenever it moves up and every
+// queueUpdateInterval. Lines it sends meanwhile are returned for replay once
+// it is admitted; ok is false if it disconnected while waiting.
+func (s *Server) waitForSlot(client *Client, lines <-chan string) (pending []string, ok bool) {
+	s.mu.Lock()
+	if s.maxPlayers <= 0 || s.active < s.maxPlayers {
+		s.active++
+		s.mu.Unlock()
+		return nil, true
+	}
+	q := &queuedClient{client: client, admit: make(chan struct{})}
+	s.queue = append(s.queue, q)
+	position := len(s.queue)
+	s.mu.Unlock()
+
+	log.Printf("Server full, %s queued at position %d", client.id, position)
+	client.Send(protocol.Line(protocol.KindQueue, strconv.Itoa(position)))
+
+	ticker := time.NewTicker(queueUpdateInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-q.admit:
+			return pending, true
+		case <-ticker.C:
+			if position := s.queuePosition(q); position > 0 {
+				client.Send(protocol.Line(protocol.KindQueue, strconv.Itoa(position)))
+			}
+		case line, open := <-lines:
+			if !open {
+				s.leaveQueue(q)
+				return nil, false
+			}
+			if len(pending) < maxPendingLines {
+				pending = append(pending, line)
+			}
+		}
+	}
+}
+
+func (s *Server) queuePosition(q *queuedClient) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, queued := range s.queue {
+		if queued == q {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+func (s *Server) leaveQueue(q *queuedClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, queued := range s.queue {
+		if queued == q {
+			s.queue = append(s.queue[:i], s.queue[i+1:]...)
+			s.notifyQueueLocked(i)
+			break
+		}
+	}
+	// The slot may have been handed over just as the client disconnected.
+	select {
+	case <-q.admit:
+		s.releaseSlotLocked()
+	default:
+	}
+}
+
+// releaseSlot frees an admitted player's slot, handing it straight to the
+// head of the queue if anyone is waiting.
+func (s *Server) releaseSlot() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.releaseSlotLocked()
+}
+
+func (s *Server) releaseSlotLocked() {
+	if len(s.queue) == 0 {
+		s.active--
+		return
+	}
+	next := s.queue[0]
+	s.queue = s.queue[1:]
+	close(next.admit)
+	s.notifyQueueLocked(0)
+}
+
+// notifyQueueLocked tells everyone from index from onward their new position.
+func (s *Server) notifyQueueLocked(from int) {
+	for i := from; i < len(s.queue); i++ {
+		s.queue[i].client.Send(protocol.Line(protocol.KindQueue, strconv.Itoa(i+1)))
+	}
+}
+
+func (s *Server) QueueLength() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.queue)
+}
@@ -0,0 +1,177 @@
+package gameserver
+
+import (
+	"log"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+const (
+	// baseRating is a new character's matchmaking rating.
+	baseRating = 1000
+	// ratingK is the most a duel can move either player's rating. In
+	// bigger matches each loser is rated as having lost to the winner, with
+	// ratingK shared out over the winner's opponents.
+	ratingK = 32.0
+)
+
+// expectedScore is the chance an Elo rating gives a player of beating an
+// opponent with the other.
+func expectedScore(rating, opponent int) float64 {
+	return 1 / (1 + math.Pow(10, float64(opponent-rating)/400))
+}
+
+// matchState is the match a room was readied for by the matcher.
+type matchState struct {
+	mode    string
+	rules   *Mode
+	players []*Client
+	stats   map[*Client]*matchStats
+	// phase is where the match is in its lifecycle, until phaseEnds.
+	// round counts the rounds started, and roundWinner is who won the
+	// last one, if anyone.
+	phase       string
+	phaseEnds   time.Time
+	round       int
+	roundWinner string
+}
+
+// matchStats is how one player is doing in a match.
+type matchStats struct {
+	kills, deaths int
+	roundKills    int
+	roundsWon     int
+}
+
+// score is what a match's players are ranked by, MVP first.
+func (s *matchStats) score() int {
+	return s.kills * killScore
+}
+
+// newMatchState readies a match for its room, which starts the warmup by
+// its own clock when the match reaches it; see openMatch.
+func newMatchState(mode string, rules *Mode, players []*Client) *matchState {
+	m := &matchState{
+		mode:    mode,
+		rules:   rules,
+		players: players,
+		stats:   make(map[*Client]*matchStats),
+	}
+	for _, c := range players {
+		m.stats[c] = &matchStats{}
+	}
+	return m
+}
+
+// openMatch makes m the room's match, warming up until its players have
+// been moved in and had the mode's warmup to get their bearings.
+func (r *Room) openMatch(m *matchState) {
+	r.match = m
+	r.setMatchPhase(protocol.MatchWarmup, matchCountdown+durationOf(m.rules.Warmup), r.clock())
+}
+
+// playing returns the match the player is in in this room, if any.
+func (r *Room) playing(c *Client) *matchState {
+	if m := r.match; m != nil && m.phase != protocol.MatchIntermission && slices.Contains(m.players, c) {
+		return m
+	}
+	return nil
+}
+
+// scoreMatchKill counts a kill between two of the match's players while a
+// round is on, ending the round once the killer has enough.
+func (r *Room) scoreMatchKill(killer, victim *Client) {
+	m := r.playing(killer)
+	if m == nil || m.phase != protocol.MatchPlaying || r.playing(victim) == nil {
+		return
+	}
+	stats := m.stats[killer]
+	stats.kills++
+	if stats.roundKills++; stats.roundKills >= m.rules.Kills {
+		r.endRound(killer, r.clock())
+	}
+}
+
+// scoreMatchDeath counts a match player's death in a round, however they
+// died.
+func (r *Room) scoreMatchDeath(c *Client) {
+	if m := r.playing(c); m != nil && m.phase == protocol.MatchPlaying {
+		m.stats[c].deaths++
+	}
+}
+
+// forfeitMatch ends the match when a player leaving it leaves one player
+// behind, who wins. A match nobody is left in ends unrated.
+func (r *Room) forfeitMatch(leaving *Client) {
+	m := r.playing(leaving)
+	if m == nil {
+		return
+	}
+	var left []*Client
+	for _, c := range m.players {
+		if _, ok := r.players[c]; ok && c != leaving {
+			left = append(left, c)
+		}
+	}
+	switch len(left) {
+	case 0:
+		r.match = nil
+	case 1:
+		r.endMatch(left[0], r.clock())
+	}
+}
+
+// endMatch rates the match's players and sends those still in the room the
+// results, for the intermission before they go back to the default room.
+func (r *Room) endMatch(winner *Client, now time.Time) {
+	m := r.match
+
+	ratings := make(map[*Client]int, len(m.players))
+	for _, c := range m.players {
+		c.updateProfile(func(p *Profile) { ratings[c] = p.Stats.Rating })
+	}
+	k := ratingK / float64(len(m.players)-1)
+	changes := make(map[*Client]int, len(m.players))
+	for _, c := range m.players {
+		if c == winner {
+			continue
+		}
+		change := int(math.Round(k * (1 - expectedScore(ratings[winner], ratings[c]))))
+		changes[winner] += change
+		changes[c] -= change
+	}
+	log.Printf("%s won %s", winner.Name(), r.name)
+
+	results := protocol.MatchResults{Mode: m.mode, Room: r.name, Winner: winner.Name(), Seconds: matchCountdown.Seconds()}
+	for _, c := range m.players {
+		change := changes[c]
+		result := protocol.MatchPlayerResult{Name: c.Name(), Kills: m.stats[c].kills, Deaths: m.stats[c].deaths, Score: m.stats[c].score(), Change: change}
+		c.updateProfile(func(p *Profile) {
+			p.Stats.Rating = max(0, p.Stats.Rating+change)
+			result.Rating = p.Stats.Rating
+		})
+		results.Players = append(results.Players, result)
+	}
+	slices.SortFunc(results.Players, func(a, b protocol.MatchPlayerResult) int {
+		if a.Score != b.Score {
+			return b.Score - a.Score
+		}
+		if a.Deaths != b.Deaths {
+			return a.Deaths - b.Deaths
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	results.MVP = results.Players[0].Name
+
+	line := protocol.Line(protocol.KindMatchResults, protocol.EncodeMatchResults(results))
+	for _, c := range m.players {
+		if _, ok := r.players[c]; ok {
+			c.Send(line)
+		}
+	}
+	r.setMatchPhase(protocol.MatchIntermission, matchCountdown, now)
+}
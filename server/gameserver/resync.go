@@ -0,0 +1,39 @@
+package gameserver
+
+import (
+	"sort"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+// resync is what a player entering the room needs to rebuild their view of
+// it: where they were just spawned, the players within interestRadius of
+// there and every entity in the room. The room goroutine calls it right
+// after the join's respawn.
+func (r *Room) resync(c *Client) protocol.Resync {
+	self := protocol.PlayerState{ID: c.id, Warp: int(c.warps.Load())}
+	if w, ok := r.warping[c]; ok {
+		self.X, self.Y = w.x, w.y
+	}
+	resync := protocol.Resync{
+		Room:     r.name,
+		MapHash:  r.world.Hash(),
+		Self:     self,
+		Players:  []protocol.PlayerState{},
+		Entities: make([]protocol.Entity, 0, len(r.entities)),
+	}
+	r.grid.Near(self.X, self.Y, interestRadius, func(other *Client, state *protocol.PlayerState) {
+		if other != c {
+			p := *state
+			p.Idle = other.idle.Load()
+			p.Mount = r.mounts[other]
+			p.Level = r.levels[other]
+			resync.Players = append(resync.Players, p)
+		}
+	})
+	for _, e := range r.entities {
+		resync.Entities = append(resync.Entities, *e)
+	}
+	sort.Slice(resync.Entities, func(i, j int) bool { return resync.Entities[i].ID < resync.Entities[j].ID })
+	return resync
+}
@@ -0,0 +1,530 @@
+package gameserver
+
+import (
+	"log"
+	"math"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"darkzone/MultiTestServer/protocol"
+	"darkzone/MultiTestServer/script"
+	"darkzone/MultiTestServer/spatial"
+)
+
+const (
+	defaultRoom     = "lobby"
+	roomInboxSize   = 256
+	localChatRadius = 400.0
+	interestRadius  = protocol.InterestRadius
+	chunkSize       = 256.0
+	// spawnX and spawnY are the spawn point used when the map has none.
+	spawnX = 400.0
+	spawnY = 300.0
+	// After a teleport, state reports farther than warpSlack from the target
+	// are ones the client sent before it snapped, and are dropped until
+	// warpTimeout passes.
+	warpSlack   = 64.0
+	warpTimeout = 2 * time.Second
+	// Players can open up to maxPlayerRooms rooms of their own by name,
+	// each closed once it has been empty for emptyRoomTimeout. Rooms are
+	// checked for closing every roomCloseInterval.
+	maxPlayerRooms    = 32
+	emptyRoomTimeout  = 5 * time.Minute
+	roomCloseInterval = 30 * time.Second
+)
+
+type roomMessageKind int
+
+const (
+	roomJoin roomMessageKind = iota
+	roomLeave
+	roomState
+	roomChat
+	roomSpawn
+	roomDespawn
+	roomTeleport
+	roomWeather
+	roomPortal
+	roomSave
+	roomVoice
+	roomRespawn
+	roomInteract
+	roomQuestAccept
+	roomDialogueChoice
+	roomShopBuy
+	roomShopSell
+	roomShopClose
+	roomCraft
+	roomGather
+	roomEffect
+	roomDash
+	roomConveyor
+	roomFeed
+	roomMatch
+	roomPause
+	roomTarget
+	roomDump
+	roomEntityMove
+	roomEntityOwner
+	roomMount
+)
+
+type roomMessage struct {
+	kind     roomMessageKind
+	client   *Client
+	state    protocol.PlayerState
+	chat     protocol.ChatMessage
+	entity   protocol.Entity
+	weather  protocol.Weather
+	portal   Portal
+	done     chan struct{}
+	saved    chan<- RoomSave
+	dumped   chan<- RoomDump
+	voice    []byte
+	quest    string
+	choice   int
+	item     string
+	seconds  float64
+	conveyor Conveyor
+	feed     protocol.FeedEvent
+	match    *matchState
+}
+
+// Room owns the simulation state of one zone. All of its state is touched
+// only by the room's own goroutine; everything else talks to it through the
+// inbox, so independent rooms tick in parallel without sharing locks.
+type Room struct {
+	name     string
+	inbox    chan roomMessage
+	players  map[*Client]*protocol.PlayerState
+	grid     *spatial.Grid[*Client, *protocol.PlayerState]
+	entities map[string]*protocol.Entity
+	homes    map[string]protocol.Entity
+	portals  []Portal
+	// conveyors carry players along; pushes are the forced moves in
+	// progress and dashReady when each player may dash again.
+	conveyors []Conveyor
+	pushes    map[*Client]*forcedMove
+	dashReady map[*Client]time.Time
+	// attackReady is when each player may start another attack.
+	attackReady map[*Client]time.Time
+	warping     map[*Client]pendingWarp
+	weather     *WeatherCycle
+	tickLoop    *TickLoop
+
+	scripts     *scriptRuntime
+	scriptClock time.Duration
+	world       *WorldMap
+	events      *EventLog
+	quests      *QuestBook
+	dialogues   *DialogueBook
+	vendors     *VendorBook
+	recipes     *RecipeBook
+	resources   *ResourceBook
+	doors       *DoorBook
+	ambient     protocol.Ambient
+	// vision is how far players see under the fog of war, 0 for no fog,
+	// and nextVision when they are next told where their party is.
+	vision     float64
+	nextVision time.Time
+	// offers is the quest each player was last offered and may accept,
+	// talking the dialogue each player is in and shopping the ID of the
+	// vendor whose shop they have open.
+	offers    map[*Client]string
+	talking   map[*Client]*conversation
+	shopping  map[*Client]string
+	crafting  map[*Client]*craftJob
+	gathering map[*Client]*gatherJob
+	depleted  map[string]depletedNode
+	effects   map[*Client][]*statusEffect
+	openDoors map[string]bool
+	// areas is the kind of area each player was last told they are in.
+	areas map[*Client]string
+	// dead is when each defeated player respawns.
+	dead map[*Client]time.Time
+	// match is the match the room was opened for, if any.
+	match *matchState
+	// finished is set once the match is over and its players sent home,
+	// for the server to close the room when it empties; stop is closed
+	// to end the room's tick loop.
+	finished atomic.Bool
+	stop     chan struct{}
+	// playerMade is set on rooms a player opened by name, and emptySince
+	// is when one was first seen empty since it last had anyone in it.
+	// The server touches both only under its lock.
+	playerMade bool
+	emptySince time.Time
+	// pauseVotes is who has voted to pause the room, and pausedAt when
+	// everyone had, while it is paused.
+	pauseVotes map[*Client]bool
+	pausedAt   time.Time
+	// targets is the player each player has targeted, for abilities to
+	// aim at.
+	targets map[*Client]*Client
+	// mounts is what each riding player rides, and mountReady when each
+	// player knocked off may ride again.
+	mounts     map[*Client]string
+	mountReady map[*Client]time.Time
+	// seats is who sits in each of a vehicle's seats, by the vehicle's
+	// ID, and riding the vehicle each player aboard one sits in.
+	seats  map[string][]*Client
+	riding map[*Client]string
+	// budgets is how far each player may still move; see limitSpeed.
+	budgets map[*Client]*moveBudget
+	// levels is the elevation level each player is at.
+	levels map[*Client]int
+	// rng is where the room's randomness comes from and clock what it
+	// reads the time from; both are fixed in a simulation.
+	rng   *rand.Rand
+	clock func() time.Time
+
+	playerCount atomic.Int64
+	stepNanos   atomic.Int64
+}
+
+func NewRoom(name string, tickRate int, scripts *scriptRuntime, world *WorldMap) *Room {
+	r := &Room{
+		name:        name,
+		inbox:       make(chan roomMessage, roomInboxSize),
+		players:     make(map[*Client]*protocol.PlayerState),
+		grid:        spatial.NewGrid[*Client, *protocol.PlayerState](chunkSize),
+		entities:    make(map[string]*protocol.Entity),
+		homes:       make(map[string]protocol.Entity),
+		warping:     make(map[*Client]pendingWarp),
+		offers:      make(map[*Client]string),
+		talking:     make(map[*Client]*conversation),
+		shopping:    make(map[*Client]string),
+		crafting:    make(map[*Client]*craftJob),
+		gathering:   make(map[*Client]*gatherJob),
+		depleted:    make(map[string]depletedNode),
+		effects:     make(map[*Client][]*statusEffect),
+		openDoors:   make(map[string]bool),
+		areas:       make(map[*Client]string),
+		dead:        make(map[*Client]time.Time),
+		pushes:      make(map[*Client]*forcedMove),
+		dashReady:   make(map[*Client]time.Time),
+		attackReady: make(map[*Client]time.Time),
+		mounts:      make(map[*Client]string),
+		mountReady:  make(map[*Client]time.Time),
+		seats:       make(map[string][]*Client),
+		riding:      make(map[*Client]string),
+		budgets:     make(map[*Client]*moveBudget),
+		levels:      make(map[*Client]int),
+		pauseVotes:  make(map[*Client]bool),
+		targets:     make(map[*Client]*Client),
+		rng:         rand.New(rand.NewSource(time.Now().UnixNano())),
+		clock:       time.Now,
+		scripts:     scripts,
+		world:       world,
+	}
+	r.weather = NewWeatherCycle(r.rng)
+	r.tickLoop = NewTickLoop(tickRate, r.step)
+	return r
+}
+
+func (r *Room) Run(stop <-chan struct{}) {
+	r.tickLoop.Run(stop)
+}
+
+func (r *Room) Send(msg roomMessage) {
+	r.inbox <- msg
+}
+
+// TrySend is Send for messages that may be dropped, returning false instead
+// of waiting when the inbox is full.
+func (r *Room) TrySend(msg roomMessage) bool {
+	select {
+	case r.inbox <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+func (r *Room) step(dt time.Duration) {
+	start := time.Now()
+	defer func() { r.stepNanos.Store(int64(time.Since(start))) }()
+
+	r.drainInbox()
+	if r.paused() {
+		r.broadcastSnapshots()
+		return
+	}
+	now := r.clock()
+	r.finishCrafting(now)
+	r.finishGathering(now)
+	r.respawnResources(now)
+	r.tickEffects(now)
+	r.reviveDead(now)
+	r.stepMatch(now)
+	r.movePushed(now)
+	r.weather.Update(dt)
+	if set := r.scripts.current(); set != nil {
+		before := r.scriptClock
+		r.scriptClock += dt
+		r.runTimers(set, int64(before), int64(r.scriptClock))
+	}
+
+	r.sendVision(now)
+	r.broadcastSnapshots()
+}
+
+// broadcastSnapshots sends each player only the players within
+// interestRadius of it, found through the chunk grid, so a snapshot costs
+// O(nearby) rather than O(room). Players whose connections cannot keep up
+// are skipped on some ticks.
+func (r *Room) broadcastSnapshots() {
+	start := r.clock()
+	now := start.UnixMilli()
+	weather := r.weather.Current()
+	players := make([]protocol.PlayerState, 0, 16)
+
+	r.grid.Each(func(c *Client, self *protocol.PlayerState) {
+		if !c.pacer.due(c, start) {
+			return
+		}
+		players = players[:0]
+		r.grid.Near(self.X, self.Y, interestRadius, func(other *Client, state *protocol.PlayerState) {
+			p := *state
+			p.Idle = other.idle.Load()
+			p.Mount = r.mounts[other]
+			p.Level = r.levels[other]
+			players = append(players, p)
+		})
+		snap := protocol.Snapshot{Time: now, Weather: weather, Players: players}
+		c.Send(protocol.Line(protocol.KindSnapshot, protocol.EncodeSnapshot(snap)))
+	})
+}
+
+func (r *Room) drainInbox() {
+	for {
+		select {
+		case msg := <-r.inbox:
+			r.handle(msg)
+		default:
+			return
+		}
+	}
+}
+
+func (r *Room) handle(msg roomMessage) {
+	switch msg.kind {
+	case roomJoin:
+		r.players[msg.client] = nil
+		r.events.Write(Event{Type: eventJoin, Player: msg.client.Name(), Room: r.name})
+		msg.client.Send(protocol.Line(protocol.KindAmbient, protocol.EncodeAmbient(r.ambient)))
+		msg.client.Send(r.visionLine(msg.client))
+		r.sendEffects(msg.client)
+		r.sendDoors(msg.client)
+		// Warps and character selection follow up with a teleport of
+		// their own; everyone else enters at a spawn point.
+		r.respawn(msg.client)
+		msg.client.Send(protocol.Line(protocol.KindResync, protocol.EncodeResync(r.resync(msg.client))))
+		r.sendSeats(msg.client)
+		if r.match != nil {
+			msg.client.Send(r.matchPhaseLine(r.clock()))
+		}
+		if len(r.pauseVotes) > 0 {
+			r.updatePause(r.clock())
+		}
+		r.runScripts(r.scripts.current().On(script.EventJoin), msg.client, "")
+	case roomLeave:
+		r.runScripts(r.scripts.current().On(script.EventLeave), msg.client, "")
+		r.events.Write(Event{Type: eventLeave, Player: msg.client.Name(), Room: r.name})
+		r.forfeitMatch(msg.client)
+		r.clearEffects(msg.client)
+		delete(r.players, msg.client)
+		delete(r.warping, msg.client)
+		delete(r.offers, msg.client)
+		delete(r.talking, msg.client)
+		delete(r.shopping, msg.client)
+		r.cancelCrafting(msg.client)
+		delete(r.gathering, msg.client)
+		delete(r.pushes, msg.client)
+		delete(r.dashReady, msg.client)
+		delete(r.attackReady, msg.client)
+		delete(r.mounts, msg.client)
+		delete(r.mountReady, msg.client)
+		delete(r.budgets, msg.client)
+		delete(r.levels, msg.client)
+		delete(r.areas, msg.client)
+		delete(r.dead, msg.client)
+		r.dropTarget(msg.client)
+		r.unseat(msg.client)
+		r.releaseEntities(msg.client)
+		if r.pauseVotes[msg.client] {
+			msg.client.Send(protocol.Line(protocol.KindPaused, protocol.EncodePauseStatus(protocol.PauseStatus{})))
+		}
+		if len(r.pauseVotes) > 0 {
+			delete(r.pauseVotes, msg.client)
+			r.updatePause(r.clock())
+		}
+		r.grid.Remove(msg.client)
+		if msg.done != nil {
+			close(msg.done)
+		}
+	case roomState:
+		_, dead := r.dead[msg.client]
+		if _, ok := r.players[msg.client]; ok && !dead && !r.paused() && r.pushes[msg.client] == nil && r.riding[msg.client] == "" && !r.staleAfterWarp(msg.client, msg.state) {
+			prev := r.players[msg.client]
+			state := msg.state
+			x, y, corrected := r.validateState(msg.client, state)
+			state.X, state.Y = x, y
+			if prev != nil {
+				msg.client.walked.Add(int64(math.Hypot(x-prev.X, y-prev.Y) * 100))
+			}
+			state.Warp = int(msg.client.warps.Load())
+			r.players[msg.client] = &state
+			r.grid.Set(msg.client, &state, state.X, state.Y)
+			msg.client.updateProfile(func(p *Profile) {
+				p.Room, p.X, p.Y = r.name, state.X, state.Y
+			})
+			if corrected {
+				r.teleport(msg.client, x, y)
+			}
+			if state.Anim == protocol.AnimAttack && (prev == nil || prev.Anim != protocol.AnimAttack) && r.readyToAttack(msg.client) {
+				r.resolveAttack(msg.client, state)
+			}
+			r.updateArea(msg.client, state.X, state.Y)
+			r.pickUpItems(msg.client, state.X, state.Y)
+			r.checkGathering(msg.client)
+			r.advanceQuests(msg.client, func(o Objective) bool { return o.reached(r.name, state.X, state.Y) })
+			r.enterPortals(msg.client, state)
+		}
+	case roomChat:
+		if msg.chat.Channel != protocol.ChannelGlobal {
+			if t, args, ok := r.scripts.current().Command(msg.chat.Text); ok {
+				r.runScripts([]*script.Trigger{t}, msg.client, args)
+				break
+			}
+		}
+		r.deliverChat(msg.client, msg.chat)
+	case roomSpawn:
+		entity := msg.entity
+		r.entities[entity.ID] = &entity
+		r.homes[entity.ID] = entity
+		r.broadcast(protocol.Line(protocol.KindSpawn, protocol.EncodeEntity(entity)))
+	case roomDespawn:
+		if _, ok := r.entities[msg.entity.ID]; ok {
+			r.emptyVehicle(msg.entity.ID)
+			delete(r.entities, msg.entity.ID)
+			delete(r.homes, msg.entity.ID)
+			delete(r.openDoors, msg.entity.ID)
+			r.broadcast(protocol.Line(protocol.KindDespawn, msg.entity.ID))
+		}
+	case roomTeleport:
+		r.teleport(msg.client, msg.state.X, msg.state.Y)
+	case roomWeather:
+		r.weather.Set(msg.weather)
+	case roomPortal:
+		r.portals = append(r.portals, msg.portal)
+	case roomSave:
+		msg.saved <- r.save()
+	case roomDump:
+		msg.dumped <- r.dump()
+	case roomEntityMove:
+		r.moveOwnedEntity(msg.client, msg.entity)
+	case roomEntityOwner:
+		r.setEntityOwner(msg.entity.ID, msg.client)
+	case roomMount:
+		if err := r.mount(msg.client, msg.item); err != nil {
+			msg.client.Send(protocol.Line(protocol.KindError, err.Error()))
+		}
+	case roomVoice:
+		r.relayVoice(msg.client, msg.voice)
+	case roomRespawn:
+		r.respawn(msg.client)
+	case roomInteract:
+		r.interact(msg.client, msg.entity.ID)
+	case roomQuestAccept:
+		r.acceptQuest(msg.client, msg.quest)
+	case roomDialogueChoice:
+		r.chooseDialogue(msg.client, msg.choice)
+	case roomShopBuy, roomShopSell:
+		r.trade(msg.client, msg.item, msg.kind == roomShopBuy)
+	case roomShopClose:
+		r.closeShop(msg.client)
+	case roomCraft:
+		r.startCrafting(msg.client, msg.item)
+	case roomGather:
+		r.startGathering(msg.client, msg.entity.ID)
+	case roomDash:
+		r.dash(msg.client, msg.state.VX, msg.state.VY)
+	case roomConveyor:
+		r.conveyors = append(r.conveyors, msg.conveyor)
+	case roomFeed:
+		r.announce(msg.feed)
+	case roomMatch:
+		r.openMatch(msg.match)
+	case roomPause:
+		r.votePause(msg.client, msg.item == protocol.PauseOn, r.clock())
+	case roomTarget:
+		r.setTarget(msg.client, msg.item)
+	case roomEffect:
+		if err := r.applyEffect(msg.client, msg.item, msg.seconds); err != nil {
+			log.Println("Error applying effect:", err)
+		}
+	}
+	r.playerCount.Store(int64(len(r.players)))
+}
+
+func (r *Room) broadcast(message string) {
+	for c := range r.players {
+		c.Send(message)
+	}
+}
+
+// teleport moves a player authoritatively. The client is told to snap there,
+// since its next state report would otherwise overwrite the new position.
+func (r *Room) teleport(c *Client, x, y float64) {
+	state, ok := r.players[c]
+	if !ok {
+		return
+	}
+	delete(r.pushes, c)
+	warps := int(c.warps.Add(1))
+	if state == nil {
+		// They have not reported a state here yet. Starting them at the
+		// target means their first report is speed-checked from it, like
+		// every later one.
+		state = &protocol.PlayerState{}
+		r.players[c] = state
+		r.grid.Set(c, state, x, y)
+	}
+	state.X, state.Y = x, y
+	state.VX, state.VY = 0, 0
+	state.Warp = warps
+	seq := state.Seq
+	r.grid.Move(c, x, y)
+	r.levels[c] = r.elevationAt(x, y).Level()
+	r.warping[c] = pendingWarp{x: x, y: y, deadline: r.clock().Add(warpTimeout)}
+	c.Send(protocol.Line(protocol.KindTeleport, protocol.EncodeTeleport(x, y, seq, r.levels[c])))
+}
+
+func (r *Room) deliverChat(sender *Client, chat protocol.ChatMessage) {
+	line := protocol.Line(protocol.KindChat, protocol.EncodeChat(chat))
+	if chat.Channel != protocol.ChannelLocal {
+		r.broadcast(line)
+		return
+	}
+
+	sender.Send(line)
+	origin := r.players[sender]
+	if origin == nil {
+		return
+	}
+	r.grid.Near(origin.X, origin.Y, localChatRadius, func(c *Client, _ *protocol.PlayerState) {
+		if c != sender {
+			c.Send(line)
+		}
+	})
+}
+
+func (r *Room) PlayerCount() int {
+	return int(r.playerCount.Load())
+}
+
+func (r *Room) LastStep() time.Duration {
+	return time.Duration(r.stepNanos.Load())
+}
@@ -0,0 +1,135 @@
+package gameserver
+
+import (
+	"time"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+// roundBreak is the pause after each round but the last, naming its
+// winner before the next one starts.
+const roundBreak = 5 * time.Second
+
+// stepMatch moves the room's match on to its next phase once the current
+// one is up: from the warmup or a round break into the next round, from a
+// round that ran out of time to its break, and from the intermission back
+// to the default room.
+func (r *Room) stepMatch(now time.Time) {
+	m := r.match
+	if m == nil || now.Before(m.phaseEnds) {
+		return
+	}
+	switch m.phase {
+	case protocol.MatchWarmup, protocol.MatchRoundEnd:
+		r.startRound(now)
+	case protocol.MatchPlaying:
+		r.endRound(r.roundLeader(), now)
+	case protocol.MatchIntermission:
+		r.match = nil
+		r.finished.Store(true)
+		for _, c := range m.players {
+			if _, ok := r.players[c]; ok {
+				c.RequestWarp(Warp{Room: defaultRoom, Spawn: true})
+			}
+		}
+	}
+}
+
+// startRound puts the match's players back at spawn points at full health
+// with no kills this round, and starts the clock.
+func (r *Room) startRound(now time.Time) {
+	m := r.match
+	m.round++
+	m.roundWinner = ""
+	for _, c := range m.players {
+		m.stats[c].roundKills = 0
+		if _, ok := r.players[c]; ok {
+			r.respawn(c)
+		}
+	}
+	r.setMatchPhase(protocol.MatchPlaying, durationOf(m.rules.Seconds), now)
+}
+
+// endRound credits the round to its winner, nil for a draw, and ends the
+// match once the winner has won most of its rounds or the last one is
+// played.
+func (r *Room) endRound(winner *Client, now time.Time) {
+	m := r.match
+	if winner != nil {
+		m.stats[winner].roundsWon++
+		m.roundWinner = winner.Name()
+		if m.stats[winner].roundsWon > m.rules.Rounds/2 {
+			r.endMatch(winner, now)
+			return
+		}
+	}
+	if m.round >= m.rules.Rounds {
+		r.endMatch(r.matchLeader(), now)
+		return
+	}
+	r.setMatchPhase(protocol.MatchRoundEnd, roundBreak, now)
+}
+
+// roundLeader is the player with the most kills this round, or nil if
+// nobody has more than everyone else.
+func (r *Room) roundLeader() *Client {
+	var leader *Client
+	best, tied := 0, false
+	for _, c := range r.match.players {
+		switch kills := r.match.stats[c].roundKills; {
+		case kills > best:
+			leader, best, tied = c, kills, false
+		case kills == best:
+			tied = true
+		}
+	}
+	if tied {
+		return nil
+	}
+	return leader
+}
+
+// matchLeader is who wins a match that ran all its rounds: the player with
+// the most rounds won, then the most kills, then the fewest deaths.
+func (r *Room) matchLeader() *Client {
+	leader := r.match.players[0]
+	for _, c := range r.match.players[1:] {
+		a, b := r.match.stats[c], r.match.stats[leader]
+		switch {
+		case a.roundsWon != b.roundsWon:
+			if a.roundsWon > b.roundsWon {
+				leader = c
+			}
+		case a.kills != b.kills:
+			if a.kills > b.kills {
+				leader = c
+			}
+		case a.deaths < b.deaths:
+			leader = c
+		}
+	}
+	return leader
+}
+
+// setMatchPhase moves the match on to phase for d and tells the room.
+func (r *Room) setMatchPhase(phase string, d time.Duration, now time.Time) {
+	r.match.phase, r.match.phaseEnds = phase, now.Add(d)
+	r.broadcast(r.matchPhaseLine(now))
+}
+
+// matchPhaseLine is the match's phase as sent to clients, counting down
+// from now.
+func (r *Room) matchPhaseLine(now time.Time) string {
+	m := r.match
+	phase := protocol.MatchPhase{
+		Mode:    m.mode,
+		Phase:   m.phase,
+		Round:   m.round,
+		Rounds:  m.rules.Rounds,
+		Seconds: max(0, m.phaseEnds.Sub(now).Seconds()),
+	}
+	if m.phase == protocol.MatchRoundEnd {
+		phase.Winner = m.roundWinner
+	}
+	return protocol.Line(protocol.KindMatchPhase, protocol.EncodeMatchPhase(phase))
+}
@@ -0,0 +1,163 @@
+package gameserver
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sync/atomic"
+
+	"darkzone/MultiTestServer/protocol"
+	"darkzone/MultiTestServer/script"
+)
+
+// scriptRuntime is shared by every room. The set is swapped atomically on
+// hot reload, so a room always runs one consistent version of the scripts.
+type scriptRuntime struct {
+	set         atomic.Pointer[script.Set]
+	newEntityID func() string
+}
+
+func (rt *scriptRuntime) current() *script.Set {
+	if rt == nil {
+		return nil
+	}
+	return rt.set.Load()
+}
+
+// runScripts fires triggers from inside the room goroutine, so the host can
+// touch room state directly.
+func (r *Room) runScripts(triggers []*script.Trigger, client *Client, args string) {
+	if len(triggers) == 0 {
+		return
+	}
+	ctx := script.Context{Room: r.name, Args: args}
+	if client != nil {
+		ctx.Player, ctx.ID = client.Name(), client.id
+		if state := r.players[client]; state != nil {
+			ctx.X, ctx.Y, ctx.Positioned = state.X, state.Y, true
+		}
+	}
+
+	host := &roomScriptHost{room: r, client: client}
+	for _, t := range triggers {
+		if err := t.Run(host, ctx); err != nil {
+			log.Println("Error running script:", err)
+		}
+	}
+}
+
+// runTimers fires "every" triggers whose interval boundary was crossed by the
+// room's script clock during this step.
+func (r *Room) runTimers(set *script.Set, before, after int64) {
+	for _, t := range set.On(script.EventEvery) {
+		interval := int64(t.Interval)
+		if before/interval != after/interval {
+			r.runScripts([]*script.Trigger{t}, nil, "")
+		}
+	}
+}
+
+type roomScriptHost struct {
+	room   *Room
+	client *Client
+}
+
+func (h *roomScriptHost) Say(text string) {
+	chat := protocol.ChatMessage{Channel: protocol.ChannelZone, From: "server", Text: text}
+	h.room.broadcast(protocol.Line(protocol.KindChat, protocol.EncodeChat(chat)))
+}
+
+func (h *roomScriptHost) Tell(text string) {
+	if h.client == nil {
+		return
+	}
+	chat := protocol.ChatMessage{Channel: protocol.ChannelZone, From: "server", Text: text}
+	h.client.Send(protocol.Line(protocol.KindChat, protocol.EncodeChat(chat)))
+}
+
+func (h *roomScriptHost) Announce(text string) {
+	h.room.announce(protocol.FeedEvent{Kind: protocol.FeedAnnounce, Text: text})
+}
+
+func (h *roomScriptHost) Spawn(kind, name string, x, y float64) {
+	if kind != protocol.EntityNPC && kind != protocol.EntityItem && kind != protocol.EntityResource && kind != protocol.EntityDoor && kind != protocol.EntityVehicle {
+		log.Printf("Script spawned unknown entity kind %q", kind)
+		return
+	}
+	entity := protocol.Entity{ID: h.room.scripts.newEntityID(), Kind: kind, Name: name, X: x, Y: y}
+	h.room.handle(roomMessage{kind: roomSpawn, entity: entity})
+}
+
+func (h *roomScriptHost) Despawn(name string) {
+	if e := h.room.entityByName(name); e != nil {
+		h.room.handle(roomMessage{kind: roomDespawn, entity: *e})
+	}
+}
+
+// Wander steps the named entity in a random direction, keeping it within
+// radius of where it was spawned. Entities a player owns are theirs to
+// move.
+func (h *roomScriptHost) Wander(name string, radius float64) {
+	e := h.room.entityByName(name)
+	if e == nil || e.Owner != protocol.OwnerServer {
+		return
+	}
+	home := h.room.homes[e.ID]
+	angle := h.room.rng.Float64() * 2 * math.Pi
+	step := radius / 2
+	x, y := e.X+math.Cos(angle)*step, e.Y+math.Sin(angle)*step
+	if d := math.Hypot(x-home.X, y-home.Y); d > radius {
+		x = home.X + (x-home.X)*radius/d
+		y = home.Y + (y-home.Y)*radius/d
+	}
+	e.X, e.Y = x, y
+	h.room.carry(e)
+	h.room.broadcast(protocol.Line(protocol.KindSpawn, protocol.EncodeEntity(*e)))
+}
+
+func (h *roomScriptHost) Teleport(x, y float64) {
+	if h.client != nil {
+		h.room.teleport(h.client, x, y)
+	}
+}
+
+func (h *roomScriptHost) Warp(room string, x, y float64) {
+	if h.client != nil {
+		h.client.RequestWarp(Warp{Room: room, X: x, Y: y})
+	}
+}
+
+func (h *roomScriptHost) SetWeather(name string) error {
+	weather, ok := protocol.ParseWeather(name)
+	if !ok {
+		return fmt.Errorf("unknown weather %q", name)
+	}
+	h.room.weather.Set(weather)
+	return nil
+}
+
+func (h *roomScriptHost) AddScore(points int) {
+	if h.client != nil {
+		h.client.updateProfile(func(p *Profile) { p.Stats.Score += points })
+	}
+}
+
+func (h *roomScriptHost) ApplyEffect(kind string, seconds float64) error {
+	if h.client == nil {
+		return nil
+	}
+	return h.room.applyEffect(h.client, kind, seconds)
+}
+
+func (h *roomScriptHost) Rand(n int) int {
+	return h.room.rng.Intn(n) + 1
+}
+
+func (r *Room) entityByName(name string) *protocol.Entity {
+	for _, e := range r.entities {
+		if e.Name == name {
+			return e
+		}
+	}
+	return nil
+}
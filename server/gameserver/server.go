@@ -0,0 +1,724 @@
+package gameserver
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"darkzone/MultiTestServer/protocol"
+	"darkzone/MultiTestServer/script"
+)
+
+const (
+	profileSaveInterval = time.Minute
+	scriptPollInterval  = 2 * time.Second
+)
+
+type Config struct {
+	BandwidthCap int64
+	TickRate     int
+	Profiles     ProfileStore
+	ScriptDir    string
+	MaxPlayers   int
+	// World, when set, bounds every room: reported positions are clamped to
+	// the map and refused inside solid tiles.
+	World *WorldMap
+	// WorldFile, when set, is where room state is saved periodically and
+	// restored from on start.
+	WorldFile string
+	// Zones, when set, runs the server as the zone at ZoneAddr behind a
+	// gateway: it only simulates the rooms the map assigns to it, hands
+	// players off for the rest and only accepts connections that present
+	// ZoneSecret.
+	Zones      *ZoneMap
+	ZoneAddr   string
+	ZoneSecret string
+	// Broker, when set, shares global chat and presence with every other
+	// server instance connected to it.
+	Broker Broker
+	// Voice, when set, is the UDP socket proximity voice chat is relayed
+	// through. Voice is not available behind a gateway.
+	Voice *net.UDPConn
+	// IdleAfter marks players idle after that long without input, and
+	// IdleKick disconnects them; zero turns either off.
+	IdleAfter time.Duration
+	IdleKick  time.Duration
+	// MapDocument, when set, is the map the accounts on MapEditors can
+	// edit together live from the client's map editor.
+	MapDocument *MapDocument
+	MapEditors  *Whitelist
+	// Events, when set, records joins, leaves, kicks, mutes, chat, deaths
+	// and completed quests.
+	Events *EventLog
+	// ChatRate is how many chat lines per second a player may keep sending
+	// after a burst of chatBurst; zero turns the limit off. ChatFilter, when
+	// set, screens every line.
+	ChatRate   float64
+	ChatFilter ChatFilter
+	// Quests, when set, are offered by the NPCs named as their givers,
+	// Dialogues give NPCs something to say when players talk to them and
+	// Vendors turn NPCs into shops. Recipes are what players can craft,
+	// Resources what they gather from resource nodes and Doors the locks
+	// on door entities.
+	Quests    *QuestBook
+	Dialogues *DialogueBook
+	Vendors   *VendorBook
+	Recipes   *RecipeBook
+	Resources *ResourceBook
+	Doors     *DoorBook
+	// Modes, when set, are the kinds of match players can queue for.
+	Modes *ModeBook
+	// Lighting, when set, is how lit each room is by day and night.
+	Lighting *LightBook
+	// VisionRadius, when not zero, is how far players see, hiding the
+	// rest of the map under fog of war.
+	VisionRadius float64
+	// MOTDFile, when set, is the message of the day players are shown as
+	// they connect: a title line, then the text. The console reloads it.
+	MOTDFile string
+	// Whitelist, when set, keeps the server to the accounts listed in it
+	// while it is on.
+	Whitelist *Whitelist
+	// Deterministic, when set, seeds every room and fixes its clock, and
+	// leaves the rooms to be stepped by hand; see Simulation.
+	Deterministic *Determinism
+}
+
+type Server struct {
+	clients      map[net.Conn]*Client
+	rooms        map[string]*Room
+	mu           sync.Mutex
+	nextID       int
+	nextEntity   int
+	bandwidthCap int64
+	tickRate     int
+	profiles     ProfileStore
+	scripts      *scriptRuntime
+	scriptDir    string
+	maxPlayers   int
+	world        *WorldMap
+	worldFile    string
+	zones        *ZoneMap
+	zoneAddr     string
+	zoneSecret   string
+	broker       Broker
+	instance     string
+	remote       map[string]remoteInstance
+	voice        *net.UDPConn
+	voiceTokens  map[string]*Client
+	idleAfter    time.Duration
+	idleKick     time.Duration
+	mapDoc       *MapDocument
+	mapEditors   *Whitelist
+	events       *EventLog
+	chatRate     float64
+	chatFilter   ChatFilter
+	quests       *QuestBook
+	dialogues    *DialogueBook
+	vendors      *VendorBook
+	recipes      *RecipeBook
+	resources    *ResourceBook
+	doors        *DoorBook
+	modes        *ModeBook
+	lighting     *LightBook
+	vision       float64
+	motdFile     string
+	motd         atomic.Pointer[protocol.MOTD]
+	whitelist    *Whitelist
+	chatCommands map[string]ChatCommand
+	mutes        map[string]time.Time
+	partyInvites map[*Client]*Client
+	started      time.Time
+	ready        atomic.Bool
+	listening    atomic.Int32
+	active       int
+	queue        []*queuedClient
+	// matchQueue is every player waiting for a match, and nextMatch
+	// numbers the match rooms.
+	matchQueue map[*Client]*queuedPlayer
+	nextMatch  int
+	// determinism is set when the rooms are stepped by a simulation.
+	determinism *Determinism
+}
+
+func NewServer(cfg Config) *Server {
+	if cfg.TickRate <= 0 {
+		cfg.TickRate = DefaultTickRate
+	}
+	if cfg.Profiles == nil {
+		cfg.Profiles = NewMemoryProfileStore()
+	}
+	s := &Server{
+		clients:      make(map[net.Conn]*Client),
+		rooms:        make(map[string]*Room),
+		bandwidthCap: cfg.BandwidthCap,
+		tickRate:     cfg.TickRate,
+		profiles:     cfg.Profiles,
+		scriptDir:    cfg.ScriptDir,
+		maxPlayers:   cfg.MaxPlayers,
+		world:        cfg.World,
+		worldFile:    cfg.WorldFile,
+		zones:        cfg.Zones,
+		zoneAddr:     cfg.ZoneAddr,
+		zoneSecret:   cfg.ZoneSecret,
+		broker:       cfg.Broker,
+		instance:     newInstanceID(),
+		remote:       make(map[string]remoteInstance),
+		voice:        cfg.Voice,
+		voiceTokens:  make(map[string]*Client),
+		idleAfter:    cfg.IdleAfter,
+		idleKick:     cfg.IdleKick,
+		mapDoc:       cfg.MapDocument,
+		mapEditors:   cfg.MapEditors,
+		events:       cfg.Events,
+		chatRate:     cfg.ChatRate,
+		chatFilter:   cfg.ChatFilter,
+		quests:       cfg.Quests,
+		dialogues:    cfg.Dialogues,
+		vendors:      cfg.Vendors,
+		recipes:      cfg.Recipes,
+		resources:    cfg.Resources,
+		doors:        cfg.Doors,
+		modes:        cfg.Modes,
+		lighting:     cfg.Lighting,
+		vision:       cfg.VisionRadius,
+		motdFile:     cfg.MOTDFile,
+		whitelist:    cfg.Whitelist,
+		mutes:        make(map[string]time.Time),
+		partyInvites: make(map[*Client]*Client),
+		chatCommands: make(map[string]ChatCommand),
+		matchQueue:   make(map[*Client]*queuedPlayer),
+		started:      time.Now(),
+		determinism:  cfg.Deterministic,
+	}
+	s.scripts = &scriptRuntime{newEntityID: s.newEntityID}
+	s.registerChatCommands()
+	return s
+}
+
+func (s *Server) room(name string) *Room {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.roomLocked(name)
+}
+
+// roomLocked is room for callers already holding s.mu.
+func (s *Server) roomLocked(name string) *Room {
+	room, ok := s.rooms[name]
+	if !ok {
+		room = NewRoom(name, s.tickRate, s.scripts, s.world)
+		room.events = s.events
+		room.quests = s.quests
+		room.dialogues = s.dialogues
+		room.vendors = s.vendors
+		room.recipes = s.recipes
+		room.resources = s.resources
+		room.doors = s.doors
+		room.ambient = s.lighting.ambient(name)
+		room.vision = s.vision
+		s.rooms[name] = room
+		if s.determinism != nil {
+			room.makeDeterministic(s.determinism)
+		} else {
+			room.stop = make(chan struct{})
+			go room.Run(room.stop)
+		}
+	}
+	return room
+}
+
+// enterRoom moves the client to the room they asked for by name. Anyone
+// may join a room that is open; opening one takes an account, a valid name
+// and a free slot under maxPlayerRooms.
+func (s *Server) enterRoom(client *Client, name string) error {
+	s.mu.Lock()
+	room, ok := s.rooms[name]
+	if !ok {
+		var err error
+		switch {
+		case !client.Can(actionCreateRoom):
+			err = errors.New("guests can only join existing rooms")
+		case !validName(name):
+			err = fmt.Errorf("invalid room name %q", name)
+		case s.playerRoomCount() >= maxPlayerRooms:
+			err = errors.New("too many rooms are open; join one of them instead")
+		}
+		if err != nil {
+			s.mu.Unlock()
+			return err
+		}
+		room = s.roomLocked(name)
+		room.playerMade = true
+	}
+	previous := client.room
+	client.room = room
+	s.mu.Unlock()
+
+	s.switchRooms(client, previous, room)
+	return nil
+}
+
+// playerRoomCount is how many rooms players have opened. It must be called
+// with s.mu held.
+func (s *Server) playerRoomCount() int {
+	n := 0
+	for _, room := range s.rooms {
+		if room.playerMade {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *Server) closeRoomsEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		s.closeRooms(now)
+	}
+}
+
+// closeRooms stops and forgets every match room whose match is over, and
+// every room a player opened that has been empty for emptyRoomTimeout,
+// once nobody is left in it or on their way there.
+func (s *Server) closeRooms(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for name, room := range s.rooms {
+		if room.PlayerCount() > 0 || s.anyoneBoundFor(room) {
+			room.emptySince = time.Time{}
+			continue
+		}
+		if room.emptySince.IsZero() {
+			room.emptySince = now
+		}
+		if !room.finished.Load() && !(room.playerMade && now.Sub(room.emptySince) >= emptyRoomTimeout) {
+			continue
+		}
+		delete(s.rooms, name)
+		if room.stop != nil {
+			close(room.stop)
+		}
+		log.Printf("Closed %s", name)
+	}
+}
+
+// anyoneBoundFor reports whether a client is in the room or has been moved
+// to it and not yet joined. It must be called with s.mu held.
+func (s *Server) anyoneBoundFor(room *Room) bool {
+	for _, c := range s.clients {
+		if c.room == room {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) newEntityID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextEntity++
+	return fmt.Sprintf("e%d", s.nextEntity)
+}
+
+func (s *Server) findClient(id string) *Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, c := range s.clients {
+		if c.id == id {
+			return c
+		}
+	}
+	return nil
+}
+
+func (s *Server) snapshotRooms() []*Room {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rooms := make([]*Room, 0, len(s.rooms))
+	for _, r := range s.rooms {
+		rooms = append(rooms, r)
+	}
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].name < rooms[j].name })
+	return rooms
+}
+
+// moveToRoom hands the client over from its current room to the named one.
+// Only the client's reader goroutine calls it, so the leave always reaches the
+// old room before the join reaches the new one.
+func (s *Server) moveToRoom(client *Client, name string) {
+	s.mu.Lock()
+	room := s.roomLocked(name)
+	previous := client.room
+	client.room = room
+	s.mu.Unlock()
+
+	s.switchRooms(client, previous, room)
+}
+
+// switchRooms tells the room the client was in, if any, that they left and
+// the one they are now in that they joined.
+func (s *Server) switchRooms(client *Client, previous, room *Room) {
+	if previous == room {
+		return
+	}
+	if previous != nil {
+		previous.Send(roomMessage{kind: roomLeave, client: client})
+	}
+	room.Send(roomMessage{kind: roomJoin, client: client})
+}
+
+func (s *Server) HandleConn(rawConn net.Conn) {
+	conn := newMeteredConn(rawConn, s.bandwidthCap)
+	defer conn.Close()
+
+	s.mu.Lock()
+	s.nextID++
+	client := &Client{
+		id:        fmt.Sprintf("player%d", s.nextID),
+		conn:      conn,
+		send:      make(chan string, clientSendQueue),
+		done:      make(chan struct{}),
+		warpTo:    make(chan Warp, clientWarpQueue),
+		connected: time.Now(),
+	}
+	s.mu.Unlock()
+	client.markActive()
+
+	go client.writeLoop()
+	defer close(client.done)
+
+	lines := readLines(conn)
+	var resume *protocol.Resume
+	if s.zones != nil {
+		r, ok := s.acceptGateway(lines)
+		if !ok {
+			log.Printf("Refused %s: not a gateway connection", conn.RemoteAddr())
+			return
+		}
+		resume = r
+	}
+	pending, ok := s.waitForSlot(client, lines)
+	if !ok {
+		return
+	}
+	defer s.releaseSlot()
+
+	s.mu.Lock()
+	s.clients[conn] = client
+	s.mu.Unlock()
+
+	client.Send(protocol.Line(protocol.KindWelcome, client.id))
+	if s.voice != nil {
+		s.offerVoice(client)
+		defer s.forgetVoice(client)
+	}
+	if s.mapDoc != nil {
+		defer s.mapDoc.leave(client)
+	}
+	defer s.leaveParty(client)
+	defer s.leaveMatchQueue(client)
+	if resume == nil {
+		s.sendMOTD(client)
+		s.moveToRoom(client, defaultRoom)
+	} else if err := s.resume(client, *resume); err != nil {
+		log.Printf("Handoff of %s failed: %v", resume.Character, err)
+		client.Send(protocol.Line(protocol.KindError, err.Error()))
+		s.moveToRoom(client, defaultRoom)
+	}
+
+	for _, message := range pending {
+		s.handleMessage(client, message)
+	}
+	for open := true; open; {
+		select {
+		case message, ok := <-lines:
+			if open = ok; ok {
+				s.handleMessage(client, message)
+			}
+		case w := <-client.warpTo:
+			s.warp(client, w)
+		}
+	}
+
+	s.mu.Lock()
+	delete(s.clients, conn)
+	room := client.room
+	s.mu.Unlock()
+
+	left := make(chan struct{})
+	room.Send(roomMessage{kind: roomLeave, client: client, done: left})
+	<-left
+	// A player handed off to another zone has no profile here and is still
+	// in the game.
+	client.mu.Lock()
+	playing := client.profile != nil
+	client.mu.Unlock()
+	if playing {
+		s.announce(protocol.FeedEvent{Kind: protocol.FeedLeft, Player: client.Name()})
+	}
+	s.saveProfile(client)
+}
+
+// readLines reads the connection on its own goroutine, so a client can be
+// watched for disconnects while it waits in the login queue. The channel is
+// closed when the connection fails or closes.
+func readLines(conn io.Reader) <-chan string {
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		reader := bufio.NewReader(conn)
+		for {
+			message, err := protocol.ReadLine(reader)
+			if err != nil {
+				log.Println("Error reading from client:", err)
+				return
+			}
+			lines <- message
+		}
+	}()
+	return lines
+}
+
+func (s *Server) handleMessage(client *Client, message string) {
+	kind, payload := protocol.Split(message)
+	// State and clock messages are sent on a timer, so only state that
+	// changes counts as input.
+	if kind != protocol.KindState && kind != protocol.KindClock {
+		client.markActive()
+	}
+	switch kind {
+	case protocol.KindState:
+		state, err := protocol.DecodeState(payload)
+		if err != nil {
+			log.Printf("Bad state from %s: %v", client.id, err)
+			return
+		}
+		state.ID = client.id
+		if client.reportChanged(state) {
+			client.markActive()
+		}
+		client.room.Send(roomMessage{kind: roomState, client: client, state: state})
+	case protocol.KindRoom:
+		if payload == "" {
+			return
+		}
+		if !s.hostsRoom(payload) {
+			if !validName(payload) {
+				client.Send(protocol.Line(protocol.KindError, fmt.Sprintf("invalid room name %q", payload)))
+				return
+			}
+			s.handoffInPlace(client, payload)
+			return
+		}
+		if err := s.enterRoom(client, payload); err != nil {
+			client.Send(protocol.Line(protocol.KindError, err.Error()))
+		}
+	case protocol.KindClock:
+		clientTime, _, err := protocol.DecodeClock(payload)
+		if err != nil {
+			log.Printf("Bad clock request from %s: %v", client.id, err)
+			return
+		}
+		client.Send(protocol.Line(protocol.KindClock, protocol.EncodeClock(clientTime, time.Now().UnixMilli())))
+	case protocol.KindAck:
+		if err := client.handleAck(payload); err != nil {
+			log.Printf("Bad ack from %s: %v", client.id, err)
+		}
+	case protocol.KindChat:
+		s.handleChat(client, payload)
+	case protocol.KindLogin:
+		if err := s.login(client, payload); err != nil {
+			log.Printf("Login failed for %s: %v", client.id, err)
+			client.Send(protocol.Line(protocol.KindError, err.Error()))
+		}
+	case protocol.KindCharacterCreate, protocol.KindCharacterDelete, protocol.KindCharacterSelect:
+		s.handleCharacterMessage(client, kind, payload)
+	case protocol.KindMapJoin, protocol.KindMapEdit, protocol.KindMapCursor, protocol.KindMapSave:
+		s.handleMapMessage(client, kind, payload)
+	case protocol.KindPartyInvite, protocol.KindPartyAccept, protocol.KindPartyLeave:
+		s.handlePartyMessage(client, kind, payload)
+	case protocol.KindMatchQueue:
+		s.handleMatchQueue(client, payload)
+	case protocol.KindInteract:
+		client.room.Send(roomMessage{kind: roomInteract, client: client, entity: protocol.Entity{ID: payload}})
+	case protocol.KindEntityMove:
+		id, x, y, err := protocol.DecodeEntityMove(payload)
+		if err != nil {
+			log.Printf("Bad entity move from %s: %v", client.id, err)
+			return
+		}
+		client.room.Send(roomMessage{kind: roomEntityMove, client: client, entity: protocol.Entity{ID: id, X: x, Y: y}})
+	case protocol.KindQuestAccept:
+		client.room.Send(roomMessage{kind: roomQuestAccept, client: client, quest: payload})
+	case protocol.KindDialogueChoice:
+		choice, err := strconv.Atoi(payload)
+		if err != nil {
+			log.Printf("Bad dialogue choice from %s: %v", client.id, err)
+			return
+		}
+		client.room.Send(roomMessage{kind: roomDialogueChoice, client: client, choice: choice})
+	case protocol.KindShopBuy:
+		client.room.Send(roomMessage{kind: roomShopBuy, client: client, item: payload})
+	case protocol.KindShopSell:
+		client.room.Send(roomMessage{kind: roomShopSell, client: client, item: payload})
+	case protocol.KindShopClose:
+		client.room.Send(roomMessage{kind: roomShopClose, client: client})
+	case protocol.KindCraft:
+		client.room.Send(roomMessage{kind: roomCraft, client: client, item: payload})
+	case protocol.KindGather:
+		client.room.Send(roomMessage{kind: roomGather, client: client, entity: protocol.Entity{ID: payload}})
+	case protocol.KindVoiceKey:
+		s.acceptVoiceKey(client, payload)
+	case protocol.KindDash:
+		dx, dy, err := protocol.DecodeDash(payload)
+		if err != nil {
+			log.Println("Error decoding dash:", err)
+			return
+		}
+		client.room.Send(roomMessage{kind: roomDash, client: client, state: protocol.PlayerState{VX: dx, VY: dy}})
+	case protocol.KindPause:
+		if payload != protocol.PauseOn && payload != protocol.PauseOff {
+			client.Send(protocol.Line(protocol.KindError, fmt.Sprintf("pause takes %s or %s", protocol.PauseOn, protocol.PauseOff)))
+			return
+		}
+		client.room.Send(roomMessage{kind: roomPause, client: client, item: payload})
+	case protocol.KindTarget:
+		client.room.Send(roomMessage{kind: roomTarget, client: client, item: payload})
+	case protocol.KindMount:
+		client.room.Send(roomMessage{kind: roomMount, client: client, item: payload})
+	case protocol.KindGuest:
+		s.joinAsGuest(client)
+	case protocol.KindSession:
+		s.recordSession(client, payload)
+	case protocol.KindLeaderboard:
+		if err := s.sendLeaderboard(client, payload); err != nil {
+			client.Send(protocol.Line(protocol.KindError, err.Error()))
+		}
+	}
+}
+
+// handleChat routes a chat line by channel. Local and zone chat stay inside
+// the sender's room; global chat is fanned out to every room's inbox.
+func (s *Server) handleChat(client *Client, input string) {
+	if s.runChatCommand(client, input) {
+		return
+	}
+	channel, text := protocol.ParseChatInput(input)
+	if text == "" {
+		return
+	}
+	if channel == protocol.ChannelGlobal && !client.Can(actionGlobalChat) {
+		client.Send(protocol.Line(protocol.KindError, "guests cannot use global chat"))
+		return
+	}
+	text, ok := s.moderateChat(client, text)
+	if !ok {
+		return
+	}
+	client.chatLines++
+	s.events.Write(Event{Type: eventChat, Player: client.Name(), Room: client.room.name, Channel: channel, Text: text})
+	msg := roomMessage{
+		kind:   roomChat,
+		client: client,
+		chat:   protocol.ChatMessage{Channel: channel, From: client.id, Text: text},
+	}
+
+	if channel != protocol.ChannelGlobal {
+		client.room.Send(msg)
+		return
+	}
+	for _, room := range s.snapshotRooms() {
+		room.Send(msg)
+	}
+	if s.broker != nil {
+		s.publishChat(msg.chat)
+	}
+}
+
+// Start creates the default room so the server is ready before the first
+// client arrives, begins saving profiles periodically and, when a script
+// directory is configured, loads the scripts and watches them for changes.
+// With a world file, the saved rooms are restored and saved periodically;
+// with a broker, the server joins the other instances' chat and presence.
+func (s *Server) Start() error {
+	if s.scriptDir != "" {
+		set, err := script.LoadDir(s.scriptDir)
+		if err != nil {
+			return err
+		}
+		log.Printf("Loaded %d script triggers from %s", set.Len(), s.scriptDir)
+		s.scripts.set.Store(set)
+		go script.Watch(s.scriptDir, scriptPollInterval, s.scripts.set.Store)
+	}
+	if s.motdFile != "" {
+		if _, err := s.ReloadMOTD(); err != nil {
+			return err
+		}
+	}
+	if s.worldFile != "" {
+		save, err := LoadWorldSave(s.worldFile)
+		switch {
+		case err == nil:
+			s.restoreWorld(save)
+			log.Printf("Restored %d rooms from %s", len(save.Rooms), s.worldFile)
+		case !errors.Is(err, os.ErrNotExist):
+			return err
+		}
+		go s.saveWorldEvery(worldSaveInterval)
+	}
+	if s.broker != nil {
+		if err := s.startBroker(); err != nil {
+			return err
+		}
+	}
+	if s.hostsRoom(defaultRoom) {
+		s.room(defaultRoom)
+	}
+	if s.voice != nil {
+		go s.ServeVoice()
+	}
+	if s.idleAfter > 0 || s.idleKick > 0 {
+		go s.checkIdleEvery(idleCheckInterval)
+	}
+	go s.saveProfilesEvery(profileSaveInterval)
+	go s.sendPartiesEvery(partyUpdateInterval)
+	if s.modes != nil {
+		go s.matchEvery(matchInterval)
+	}
+	go s.closeRoomsEvery(roomCloseInterval)
+	s.ready.Store(true)
+	return nil
+}
+
+func (s *Server) Serve(listener net.Listener) {
+	s.listening.Add(1)
+	defer s.listening.Add(-1)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Println("Error accepting connection:", err)
+			continue
+		}
+		go s.HandleConn(conn)
+	}
+}
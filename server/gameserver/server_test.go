@@ -0,0 +1,119 @@
+package gameserver
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+// pipeClient connects to the server the way the client's offline mode does,
+// over an in-memory pipe, and reads what the server sends in the background:
+// a pipe blocks the writer until the line is read.
+func pipeClient(t *testing.T, s *Server) (net.Conn, <-chan string) {
+	t.Helper()
+	clientConn, serverConn := net.Pipe()
+	go s.HandleConn(serverConn)
+	t.Cleanup(func() { clientConn.Close() })
+
+	lines := make(chan string, 256)
+	go func() {
+		defer close(lines)
+		reader := bufio.NewReader(clientConn)
+		for {
+			line, err := protocol.ReadLine(reader)
+			if err != nil {
+				return
+			}
+			lines <- line
+		}
+	}()
+	return clientConn, lines
+}
+
+// waitFor returns the payload of the first line of the given kind that
+// match accepts, failing the test if none comes within a few seconds.
+func waitFor(t *testing.T, lines <-chan string, kind string, match func(payload string) bool) string {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatalf("connection closed waiting for %s", kind)
+			}
+			if k, payload := protocol.Split(line); k == kind && match(payload) {
+				return payload
+			}
+		case <-timeout:
+			t.Fatalf("no %s within the timeout", kind)
+		}
+	}
+}
+
+func TestOfflineJoinMoveSnapshot(t *testing.T) {
+	s := NewServer(Config{})
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	conn, lines := pipeClient(t, s)
+
+	id := waitFor(t, lines, protocol.KindWelcome, func(string) bool { return true })
+
+	report := protocol.PlayerState{X: 410, Y: 300, VX: 120, Direction: 1, Anim: protocol.AnimWalk}
+	if _, err := fmt.Fprint(conn, protocol.Line(protocol.KindState, protocol.EncodeState(report))); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, lines, protocol.KindSnapshot, func(payload string) bool {
+		snap, err := protocol.DecodeSnapshot(payload)
+		if err != nil {
+			t.Fatalf("decoding snapshot: %v", err)
+		}
+		for _, p := range snap.Players {
+			if p.ID == id && p.X == report.X && p.Y == report.Y {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func TestPlayerRoomsAreCappedAndClosed(t *testing.T) {
+	s := NewServer(Config{})
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	conn, lines := pipeClient(t, s)
+	fmt.Fprint(conn, protocol.Line(protocol.KindLogin, protocol.EncodeLogin("Tester", "correct horse")))
+	waitFor(t, lines, protocol.KindLogin, func(string) bool { return true })
+
+	for i := 0; i <= maxPlayerRooms; i++ {
+		fmt.Fprint(conn, protocol.Line(protocol.KindRoom, fmt.Sprintf("room%d", i)))
+	}
+	waitFor(t, lines, protocol.KindError, func(payload string) bool { return strings.Contains(payload, "too many rooms") })
+
+	// Every room but the lobby and the one the player is in closes once it
+	// has been empty long enough; rooms empty out as their leaves arrive.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		now := time.Now()
+		s.closeRooms(now)
+		s.closeRooms(now.Add(emptyRoomTimeout))
+		var open []string
+		for _, room := range s.snapshotRooms() {
+			open = append(open, room.name)
+		}
+		if want := []string{defaultRoom, fmt.Sprintf("room%d", maxPlayerRooms-1)}; slices.Equal(open, want) {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatalf("rooms %v are open, want %v", open, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
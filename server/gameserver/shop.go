@@ -0,0 +1,138 @@
+package gameserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+// Vendor is what a vendor NPC trades. Items with a zero Buy price are not
+// sold, and ones with a zero Sell price are not bought back.
+type Vendor struct {
+	Items []protocol.ShopItem `json:"items"`
+}
+
+func (v *Vendor) item(name string) (protocol.ShopItem, bool) {
+	for _, item := range v.Items {
+		if item.Item == name {
+			return item, true
+		}
+	}
+	return protocol.ShopItem{}, false
+}
+
+// VendorBook holds the vendors loaded from a shop file, a JSON object
+// mapping NPC names to what they trade. A nil VendorBook has no vendors.
+type VendorBook struct {
+	byNPC map[string]*Vendor
+}
+
+func LoadVendorBook(path string) (*VendorBook, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b := &VendorBook{}
+	if err := json.Unmarshal(data, &b.byNPC); err != nil {
+		return nil, fmt.Errorf("parsing shops %s: %w", path, err)
+	}
+	for npc, v := range b.byNPC {
+		for _, item := range v.Items {
+			if item.Item == "" || item.Buy < 0 || item.Sell < 0 {
+				return nil, fmt.Errorf("shops %s: %s sells an item without a name or with a negative price", path, npc)
+			}
+		}
+	}
+	return b, nil
+}
+
+func (b *VendorBook) vendor(npc string) *Vendor {
+	if b == nil {
+		return nil
+	}
+	return b.byNPC[npc]
+}
+
+// openShop shows the player the NPC's shop, returning false when the NPC is
+// not a vendor.
+func (r *Room) openShop(c *Client, e *protocol.Entity) bool {
+	if r.vendors.vendor(e.Name) == nil {
+		return false
+	}
+	r.shopping[c] = e.ID
+	r.sendShop(c, e.Name)
+	return true
+}
+
+func (r *Room) sendShop(c *Client, npc string) {
+	shop := protocol.Shop{NPC: npc}
+	c.updateProfile(func(p *Profile) {
+		shop.Gold = p.Stats.Gold
+		for _, item := range r.vendors.vendor(npc).Items {
+			item.Owned = p.Inventory[item.Item]
+			shop.Items = append(shop.Items, item)
+		}
+	})
+	c.Send(protocol.Line(protocol.KindShop, protocol.EncodeShop(shop)))
+}
+
+func (r *Room) closeShop(c *Client) {
+	if _, ok := r.shopping[c]; ok {
+		delete(r.shopping, c)
+		c.Send(protocol.Line(protocol.KindShop, ""))
+	}
+}
+
+// trade buys or sells one of an item at the vendor the player has open,
+// checking the price against their gold or the item against their inventory.
+// Guests may browse but not trade.
+func (r *Room) trade(c *Client, name string, buy bool) {
+	if !c.Can(actionTrade) {
+		c.Send(protocol.Line(protocol.KindError, "guests cannot trade"))
+		return
+	}
+	id, ok := r.shopping[c]
+	if !ok {
+		return
+	}
+	e := r.entities[id]
+	if e == nil || !r.withinReach(c, e) {
+		r.closeShop(c)
+		return
+	}
+	item, ok := r.vendors.vendor(e.Name).item(name)
+	var err error
+	switch {
+	case !ok || buy && item.Buy == 0:
+		err = fmt.Errorf("%s does not sell %s", e.Name, name)
+	case !buy && item.Sell == 0:
+		err = fmt.Errorf("%s does not buy %s", e.Name, name)
+	}
+	if err == nil {
+		c.updateProfile(func(p *Profile) {
+			switch {
+			case buy && p.Stats.Gold < item.Buy:
+				err = fmt.Errorf("%s costs %d gold", name, item.Buy)
+			case buy:
+				p.Stats.Gold -= item.Buy
+				p.Inventory[name]++
+			case p.Inventory[name] <= 0:
+				err = fmt.Errorf("you have no %s to sell", name)
+			default:
+				p.Stats.Gold += item.Sell
+				p.Inventory[name]--
+			}
+		})
+	}
+	if err != nil {
+		c.Send(protocol.Line(protocol.KindError, err.Error()))
+		return
+	}
+	r.sendShop(c, e.Name)
+	c.sendInventory()
+	if buy {
+		r.advanceQuests(c, func(Objective) bool { return false })
+	}
+}
@@ -0,0 +1,227 @@
+package gameserver
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"darkzone/MultiTestServer/script"
+)
+
+// simulationEpoch is when every simulation's clock starts.
+var simulationEpoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Simulation drives a server's rooms by hand, tick by tick, on a clock that
+// only moves when they do, so scripted input always plays out the same way
+// and the world it leaves behind can be checked against a known hash.
+// Players join without a connection; what the server sends them is thrown
+// away. They are not listed among the server's clients, so whispers,
+// parties and the like cannot find them.
+type Simulation struct {
+	server  *Server
+	now     time.Time
+	tick    time.Duration
+	ticks   int
+	clients map[string]*Client
+}
+
+// NewSimulation sets up a server from cfg whose rooms are seeded from seed.
+// Scripts in cfg.ScriptDir are loaded once and not watched.
+func NewSimulation(cfg Config, seed int64) (*Simulation, error) {
+	sim := &Simulation{now: simulationEpoch, clients: make(map[string]*Client)}
+	cfg.Deterministic = &Determinism{Seed: seed, Clock: func() time.Time { return sim.now }}
+	sim.server = NewServer(cfg)
+	sim.tick = time.Second / time.Duration(sim.server.tickRate)
+	if cfg.ScriptDir != "" {
+		set, err := script.LoadDir(cfg.ScriptDir)
+		if err != nil {
+			return nil, err
+		}
+		sim.server.scripts.set.Store(set)
+	}
+	return sim, nil
+}
+
+// Join brings a player with the given ID into the named room, logged in
+// under the ID as their name.
+func (sim *Simulation) Join(id, room string) error {
+	if _, ok := sim.clients[id]; ok {
+		return fmt.Errorf("%s has already joined", id)
+	}
+	c := &Client{
+		id:      id,
+		name:    id,
+		profile: NewProfile(id),
+		send:    make(chan string, clientSendQueue),
+		done:    make(chan struct{}),
+		warpTo:  make(chan Warp, clientWarpQueue),
+	}
+	sim.clients[id] = c
+	sim.server.moveToRoom(c, room)
+	return nil
+}
+
+// Input handles a protocol line as if the player had sent it, taking
+// effect on the next tick.
+func (sim *Simulation) Input(id, line string) error {
+	c, ok := sim.clients[id]
+	if !ok {
+		return fmt.Errorf("%s has not joined", id)
+	}
+	sim.server.handleMessage(c, line)
+	return nil
+}
+
+// Step runs n ticks: each moves the clock on by a tick, hands out any
+// warps, then steps every room in order of name.
+func (sim *Simulation) Step(n int) {
+	for range n {
+		sim.now = sim.now.Add(sim.tick)
+		sim.ticks++
+		for _, id := range sim.clientIDs() {
+			c := sim.clients[id]
+			select {
+			case w := <-c.warpTo:
+				sim.server.warp(c, w)
+			default:
+			}
+		}
+		for _, room := range sim.server.snapshotRooms() {
+			room.step(sim.tick)
+		}
+		for _, c := range sim.clients {
+			for len(c.send) > 0 {
+				<-c.send
+			}
+		}
+	}
+}
+
+func (sim *Simulation) clientIDs() []string {
+	ids := make([]string, 0, len(sim.clients))
+	for id := range sim.clients {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Dump is the state of every room as of the last tick, as DumpState
+// writes it. Input sent since is not in it until the next.
+func (sim *Simulation) Dump() StateDump {
+	dump := StateDump{Taken: sim.now}
+	for _, room := range sim.server.snapshotRooms() {
+		dump.Rooms = append(dump.Rooms, room.dump())
+	}
+	sim.server.mu.Lock()
+	dump.NextEntity = sim.server.nextEntity
+	sim.server.mu.Unlock()
+	return dump
+}
+
+// Hash identifies the simulation's state, as of its last tick.
+func (sim *Simulation) Hash() string {
+	data, _ := json.Marshal(sim.Dump())
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// RunFixture plays the simulation fixture at path against a server set up
+// from cfg and checks every hash it expects. A fixture is a list of
+// commands, one per line, and comments starting with #:
+//
+//	seed 42                    seed the rooms; only before anything else
+//	join player1 lobby         bring a player into a room (lobby if none)
+//	send player1 state,{...}   have a player send a protocol line
+//	run 30                     step the simulation 30 ticks
+//	expect 3f0c9d1e2a4b5c6d    check the state hashes to this
+//
+// An expect with no hash only prints the hash, for writing new fixtures.
+// It returns an error at the first line that fails or does not match.
+func RunFixture(cfg Config, path string, report func(string)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	seed := int64(1)
+	var sim *Simulation
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if fields[0] == "seed" {
+			if sim != nil || len(fields) != 2 {
+				return fmt.Errorf("%s:%d: seed must come first, with one number", path, lineNo)
+			}
+			if seed, err = strconv.ParseInt(fields[1], 10, 64); err != nil {
+				return fmt.Errorf("%s:%d: %w", path, lineNo, err)
+			}
+			continue
+		}
+		if sim == nil {
+			if sim, err = NewSimulation(cfg, seed); err != nil {
+				return err
+			}
+		}
+		if err := sim.runCommand(fields, line, path, report); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+	}
+	return scanner.Err()
+}
+
+func (sim *Simulation) runCommand(fields []string, line, path string, report func(string)) error {
+	switch fields[0] {
+	case "join":
+		if len(fields) < 2 {
+			return errors.New("join needs a player")
+		}
+		room := defaultRoom
+		if len(fields) > 2 {
+			room = fields[2]
+		}
+		return sim.Join(fields[1], room)
+	case "send":
+		if len(fields) < 3 {
+			return errors.New("send needs a player and a line")
+		}
+		// The line is everything after the player, spaces and all.
+		_, rest, _ := strings.Cut(line, " ")
+		_, rest, _ = strings.Cut(strings.TrimSpace(rest), " ")
+		return sim.Input(fields[1], strings.TrimSpace(rest))
+	case "run":
+		if len(fields) < 2 {
+			return errors.New("run needs a number of ticks")
+		}
+		n, err := strconv.Atoi(fields[1])
+		if err != nil || n < 0 {
+			return errors.New("run needs a number of ticks")
+		}
+		sim.Step(n)
+	case "expect":
+		got := sim.Hash()
+		if len(fields) < 2 {
+			report(fmt.Sprintf("%s: tick %d hashes to %s", path, sim.ticks, got))
+			return nil
+		}
+		if got != fields[1] {
+			return fmt.Errorf("tick %d hashes to %s, expected %s", sim.ticks, got, fields[1])
+		}
+	default:
+		return fmt.Errorf("unknown command %q", fields[0])
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package gameserver
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestSimulationFixtures plays every fixture in the fixtures directory, as
+// recorded: without a map or any other data files.
+func TestSimulationFixtures(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("..", "fixtures", "*.sim"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no simulation fixtures found")
+	}
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			if err := RunFixture(Config{}, path, func(s string) { t.Log(s) }); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package gameserver
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// maxSnapshotDivisor is as far as a struggling client's snapshots are
+	// cut: to one every this many ticks.
+	maxSnapshotDivisor = 4
+	// A client is congested once this many messages wait in its send queue
+	// or its acks arrive this late, and healthy again below the lower
+	// marks.
+	congestedQueue   = clientSendQueue / 4
+	congestedLatency = 300 * time.Millisecond
+	healthyQueue     = 2
+	healthyLatency   = 150 * time.Millisecond
+	// snapshotRateCooldown is how long after a change the rate may drop
+	// again, and snapshotRateHold how long a client must stay healthy for
+	// it to go back up a step.
+	snapshotRateCooldown = time.Second
+	snapshotRateHold     = 3 * time.Second
+	// ackSmoothing is the weight each new ack has in the smoothed latency.
+	ackSmoothing = 0.25
+)
+
+// snapshotPacer adapts how often a client is sent snapshots to what its
+// connection keeps up with, halving the rate while the client is congested
+// and doubling it back once it has been healthy for a while, so a weak
+// connection sees choppier movement rather than a full queue and dropped
+// messages.
+type snapshotPacer struct {
+	// divisor is read by the metrics handler; everything else only by the
+	// room goroutine.
+	divisor      atomic.Int32
+	skipped      int
+	changed      time.Time
+	healthySince time.Time
+}
+
+// Divisor is how many ticks the client waits between snapshots.
+func (p *snapshotPacer) Divisor() int {
+	return max(int(p.divisor.Load()), 1)
+}
+
+// due adjusts the client's rate to how far behind it is and reports
+// whether it gets a snapshot this tick.
+func (p *snapshotPacer) due(c *Client, now time.Time) bool {
+	divisor := p.Divisor()
+	queued := len(c.send)
+	latency := time.Duration(c.ackLatency.Load())
+	switch {
+	case queued >= congestedQueue || latency >= congestedLatency:
+		p.healthySince = time.Time{}
+		if divisor < maxSnapshotDivisor && now.Sub(p.changed) >= snapshotRateCooldown {
+			divisor *= 2
+			p.changed = now
+			log.Printf("Slowed snapshots for %s to 1 in %d ticks (%d queued, acks %v late)", c.id, divisor, queued, latency.Round(time.Millisecond))
+		}
+	case queued <= healthyQueue && latency < healthyLatency:
+		if p.healthySince.IsZero() {
+			p.healthySince = now
+		}
+		if divisor > 1 && now.Sub(p.healthySince) >= snapshotRateHold {
+			divisor /= 2
+			p.changed, p.healthySince = now, now
+			log.Printf("Sped snapshots for %s back up to 1 in %d ticks", c.id, divisor)
+		}
+	default:
+		p.healthySince = time.Time{}
+	}
+	p.divisor.Store(int32(divisor))
+
+	p.skipped++
+	if p.skipped < divisor {
+		return false
+	}
+	p.skipped = 0
+	return true
+}
+
+// handleAck folds how long ago the acknowledged snapshot was sent into the
+// client's smoothed ack latency.
+func (c *Client) handleAck(payload string) error {
+	sent, err := strconv.ParseInt(payload, 10, 64)
+	if err != nil {
+		return fmt.Errorf("ack time: %w", err)
+	}
+	latency := max(time.Since(time.UnixMilli(sent)), 0)
+	if previous := time.Duration(c.ackLatency.Load()); previous > 0 {
+		latency = previous + time.Duration(float64(latency-previous)*ackSmoothing)
+	}
+	c.ackLatency.Store(int64(latency))
+	return nil
+}
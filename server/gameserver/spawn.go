@@ -0,0 +1,57 @@
+package gameserver
+
+import "darkzone/MultiTestServer/protocol"
+
+// spawnClearance is how close another player may stand to a spawn point
+// before it counts as taken.
+const spawnClearance = 48.0
+
+// SpawnPoint is a map position players enter the world and respawn at.
+type SpawnPoint struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// spawnPoints lists the map's spawn points, or the default one when the
+// server runs without a map or the map defines none.
+func (r *Room) spawnPoints() []SpawnPoint {
+	if r.world == nil || len(r.world.Spawns) == 0 {
+		return []SpawnPoint{{spawnX, spawnY}}
+	}
+	return r.world.Spawns
+}
+
+// pickSpawn chooses a random spawn point for c, preferring ones no other
+// player is standing on. When every point is taken it still returns one,
+// since a crowded spawn beats none.
+func (r *Room) pickSpawn(c *Client) (x, y float64) {
+	points := r.spawnPoints()
+	for _, i := range r.rng.Perm(len(points)) {
+		p := points[i]
+		if r.world != nil && r.world.Solid(p.X, p.Y) {
+			continue
+		}
+		taken := false
+		r.grid.Near(p.X, p.Y, spawnClearance, func(other *Client, _ *protocol.PlayerState) {
+			taken = taken || other != c
+		})
+		if !taken {
+			return p.X, p.Y
+		}
+	}
+	p := points[r.rng.Intn(len(points))]
+	return p.X, p.Y
+}
+
+// respawn moves c to a freshly picked spawn point at full health, free of
+// status effects.
+func (r *Room) respawn(c *Client) {
+	c.health.Store(protocol.MaxHealth)
+	r.clearEffects(c)
+	delete(r.dead, c)
+	if state := r.players[c]; state != nil && state.Anim == protocol.AnimDead {
+		state.Anim = protocol.AnimIdle
+	}
+	x, y := r.pickSpawn(c)
+	r.teleport(c, x, y)
+}
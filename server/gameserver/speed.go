@@ -0,0 +1,61 @@
+package gameserver
+
+import (
+	"math"
+	"time"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+const (
+	// speedTolerance is how much faster than they may the server lets
+	// players move, for the jitter in when their reports arrive.
+	speedTolerance = 1.25
+	// maxMoveBurst is how many seconds of movement a player can save up,
+	// for reports that arrive bunched together after a stall.
+	maxMoveBurst = 1.0
+)
+
+// moveBudget is how far a player may still move before their next report,
+// as of at.
+type moveBudget struct {
+	distance float64
+	at       time.Time
+}
+
+// maxSpeed is the fastest the player may move where they stand: walking
+// on its terrain, sped up or slowed down by their mount and effects.
+func (r *Room) maxSpeed(c *Client, state *protocol.PlayerState, now time.Time) float64 {
+	effects := r.statusOf(c, now).Effects
+	return protocol.WalkSpeed * r.terrainAt(state.X, state.Y).Speed() * protocol.MountSpeed(r.mounts[c]) * protocol.SpeedFactor(effects)
+}
+
+// limitSpeed holds a reported move to what the player could have covered
+// since their last report, stopping it short along the way when it goes
+// farther. The budget refills at the player's top speed, with some
+// tolerance, up to maxMoveBurst of movement. Every player is placed by a
+// teleport as they enter the room, so even their first report has a
+// previous state to be checked against.
+func (r *Room) limitSpeed(c *Client, x, y float64, now time.Time) (float64, float64) {
+	prev := r.players[c]
+	if prev == nil {
+		return x, y
+	}
+	speed := r.maxSpeed(c, prev, now) * speedTolerance
+	budget := r.budgets[c]
+	if budget == nil {
+		budget = &moveBudget{distance: speed * maxMoveBurst, at: now}
+		r.budgets[c] = budget
+	}
+	budget.distance = math.Min(budget.distance+speed*now.Sub(budget.at).Seconds(), speed*maxMoveBurst)
+	budget.at = now
+
+	d := math.Hypot(x-prev.X, y-prev.Y)
+	if d <= budget.distance {
+		budget.distance -= d
+		return x, y
+	}
+	t := budget.distance / d
+	budget.distance = 0
+	return prev.X + (x-prev.X)*t, prev.Y + (y-prev.Y)*t
+}
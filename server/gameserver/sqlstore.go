@@ -0,0 +1,352 @@
+package gameserver
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// A migration moves the profile database on by one schema version. The
+// version a database is at is kept in its schema_version table, and
+// opening a store applies every migration past it in order, each in its own
+// transaction. New columns and tables go in a new migration at the end;
+// released ones are never edited.
+type migration struct {
+	// probe succeeds on a database whose schema already includes the
+	// migration. It places databases from before schema_version existed.
+	probe string
+	up    string
+}
+
+var profileMigrations = []migration{
+	{
+		probe: `SELECT name FROM profiles LIMIT 0`,
+		up: `
+CREATE TABLE profiles (
+	name         TEXT PRIMARY KEY,
+	appearance   TEXT NOT NULL,
+	room         TEXT NOT NULL,
+	x            REAL NOT NULL,
+	y            REAL NOT NULL,
+	kills        INTEGER NOT NULL DEFAULT 0,
+	deaths       INTEGER NOT NULL DEFAULT 0,
+	play_seconds INTEGER NOT NULL DEFAULT 0,
+	distance     REAL NOT NULL DEFAULT 0,
+	chats_sent   INTEGER NOT NULL DEFAULT 0
+);
+CREATE TABLE inventory (
+	name  TEXT NOT NULL REFERENCES profiles(name) ON DELETE CASCADE,
+	item  TEXT NOT NULL,
+	count INTEGER NOT NULL,
+	PRIMARY KEY (name, item)
+);`,
+	},
+	{
+		// Characters belong to accounts: each existing profile becomes the
+		// single character of an account with the same name.
+		probe: `SELECT account FROM profiles LIMIT 0`,
+		up: `
+ALTER TABLE profiles ADD COLUMN account TEXT NOT NULL DEFAULT '';
+UPDATE profiles SET account = name WHERE account = '';
+CREATE INDEX profiles_account ON profiles(account);`,
+	},
+	{
+		probe: `SELECT score FROM profiles LIMIT 0`,
+		up: `
+ALTER TABLE profiles ADD COLUMN score INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX profiles_score ON profiles(score);`,
+	},
+	{
+		probe: `SELECT xp FROM profiles LIMIT 0`,
+		up:    `ALTER TABLE profiles ADD COLUMN xp INTEGER NOT NULL DEFAULT 0;`,
+	},
+	{
+		probe: `SELECT quest FROM quests LIMIT 0`,
+		up: `
+CREATE TABLE quests (
+	name  TEXT NOT NULL REFERENCES profiles(name) ON DELETE CASCADE,
+	quest TEXT NOT NULL,
+	step  INTEGER NOT NULL,
+	PRIMARY KEY (name, quest)
+);`,
+	},
+	{
+		probe: `SELECT gold FROM profiles LIMIT 0`,
+		up:    `ALTER TABLE profiles ADD COLUMN gold INTEGER NOT NULL DEFAULT 0;`,
+	},
+	{
+		// Everyone starts at baseRating.
+		probe: `SELECT rating FROM profiles LIMIT 0`,
+		up:    `ALTER TABLE profiles ADD COLUMN rating INTEGER NOT NULL DEFAULT 1000;`,
+	},
+	{
+		// Accounts that already have characters get a row on their next
+		// login, with the password it gave.
+		probe: `SELECT password_hash FROM accounts LIMIT 0`,
+		up: `
+CREATE TABLE accounts (
+	name          TEXT PRIMARY KEY,
+	password_hash BLOB NOT NULL
+);`,
+	},
+}
+
+// SQLProfileStore keeps profiles in a SQL database. It is written against
+// SQLite but only uses database/sql, so the driver is chosen by the caller
+// (see sqlite.go in the server command).
+type SQLProfileStore struct {
+	db *sql.DB
+}
+
+func OpenSQLProfileStore(driver, dsn string) (*SQLProfileStore, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrate(db, profileMigrations); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrating profile database: %w", err)
+	}
+	return &SQLProfileStore{db: db}, nil
+}
+
+// migrate brings the database up to the last of migrations.
+func migrate(db *sql.DB, migrations []migration) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (version INTEGER NOT NULL)`); err != nil {
+		return err
+	}
+	version := 0
+	err := db.QueryRow(`SELECT version FROM schema_version`).Scan(&version)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		// Either a fresh database or one that predates schema_version,
+		// which is at the last migration whose changes it already has.
+		for version < len(migrations) {
+			if _, err := db.Exec(migrations[version].probe); err != nil {
+				break
+			}
+			version++
+		}
+		if _, err := db.Exec(`INSERT INTO schema_version (version) VALUES (?)`, version); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("database is at schema version %d, newer than this server's %d", version, len(migrations))
+	}
+
+	for ; version < len(migrations); version++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[version].up); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("to version %d: %w", version+1, err)
+		}
+		if _, err := tx.Exec(`UPDATE schema_version SET version = ?`, version+1); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLProfileStore) Load(name string) (*Profile, error) {
+	p := &Profile{Name: name, Inventory: make(map[string]int), Quests: make(map[string]int)}
+	row := s.db.QueryRow(`SELECT account, appearance, room, x, y, score, kills, deaths, play_seconds, distance, chats_sent, xp, gold, rating
+		FROM profiles WHERE name = ?`, name)
+	err := row.Scan(&p.Account, &p.Appearance, &p.Room, &p.X, &p.Y,
+		&p.Stats.Score, &p.Stats.Kills, &p.Stats.Deaths, &p.Stats.PlaySeconds, &p.Stats.Distance, &p.Stats.ChatsSent, &p.Stats.XP, &p.Stats.Gold, &p.Stats.Rating)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoProfile
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`SELECT item, count FROM inventory WHERE name = ?`, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item string
+		var count int
+		if err := rows.Scan(&item, &count); err != nil {
+			return nil, err
+		}
+		p.Inventory[item] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	quests, err := s.db.Query(`SELECT quest, step FROM quests WHERE name = ?`, name)
+	if err != nil {
+		return nil, err
+	}
+	defer quests.Close()
+	for quests.Next() {
+		var quest string
+		var step int
+		if err := quests.Scan(&quest, &step); err != nil {
+			return nil, err
+		}
+		p.Quests[quest] = step
+	}
+	return p, quests.Err()
+}
+
+func (s *SQLProfileStore) List(account string) ([]*Profile, error) {
+	return s.loadAll(`SELECT name FROM profiles WHERE account = ? ORDER BY name`, account)
+}
+
+// loadAll runs a query selecting profile names and loads each profile.
+func (s *SQLProfileStore) loadAll(query string, args ...any) ([]*Profile, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	profiles := make([]*Profile, 0, len(names))
+	for _, name := range names {
+		p, err := s.Load(name)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, nil
+}
+
+// leaderboardColumns maps LeaderboardStats names to their columns; only these
+// are ever interpolated into a query.
+var leaderboardColumns = map[string]string{
+	"score":    "score",
+	"kills":    "kills",
+	"deaths":   "deaths",
+	"playtime": "play_seconds",
+	"distance": "distance",
+	"chats":    "chats_sent",
+	"xp":       "xp",
+	"gold":     "gold",
+	"rating":   "rating",
+}
+
+func (s *SQLProfileStore) Top(stat string, n int) ([]*Profile, error) {
+	column, ok := leaderboardColumns[stat]
+	if !ok {
+		return nil, fmt.Errorf("unknown stat %q", stat)
+	}
+	return s.loadAll(`SELECT name FROM profiles ORDER BY `+column+` DESC, name LIMIT ?`, n)
+}
+
+func (s *SQLProfileStore) Delete(name string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM inventory WHERE name = ?`, name); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM quests WHERE name = ?`, name); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM profiles WHERE name = ?`, name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLProfileStore) Save(p *Profile) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO profiles (name, account, appearance, room, x, y, score, kills, deaths, play_seconds, distance, chats_sent, xp, gold, rating)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET
+			account = excluded.account, appearance = excluded.appearance, room = excluded.room, x = excluded.x, y = excluded.y,
+			score = excluded.score, kills = excluded.kills, deaths = excluded.deaths, play_seconds = excluded.play_seconds,
+			distance = excluded.distance, chats_sent = excluded.chats_sent, xp = excluded.xp, gold = excluded.gold,
+			rating = excluded.rating`,
+		p.Name, p.Account, p.Appearance, p.Room, p.X, p.Y,
+		p.Stats.Score, p.Stats.Kills, p.Stats.Deaths, p.Stats.PlaySeconds, p.Stats.Distance, p.Stats.ChatsSent, p.Stats.XP, p.Stats.Gold, p.Stats.Rating)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM inventory WHERE name = ?`, p.Name); err != nil {
+		return err
+	}
+	for item, count := range p.Inventory {
+		if count <= 0 {
+			continue
+		}
+		if _, err := tx.Exec(`INSERT INTO inventory (name, item, count) VALUES (?, ?, ?)`, p.Name, item, count); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM quests WHERE name = ?`, p.Name); err != nil {
+		return err
+	}
+	for quest, step := range p.Quests {
+		if _, err := tx.Exec(`INSERT INTO quests (name, quest, step) VALUES (?, ?, ?)`, p.Name, quest, step); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLProfileStore) LoadAccount(name string) (*Account, error) {
+	a := &Account{Name: name}
+	err := s.db.QueryRow(`SELECT password_hash FROM accounts WHERE name = ?`, name).Scan(&a.PasswordHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoAccount
+	}
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (s *SQLProfileStore) CreateAccount(a *Account) error {
+	result, err := s.db.Exec(`INSERT OR IGNORE INTO accounts (name, password_hash) VALUES (?, ?)`, a.Name, a.PasswordHash)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrAccountExists
+	}
+	return nil
+}
+
+func (s *SQLProfileStore) Close() error {
+	return s.db.Close()
+}
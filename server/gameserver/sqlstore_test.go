@@ -0,0 +1,75 @@
+package gameserver
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestSQLProfileStoreRoundTrip(t *testing.T) {
+	store, err := OpenSQLProfileStore("sqlite", filepath.Join(t.TempDir(), "profiles.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	p := NewProfile("Hero")
+	p.Account = "player"
+	p.Stats.Gold = 12
+	p.Stats.Rating = 1040
+	p.Inventory["potion"] = 3
+	p.Quests["rats"] = 2
+	if err := store.Save(p); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.Load("Hero")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Account != "player" || got.Stats.Gold != 12 || got.Stats.Rating != 1040 || got.Inventory["potion"] != 3 || got.Quests["rats"] != 2 {
+		t.Errorf("loaded %+v, saved %+v", got, p)
+	}
+	if _, err := store.Load("Nobody"); err != ErrNoProfile {
+		t.Errorf("loading a missing profile: %v, want ErrNoProfile", err)
+	}
+}
+
+// TestMigrateUnversionedDatabase opens a database from before
+// schema_version, as the first SQLite store left it, and checks it is
+// brought up to date without losing its profiles.
+func TestMigrateUnversionedDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profiles.db")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(profileMigrations[0].up); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO profiles (name, appearance, room, x, y, kills) VALUES ('Old', 'default', 'lobby', 1, 2, 5)`); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	store, err := OpenSQLProfileStore("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	var version int
+	if err := store.db.QueryRow(`SELECT version FROM schema_version`).Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	if version != len(profileMigrations) {
+		t.Errorf("at schema version %d, want %d", version, len(profileMigrations))
+	}
+	p, err := store.Load("Old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Account != "Old" || p.Stats.Kills != 5 || p.Stats.Rating != baseRating {
+		t.Errorf("migrated profile is %+v", p)
+	}
+}
@@ -0,0 +1,281 @@
+package gameserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+// StateDump is the authoritative state of the world at one moment, for
+// debugging: everything a world save holds plus what lives only in memory,
+// like where players stand. Everything in it is sorted, so two dumps of the
+// same state are byte for byte the same and diff cleanly.
+type StateDump struct {
+	Taken      time.Time  `json:"taken"`
+	NextEntity int        `json:"nextEntity"`
+	Rooms      []RoomDump `json:"rooms"`
+}
+
+type RoomDump struct {
+	RoomSave
+	Ambient   protocol.Ambient `json:"ambient"`
+	OpenDoors []string         `json:"openDoors"`
+	Match     *MatchDump       `json:"match,omitempty"`
+	Players   []PlayerDump     `json:"players"`
+}
+
+type MatchDump struct {
+	Mode  string `json:"mode"`
+	Phase string `json:"phase"`
+	Round int    `json:"round"`
+}
+
+type PlayerDump struct {
+	ID      string             `json:"id"`
+	Name    string             `json:"name"`
+	X       float64            `json:"x"`
+	Y       float64            `json:"y"`
+	Anim    protocol.AnimState `json:"anim"`
+	Health  int                `json:"health"`
+	Dead    bool               `json:"dead"`
+	Effects []string           `json:"effects"`
+	Target  string             `json:"target,omitempty"`
+}
+
+func (r *Room) dump() RoomDump {
+	dump := RoomDump{RoomSave: r.save(), Ambient: r.ambient}
+	sort.Slice(dump.Entities, func(i, j int) bool { return dump.Entities[i].ID < dump.Entities[j].ID })
+	for id, open := range r.openDoors {
+		if open {
+			dump.OpenDoors = append(dump.OpenDoors, id)
+		}
+	}
+	sort.Strings(dump.OpenDoors)
+	if r.match != nil {
+		dump.Match = &MatchDump{Mode: r.match.mode, Phase: r.match.phase, Round: r.match.round}
+	}
+	for client, state := range r.players {
+		_, dead := r.dead[client]
+		player := PlayerDump{
+			ID:     client.id,
+			Name:   client.Name(),
+			Health: int(client.health.Load()),
+			Dead:   dead,
+		}
+		// Players who have not reported a state yet have no position.
+		if state != nil {
+			player.X, player.Y, player.Anim = state.X, state.Y, state.Anim
+		}
+		for _, effect := range r.effects[client] {
+			player.Effects = append(player.Effects, fmt.Sprintf("%s x%d", effect.kind, effect.stacks))
+		}
+		sort.Strings(player.Effects)
+		if target := r.targets[client]; target != nil {
+			player.Target = target.id
+		}
+		dump.Players = append(dump.Players, player)
+	}
+	sort.Slice(dump.Players, func(i, j int) bool { return dump.Players[i].ID < dump.Players[j].ID })
+	return dump
+}
+
+// DumpState collects every room's state from its own goroutine and writes
+// it to path as indented JSON.
+func (s *Server) DumpState(path string) error {
+	dump := StateDump{Taken: time.Now()}
+	for _, room := range s.snapshotRooms() {
+		dumped := make(chan RoomDump, 1)
+		room.Send(roomMessage{kind: roomDump, dumped: dumped})
+		dump.Rooms = append(dump.Rooms, <-dumped)
+	}
+	sort.Slice(dump.Rooms, func(i, j int) bool { return dump.Rooms[i].Name < dump.Rooms[j].Name })
+	s.mu.Lock()
+	dump.NextEntity = s.nextEntity
+	s.mu.Unlock()
+
+	data, err := json.MarshalIndent(dump, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// DiffStates writes the differences between two state dumps, or world
+// saves, to out, one per line: "-" for what only a has, "+" for what only
+// b has and "~" for values that changed. Lists of things with IDs or names
+// are matched up by them, so a despawned entity shows as one removal
+// rather than every later entity changing. It returns how many differences
+// there were.
+func DiffStates(a, b string, out io.Writer) (int, error) {
+	before, err := readStateDump(a)
+	if err != nil {
+		return 0, err
+	}
+	after, err := readStateDump(b)
+	if err != nil {
+		return 0, err
+	}
+	return diffValues("", before, after, out), nil
+}
+
+// readStateDump reads a dump, or a world save with its header line, as
+// generic JSON.
+func readStateDump(path string) (any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(data, []byte(worldSaveMagic)) {
+		_, data, _ = bytes.Cut(data, []byte("\n"))
+	}
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return v, nil
+}
+
+func diffValues(path string, a, b any, out io.Writer) int {
+	// Empty lists are written as null.
+	if _, ok := b.([]any); ok && a == nil {
+		a = []any{}
+	}
+	if _, ok := a.([]any); ok && b == nil {
+		b = []any{}
+	}
+	switch a := a.(type) {
+	case map[string]any:
+		if b, ok := b.(map[string]any); ok {
+			return diffObjects(path, a, b, out)
+		}
+	case []any:
+		if b, ok := b.([]any); ok {
+			return diffLists(path, a, b, out)
+		}
+	}
+	if reflect.DeepEqual(a, b) {
+		return 0
+	}
+	fmt.Fprintf(out, "~ %s: %s -> %s\n", path, compactJSON(a), compactJSON(b))
+	return 1
+}
+
+func diffObjects(path string, a, b map[string]any, out io.Writer) int {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	n := 0
+	for _, k := range keys {
+		av, inA := a[k]
+		bv, inB := b[k]
+		sub := k
+		if path != "" {
+			sub = path + "." + k
+		}
+		switch {
+		case !inB:
+			fmt.Fprintf(out, "- %s: %s\n", sub, compactJSON(av))
+			n++
+		case !inA:
+			fmt.Fprintf(out, "+ %s: %s\n", sub, compactJSON(bv))
+			n++
+		default:
+			n += diffValues(sub, av, bv, out)
+		}
+	}
+	return n
+}
+
+// diffLists compares lists by the key of each element, when every element
+// has one, and by position otherwise.
+func diffLists(path string, a, b []any, out io.Writer) int {
+	aKeys, aKeyed := listKeys(a)
+	bKeys, bKeyed := listKeys(b)
+	if !aKeyed || !bKeyed {
+		n := 0
+		for i := range max(len(a), len(b)) {
+			sub := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(b):
+				fmt.Fprintf(out, "- %s: %s\n", sub, compactJSON(a[i]))
+				n++
+			case i >= len(a):
+				fmt.Fprintf(out, "+ %s: %s\n", sub, compactJSON(b[i]))
+				n++
+			default:
+				n += diffValues(sub, a[i], b[i], out)
+			}
+		}
+		return n
+	}
+
+	inB := make(map[string]any, len(b))
+	for i, k := range bKeys {
+		inB[k] = b[i]
+	}
+	n := 0
+	for i, k := range aKeys {
+		sub := fmt.Sprintf("%s[%s]", path, k)
+		if bv, ok := inB[k]; ok {
+			n += diffValues(sub, a[i], bv, out)
+		} else {
+			fmt.Fprintf(out, "- %s: %s\n", sub, compactJSON(a[i]))
+			n++
+		}
+	}
+	for i, k := range bKeys {
+		if !slices.Contains(aKeys, k) {
+			fmt.Fprintf(out, "+ %s[%s]: %s\n", path, k, compactJSON(b[i]))
+			n++
+		}
+	}
+	return n
+}
+
+// listKeys is the "id", or failing that "name", of each element of list,
+// false unless every element has a distinct one.
+func listKeys(list []any) ([]string, bool) {
+	keys := make([]string, 0, len(list))
+	seen := make(map[string]bool, len(list))
+	for _, v := range list {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		key, ok := obj["id"].(string)
+		if !ok {
+			key, ok = obj["name"].(string)
+		}
+		if !ok || seen[key] {
+			return nil, false
+		}
+		seen[key] = true
+		keys = append(keys, key)
+	}
+	return keys, true
+}
+
+func compactJSON(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,135 @@
+package gameserver
+
+import (
+	"fmt"
+	"time"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+// effectRule is how an effect stacks and what it does over time. Applying
+// an effect a player already has adds a stack, up to maxStacks, and
+// refreshes its duration if the new one runs longer. Effects with a tick
+// deal damage per stack every tick while they last.
+type effectRule struct {
+	maxStacks int
+	tick      time.Duration
+	damage    int32
+}
+
+var effectRules = map[string]effectRule{
+	protocol.EffectSpeed:        {maxStacks: 1},
+	protocol.EffectSlow:         {maxStacks: 1},
+	protocol.EffectPoison:       {maxStacks: 3, tick: time.Second, damage: 4},
+	protocol.EffectInvulnerable: {maxStacks: 1},
+}
+
+// statusEffect is one effect on a player. Effects belong to the room, so
+// changing rooms leaves them behind.
+type statusEffect struct {
+	kind     string
+	stacks   int
+	expires  time.Time
+	nextTick time.Time
+}
+
+// applyEffect puts the effect on the player for seconds, or stacks it on the
+// one they already have.
+func (r *Room) applyEffect(c *Client, kind string, seconds float64) error {
+	rule, ok := effectRules[kind]
+	if !ok {
+		return fmt.Errorf("unknown effect %q", kind)
+	}
+	if _, ok := r.players[c]; !ok {
+		return fmt.Errorf("%s is not in %s", c.Name(), r.name)
+	}
+	now := r.clock()
+	expires := now.Add(durationOf(seconds))
+	for _, e := range r.effects[c] {
+		if e.kind == kind {
+			e.stacks = min(e.stacks+1, rule.maxStacks)
+			if expires.After(e.expires) {
+				e.expires = expires
+			}
+			r.broadcastEffects(c)
+			return nil
+		}
+	}
+	r.effects[c] = append(r.effects[c], &statusEffect{kind: kind, stacks: 1, expires: expires, nextTick: now.Add(rule.tick)})
+	r.broadcastEffects(c)
+	return nil
+}
+
+// clearEffects removes every effect from the player, as when they die.
+func (r *Room) clearEffects(c *Client) {
+	if len(r.effects[c]) == 0 {
+		return
+	}
+	delete(r.effects, c)
+	r.broadcastEffects(c)
+}
+
+// tickEffects deals damage from ticking effects and drops the ones that
+// have worn off.
+func (r *Room) tickEffects(now time.Time) {
+players:
+	for _, c := range inOrder(r.effects) {
+		effects, ok := r.effects[c]
+		if !ok {
+			continue
+		}
+		changed := false
+		kept := effects[:0]
+		for _, e := range effects {
+			rule := effectRules[e.kind]
+			for rule.tick > 0 && !now.Before(e.nextTick) && e.nextTick.Before(e.expires) {
+				e.nextTick = e.nextTick.Add(rule.tick)
+				if c.health.Add(-rule.damage*int32(e.stacks)) <= 0 {
+					r.succumb(c, e.kind)
+					continue players
+				}
+			}
+			if now.Before(e.expires) {
+				kept = append(kept, e)
+			} else {
+				changed = true
+			}
+		}
+		r.effects[c] = kept
+		if changed {
+			if len(kept) == 0 {
+				delete(r.effects, c)
+			}
+			r.broadcastEffects(c)
+		}
+	}
+}
+
+// succumb kills a player whose health an effect emptied, which clears
+// their effects.
+func (r *Room) succumb(c *Client, kind string) {
+	c.updateProfile(func(p *Profile) { p.Stats.Deaths++ })
+	r.events.Write(Event{Type: eventDeath, Player: c.Name(), Room: r.name, Other: kind})
+	r.announce(protocol.FeedEvent{Kind: protocol.FeedSuccumbed, Player: c.Name(), Other: kind})
+	r.kill(c, nil, kind)
+}
+
+func (r *Room) broadcastEffects(c *Client) {
+	r.broadcast(protocol.Line(protocol.KindStatus, protocol.EncodeStatusEffects(r.statusOf(c, r.clock()))))
+}
+
+func (r *Room) statusOf(c *Client, now time.Time) protocol.StatusEffects {
+	status := protocol.StatusEffects{Player: c.id}
+	for _, e := range r.effects[c] {
+		status.Effects = append(status.Effects, protocol.StatusEffect{Kind: e.kind, Seconds: e.expires.Sub(now).Seconds(), Stacks: e.stacks})
+	}
+	return status
+}
+
+// sendEffects tells a player entering the room about everyone's effects.
+func (r *Room) sendEffects(to *Client) {
+	now := r.clock()
+	for c := range r.effects {
+		to.Send(protocol.Line(protocol.KindStatus, protocol.EncodeStatusEffects(r.statusOf(c, now))))
+	}
+}
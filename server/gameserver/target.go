@@ -0,0 +1,44 @@
+package gameserver
+
+import "darkzone/MultiTestServer/protocol"
+
+// setTarget records the player c has picked out by ID, or clears it for an
+// empty ID. Only players in line of sight can be picked out.
+func (r *Room) setTarget(c *Client, id string) {
+	if id == "" {
+		delete(r.targets, c)
+		return
+	}
+	target := r.playerByID(id)
+	switch target {
+	case nil:
+		c.Send(protocol.Line(protocol.KindError, "no such player here"))
+	case c:
+		c.Send(protocol.Line(protocol.KindError, "cannot target yourself"))
+	default:
+		if from, to := r.players[c], r.players[target]; from != nil && to != nil && !r.lineOfSight(from.X, from.Y, to.X, to.Y) {
+			c.Send(protocol.Line(protocol.KindError, "target is out of sight"))
+			return
+		}
+		r.targets[c] = target
+	}
+}
+
+// dropTarget forgets c as anyone's target, as they leave the room.
+func (r *Room) dropTarget(c *Client) {
+	delete(r.targets, c)
+	for from, target := range r.targets {
+		if target == c {
+			delete(r.targets, from)
+		}
+	}
+}
+
+func (r *Room) playerByID(id string) *Client {
+	for c := range r.players {
+		if c.id == id {
+			return c
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package gameserver
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultTickRate   = 30
+	maxCatchUpSteps   = 5
+	maxAccumulatedLag = 250 * time.Millisecond
+)
+
+// TickLoop drives a fixed-timestep simulation. When a tick overruns it runs
+// up to maxCatchUp extra steps to catch up; any backlog beyond that (or beyond
+// maxLag) is dropped so the loop slews forward instead of spiraling.
+type TickLoop struct {
+	interval   time.Duration
+	maxCatchUp int
+	maxLag     time.Duration
+	step       func(dt time.Duration)
+
+	ticks       atomic.Int64
+	overruns    atomic.Int64
+	droppedNano atomic.Int64
+	lastTick    atomic.Int64
+}
+
+func NewTickLoop(rate int, step func(dt time.Duration)) *TickLoop {
+	t := &TickLoop{
+		interval:   time.Second / time.Duration(rate),
+		maxCatchUp: maxCatchUpSteps,
+		maxLag:     maxAccumulatedLag,
+		step:       step,
+	}
+	t.lastTick.Store(time.Now().UnixNano())
+	return t
+}
+
+func (t *TickLoop) Run(stop <-chan struct{}) {
+	last := time.Now()
+	var accumulator time.Duration
+
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		now := time.Now()
+		accumulator += now.Sub(last)
+		last = now
+
+		if accumulator > t.maxLag {
+			t.drop(accumulator - t.maxLag)
+			accumulator = t.maxLag
+		}
+
+		steps := 0
+		for accumulator >= t.interval && steps < t.maxCatchUp {
+			t.step(t.interval)
+			t.ticks.Add(1)
+			t.lastTick.Store(time.Now().UnixNano())
+			accumulator -= t.interval
+			steps++
+		}
+		if steps > 1 {
+			t.overruns.Add(1)
+		}
+		if accumulator >= t.interval {
+			backlog := accumulator - accumulator%t.interval
+			t.drop(backlog)
+			accumulator -= backlog
+		}
+
+		time.Sleep(t.interval - accumulator)
+	}
+}
+
+func (t *TickLoop) drop(d time.Duration) {
+	t.droppedNano.Add(int64(d))
+	log.Printf("Tick loop fell behind, dropped %v of simulation time", d)
+}
+
+func (t *TickLoop) Ticks() int64 {
+	return t.ticks.Load()
+}
+
+// LastTick is when the loop last completed a step, or was created.
+func (t *TickLoop) LastTick() time.Time {
+	return time.Unix(0, t.lastTick.Load())
+}
+
+func (t *TickLoop) Overruns() int64 {
+	return t.overruns.Load()
+}
+
+func (t *TickLoop) Dropped() time.Duration {
+	return time.Duration(t.droppedNano.Load())
+}
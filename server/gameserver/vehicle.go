@@ -0,0 +1,94 @@
+package gameserver
+
+import (
+	"fmt"
+	"slices"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+// board seats the player in the vehicle's first free seat, handing them the
+// vehicle when that is the driver's, or gets them out when they already
+// ride in it.
+func (r *Room) board(c *Client, e *protocol.Entity) {
+	if r.riding[c] == e.ID {
+		r.unseat(c)
+		return
+	}
+	seats := protocol.VehicleSeats[e.Name]
+	if _, dead := r.dead[c]; dead || r.riding[c] != "" || len(seats) == 0 {
+		return
+	}
+	taken := r.seats[e.ID]
+	if taken == nil {
+		taken = make([]*Client, len(seats))
+		r.seats[e.ID] = taken
+	}
+	seat := slices.Index(taken, nil)
+	if seat < 0 {
+		c.Send(protocol.Line(protocol.KindError, fmt.Sprintf("the %s is full", e.Name)))
+		return
+	}
+	taken[seat] = c
+	r.riding[c] = e.ID
+	delete(r.mounts, c)
+	delete(r.pushes, c)
+	r.broadcast(protocol.Line(protocol.KindSeat, protocol.EncodeSeat(protocol.SeatChange{Vehicle: e.ID, Seat: seat, Player: c.id})))
+	if seat == 0 {
+		r.setEntityOwner(e.ID, c)
+	}
+	r.carry(e)
+}
+
+// unseat gets the player out of whatever they ride in, where they sit. The
+// vehicle goes back to the server when its driver gets out.
+func (r *Room) unseat(c *Client) {
+	id, ok := r.riding[c]
+	if !ok {
+		return
+	}
+	delete(r.riding, c)
+	seat := slices.Index(r.seats[id], c)
+	r.seats[id][seat] = nil
+	r.broadcast(protocol.Line(protocol.KindSeat, protocol.EncodeSeat(protocol.SeatChange{Vehicle: id, Seat: seat})))
+	if seat == 0 {
+		r.setEntityOwner(id, nil)
+	}
+}
+
+// emptyVehicle gets everyone out of a vehicle about to despawn.
+func (r *Room) emptyVehicle(id string) {
+	for _, c := range r.seats[id] {
+		if c != nil {
+			r.unseat(c)
+		}
+	}
+	delete(r.seats, id)
+}
+
+// carry moves everyone aboard the vehicle to their seats.
+func (r *Room) carry(e *protocol.Entity) {
+	seats := protocol.VehicleSeats[e.Name]
+	for i, c := range r.seats[e.ID] {
+		state := r.players[c]
+		if c == nil || state == nil {
+			continue
+		}
+		x, y := e.X+seats[i].X, e.Y+seats[i].Y
+		state.X, state.Y, state.VX, state.VY = x, y, 0, 0
+		r.grid.Move(c, x, y)
+		c.updateProfile(func(p *Profile) { p.X, p.Y = x, y })
+		r.updateArea(c, x, y)
+	}
+}
+
+// sendSeats tells a player entering the room who sits where.
+func (r *Room) sendSeats(c *Client) {
+	for id, taken := range r.seats {
+		for seat, rider := range taken {
+			if rider != nil {
+				c.Send(protocol.Line(protocol.KindSeat, protocol.EncodeSeat(protocol.SeatChange{Vehicle: id, Seat: seat, Player: rider.id})))
+			}
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package gameserver
+
+import (
+	"time"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+// visionInterval is how often players are told where their party members
+// are, for their fog of war.
+const visionInterval = 250 * time.Millisecond
+
+func (r *Room) visionLine(c *Client) string {
+	vision := protocol.Vision{Radius: r.vision}
+	if p := c.party.Load(); p != nil && r.vision > 0 {
+		for _, m := range p.Members() {
+			if state := r.players[m]; state != nil && m != c {
+				vision.Allies = append(vision.Allies, [2]float64{state.X, state.Y})
+			}
+		}
+	}
+	return protocol.Line(protocol.KindVision, protocol.EncodeVision(vision))
+}
+
+// sendVision keeps each player's fog of war up to date with where their
+// party members are, when the room has one.
+func (r *Room) sendVision(now time.Time) {
+	if r.vision <= 0 || now.Before(r.nextVision) {
+		return
+	}
+	r.nextVision = now.Add(visionInterval)
+	for c := range r.players {
+		c.Send(r.visionLine(c))
+	}
+}
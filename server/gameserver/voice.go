@@ -0,0 +1,142 @@
+package gameserver
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+const (
+	voiceRadius = protocol.VoiceRadius
+	// maxVoicePacket comfortably fits one Opus voice frame plus its header.
+	maxVoicePacket = 1500
+)
+
+func newVoiceToken() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// offerVoice gives the client a voice token and tells it where to send
+// voice, with the server's half of the key exchange. The client's address
+// is learned from its first packet.
+func (s *Server) offerVoice(client *Client) {
+	key, err := protocol.NewVoiceKey()
+	if err != nil {
+		log.Println("Error making voice key:", err)
+		return
+	}
+	client.voiceToken = newVoiceToken()
+	client.voiceConn = s.voice
+	client.voiceKey = key
+	s.mu.Lock()
+	s.voiceTokens[client.voiceToken] = client
+	s.mu.Unlock()
+
+	port := s.voice.LocalAddr().(*net.UDPAddr).Port
+	client.Send(protocol.Line(protocol.KindVoice, protocol.EncodeVoiceOffer(port, client.voiceToken, protocol.EncodeVoiceKey(key))))
+}
+
+// acceptVoiceKey completes the key exchange with the client's half. Until
+// it has, the client's voice packets are dropped and none are sent to it.
+func (s *Server) acceptVoiceKey(client *Client, payload string) {
+	if client.voiceKey == nil {
+		return
+	}
+	keys, err := protocol.DeriveVoiceKeys(client.voiceKey, payload, client.voiceToken)
+	if err != nil {
+		log.Printf("Bad voice key from %s: %v", client.id, err)
+		return
+	}
+	client.voiceKeys.Store(&keys)
+}
+
+func (s *Server) forgetVoice(client *Client) {
+	s.mu.Lock()
+	delete(s.voiceTokens, client.voiceToken)
+	s.mu.Unlock()
+}
+
+// ServeVoice relays voice packets until the voice socket closes. Each frame
+// goes to the speaker's room, which forwards it to the players within
+// voiceRadius; frames are dropped rather than queued when the room is busy.
+// Packets that fail their tag, or replay one already seen, are dropped, so
+// nobody can speak as another player or take over where their voice goes.
+func (s *Server) ServeVoice() {
+	buf := make([]byte, maxVoicePacket)
+	for {
+		n, addr, err := s.voice.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Println("Error reading voice:", err)
+			continue
+		}
+		token, _, _, err := protocol.DecodeVoicePacket(buf[:n])
+		if err != nil {
+			continue
+		}
+
+		s.mu.Lock()
+		client, ok := s.voiceTokens[token]
+		var room *Room
+		if ok {
+			room = client.room
+		}
+		s.mu.Unlock()
+		if !ok {
+			continue
+		}
+		keys := client.voiceKeys.Load()
+		if keys == nil {
+			continue
+		}
+		packet, err := protocol.OpenVoicePacket(keys.Up, buf[:n])
+		if err != nil {
+			continue
+		}
+		_, seq, frame, err := protocol.DecodeVoicePacket(packet)
+		// Sequence numbers wrap.
+		if err != nil || client.voiceAddr.Load() != nil && int16(seq-client.voiceSeq) <= 0 {
+			continue
+		}
+		client.voiceSeq = seq
+		client.voiceAddr.Store(addr)
+		if len(frame) == 0 || room == nil {
+			continue
+		}
+		room.TrySend(roomMessage{kind: roomVoice, client: client, voice: protocol.EncodeVoicePacket(client.id, seq, frame)})
+	}
+}
+
+// relayVoice forwards a speaker's packet to everyone in earshot.
+func (r *Room) relayVoice(speaker *Client, packet []byte) {
+	state, ok := r.players[speaker]
+	if !ok || state == nil {
+		return
+	}
+	r.grid.Near(state.X, state.Y, voiceRadius, func(c *Client, _ *protocol.PlayerState) {
+		if c != speaker {
+			c.sendVoice(packet)
+		}
+	})
+}
+
+// sendVoice seals a voice packet for the client and writes it once the
+// client has sent one of its own, which is how the server learns its
+// address.
+func (c *Client) sendVoice(packet []byte) {
+	addr, keys := c.voiceAddr.Load(), c.voiceKeys.Load()
+	if addr == nil || keys == nil {
+		return
+	}
+	if _, err := c.voiceConn.WriteToUDP(protocol.SealVoicePacket(keys.Down, packet), addr); err != nil {
+		log.Printf("Error sending voice to %s: %v", c.id, err)
+	}
+}
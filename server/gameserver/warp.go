@@ -0,0 +1,88 @@
+package gameserver
+
+import (
+	"math"
+	"time"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+const clientWarpQueue = 4
+
+// Warp is a forced move to a position in a room, which may be the player's
+// current one.
+type Warp struct {
+	Room string  `json:"room"`
+	X    float64 `json:"x"`
+	Y    float64 `json:"y"`
+	// Spawn ignores X and Y and lands the player on one of the room's
+	// spawn points instead.
+	Spawn bool `json:"spawn,omitempty"`
+}
+
+// Portal warps any player whose reported position comes within Radius of it.
+type Portal struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Radius float64 `json:"radius"`
+	To     Warp    `json:"to"`
+}
+
+type pendingWarp struct {
+	x, y     float64
+	deadline time.Time
+}
+
+// RequestWarp queues a warp for the client's reader goroutine. It never
+// blocks, so rooms can call it from their tick; a full queue drops the warp.
+func (c *Client) RequestWarp(w Warp) bool {
+	select {
+	case c.warpTo <- w:
+		return true
+	default:
+		return false
+	}
+}
+
+// warp runs on the client's reader goroutine, so it is ordered with the
+// client's own room changes.
+func (s *Server) warp(client *Client, w Warp) {
+	if !s.hostsRoom(w.Room) {
+		s.handoff(client, w)
+		return
+	}
+	s.moveToRoom(client, w.Room)
+	if w.Spawn {
+		client.room.Send(roomMessage{kind: roomRespawn, client: client})
+		return
+	}
+	client.room.Send(roomMessage{kind: roomTeleport, client: client, state: protocol.PlayerState{X: w.X, Y: w.Y}})
+}
+
+// staleAfterWarp reports whether a state update predates the client's most
+// recent teleport, so it must not drag the player back to where it was.
+func (r *Room) staleAfterWarp(c *Client, state protocol.PlayerState) bool {
+	pending, ok := r.warping[c]
+	if !ok {
+		return false
+	}
+	if math.Hypot(state.X-pending.x, state.Y-pending.y) > warpSlack && r.clock().Before(pending.deadline) {
+		return true
+	}
+	delete(r.warping, c)
+	return false
+}
+
+func (r *Room) enterPortals(c *Client, state protocol.PlayerState) {
+	if _, warping := r.warping[c]; warping {
+		return
+	}
+	for _, p := range r.portals {
+		if math.Hypot(state.X-p.X, state.Y-p.Y) <= p.Radius && c.RequestWarp(p.To) {
+			// Ignore further reports from inside the portal until the warp
+			// lands, so one step through it warps once.
+			r.warping[c] = pendingWarp{x: p.To.X, y: p.To.Y, deadline: r.clock().Add(warpTimeout)}
+			return
+		}
+	}
+}
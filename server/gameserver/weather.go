@@ -0,0 +1,74 @@
+package gameserver
+
+import (
+	"math/rand"
+	"time"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+const (
+	minWeatherSpell = 2 * time.Minute
+	maxWeatherSpell = 6 * time.Minute
+)
+
+// weatherOdds weights how likely each state is when a spell ends.
+var weatherOdds = []struct {
+	weather protocol.Weather
+	weight  int
+}{
+	{protocol.WeatherClear, 5},
+	{protocol.WeatherRain, 2},
+	{protocol.WeatherFog, 2},
+	{protocol.WeatherSnow, 1},
+}
+
+// WeatherCycle picks a room's weather and changes it at random intervals.
+// Rooms include the current state in every snapshot, so all players in a
+// zone see the same sky.
+type WeatherCycle struct {
+	current   protocol.Weather
+	remaining time.Duration
+	rng       *rand.Rand
+}
+
+func NewWeatherCycle(rng *rand.Rand) *WeatherCycle {
+	w := &WeatherCycle{current: protocol.WeatherClear, rng: rng}
+	w.remaining = w.randomSpell()
+	return w
+}
+
+func (w *WeatherCycle) randomSpell() time.Duration {
+	return minWeatherSpell + time.Duration(w.rng.Int63n(int64(maxWeatherSpell-minWeatherSpell)))
+}
+
+func (w *WeatherCycle) Update(dt time.Duration) {
+	w.remaining -= dt
+	if w.remaining > 0 {
+		return
+	}
+
+	total := 0
+	for _, o := range weatherOdds {
+		total += o.weight
+	}
+	pick := w.rng.Intn(total)
+	for _, o := range weatherOdds {
+		if pick < o.weight {
+			w.current = o.weather
+			break
+		}
+		pick -= o.weight
+	}
+	w.remaining = w.randomSpell()
+}
+
+// Set forces a state, holding it for a full spell before the cycle resumes.
+func (w *WeatherCycle) Set(weather protocol.Weather) {
+	w.current = weather
+	w.remaining = w.randomSpell()
+}
+
+func (w *WeatherCycle) Current() protocol.Weather {
+	return w.current
+}
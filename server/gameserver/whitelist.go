@@ -0,0 +1,122 @@
+package gameserver
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// whitelistRejection is what players who are not on the whitelist are told
+// as they are turned away.
+const whitelistRejection = "This server is private. Ask an administrator to add your account to the whitelist."
+
+// Whitelist keeps a private server to the accounts listed in its file, one
+// name per line. Accounts have passwords, so the name is all it checks.
+// Names match regardless of case. It can be switched off and on, and names
+// added and removed, while the server runs; changes to the list are written
+// back to the file. The accounts allowed to edit the shared map are kept in
+// one too.
+type Whitelist struct {
+	mu      sync.Mutex
+	path    string
+	names   map[string]string
+	enabled bool
+}
+
+// LoadWhitelist reads a whitelist file, switched on. Blank lines and lines
+// starting with # are skipped, as is anything after the name, like the
+// access keys older versions kept there; a missing file is an empty list.
+func LoadWhitelist(path string) (*Whitelist, error) {
+	w := &Whitelist{path: path, names: make(map[string]string), enabled: true}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return w, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			name := strings.Fields(line)[0]
+			w.names[strings.ToLower(name)] = name
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading whitelist %s: %w", path, err)
+	}
+	return w, nil
+}
+
+// Allows reports whether the named account may join: always, while the
+// whitelist is off.
+func (w *Whitelist) Allows(name string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.enabled {
+		return true
+	}
+	_, ok := w.names[strings.ToLower(name)]
+	return ok
+}
+
+func (w *Whitelist) Enabled() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.enabled
+}
+
+func (w *Whitelist) SetEnabled(enabled bool) {
+	w.mu.Lock()
+	w.enabled = enabled
+	w.mu.Unlock()
+}
+
+// Add puts the name on the list and saves it.
+func (w *Whitelist) Add(name string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.names[strings.ToLower(name)] = name
+	return w.save()
+}
+
+// Remove takes the name off the list and saves it, reporting false when it
+// was not on it.
+func (w *Whitelist) Remove(name string) (bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	key := strings.ToLower(name)
+	if _, ok := w.names[key]; !ok {
+		return false, nil
+	}
+	delete(w.names, key)
+	return true, w.save()
+}
+
+// Names is the list, sorted.
+func (w *Whitelist) Names() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.sortedNames()
+}
+
+// save writes the list back to its file. The caller holds w.mu.
+func (w *Whitelist) save() error {
+	return os.WriteFile(w.path, []byte(strings.Join(w.sortedNames(), "\n")+"\n"), 0o644)
+}
+
+func (w *Whitelist) sortedNames() []string {
+	names := make([]string, 0, len(w.names))
+	for _, name := range w.names {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return strings.ToLower(names[i]) < strings.ToLower(names[j]) })
+	return names
+}
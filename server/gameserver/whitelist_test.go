@@ -0,0 +1,47 @@
+package gameserver
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestWhitelist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "whitelist.txt")
+	if err := os.WriteFile(path, []byte("# friends\nAlice\nCarol 3f2a9c\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	w, err := LoadWhitelist(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !w.Allows("ALICE") {
+		t.Error("refused a listed account")
+	}
+	if !w.Allows("carol") {
+		t.Error("refused an account listed with an old access key")
+	}
+	if w.Allows("Mallory") {
+		t.Error("allowed an account not on the list")
+	}
+
+	if err := w.Add("Bob"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := w.Remove("alice"); err != nil || !ok {
+		t.Fatalf("removing Alice: %v, %v", ok, err)
+	}
+	reloaded, err := LoadWhitelist(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := reloaded.Names(); !slices.Equal(names, []string{"Bob", "Carol"}) {
+		t.Errorf("saved list is %v, want [Bob Carol]", names)
+	}
+
+	w.SetEnabled(false)
+	if !w.Allows("Mallory") {
+		t.Error("refused a player while the whitelist is off")
+	}
+}
@@ -0,0 +1,211 @@
+package gameserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+const (
+	worldSaveInterval = time.Minute
+	// worldSaveMagic starts the header line of every save file, followed by
+	// the schema version the body was written with.
+	worldSaveMagic = "MTWORLD"
+	// worldSaveVersion is the schema version this server writes. Bump it
+	// whenever WorldSave changes shape, and add a migration from the
+	// previous version to worldMigrations.
+	worldSaveVersion = 2
+)
+
+// worldMigrations upgrade a save body one schema version at a time:
+// worldMigrations[v] rewrites a version v body, decoded as generic JSON, into
+// version v+1. They run in order from the file's version up to
+// worldSaveVersion before the body is decoded into a WorldSave.
+var worldMigrations = map[int]func(body map[string]any) error{
+	1: func(body map[string]any) error {
+		// Version 2 added conveyors, which older worlds have none of.
+		rooms, _ := body["rooms"].([]any)
+		for _, room := range rooms {
+			if room, ok := room.(map[string]any); ok {
+				room["conveyors"] = []any{}
+			}
+		}
+		return nil
+	},
+}
+
+// WorldSave is the persistent state of the world outside player profiles:
+// each room's weather, entities, portals and conveyors.
+type WorldSave struct {
+	Saved      time.Time  `json:"saved"`
+	NextEntity int        `json:"nextEntity"`
+	Rooms      []RoomSave `json:"rooms"`
+}
+
+type RoomSave struct {
+	Name      string            `json:"name"`
+	Weather   protocol.Weather  `json:"weather"`
+	Entities  []protocol.Entity `json:"entities"`
+	Portals   []Portal          `json:"portals"`
+	Conveyors []Conveyor        `json:"conveyors"`
+}
+
+// LoadWorldSave reads a save file written by any schema version up to the
+// current one, migrating older bodies as it goes.
+func LoadWorldSave(path string) (*WorldSave, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	header, body, _ := bytes.Cut(data, []byte("\n"))
+	magic, version, ok := strings.Cut(strings.TrimSpace(string(header)), " ")
+	if !ok || magic != worldSaveMagic {
+		return nil, fmt.Errorf("world save %s: missing %s header", path, worldSaveMagic)
+	}
+	v, err := strconv.Atoi(version)
+	if err != nil {
+		return nil, fmt.Errorf("world save %s: bad version %q", path, version)
+	}
+	if v > worldSaveVersion {
+		return nil, fmt.Errorf("world save %s: version %d is newer than this server (%d)", path, v, worldSaveVersion)
+	}
+
+	if v < worldSaveVersion {
+		if body, err = migrateWorldSave(v, body); err != nil {
+			return nil, fmt.Errorf("world save %s: %w", path, err)
+		}
+		log.Printf("Migrated world save %s from version %d to %d", path, v, worldSaveVersion)
+	}
+	var save WorldSave
+	if err := json.Unmarshal(body, &save); err != nil {
+		return nil, fmt.Errorf("parsing world save %s: %w", path, err)
+	}
+	return &save, nil
+}
+
+func migrateWorldSave(from int, body []byte) ([]byte, error) {
+	var generic map[string]any
+	if err := json.Unmarshal(body, &generic); err != nil {
+		return nil, err
+	}
+	for v := from; v < worldSaveVersion; v++ {
+		migrate, ok := worldMigrations[v]
+		if !ok {
+			return nil, fmt.Errorf("no migration from version %d", v)
+		}
+		if err := migrate(generic); err != nil {
+			return nil, fmt.Errorf("migrating from version %d: %w", v, err)
+		}
+	}
+	return json.Marshal(generic)
+}
+
+// Write saves the world to path under the current schema version. It writes
+// a temporary file and renames it over path, so a crash mid-save leaves the
+// previous save intact.
+func (w *WorldSave) Write(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	out := bufio.NewWriter(tmp)
+	fmt.Fprintf(out, "%s %d\n", worldSaveMagic, worldSaveVersion)
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(w); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := out.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (r *Room) save() RoomSave {
+	save := RoomSave{
+		Name:      r.name,
+		Weather:   r.weather.Current(),
+		Portals:   append([]Portal(nil), r.portals...),
+		Conveyors: append([]Conveyor(nil), r.conveyors...),
+	}
+	for _, e := range r.entities {
+		save.Entities = append(save.Entities, *e)
+	}
+	// Emptied resource nodes come back straight away after a restart.
+	for _, node := range r.depleted {
+		save.Entities = append(save.Entities, node.entity)
+	}
+	return save
+}
+
+// SaveWorld collects every room's state from its own goroutine and writes
+// it to the configured world save file.
+func (s *Server) SaveWorld() error {
+	if s.worldFile == "" {
+		return errors.New("no world save file configured")
+	}
+	save := WorldSave{Saved: time.Now()}
+	for _, room := range s.snapshotRooms() {
+		saved := make(chan RoomSave, 1)
+		room.Send(roomMessage{kind: roomSave, saved: saved})
+		save.Rooms = append(save.Rooms, <-saved)
+	}
+	s.mu.Lock()
+	save.NextEntity = s.nextEntity
+	s.mu.Unlock()
+	return save.Write(s.worldFile)
+}
+
+// restoreWorld recreates the saved rooms by replaying their state through
+// the rooms' inboxes, the same way the console builds them up.
+func (s *Server) restoreWorld(save *WorldSave) {
+	s.mu.Lock()
+	s.nextEntity = max(s.nextEntity, save.NextEntity)
+	s.mu.Unlock()
+
+	for _, rs := range save.Rooms {
+		room := s.room(rs.Name)
+		if weather, ok := protocol.ParseWeather(string(rs.Weather)); ok {
+			room.Send(roomMessage{kind: roomWeather, weather: weather})
+		}
+		for _, e := range rs.Entities {
+			// Owners are connections, which do not outlive the server.
+			e.Owner = protocol.OwnerServer
+			room.Send(roomMessage{kind: roomSpawn, entity: e})
+		}
+		for _, p := range rs.Portals {
+			room.Send(roomMessage{kind: roomPortal, portal: p})
+		}
+		for _, c := range rs.Conveyors {
+			room.Send(roomMessage{kind: roomConveyor, conveyor: c})
+		}
+	}
+}
+
+func (s *Server) saveWorldEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := s.SaveWorld(); err != nil {
+			log.Println("Error saving world:", err)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package gameserver
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+// gatewayHelloTimeout is how long a zone waits for the line a gateway opens
+// every connection with.
+const gatewayHelloTimeout = 5 * time.Second
+
+// ZoneMap assigns rooms to zone servers. The gateway and every zone parse
+// the same map, so they agree on where each room runs.
+type ZoneMap struct {
+	zones []string
+	rooms map[string]string
+}
+
+// ParseZoneMap parses "addr=room,room;addr=room". The first zone also hosts
+// every room not listed, including ones created on the fly.
+func ParseZoneMap(spec string) (*ZoneMap, error) {
+	m := &ZoneMap{rooms: make(map[string]string)}
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		addr, rooms, _ := strings.Cut(entry, "=")
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			return nil, fmt.Errorf("zone %q has no address", entry)
+		}
+		m.zones = append(m.zones, addr)
+		for _, room := range strings.Split(rooms, ",") {
+			room = strings.TrimSpace(room)
+			if room == "" {
+				continue
+			}
+			if other, ok := m.rooms[room]; ok {
+				return nil, fmt.Errorf("room %s is assigned to both %s and %s", room, other, addr)
+			}
+			m.rooms[room] = addr
+		}
+	}
+	if len(m.zones) == 0 {
+		return nil, errors.New("no zones given")
+	}
+	return m, nil
+}
+
+func (m *ZoneMap) ZoneFor(room string) string {
+	if addr, ok := m.rooms[room]; ok {
+		return addr
+	}
+	return m.zones[0]
+}
+
+func (m *ZoneMap) Has(addr string) bool {
+	for _, z := range m.zones {
+		if z == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// hostsRoom reports whether this server simulates the room. A standalone
+// server hosts every room.
+func (s *Server) hostsRoom(name string) bool {
+	return s.zones == nil || s.zones.ZoneFor(name) == s.zoneAddr
+}
+
+// acceptGateway reads the hello a gateway opens every zone connection with:
+// the shared secret, then the player being handed over, if any. A nil
+// resume means a new player.
+func (s *Server) acceptGateway(lines <-chan string) (resume *protocol.Resume, ok bool) {
+	timeout := time.NewTimer(gatewayHelloTimeout)
+	defer timeout.Stop()
+
+	var line string
+	select {
+	case line, ok = <-lines:
+		if !ok {
+			return nil, false
+		}
+	case <-timeout.C:
+		return nil, false
+	}
+
+	kind, payload := protocol.Split(line)
+	secret, state, _ := strings.Cut(payload, ";")
+	if kind != protocol.KindResume || subtle.ConstantTimeCompare([]byte(secret), []byte(s.zoneSecret)) != 1 {
+		return nil, false
+	}
+	if state == "" {
+		return nil, true
+	}
+	r, err := protocol.DecodeResume(state)
+	if err != nil {
+		log.Println("Bad handoff from gateway:", err)
+		return nil, false
+	}
+	return &r, true
+}
+
+// handoff moves the player to the zone hosting w.Room. The profile is saved
+// and detached first, so the next zone loads it up to date and this one
+// never writes it again; the gateway then reconnects the player there.
+func (s *Server) handoff(client *Client, w Warp) {
+	if w.Spawn {
+		// The next zone only takes a position, so use the default spawn.
+		w.X, w.Y = spawnX, spawnY
+	}
+	client.mu.Lock()
+	r := protocol.Resume{Account: client.account, Character: client.name, Guest: client.guest, Room: w.Room, X: w.X, Y: w.Y}
+	playing := client.profile != nil
+	client.mu.Unlock()
+	if !playing {
+		client.Send(protocol.Line(protocol.KindError, "choose a character before changing rooms"))
+		return
+	}
+
+	s.saveProfile(client)
+	client.mu.Lock()
+	client.profile = nil
+	client.mu.Unlock()
+	client.Send(protocol.Line(protocol.KindHandoff, protocol.EncodeResume(r)))
+}
+
+// handoffInPlace hands the player off to room at their current position.
+func (s *Server) handoffInPlace(client *Client, room string) {
+	w := Warp{Room: room, X: spawnX, Y: spawnY}
+	client.updateProfile(func(p *Profile) { w.X, w.Y = p.X, p.Y })
+	s.handoff(client, w)
+}
+
+// resume takes over a player handed off by another zone. Zones behind one
+// gateway must share a profile database for account characters to follow.
+func (s *Server) resume(client *Client, r protocol.Resume) error {
+	profile := NewProfile(r.Character)
+	if !r.Guest {
+		p, err := s.profiles.Load(r.Character)
+		if err != nil {
+			return fmt.Errorf("loading %s: %w", r.Character, err)
+		}
+		if p.Account != r.Account {
+			return fmt.Errorf("%s does not belong to %s", r.Character, r.Account)
+		}
+		profile = p
+	}
+
+	client.mu.Lock()
+	client.account = r.Account
+	client.name = r.Character
+	client.guest = r.Guest
+	client.profile = profile
+	client.mu.Unlock()
+
+	s.moveToRoom(client, r.Room)
+	client.room.Send(roomMessage{kind: roomTeleport, client: client, state: protocol.PlayerState{X: r.X, Y: r.Y}})
+	return nil
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"darkzone/MultiTestServer/gameserver"
+)
+
+func main() {
+	listenAddrs := flag.String("listen", ":8080", "comma-separated bind addresses, e.g. \"0.0.0.0:8080,[::]:8080\"")
+	metricsAddr := flag.String("metrics", "", "address for the /metrics HTTP endpoint (disabled when empty)")
+	apiAddr := flag.String("api", "", "address for the JSON HTTP API used by websites and launchers (disabled when empty)")
+	healthAddr := flag.String("health", "", "address for the /healthz and /readyz probes used by orchestrators (disabled when empty)")
+	bandwidthCap := flag.Int64("bandwidth-cap", 0, "per-client upstream cap in bytes per second (0 for unlimited)")
+	tickRate := flag.Int("tickrate", gameserver.DefaultTickRate, "simulation ticks per second")
+	dbPath := flag.String("db", "profiles.db", "SQLite database for player profiles (in-memory profiles when empty)")
+	dbDriver := flag.String("db-driver", "sqlite", "database/sql driver name used with -db")
+	maxPlayers := flag.Int("max-players", 0, "players admitted at once; extra connections wait in a login queue (0 for unlimited)")
+	scriptDir := flag.String("scripts", "", "directory of *.star gameplay scripts, written in Starlark, hot-reloaded on change (disabled when empty)")
+	mapPath := flag.String("map", "", "client map file used to keep players inside the world and out of walls (unchecked when empty)")
+	worldFile := flag.String("world", "", "file the rooms' weather, entities, portals and conveyors are saved to and restored from (not persisted when empty)")
+	zoneSpec := flag.String("zones", "", "zone servers and their rooms for a gateway deployment, e.g. \"10.0.0.2:9000=lobby,arena;10.0.0.3:9000=dungeon\"; the first zone also hosts unlisted rooms")
+	gatewayMode := flag.Bool("gateway", false, "run as the gateway, relaying players to the -zones servers instead of simulating rooms")
+	zoneAddr := flag.String("zone", "", "run as the zone with this address in -zones, accepting players only through the gateway")
+	zoneSecret := flag.String("zone-secret", "", "shared secret the gateway presents to zone servers")
+	brokerURL := flag.String("broker", "", "pub-sub broker shared with other instances for global chat and presence, e.g. nats://host:4222 or redis://host:6379 (disabled when empty)")
+	idleAfter := flag.Duration("idle", 5*time.Minute, "mark players idle after this long without input (0 to disable)")
+	idleKick := flag.Duration("idle-kick", 0, "disconnect players after this long without input, warning them a minute ahead, e.g. 15m (0 to disable)")
+	editMap := flag.String("edit-map", "", "map file the -map-editors accounts may edit together from the client's map editor, saved back on request (disabled when empty; not available with -gateway or -zone)")
+	mapEditorsFile := flag.String("map-editors", "", "file of the accounts allowed to edit the -edit-map map, one per line (manage it with the editors console command)")
+	eventLog := flag.String("event-log", "", "file joins, leaves, kicks, mutes, chat, deaths and completed quests are appended to as JSON lines (disabled when empty)")
+	eventLogSize := flag.Int64("event-log-size", 64, "megabytes the event log grows to before it is rotated, keeping five old files (0 to never rotate)")
+	chatRate := flag.Float64("chat-rate", 1, "chat lines per second a player may keep sending after a short burst (0 for unlimited)")
+	chatWordlist := flag.String("chat-wordlist", "", "file of words, one per line, masked out of chat (unfiltered when empty)")
+	questFile := flag.String("quests", "", "JSON file of quests offered by NPCs, with reach, talk and collect objectives, e.g. quests.json (no quests when empty)")
+	dialogueFile := flag.String("dialogue", "", "JSON file of NPC dialogue trees, keyed by NPC name, e.g. dialogue.json (NPCs stay silent when empty)")
+	shopFile := flag.String("shops", "", "JSON file of vendor NPCs and the items they buy and sell, keyed by NPC name, e.g. shops.json (no vendors when empty)")
+	recipeFile := flag.String("recipes", "", "JSON file of crafting recipes, e.g. recipes.json (no crafting when empty)")
+	resourceFile := flag.String("resources", "", "JSON file of gatherable resource nodes, keyed by node name, with their yield, channel time and respawn time, e.g. resources.json (nothing to gather when empty)")
+	doorFile := flag.String("doors", "", "JSON file of door locks, keyed by door name, and the teams they admit, e.g. doors.json (every door opens for anyone when empty)")
+	lightingFile := flag.String("lighting", "", "JSON file of ambient light levels by day and night, keyed by room name, e.g. lighting.json (rooms not listed are fully lit by day and dim at night)")
+	vision := flag.Float64("vision", 0, "radius in pixels players and their party members see within, hiding the rest of the map under fog of war (0 to see everything)")
+	modeFile := flag.String("modes", "", "JSON file of matchmaking modes, keyed by mode name, with the players per match, kills to win a round, rounds, round length and warmup, e.g. modes.json (no matchmaking when empty)")
+	voiceAddr := flag.String("voice", "", "UDP address for proximity voice chat, e.g. \":8081\" (disabled when empty; not available with -gateway or -zone)")
+	motdFile := flag.String("motd", "", "message of the day file shown to players as they connect, a title line then the text, e.g. motd.txt (none when empty; reload with the motd console command)")
+	whitelistFile := flag.String("whitelist", "", "file of the accounts allowed to join, one per line, making the server private (anyone may join when empty; manage it with the whitelist console command)")
+	simulate := flag.String("simulate", "", "glob of simulation fixtures to play deterministically and check the state hashes of, e.g. \"fixtures/*.sim\", exiting instead of serving (disabled when empty)")
+	flag.Parse()
+
+	var zones *gameserver.ZoneMap
+	if *gatewayMode || *zoneAddr != "" {
+		m, err := gameserver.ParseZoneMap(*zoneSpec)
+		if err != nil {
+			log.Fatal("Error parsing -zones: ", err)
+		}
+		if *zoneAddr != "" && !m.Has(*zoneAddr) {
+			log.Fatalf("Zone %s is not in -zones", *zoneAddr)
+		}
+		if *zoneSecret == "" {
+			log.Fatal("-zone-secret is required for gateways and zones")
+		}
+		zones = m
+	}
+	if *gatewayMode {
+		gateway := gameserver.NewGateway(zones, *zoneSecret)
+		listeners := listen(*listenAddrs)
+		for _, listener := range listeners[1:] {
+			go gateway.Serve(listener)
+		}
+		gateway.Serve(listeners[0])
+		return
+	}
+
+	var profiles gameserver.ProfileStore
+	if *dbPath != "" {
+		store, err := gameserver.OpenSQLProfileStore(*dbDriver, *dbPath)
+		if err != nil {
+			log.Fatal("Error opening profile database: ", err)
+		}
+		defer store.Close()
+		profiles = store
+	}
+
+	var world *gameserver.WorldMap
+	if *mapPath != "" {
+		m, err := gameserver.LoadWorldMap(*mapPath)
+		if err != nil {
+			log.Fatal("Error loading map: ", err)
+		}
+		world = m
+	}
+
+	var mapDoc *gameserver.MapDocument
+	var mapEditors *gameserver.Whitelist
+	if *editMap != "" {
+		if zones != nil {
+			log.Fatal("-edit-map is not available behind a gateway")
+		}
+		if *mapEditorsFile == "" {
+			log.Fatal("-edit-map needs a -map-editors file")
+		}
+		doc, err := gameserver.LoadMapDocument(*editMap)
+		if err != nil {
+			log.Fatal("Error loading -edit-map: ", err)
+		}
+		mapDoc = doc
+		if mapEditors, err = gameserver.LoadWhitelist(*mapEditorsFile); err != nil {
+			log.Fatal("Error loading map editors: ", err)
+		}
+	}
+
+	var events *gameserver.EventLog
+	if *eventLog != "" {
+		l, err := gameserver.OpenEventLog(*eventLog, *eventLogSize<<20)
+		if err != nil {
+			log.Fatal("Error opening event log: ", err)
+		}
+		defer l.Close()
+		events = l
+	}
+
+	var chatFilter gameserver.ChatFilter
+	if *chatWordlist != "" {
+		f, err := gameserver.LoadWordlistFilter(*chatWordlist)
+		if err != nil {
+			log.Fatal("Error loading chat wordlist: ", err)
+		}
+		chatFilter = f
+	}
+
+	var quests *gameserver.QuestBook
+	if *questFile != "" {
+		b, err := gameserver.LoadQuestBook(*questFile)
+		if err != nil {
+			log.Fatal("Error loading quests: ", err)
+		}
+		quests = b
+	}
+
+	var dialogues *gameserver.DialogueBook
+	if *dialogueFile != "" {
+		b, err := gameserver.LoadDialogueBook(*dialogueFile)
+		if err != nil {
+			log.Fatal("Error loading dialogue: ", err)
+		}
+		dialogues = b
+	}
+
+	var vendors *gameserver.VendorBook
+	if *shopFile != "" {
+		b, err := gameserver.LoadVendorBook(*shopFile)
+		if err != nil {
+			log.Fatal("Error loading shops: ", err)
+		}
+		vendors = b
+	}
+
+	var recipes *gameserver.RecipeBook
+	if *recipeFile != "" {
+		b, err := gameserver.LoadRecipeBook(*recipeFile)
+		if err != nil {
+			log.Fatal("Error loading recipes: ", err)
+		}
+		recipes = b
+	}
+
+	var resources *gameserver.ResourceBook
+	if *resourceFile != "" {
+		b, err := gameserver.LoadResourceBook(*resourceFile)
+		if err != nil {
+			log.Fatal("Error loading resources: ", err)
+		}
+		resources = b
+	}
+
+	var doors *gameserver.DoorBook
+	if *doorFile != "" {
+		b, err := gameserver.LoadDoorBook(*doorFile)
+		if err != nil {
+			log.Fatal("Error loading doors: ", err)
+		}
+		doors = b
+	}
+
+	var lighting *gameserver.LightBook
+	if *lightingFile != "" {
+		b, err := gameserver.LoadLightBook(*lightingFile)
+		if err != nil {
+			log.Fatal("Error loading lighting: ", err)
+		}
+		lighting = b
+	}
+
+	var whitelist *gameserver.Whitelist
+	if *whitelistFile != "" {
+		w, err := gameserver.LoadWhitelist(*whitelistFile)
+		if err != nil {
+			log.Fatal("Error loading whitelist: ", err)
+		}
+		whitelist = w
+	}
+
+	var modes *gameserver.ModeBook
+	if *modeFile != "" {
+		b, err := gameserver.LoadModeBook(*modeFile)
+		if err != nil {
+			log.Fatal("Error loading modes: ", err)
+		}
+		modes = b
+	}
+
+	var broker gameserver.Broker
+	if *brokerURL != "" {
+		b, err := openBroker(*brokerURL)
+		if err != nil {
+			log.Fatal("Error connecting to broker: ", err)
+		}
+		defer b.Close()
+		broker = b
+	}
+
+	var voice *net.UDPConn
+	if *voiceAddr != "" {
+		if zones != nil {
+			log.Fatal("-voice is not available behind a gateway")
+		}
+		addr, err := net.ResolveUDPAddr("udp", *voiceAddr)
+		if err != nil {
+			log.Fatal("Error parsing -voice: ", err)
+		}
+		voice, err = net.ListenUDP("udp", addr)
+		if err != nil {
+			log.Fatal("Error starting voice: ", err)
+		}
+		log.Println("Voice on", voice.LocalAddr())
+	}
+
+	cfg := gameserver.Config{
+		BandwidthCap: *bandwidthCap,
+		TickRate:     *tickRate,
+		Profiles:     profiles,
+		ScriptDir:    *scriptDir,
+		MaxPlayers:   *maxPlayers,
+		World:        world,
+		WorldFile:    *worldFile,
+		Zones:        zones,
+		ZoneAddr:     *zoneAddr,
+		ZoneSecret:   *zoneSecret,
+		Broker:       broker,
+		Voice:        voice,
+		IdleAfter:    *idleAfter,
+		IdleKick:     *idleKick,
+		MapDocument:  mapDoc,
+		MapEditors:   mapEditors,
+		Events:       events,
+		ChatRate:     *chatRate,
+		ChatFilter:   chatFilter,
+		Quests:       quests,
+		Dialogues:    dialogues,
+		Vendors:      vendors,
+		Recipes:      recipes,
+		Resources:    resources,
+		Doors:        doors,
+		Modes:        modes,
+		Lighting:     lighting,
+		VisionRadius: *vision,
+		MOTDFile:     *motdFile,
+		Whitelist:    whitelist,
+	}
+	if *simulate != "" {
+		os.Exit(runFixtures(cfg, *simulate))
+	}
+
+	server := gameserver.NewServer(cfg)
+	if err := server.Start(); err != nil {
+		log.Fatal("Error starting server: ", err)
+	}
+
+	listeners := listen(*listenAddrs)
+
+	if *metricsAddr != "" {
+		go server.ServeMetrics(*metricsAddr)
+	}
+	if *apiAddr != "" {
+		go server.ServeAPI(*apiAddr)
+	}
+	if *healthAddr != "" {
+		go server.ServeHealth(*healthAddr)
+	}
+	go server.RunConsole(os.Stdin, os.Stdout)
+
+	for _, listener := range listeners[1:] {
+		go server.Serve(listener)
+	}
+	server.Serve(listeners[0])
+}
+
+// runFixtures plays every simulation fixture matching pattern and returns
+// the exit status: 1 if any failed. Profiles are kept in memory, so
+// fixtures never touch the -db database.
+func runFixtures(cfg gameserver.Config, pattern string) int {
+	cfg.Profiles = nil
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		log.Fatal("Error parsing -simulate: ", err)
+	}
+	if len(paths) == 0 {
+		log.Fatalf("No simulation fixtures match %s", pattern)
+	}
+	status := 0
+	for _, path := range paths {
+		if err := gameserver.RunFixture(cfg, path, func(s string) { log.Println(s) }); err != nil {
+			log.Println("FAIL", err)
+			status = 1
+			continue
+		}
+		log.Println("ok", path)
+	}
+	return status
+}
+
+// listen binds every comma-separated address, exiting if any fails or none
+// is given.
+func listen(addrs string) []net.Listener {
+	var listeners []net.Listener
+	for _, addr := range strings.Split(addrs, ",") {
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			continue
+		}
+		listener, err := net.Listen(listenNetwork(addr), addr)
+		if err != nil {
+			log.Fatal("Error starting server:", err)
+		}
+		log.Println("Listening on", listener.Addr())
+		listeners = append(listeners, listener)
+	}
+	if len(listeners) == 0 {
+		log.Fatal("Error starting server: no listen address given")
+	}
+	return listeners
+}
+
+// listenNetwork pins explicit IPv4 or IPv6 bind addresses to their own
+// family, so "0.0.0.0:8080" and "[::]:8080" can be bound side by side. A bare
+// ":port" keeps the OS default, which is dual-stack on most systems.
+func listenNetwork(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil || host == "" {
+		return "tcp"
+	}
+	ip := net.ParseIP(host)
+	switch {
+	case ip == nil:
+		return "tcp"
+	case ip.To4() != nil:
+		return "tcp4"
+	default:
+		return "tcp6"
+	}
+}
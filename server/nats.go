@@ -0,0 +1,38 @@
+//go:build nats
+
+package main
+
+// Building with -tags nats links the NATS client so -broker accepts nats://
+// URLs.
+import (
+	"darkzone/MultiTestServer/gameserver"
+	"github.com/nats-io/nats.go"
+)
+
+func init() {
+	brokers["nats"] = func(url string) (gameserver.Broker, error) {
+		conn, err := nats.Connect(url)
+		if err != nil {
+			return nil, err
+		}
+		return natsBroker{conn}, nil
+	}
+}
+
+type natsBroker struct {
+	conn *nats.Conn
+}
+
+func (b natsBroker) Publish(subject string, data []byte) error {
+	return b.conn.Publish(subject, data)
+}
+
+func (b natsBroker) Subscribe(subject string, handler func(data []byte)) error {
+	_, err := b.conn.Subscribe(subject, func(m *nats.Msg) { handler(m.Data) })
+	return err
+}
+
+func (b natsBroker) Close() error {
+	b.conn.Close()
+	return nil
+}
@@ -0,0 +1,12 @@
+package protocol
+
+// Areas. Maps mark cells as safe, where players cannot attack or be
+// attacked, or as open to PvP. The server sends KindArea with AreaSafe or
+// AreaPvP as a player enters the world and whenever they cross into the
+// other kind of area.
+const KindArea = "area"
+
+const (
+	AreaSafe = "safe"
+	AreaPvP  = "pvp"
+)
@@ -0,0 +1,36 @@
+package protocol
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Entity authority. Every entity has an owner: the server, or one client
+// that drives it, such as a player's pet or the vehicle they are in. The
+// owner simulates the entity and sends its moves as KindEntityMove; the
+// server checks each one came from the owner and is a legal step before
+// passing it on to everyone else as a KindSpawn, and answers a refused
+// move with the entity as it stands so the owner can correct itself.
+// Authority goes back to the server when the owner leaves the room.
+const (
+	KindEntityMove = "emove"
+
+	// OwnerServer is the Owner of entities the server drives.
+	OwnerServer = ""
+)
+
+func EncodeEntityMove(id string, x, y float64) string {
+	return id + "," + EncodePosition(x, y)
+}
+
+func DecodeEntityMove(payload string) (id string, x, y float64, err error) {
+	id, position, ok := strings.Cut(payload, ",")
+	if !ok || id == "" {
+		return "", 0, 0, fmt.Errorf("entity move: missing entity ID in %q", payload)
+	}
+	x, y, err = DecodePosition(position)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("entity move: %w", err)
+	}
+	return id, x, y, nil
+}
@@ -0,0 +1,101 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Crafting. On entering the world a player is sent the server's recipes as
+// KindRecipes and their inventory as KindInventory, which is sent again
+// whenever it changes. The player sends KindCraft with a recipe ID to
+// start crafting; the server takes the ingredients and answers with a
+// CraftStatus giving how long it takes, then with Done set once the result
+// is in the inventory, or with Cancelled set if the player left the room
+// first and got the ingredients back.
+const (
+	KindRecipes   = "recipes"
+	KindCraft     = "craft"
+	KindInventory = "inv"
+)
+
+// Recipe turns Inputs, item names and counts, into Count of Output after
+// Seconds.
+type Recipe struct {
+	ID      string         `json:"id"`
+	Output  string         `json:"output"`
+	Count   int            `json:"count,omitempty"`
+	Inputs  map[string]int `json:"inputs"`
+	Seconds float64        `json:"seconds,omitempty"`
+}
+
+func EncodeRecipes(recipes []Recipe) string {
+	data, _ := json.Marshal(recipes)
+	return string(data)
+}
+
+func DecodeRecipes(payload string) ([]Recipe, error) {
+	var recipes []Recipe
+	if err := json.Unmarshal([]byte(payload), &recipes); err != nil {
+		return nil, fmt.Errorf("recipes: %w", err)
+	}
+	return recipes, nil
+}
+
+type CraftStatus struct {
+	Recipe    string  `json:"recipe"`
+	Seconds   float64 `json:"seconds,omitempty"`
+	Done      bool    `json:"done,omitempty"`
+	Cancelled bool    `json:"cancelled,omitempty"`
+}
+
+func EncodeCraftStatus(s CraftStatus) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+func DecodeCraftStatus(payload string) (CraftStatus, error) {
+	var s CraftStatus
+	if err := json.Unmarshal([]byte(payload), &s); err != nil {
+		return CraftStatus{}, fmt.Errorf("craft status: %w", err)
+	}
+	return s, nil
+}
+
+// EncodeInventory lists the items carried as "item:count" pairs separated by
+// commas, sorted by item name.
+func EncodeInventory(inventory map[string]int) string {
+	var b strings.Builder
+	for _, item := range slices.Sorted(maps.Keys(inventory)) {
+		if inventory[item] <= 0 {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s:%d", item, inventory[item])
+	}
+	return b.String()
+}
+
+func DecodeInventory(payload string) (map[string]int, error) {
+	inventory := make(map[string]int)
+	if payload == "" {
+		return inventory, nil
+	}
+	for _, pair := range strings.Split(payload, ",") {
+		item, count, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, fmt.Errorf("inventory: want item:count, got %q", pair)
+		}
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			return nil, fmt.Errorf("inventory count of %s: %w", item, err)
+		}
+		inventory[item] = n
+	}
+	return inventory, nil
+}
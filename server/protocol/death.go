@@ -0,0 +1,30 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Defeat is the KindDefeated payload. By names what defeated the player: the
+// killer's character, or the effect that wore their health down. Killer is
+// the killing player's ID, for the client to follow while it waits, and is
+// empty when no player is to blame. The player lies dead for Seconds and
+// then respawns with a teleport to a spawn point, briefly invulnerable.
+type Defeat struct {
+	By      string  `json:"by"`
+	Killer  string  `json:"killer,omitempty"`
+	Seconds float64 `json:"seconds"`
+}
+
+func EncodeDefeat(d Defeat) string {
+	data, _ := json.Marshal(d)
+	return string(data)
+}
+
+func DecodeDefeat(payload string) (Defeat, error) {
+	var d Defeat
+	if err := json.Unmarshal([]byte(payload), &d); err != nil {
+		return Defeat{}, fmt.Errorf("defeat: %w", err)
+	}
+	return d, nil
+}
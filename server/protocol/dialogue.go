@@ -0,0 +1,37 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// NPC dialogue. Interacting with an NPC that has a dialogue starts it: the
+// server sends the first line as KindDialogue, and the player answers with
+// KindDialogueChoice carrying the index of the choice they picked, or -1 to
+// walk away. The server replies with the next line, or with an empty
+// KindDialogue once the conversation is over.
+const (
+	KindDialogue       = "dialogue"
+	KindDialogueChoice = "dchoice"
+)
+
+// DialogueLine is what an NPC says and the answers the player can give. A
+// line without choices is answered with choice 0 to continue.
+type DialogueLine struct {
+	NPC     string   `json:"npc"`
+	Text    string   `json:"text"`
+	Choices []string `json:"choices,omitempty"`
+}
+
+func EncodeDialogueLine(l DialogueLine) string {
+	data, _ := json.Marshal(l)
+	return string(data)
+}
+
+func DecodeDialogueLine(payload string) (DialogueLine, error) {
+	var l DialogueLine
+	if err := json.Unmarshal([]byte(payload), &l); err != nil {
+		return DialogueLine{}, fmt.Errorf("dialogue line: %w", err)
+	}
+	return l, nil
+}
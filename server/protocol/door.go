@@ -0,0 +1,36 @@
+package protocol
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Doors. A door entity covers a DoorSize square from its position, which
+// players cannot walk into while it is closed. A player opens or closes one
+// by sending KindInteract with its ID from within InteractRange; the server
+// checks the door's lock and sends every player in the room KindDoor with
+// the door's ID and whether it is now open. Doors start closed, and a
+// player entering a room is sent one for each door that is open.
+const KindDoor = "door"
+
+const DoorSize = 32.0
+
+// DoorCovers reports whether a door at doorX, doorY covers x, y.
+func DoorCovers(doorX, doorY, x, y float64) bool {
+	return x >= doorX && x < doorX+DoorSize && y >= doorY && y < doorY+DoorSize
+}
+
+func EncodeDoor(id string, open bool) string {
+	if open {
+		return id + ",1"
+	}
+	return id + ",0"
+}
+
+func DecodeDoor(payload string) (id string, open bool, err error) {
+	id, state, ok := strings.Cut(payload, ",")
+	if !ok || (state != "0" && state != "1") {
+		return "", false, fmt.Errorf("door: want id,0 or id,1, got %q", payload)
+	}
+	return id, state == "1", nil
+}
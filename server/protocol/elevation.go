@@ -0,0 +1,62 @@
+package protocol
+
+// Elevation. A map's elevation array gives each cell an Elevation, ground
+// where it gives none. Players stand at level 0 on the ground or level 1
+// up high, and what they may walk into depends on their level: the ground
+// at 0, high ground at 1, and bridges at either, over the deck or under
+// it. Ramps join the two, and players change level only by stepping off
+// a ramp: up onto high ground or a bridge, or down onto the ground.
+// Players only fight others at their own level. The server sends each
+// player's level in snapshots and with every teleport.
+type Elevation int
+
+const (
+	ElevationGround Elevation = iota
+	ElevationHigh
+	ElevationBridge
+	ElevationRamp
+)
+
+// ValidElevation reports whether e is one of the elevations above.
+func ValidElevation(e Elevation) bool {
+	return e >= ElevationGround && e <= ElevationRamp
+}
+
+// CanEnter reports whether a player at level can step from a cell of
+// elevation from into one of elevation to.
+func CanEnter(from, to Elevation, level int) bool {
+	if from == ElevationRamp {
+		return true
+	}
+	switch to {
+	case ElevationGround:
+		return level == 0
+	case ElevationHigh:
+		return level == 1
+	}
+	return true
+}
+
+// Climb is a player's level after stepping from a cell of elevation from
+// into one of elevation to.
+func Climb(from, to Elevation, level int) int {
+	if from != ElevationRamp {
+		return level
+	}
+	switch to {
+	case ElevationGround:
+		return 0
+	case ElevationHigh, ElevationBridge:
+		return 1
+	}
+	return level
+}
+
+// Level is the level a player put down in a cell of the elevation stands
+// at, for spawns and teleports: up high on high ground and bridges.
+func (e Elevation) Level() int {
+	if e == ElevationHigh || e == ElevationBridge {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,42 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// The event feed. The server sends KindFeed for things worth a glance but
+// not a chat line: defeats in the room, players joining and leaving the
+// game, and announcements from scripts and the console. Clients word each
+// kind themselves from Player and Other; announcements carry their Text.
+const KindFeed = "feed"
+
+const (
+	// FeedDefeated is Other defeating Player, and FeedSuccumbed Player
+	// succumbing to the effect Other.
+	FeedDefeated  = "defeated"
+	FeedSuccumbed = "succumbed"
+	FeedJoined    = "joined"
+	FeedLeft      = "left"
+	FeedAnnounce  = "announce"
+)
+
+type FeedEvent struct {
+	Kind   string `json:"kind"`
+	Player string `json:"player,omitempty"`
+	Other  string `json:"other,omitempty"`
+	Text   string `json:"text,omitempty"`
+}
+
+func EncodeFeedEvent(e FeedEvent) string {
+	data, _ := json.Marshal(e)
+	return string(data)
+}
+
+func DecodeFeedEvent(payload string) (FeedEvent, error) {
+	var e FeedEvent
+	if err := json.Unmarshal([]byte(payload), &e); err != nil {
+		return FeedEvent{}, fmt.Errorf("feed event: %w", err)
+	}
+	return e, nil
+}
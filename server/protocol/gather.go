@@ -0,0 +1,38 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Gathering. A player sends KindGather with the ID of a resource node within
+// InteractRange to start gathering from it. The server answers with a
+// GatherStatus giving the channel time, and again with Done set once the
+// yield is in their inventory, or with Cancelled set if they walked away or
+// someone else emptied the node first. Every player in the room is sent
+// KindHarvest with the node's ID as it is emptied, just before it despawns
+// until it grows back.
+const (
+	KindGather  = "gather"
+	KindHarvest = "harvest"
+)
+
+type GatherStatus struct {
+	ID        string  `json:"id"`
+	Seconds   float64 `json:"seconds,omitempty"`
+	Done      bool    `json:"done,omitempty"`
+	Cancelled bool    `json:"cancelled,omitempty"`
+}
+
+func EncodeGatherStatus(s GatherStatus) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+func DecodeGatherStatus(payload string) (GatherStatus, error) {
+	var s GatherStatus
+	if err := json.Unmarshal([]byte(payload), &s); err != nil {
+		return GatherStatus{}, fmt.Errorf("gather status: %w", err)
+	}
+	return s, nil
+}
@@ -0,0 +1,56 @@
+package protocol
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Lighting. The server sends KindAmbient as a player enters a room with
+// how lit the room is at midday and at midnight, from 0 for pitch dark to
+// 1 for broad daylight. In between, the light follows the day, which every
+// client works out for itself from the synchronised server clock.
+const KindAmbient = "ambient"
+
+// DayLength is how long a day lasts, midnight to midnight.
+const DayLength = 20 * time.Minute
+
+type Ambient struct {
+	Day, Night float64
+}
+
+// DefaultAmbient is the light in rooms the server has no levels for.
+var DefaultAmbient = Ambient{Day: 1, Night: 0.3}
+
+// Daylight is how far into the day the server time in milliseconds is:
+// 0 at midnight, rising to 1 at midday and falling back.
+func Daylight(serverMillis int64) float64 {
+	t := float64(serverMillis%DayLength.Milliseconds()) / float64(DayLength.Milliseconds())
+	return (1 - math.Cos(2*math.Pi*t)) / 2
+}
+
+// At is the ambient light level at the server time in milliseconds.
+func (a Ambient) At(serverMillis int64) float64 {
+	return a.Night + (a.Day-a.Night)*Daylight(serverMillis)
+}
+
+func EncodeAmbient(a Ambient) string {
+	return fmt.Sprintf("%.2f,%.2f", a.Day, a.Night)
+}
+
+func DecodeAmbient(payload string) (Ambient, error) {
+	fields := strings.Split(payload, ",")
+	if len(fields) != 2 {
+		return Ambient{}, fmt.Errorf("ambient: want 2 fields, got %d", len(fields))
+	}
+	var a Ambient
+	var err error
+	if a.Day, err = ParseFloat(fields[0]); err != nil {
+		return Ambient{}, fmt.Errorf("ambient day: %w", err)
+	}
+	if a.Night, err = ParseFloat(fields[1]); err != nil {
+		return Ambient{}, fmt.Errorf("ambient night: %w", err)
+	}
+	return a, nil
+}
@@ -0,0 +1,52 @@
+package protocol
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Limits. Whatever arrives over the wire is untrusted, so every decoder
+// returns an error for input it cannot make sense of instead of panicking,
+// lines are read only up to MaxLineLength rather than buffered without end,
+// and numbers must be finite, since a NaN or infinite position would spread
+// through everything it touched.
+
+// MaxLineLength bounds a single message, newline included. The largest
+// legitimate one is a map sent to the editor.
+const MaxLineLength = 1 << 20
+
+var ErrLineTooLong = fmt.Errorf("line longer than %d bytes", MaxLineLength)
+
+// ReadLine reads the next message from r, newline included. A line longer
+// than MaxLineLength is refused with ErrLineTooLong; the connection it came
+// from cannot be trusted to be in step any more.
+func ReadLine(r *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if len(line)+len(chunk) > MaxLineLength {
+			return "", ErrLineTooLong
+		}
+		line = append(line, chunk...)
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			return string(line), err
+		}
+	}
+}
+
+// ParseFloat is strconv.ParseFloat for wire values, which are never NaN or
+// infinite. Anything else parsing numbers it did not write itself, such as
+// console and script arguments, goes through it too.
+func ParseFloat(s string) (float64, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("%q is not a finite number", s)
+	}
+	return f, nil
+}
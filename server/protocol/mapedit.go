@@ -0,0 +1,105 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Live map editing. An editor sends KindMapJoin and gets the whole document
+// back as KindMapData, then streams KindMapEdit for every cell it changes
+// and KindMapCursor as its cursor moves. The server applies edits in the
+// order it receives them and relays each one to every editor, the author
+// included, so the last write to a cell wins everywhere. KindMapLeave tells
+// editors to drop a cursor, and KindMapSave asks the server to write the
+// document to disk, which it confirms with the same kind.
+const (
+	KindMapJoin   = "mapjoin"
+	KindMapData   = "mapdata"
+	KindMapEdit   = "mapedit"
+	KindMapCursor = "mapcursor"
+	KindMapLeave  = "mapleave"
+	KindMapSave   = "mapsave"
+)
+
+// MapCollisionLayer is the Layer of an edit to the collision flags.
+const MapCollisionLayer = -1
+
+// MapData is the editable part of a map file.
+type MapData struct {
+	Width     int     `json:"width"`
+	Layers    [][]int `json:"layers"`
+	Collision []int   `json:"collision"`
+}
+
+func EncodeMapData(m MapData) (string, error) {
+	data, err := json.Marshal(m)
+	return string(data), err
+}
+
+func DecodeMapData(payload string) (MapData, error) {
+	var m MapData
+	if err := json.Unmarshal([]byte(payload), &m); err != nil {
+		return MapData{}, fmt.Errorf("map data: %w", err)
+	}
+	return m, nil
+}
+
+// MapEdit sets one cell: a tile on Layer, -1 for none, or the collision flag
+// when Layer is MapCollisionLayer. A Layer one above the top layer adds an
+// empty layer first. Author is the editing player's ID, filled in by the
+// server.
+type MapEdit struct {
+	Layer  int
+	Index  int
+	Value  int
+	Author string
+}
+
+func EncodeMapEdit(e MapEdit) string {
+	return fmt.Sprintf("%d,%d,%d,%s", e.Layer, e.Index, e.Value, e.Author)
+}
+
+func DecodeMapEdit(payload string) (MapEdit, error) {
+	fields := strings.Split(payload, ",")
+	if len(fields) != 4 {
+		return MapEdit{}, fmt.Errorf("map edit: want 4 fields, got %d", len(fields))
+	}
+	var e MapEdit
+	var err error
+	if e.Layer, err = strconv.Atoi(fields[0]); err != nil {
+		return MapEdit{}, fmt.Errorf("map edit layer: %w", err)
+	}
+	if e.Index, err = strconv.Atoi(fields[1]); err != nil {
+		return MapEdit{}, fmt.Errorf("map edit index: %w", err)
+	}
+	if e.Value, err = strconv.Atoi(fields[2]); err != nil {
+		return MapEdit{}, fmt.Errorf("map edit value: %w", err)
+	}
+	e.Author = fields[3]
+	return e, nil
+}
+
+// MapCursor is where an editor's cursor is, in world coordinates. Editors
+// send it with an empty ID; the server fills in theirs when relaying.
+type MapCursor struct {
+	ID   string
+	X, Y float64
+}
+
+func EncodeMapCursor(c MapCursor) string {
+	return c.ID + "," + EncodePosition(c.X, c.Y)
+}
+
+func DecodeMapCursor(payload string) (MapCursor, error) {
+	id, position, ok := strings.Cut(payload, ",")
+	if !ok {
+		return MapCursor{}, fmt.Errorf("map cursor: want id and position, got %q", payload)
+	}
+	x, y, err := DecodePosition(position)
+	if err != nil {
+		return MapCursor{}, fmt.Errorf("map cursor: %w", err)
+	}
+	return MapCursor{ID: id, X: x, Y: y}, nil
+}
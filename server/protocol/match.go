@@ -0,0 +1,121 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Matchmaking. A player queues for a mode with KindMatchQueue naming it, or
+// leaves the queue with an empty payload. The server answers with
+// KindMatch: MatchQueued, repeated while they wait, with how many are
+// queued for the mode; MatchFound once the matcher has grouped them with
+// players of a similar rating, naming the match room and everyone in it,
+// Seconds before they are moved there; and MatchLeft when they are out of
+// the queue without a match. While the match runs, the match room sends
+// KindMatchPhase whenever it moves on to another phase, and to players
+// joining it. When the match ends, everyone still in it is sent
+// KindMatchResults, Seconds before they are moved back to the lobby.
+const (
+	KindMatchQueue   = "mmqueue"
+	KindMatch        = "match"
+	KindMatchPhase   = "phase"
+	KindMatchResults = "results"
+)
+
+const (
+	MatchQueued = "queued"
+	MatchFound  = "found"
+	MatchLeft   = "left"
+)
+
+// Match phases. A match warms up while its players arrive, then plays its
+// rounds, each followed by a short break naming the round's winner, and
+// ends in an intermission showing the results.
+const (
+	MatchWarmup       = "warmup"
+	MatchPlaying      = "playing"
+	MatchRoundEnd     = "roundend"
+	MatchIntermission = "intermission"
+)
+
+type MatchStatus struct {
+	Mode    string   `json:"mode"`
+	State   string   `json:"state"`
+	Waiting int      `json:"waiting,omitempty"`
+	Room    string   `json:"room,omitempty"`
+	Players []string `json:"players,omitempty"`
+	Seconds float64  `json:"seconds,omitempty"`
+}
+
+// MatchPhase is the phase a match is in, Seconds before it moves on. Round
+// counts from 1 once the first round starts; Winner names who won the
+// round just played, empty for a draw.
+type MatchPhase struct {
+	Mode    string  `json:"mode"`
+	Phase   string  `json:"phase"`
+	Round   int     `json:"round,omitempty"`
+	Rounds  int     `json:"rounds"`
+	Seconds float64 `json:"seconds"`
+	Winner  string  `json:"winner,omitempty"`
+}
+
+// MatchPlayerResult is how one player did in a match, and their Rating
+// after it, Change from before.
+type MatchPlayerResult struct {
+	Name   string `json:"name"`
+	Kills  int    `json:"kills"`
+	Deaths int    `json:"deaths"`
+	Score  int    `json:"score"`
+	Rating int    `json:"rating"`
+	Change int    `json:"change"`
+}
+
+// MatchResults is the end of a match: who won, who played best and how
+// everyone did, best first.
+type MatchResults struct {
+	Mode    string              `json:"mode"`
+	Room    string              `json:"room"`
+	Winner  string              `json:"winner"`
+	MVP     string              `json:"mvp"`
+	Seconds float64             `json:"seconds"`
+	Players []MatchPlayerResult `json:"players"`
+}
+
+func EncodeMatchStatus(m MatchStatus) string {
+	data, _ := json.Marshal(m)
+	return string(data)
+}
+
+func DecodeMatchStatus(payload string) (MatchStatus, error) {
+	var m MatchStatus
+	if err := json.Unmarshal([]byte(payload), &m); err != nil {
+		return MatchStatus{}, fmt.Errorf("match status: %w", err)
+	}
+	return m, nil
+}
+
+func EncodeMatchPhase(m MatchPhase) string {
+	data, _ := json.Marshal(m)
+	return string(data)
+}
+
+func DecodeMatchPhase(payload string) (MatchPhase, error) {
+	var m MatchPhase
+	if err := json.Unmarshal([]byte(payload), &m); err != nil {
+		return MatchPhase{}, fmt.Errorf("match phase: %w", err)
+	}
+	return m, nil
+}
+
+func EncodeMatchResults(m MatchResults) string {
+	data, _ := json.Marshal(m)
+	return string(data)
+}
+
+func DecodeMatchResults(payload string) (MatchResults, error) {
+	var m MatchResults
+	if err := json.Unmarshal([]byte(payload), &m); err != nil {
+		return MatchResults{}, fmt.Errorf("match results: %w", err)
+	}
+	return m, nil
+}
@@ -0,0 +1,29 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Message of the day. The server sends KindMOTD to a player as they
+// connect, when it has one, with news to read before playing. Clients
+// show it in a panel the player dismisses.
+const KindMOTD = "motd"
+
+type MOTD struct {
+	Title string `json:"title"`
+	Text  string `json:"text"`
+}
+
+func EncodeMOTD(m MOTD) string {
+	data, _ := json.Marshal(m)
+	return string(data)
+}
+
+func DecodeMOTD(payload string) (MOTD, error) {
+	var m MOTD
+	if err := json.Unmarshal([]byte(payload), &m); err != nil {
+		return MOTD{}, fmt.Errorf("motd: %w", err)
+	}
+	return m, nil
+}
@@ -0,0 +1,25 @@
+package protocol
+
+// Mounts. A player sends KindMount with the name of a mount to ride it, or
+// with an empty payload to get down. The server decides whether they may,
+// and everyone sees the rider on their mount through the Mount field of
+// their snapshot state. Players riding move faster, by the mount's factor
+// in Mounts, and are knocked off when hit.
+const KindMount = "mount"
+
+// DefaultMount is the mount players call when they have no other.
+const DefaultMount = "horse"
+
+// Mounts maps each mount to what it scales its rider's movement speed by.
+var Mounts = map[string]float64{
+	"horse": 1.8,
+}
+
+// MountSpeed is what riding mount scales a player's movement speed by: 1
+// on foot.
+func MountSpeed(mount string) float64 {
+	if f, ok := Mounts[mount]; ok {
+		return f
+	}
+	return 1
+}
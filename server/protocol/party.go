@@ -0,0 +1,56 @@
+package protocol
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Parties. A player invites another by name with KindPartyInvite, which the
+// server forwards to the invitee with the inviter's name as the payload;
+// the invitee answers with KindPartyAccept naming the inviter, and either
+// can quit with KindPartyLeave. Members get KindParty whenever the party
+// changes and periodically while in one, so they can show each other's
+// health anywhere on the map; an empty payload means no party.
+const (
+	KindParty       = "party"
+	KindPartyInvite = "pinvite"
+	KindPartyAccept = "paccept"
+	KindPartyLeave  = "pleave"
+)
+
+// MaxHealth is the health players spawn with.
+const MaxHealth = 100
+
+// PartyMember is one entry of a party list.
+type PartyMember struct {
+	Name   string
+	Health int
+}
+
+func EncodeParty(members []PartyMember) string {
+	entries := make([]string, len(members))
+	for i, m := range members {
+		entries[i] = m.Name + "," + strconv.Itoa(m.Health)
+	}
+	return strings.Join(entries, ";")
+}
+
+func DecodeParty(payload string) ([]PartyMember, error) {
+	if payload == "" {
+		return nil, nil
+	}
+	var members []PartyMember
+	for _, entry := range strings.Split(payload, ";") {
+		name, health, ok := strings.Cut(entry, ",")
+		if !ok {
+			return nil, fmt.Errorf("party member: want name and health, got %q", entry)
+		}
+		h, err := strconv.Atoi(health)
+		if err != nil {
+			return nil, fmt.Errorf("party member health: %w", err)
+		}
+		members = append(members, PartyMember{Name: name, Health: h})
+	}
+	return members, nil
+}
@@ -0,0 +1,45 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Pausing co-op rooms. A player votes to pause the room they are in with
+// KindPause and PauseOn, or takes the vote back with PauseOff. The room
+// pauses once everyone in it has voted, and resumes as soon as anyone takes
+// their vote back or someone new arrives. The room sends everyone
+// KindPaused whenever the votes change, and a player leaving it with their
+// vote in an empty PauseStatus.
+const (
+	KindPause  = "pause"
+	KindPaused = "paused"
+)
+
+const (
+	PauseOn  = "on"
+	PauseOff = "off"
+)
+
+// PauseStatus is whether the room is paused, who has voted to pause it,
+// whether that includes the player it is sent to, and how many players are
+// in it.
+type PauseStatus struct {
+	Paused  bool     `json:"paused"`
+	Votes   []string `json:"votes,omitempty"`
+	Voted   bool     `json:"voted,omitempty"`
+	Players int      `json:"players"`
+}
+
+func EncodePauseStatus(p PauseStatus) string {
+	data, _ := json.Marshal(p)
+	return string(data)
+}
+
+func DecodePauseStatus(payload string) (PauseStatus, error) {
+	var p PauseStatus
+	if err := json.Unmarshal([]byte(payload), &p); err != nil {
+		return PauseStatus{}, fmt.Errorf("pause status: %w", err)
+	}
+	return p, nil
+}
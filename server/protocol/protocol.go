@@ -0,0 +1,512 @@
+// Package protocol defines the line-based wire format shared by the client
+// and the server. Every message is a single line of the form "kind,payload".
+package protocol
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	KindWelcome     = "welcome"
+	KindState       = "state"
+	KindSnapshot    = "snap"
+	KindRoom        = "room"
+	KindSession     = "session"
+	KindClock       = "clock"
+	KindChat        = "chat"
+	KindSpawn       = "spawn"
+	KindDespawn     = "despawn"
+	KindTeleport    = "teleport"
+	KindLogin       = "login"
+	KindError       = "error"
+	KindGuest       = "guest"
+	KindQueue       = "queue"
+	KindKick        = "kick"
+	KindLeaderboard = "board"
+	// KindHit tells an attacker whose attack landed, and KindDefeated tells
+	// the victim who defeated them and when they respawn, as a Defeat.
+	KindHit      = "hit"
+	KindDefeated = "defeated"
+	// KindVoice offers voice chat: the server's voice port, the token the
+	// client's voice packets must carry and the server's half of the key
+	// exchange. A client taking it up answers with KindVoiceKey, its own
+	// half; see VoiceKeys.
+	KindVoice    = "voice"
+	KindVoiceKey = "voicekey"
+	// KindAck acknowledges a snapshot by echoing its Time. Clients ack a
+	// few snapshots a second, and the server slows the snapshots of those
+	// whose acks come back late.
+	KindAck = "ack"
+
+	// Internal messages between the gateway and zone servers; clients never
+	// see them. A zone sends KindHandoff when a player must move to a room
+	// another zone hosts, and the gateway opens every zone connection with
+	// KindResume.
+	KindHandoff = "handoff"
+	KindResume  = "resume"
+
+	KindCharacters      = "chars"
+	KindCharacterCreate = "charnew"
+	KindCharacterDelete = "chardel"
+	KindCharacterSelect = "charsel"
+)
+
+const (
+	EntityNPC  = "npc"
+	EntityItem = "item"
+	// EntityResource is a node players gather items from, such as a tree
+	// or a rock, named after its resource type.
+	EntityResource = "resource"
+	// EntityDoor is a door or gate that players open and close; see
+	// KindDoor.
+	EntityDoor = "door"
+	// EntityVehicle is something players ride in together, such as a
+	// boat; see KindSeat.
+	EntityVehicle = "vehicle"
+)
+
+const (
+	ChannelLocal  = "local"
+	ChannelZone   = "zone"
+	ChannelGlobal = "global"
+)
+
+// InterestRadius is how far from a player the server still includes other
+// players in that player's snapshots.
+const InterestRadius = 1200.0
+
+// Line encodes a message, including the trailing newline.
+func Line(kind, payload string) string {
+	return kind + "," + payload + "\n"
+}
+
+// Split separates a received line into its kind and payload.
+func Split(line string) (kind, payload string) {
+	kind, payload, _ = strings.Cut(strings.TrimSpace(line), ",")
+	return kind, payload
+}
+
+// AnimState is the animation a character is playing. It replaces a plain
+// moving flag so actions other than walking show up on every client.
+type AnimState int
+
+const (
+	AnimIdle AnimState = iota
+	AnimWalk
+	AnimAttack
+	AnimHurt
+	AnimDead
+)
+
+type PlayerState struct {
+	ID        string
+	X, Y      float64
+	VX, VY    float64
+	Direction int
+	Anim      AnimState
+	// Warp counts the server-forced teleports of this player. It only
+	// travels in snapshots; a change tells clients to snap instead of
+	// interpolating across the jump.
+	Warp int
+	// Seq numbers a client's own state reports. The server echoes the last
+	// one it applied in teleports, so the client can replay the inputs the
+	// server had not seen yet.
+	Seq int
+	// Idle is set by the server on players who have sent no input for a
+	// while. It travels in snapshots only.
+	Idle bool
+	// Mount is what the player is riding, empty on foot. It travels in
+	// snapshots only.
+	Mount string
+	// Level is the elevation level the player is at, 0 on the ground. It
+	// travels in snapshots only.
+	Level int
+}
+
+// EncodeState encodes the fields a client reports about itself; the ID is
+// assigned by the server and therefore omitted.
+func EncodeState(p PlayerState) string {
+	return fmt.Sprintf("%.2f,%.2f,%.2f,%.2f,%d,%d", p.X, p.Y, p.VX, p.VY, p.Direction, p.Anim)
+}
+
+// EncodeReport is a client's state report: its state followed by Seq.
+func EncodeReport(p PlayerState) string {
+	return EncodeState(p) + "," + strconv.Itoa(p.Seq)
+}
+
+// DecodeState decodes a state report, with or without a trailing Seq.
+func DecodeState(payload string) (PlayerState, error) {
+	fields := strings.Split(payload, ",")
+	if len(fields) != 6 && len(fields) != 7 {
+		return PlayerState{}, fmt.Errorf("state: want 6 or 7 fields, got %d", len(fields))
+	}
+	p, err := decodeStateFields(fields[:6])
+	if err != nil || len(fields) == 6 {
+		return p, err
+	}
+	if p.Seq, err = strconv.Atoi(fields[6]); err != nil {
+		return PlayerState{}, fmt.Errorf("state seq: %w", err)
+	}
+	return p, nil
+}
+
+type Weather string
+
+const (
+	WeatherClear Weather = "clear"
+	WeatherRain  Weather = "rain"
+	WeatherSnow  Weather = "snow"
+	WeatherFog   Weather = "fog"
+)
+
+func ParseWeather(s string) (Weather, bool) {
+	switch w := Weather(s); w {
+	case WeatherClear, WeatherRain, WeatherSnow, WeatherFog:
+		return w, true
+	}
+	return "", false
+}
+
+// Snapshot is the room state at server time Time, in Unix milliseconds.
+type Snapshot struct {
+	Time    int64
+	Weather Weather
+	Players []PlayerState
+}
+
+func EncodeSnapshot(snap Snapshot) string {
+	entries := make([]string, 0, len(snap.Players)+1)
+	entries = append(entries, strconv.FormatInt(snap.Time, 10)+","+string(snap.Weather))
+	for _, p := range snap.Players {
+		idle := "0"
+		if p.Idle {
+			idle = "1"
+		}
+		entries = append(entries, p.ID+","+EncodeState(p)+","+strconv.Itoa(p.Warp)+","+idle+","+p.Mount+","+strconv.Itoa(p.Level))
+	}
+	return strings.Join(entries, ";")
+}
+
+func DecodeSnapshot(payload string) (Snapshot, error) {
+	entries := strings.Split(payload, ";")
+	header := strings.Split(entries[0], ",")
+	if len(header) != 2 {
+		return Snapshot{}, fmt.Errorf("snapshot header: want 2 fields, got %d", len(header))
+	}
+	serverTime, err := strconv.ParseInt(header[0], 10, 64)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("snapshot time: %w", err)
+	}
+	weather, ok := ParseWeather(header[1])
+	if !ok {
+		return Snapshot{}, fmt.Errorf("snapshot weather: unknown %q", header[1])
+	}
+
+	snap := Snapshot{Time: serverTime, Weather: weather, Players: make([]PlayerState, 0, len(entries)-1)}
+	for _, entry := range entries[1:] {
+		fields := strings.Split(entry, ",")
+		if len(fields) < 8 || len(fields) > 11 {
+			return Snapshot{}, fmt.Errorf("snapshot entry: want 8 to 11 fields, got %d", len(fields))
+		}
+		p, err := decodeStateFields(fields[1:7])
+		if err != nil {
+			return Snapshot{}, err
+		}
+		p.ID = fields[0]
+		if p.Warp, err = strconv.Atoi(fields[7]); err != nil {
+			return Snapshot{}, fmt.Errorf("snapshot warp: %w", err)
+		}
+		p.Idle = len(fields) >= 9 && fields[8] == "1"
+		if len(fields) >= 10 {
+			p.Mount = fields[9]
+		}
+		if len(fields) == 11 {
+			if p.Level, err = strconv.Atoi(fields[10]); err != nil {
+				return Snapshot{}, fmt.Errorf("snapshot level: %w", err)
+			}
+		}
+		snap.Players = append(snap.Players, p)
+	}
+	return snap, nil
+}
+
+// EncodeClock builds a clock sync payload. Clients send only their own send
+// time; the server echoes it back together with its own clock reading.
+func EncodeClock(clientTime, serverTime int64) string {
+	if serverTime == 0 {
+		return strconv.FormatInt(clientTime, 10)
+	}
+	return fmt.Sprintf("%d,%d", clientTime, serverTime)
+}
+
+func DecodeClock(payload string) (clientTime, serverTime int64, err error) {
+	fields := strings.Split(payload, ",")
+	if len(fields) > 2 {
+		return 0, 0, fmt.Errorf("clock: want at most 2 fields, got %d", len(fields))
+	}
+	if clientTime, err = strconv.ParseInt(fields[0], 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("clock client time: %w", err)
+	}
+	if len(fields) == 2 {
+		if serverTime, err = strconv.ParseInt(fields[1], 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("clock server time: %w", err)
+		}
+	}
+	return clientTime, serverTime, nil
+}
+
+func decodeStateFields(fields []string) (PlayerState, error) {
+	var p PlayerState
+	var err error
+	floats := []*float64{&p.X, &p.Y, &p.VX, &p.VY}
+	for i, f := range floats {
+		if *f, err = ParseFloat(fields[i]); err != nil {
+			return PlayerState{}, fmt.Errorf("state field %d: %w", i, err)
+		}
+	}
+	if p.Direction, err = strconv.Atoi(fields[4]); err != nil {
+		return PlayerState{}, fmt.Errorf("state direction: %w", err)
+	}
+	anim, err := strconv.Atoi(fields[5])
+	if err != nil {
+		return PlayerState{}, fmt.Errorf("state anim: %w", err)
+	}
+	if anim < int(AnimIdle) || anim > int(AnimDead) {
+		return PlayerState{}, fmt.Errorf("state anim: unknown state %d", anim)
+	}
+	p.Anim = AnimState(anim)
+	return p, nil
+}
+
+type ChatMessage struct {
+	Channel string
+	From    string
+	Text    string
+}
+
+// EncodeChat builds the server-to-client chat payload. The text goes last so
+// it may contain commas.
+func EncodeChat(m ChatMessage) string {
+	return m.Channel + "," + m.From + "," + m.Text
+}
+
+func DecodeChat(payload string) (ChatMessage, error) {
+	fields := strings.SplitN(payload, ",", 3)
+	if len(fields) != 3 {
+		return ChatMessage{}, fmt.Errorf("chat: want 3 fields, got %d", len(fields))
+	}
+	return ChatMessage{Channel: fields[0], From: fields[1], Text: fields[2]}, nil
+}
+
+// ParseChatInput splits what a player typed into a channel and the message,
+// honoring the /l, /z and /g prefixes. Unprefixed text goes to the zone.
+func ParseChatInput(input string) (channel, text string) {
+	prefixes := map[string]string{"/l": ChannelLocal, "/z": ChannelZone, "/g": ChannelGlobal}
+	command, rest, _ := strings.Cut(strings.TrimSpace(input), " ")
+	if channel, ok := prefixes[command]; ok {
+		return channel, strings.TrimSpace(rest)
+	}
+	return ChannelZone, strings.TrimSpace(input)
+}
+
+// Entity is a server-spawned world object such as an NPC or a dropped item.
+type Entity struct {
+	ID   string  `json:"id"`
+	Kind string  `json:"kind"`
+	Name string  `json:"name"`
+	X    float64 `json:"x"`
+	Y    float64 `json:"y"`
+	// Owner is the ID of the client with authority over the entity, or
+	// OwnerServer; see KindEntityMove.
+	Owner string `json:"owner,omitempty"`
+}
+
+func EncodeEntity(e Entity) string {
+	return fmt.Sprintf("%s,%s,%s,%.2f,%.2f,%s", e.ID, e.Kind, e.Name, e.X, e.Y, e.Owner)
+}
+
+// DecodeEntity also takes entities without the owner field, from peers
+// that predate it, as owned by the server.
+func DecodeEntity(payload string) (Entity, error) {
+	fields := strings.Split(payload, ",")
+	if len(fields) != 5 && len(fields) != 6 {
+		return Entity{}, fmt.Errorf("entity: want 5 or 6 fields, got %d", len(fields))
+	}
+	e := Entity{ID: fields[0], Kind: fields[1], Name: fields[2]}
+	if len(fields) == 6 {
+		e.Owner = fields[5]
+	}
+	var err error
+	if e.X, err = ParseFloat(fields[3]); err != nil {
+		return Entity{}, fmt.Errorf("entity x: %w", err)
+	}
+	if e.Y, err = ParseFloat(fields[4]); err != nil {
+		return Entity{}, fmt.Errorf("entity y: %w", err)
+	}
+	return e, nil
+}
+
+func EncodePosition(x, y float64) string {
+	return fmt.Sprintf("%.2f,%.2f", x, y)
+}
+
+// EncodeTeleport is a teleport target plus the Seq of the last state report
+// the server applied before it, or 0 if there was none.
+func EncodeTeleport(x, y float64, seq, level int) string {
+	return EncodePosition(x, y) + "," + strconv.Itoa(seq) + "," + strconv.Itoa(level)
+}
+
+// DecodeTeleport also takes teleports without the seq or level, from
+// servers that predate them.
+func DecodeTeleport(payload string) (x, y float64, seq, level int, err error) {
+	fields := strings.Split(payload, ",")
+	if len(fields) == 4 {
+		if level, err = strconv.Atoi(fields[3]); err != nil {
+			return 0, 0, 0, 0, fmt.Errorf("teleport level: %w", err)
+		}
+	}
+	if len(fields) >= 3 {
+		if seq, err = strconv.Atoi(fields[2]); err != nil {
+			return 0, 0, 0, 0, fmt.Errorf("teleport seq: %w", err)
+		}
+		payload = fields[0] + "," + fields[1]
+	}
+	x, y, err = DecodePosition(payload)
+	return x, y, seq, level, err
+}
+
+func DecodePosition(payload string) (x, y float64, err error) {
+	fields := strings.Split(payload, ",")
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("position: want 2 fields, got %d", len(fields))
+	}
+	if x, err = ParseFloat(fields[0]); err != nil {
+		return 0, 0, fmt.Errorf("position x: %w", err)
+	}
+	if y, err = ParseFloat(fields[1]); err != nil {
+		return 0, 0, fmt.Errorf("position y: %w", err)
+	}
+	return x, y, nil
+}
+
+// EncodeLogin logs in to account with its password. Account names cannot
+// contain the separator; passwords can.
+func EncodeLogin(account, password string) string {
+	return account + ";" + password
+}
+
+// DecodeLogin splits a login into its account and password, empty when none
+// was given.
+func DecodeLogin(payload string) (account, password string) {
+	account, password, _ = strings.Cut(payload, ";")
+	return account, password
+}
+
+// Appearances are the looks a new character can be created with.
+var Appearances = []string{"default", "crimson", "azure", "moss"}
+
+// CharacterSummary is one entry of an account's character list.
+type CharacterSummary struct {
+	Name       string
+	Appearance string
+	Room       string
+	Rating     int
+}
+
+func EncodeCharacters(chars []CharacterSummary) string {
+	entries := make([]string, len(chars))
+	for i, c := range chars {
+		entries[i] = c.Name + "," + c.Appearance + "," + c.Room + "," + strconv.Itoa(c.Rating)
+	}
+	return strings.Join(entries, ";")
+}
+
+func DecodeCharacters(payload string) ([]CharacterSummary, error) {
+	if payload == "" {
+		return nil, nil
+	}
+	var chars []CharacterSummary
+	for _, entry := range strings.Split(payload, ";") {
+		fields := strings.Split(entry, ",")
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("character: want 4 fields, got %d", len(fields))
+		}
+		rating, err := strconv.Atoi(fields[3])
+		if err != nil {
+			return nil, fmt.Errorf("character rating: %w", err)
+		}
+		chars = append(chars, CharacterSummary{Name: fields[0], Appearance: fields[1], Room: fields[2], Rating: rating})
+	}
+	return chars, nil
+}
+
+// LeaderboardEntry is one ranked character on a leaderboard.
+type LeaderboardEntry struct {
+	Rank  int
+	Name  string
+	Value float64
+}
+
+// EncodeLeaderboard builds the reply to a leaderboard request: the stat it
+// ranks, then one "rank,name,value" entry per character.
+func EncodeLeaderboard(stat string, entries []LeaderboardEntry) string {
+	parts := make([]string, 0, len(entries)+1)
+	parts = append(parts, stat)
+	for _, e := range entries {
+		parts = append(parts, fmt.Sprintf("%d,%s,%s", e.Rank, e.Name, strconv.FormatFloat(e.Value, 'f', -1, 64)))
+	}
+	return strings.Join(parts, ";")
+}
+
+func DecodeLeaderboard(payload string) (stat string, entries []LeaderboardEntry, err error) {
+	parts := strings.Split(payload, ";")
+	for _, part := range parts[1:] {
+		fields := strings.Split(part, ",")
+		if len(fields) != 3 {
+			return "", nil, fmt.Errorf("leaderboard entry: want 3 fields, got %d", len(fields))
+		}
+		e := LeaderboardEntry{Name: fields[1]}
+		if e.Rank, err = strconv.Atoi(fields[0]); err != nil {
+			return "", nil, fmt.Errorf("leaderboard rank: %w", err)
+		}
+		if e.Value, err = ParseFloat(fields[2]); err != nil {
+			return "", nil, fmt.Errorf("leaderboard value: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	return parts[0], entries, nil
+}
+
+// Resume carries a player from one zone server to another: who they are and
+// where they enter the next zone.
+type Resume struct {
+	Account   string
+	Character string
+	Guest     bool
+	Room      string
+	X, Y      float64
+}
+
+// EncodeResume puts the room last, since room names are free text.
+func EncodeResume(r Resume) string {
+	guest := "0"
+	if r.Guest {
+		guest = "1"
+	}
+	return fmt.Sprintf("%s,%s,%s,%.2f,%.2f,%s", r.Account, r.Character, guest, r.X, r.Y, r.Room)
+}
+
+func DecodeResume(payload string) (Resume, error) {
+	fields := strings.SplitN(payload, ",", 6)
+	if len(fields) != 6 {
+		return Resume{}, fmt.Errorf("resume: want 6 fields, got %d", len(fields))
+	}
+	r := Resume{Account: fields[0], Character: fields[1], Guest: fields[2] == "1", Room: fields[5]}
+	var err error
+	if r.X, r.Y, err = DecodePosition(fields[3] + "," + fields[4]); err != nil {
+		return Resume{}, fmt.Errorf("resume: %w", err)
+	}
+	return r, nil
+}
@@ -0,0 +1,187 @@
+package protocol
+
+import (
+	"bufio"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+// payloadDecoders is every decoder of a line's payload, each reduced to
+// its error. The fuzz targets check none of them panics, whatever arrives.
+var payloadDecoders = map[string]func(string) error{
+	"entitymove": func(p string) error { _, _, _, err := DecodeEntityMove(p); return err },
+	"recipes":    func(p string) error { _, err := DecodeRecipes(p); return err },
+	"craft":      func(p string) error { _, err := DecodeCraftStatus(p); return err },
+	"inventory":  func(p string) error { _, err := DecodeInventory(p); return err },
+	"defeat":     func(p string) error { _, err := DecodeDefeat(p); return err },
+	"dialogue":   func(p string) error { _, err := DecodeDialogueLine(p); return err },
+	"door":       func(p string) error { _, _, err := DecodeDoor(p); return err },
+	"feed":       func(p string) error { _, err := DecodeFeedEvent(p); return err },
+	"gather":     func(p string) error { _, err := DecodeGatherStatus(p); return err },
+	"ambient":    func(p string) error { _, err := DecodeAmbient(p); return err },
+	"mapdata":    func(p string) error { _, err := DecodeMapData(p); return err },
+	"mapedit":    func(p string) error { _, err := DecodeMapEdit(p); return err },
+	"mapcursor":  func(p string) error { _, err := DecodeMapCursor(p); return err },
+	"match":      func(p string) error { _, err := DecodeMatchStatus(p); return err },
+	"phase":      func(p string) error { _, err := DecodeMatchPhase(p); return err },
+	"results":    func(p string) error { _, err := DecodeMatchResults(p); return err },
+	"motd":       func(p string) error { _, err := DecodeMOTD(p); return err },
+	"party":      func(p string) error { _, err := DecodeParty(p); return err },
+	"pause":      func(p string) error { _, err := DecodePauseStatus(p); return err },
+	"state":      func(p string) error { _, err := DecodeState(p); return err },
+	"snapshot":   func(p string) error { _, err := DecodeSnapshot(p); return err },
+	"clock":      func(p string) error { _, _, err := DecodeClock(p); return err },
+	"chat":       func(p string) error { _, err := DecodeChat(p); return err },
+	"entity":     func(p string) error { _, err := DecodeEntity(p); return err },
+	"teleport":   func(p string) error { _, _, _, _, err := DecodeTeleport(p); return err },
+	"position":   func(p string) error { _, _, err := DecodePosition(p); return err },
+	"characters": func(p string) error { _, err := DecodeCharacters(p); return err },
+	"board":      func(p string) error { _, _, err := DecodeLeaderboard(p); return err },
+	"resume":     func(p string) error { _, err := DecodeResume(p); return err },
+	"push":       func(p string) error { _, err := DecodePush(p); return err },
+	"dash":       func(p string) error { _, _, err := DecodeDash(p); return err },
+	"qoffer":     func(p string) error { _, err := DecodeQuestOffer(p); return err },
+	"quest":      func(p string) error { _, err := DecodeQuestStatus(p); return err },
+	"resync":     func(p string) error { _, err := DecodeResync(p); return err },
+	"session":    func(p string) error { _, _, _, err := DecodeSession(p); return err },
+	"shop":       func(p string) error { _, err := DecodeShop(p); return err },
+	"status":     func(p string) error { _, err := DecodeStatusEffects(p); return err },
+	"seat":       func(p string) error { _, err := DecodeSeat(p); return err },
+	"vision":     func(p string) error { _, err := DecodeVision(p); return err },
+	"voice":      func(p string) error { _, _, _, err := DecodeVoiceOffer(p); return err },
+}
+
+// seedPayloads are payloads of the shapes the decoders expect, for the
+// fuzzer to start from.
+var seedPayloads = []string{
+	"",
+	",",
+	";;",
+	"410.00,300.00,120.00,0.00,1,1,7",
+	"1700000000000,rain;player1,400.00,300.00,0.00,0.00,0,0,0,0,,0",
+	"NaN,Inf,-Inf,1e309",
+	"e1,crate,10.5,20.25",
+	`{"name":"lobby","tiles":[[1,2],[3]]}`,
+	"12,4021.50,3,0",
+	"global,hello, world",
+	"duel,found,duel-1,alice;bob,5",
+	"4000,token,key",
+}
+
+func FuzzSplit(f *testing.F) {
+	for _, seed := range []string{"", "\n", "welcome,player1\n", "state," + seedPayloads[3], "kind", ",payload"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, line string) {
+		kind, payload := Split(line)
+		if strings.Contains(kind, ",") {
+			t.Errorf("kind %q holds a separator", kind)
+		}
+		if len(kind)+len(payload) > len(line) {
+			t.Errorf("split %q into more than it held: %q and %q", line, kind, payload)
+		}
+		if !strings.ContainsAny(line, "\r\n\t ") && !strings.Contains(kind, ",") {
+			if k, p := Split(Line(kind, payload)); k != kind || p != payload {
+				t.Errorf("Line(%q, %q) splits into %q, %q", kind, payload, k, p)
+			}
+		}
+	})
+}
+
+func FuzzDecode(f *testing.F) {
+	for _, seed := range seedPayloads {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, payload string) {
+		for _, decode := range payloadDecoders {
+			decode(payload)
+		}
+	})
+}
+
+// FuzzDecodeState checks what a client reports about itself is either
+// refused or finite, since the server moves the player there.
+func FuzzDecodeState(f *testing.F) {
+	for _, seed := range seedPayloads {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, payload string) {
+		p, err := DecodeState(payload)
+		if err != nil {
+			return
+		}
+		for _, v := range []float64{p.X, p.Y, p.VX, p.VY} {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				t.Fatalf("decoded %q to non-finite %+v", payload, p)
+			}
+		}
+		if _, err := DecodeState(EncodeReport(p)); err != nil {
+			t.Errorf("re-encoded %+v does not decode: %v", p, err)
+		}
+	})
+}
+
+func FuzzDecodePosition(f *testing.F) {
+	for _, seed := range []string{"10.50,20.25", "NaN,0", "1e309,0", ","} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, payload string) {
+		x, y, err := DecodePosition(payload)
+		if err == nil && (math.IsNaN(x) || math.IsInf(x, 0) || math.IsNaN(y) || math.IsInf(y, 0)) {
+			t.Fatalf("decoded %q to non-finite %v,%v", payload, x, y)
+		}
+	})
+}
+
+func FuzzDecodeVoicePacket(f *testing.F) {
+	f.Add([]byte{})
+	f.Add(EncodeVoicePacket("player1", 7, []byte{1, 2, 3}))
+	f.Add([]byte{255, 'a'})
+	f.Fuzz(func(t *testing.T, packet []byte) {
+		sender, seq, frame, err := DecodeVoicePacket(packet)
+		if err != nil {
+			return
+		}
+		if len(sender) > 255 {
+			t.Fatalf("sender of %d bytes from a one-byte length", len(sender))
+		}
+		again := EncodeVoicePacket(sender, seq, frame)
+		if string(again) != string(packet) {
+			t.Errorf("%x re-encodes as %x", packet, again)
+		}
+	})
+}
+
+// FuzzReadLine checks lines come back whole and none is read past
+// MaxLineLength.
+func FuzzReadLine(f *testing.F) {
+	f.Add("welcome,player1\nstate,1,2\n", 0)
+	f.Add("no newline", 0)
+	f.Add("x\n", MaxLineLength)
+	f.Fuzz(func(t *testing.T, input string, pad int) {
+		if pad < 0 || pad > 2*MaxLineLength {
+			return
+		}
+		input = strings.Repeat("a", pad) + input
+		r := bufio.NewReader(strings.NewReader(input))
+		read := 0
+		for {
+			line, err := ReadLine(r)
+			if errors.Is(err, ErrLineTooLong) {
+				return
+			}
+			if len(line) > MaxLineLength {
+				t.Fatalf("read a line of %d bytes", len(line))
+			}
+			read += len(line)
+			if err != nil {
+				break
+			}
+		}
+		if read != len(input) {
+			t.Errorf("read %d of %d bytes", read, len(input))
+		}
+	})
+}
@@ -0,0 +1,69 @@
+package protocol
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Forced movement. The server sends KindPush when something moves a player
+// against their will, as a knockback from a hit, a conveyor or a dash: the
+// player glides to X, Y over Seconds, easing out, and takes no movement
+// input until they arrive. Unlike a teleport, other players see the glide
+// rather than a snap. A player sends KindDash with the direction to dash
+// in, which the server answers with a push once the dash is off cooldown.
+const (
+	KindPush = "push"
+	KindDash = "dash"
+)
+
+type Push struct {
+	X, Y    float64
+	Seconds float64
+}
+
+// PushProgress is how far along its path a push is once t of its duration
+// has passed, from 0 to 1. Client and server ease the same way, so the
+// glide a player sees matches what everyone else is sent.
+func PushProgress(t float64) float64 {
+	t = math.Max(0, math.Min(t, 1))
+	return 1 - (1-t)*(1-t)
+}
+
+func EncodePush(p Push) string {
+	return fmt.Sprintf("%.2f,%.2f,%.3f", p.X, p.Y, p.Seconds)
+}
+
+func DecodePush(payload string) (Push, error) {
+	fields := strings.Split(payload, ",")
+	if len(fields) != 3 {
+		return Push{}, fmt.Errorf("push: want 3 fields, got %d", len(fields))
+	}
+	var values [3]float64
+	for i, f := range fields {
+		v, err := ParseFloat(f)
+		if err != nil {
+			return Push{}, fmt.Errorf("push: %w", err)
+		}
+		values[i] = v
+	}
+	return Push{X: values[0], Y: values[1], Seconds: values[2]}, nil
+}
+
+func EncodeDash(dx, dy float64) string {
+	return fmt.Sprintf("%.3f,%.3f", dx, dy)
+}
+
+func DecodeDash(payload string) (dx, dy float64, err error) {
+	xs, ys, ok := strings.Cut(payload, ",")
+	if !ok {
+		return 0, 0, fmt.Errorf("dash: want 2 fields in %q", payload)
+	}
+	if dx, err = ParseFloat(xs); err != nil {
+		return 0, 0, fmt.Errorf("dash: %w", err)
+	}
+	if dy, err = ParseFloat(ys); err != nil {
+		return 0, 0, fmt.Errorf("dash: %w", err)
+	}
+	return dx, dy, nil
+}
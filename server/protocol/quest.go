@@ -0,0 +1,67 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Interaction and quests. A player sends KindInteract with the ID of an NPC
+// within InteractRange. An NPC that gives a quest the player has not taken
+// answers with KindQuestOffer, which the player takes up by sending
+// KindQuestAccept with the quest ID. The server then reports each active
+// quest's progress with KindQuest, again whenever it changes, and a last
+// time with Done set once the quest is complete.
+const (
+	KindInteract    = "interact"
+	KindQuestOffer  = "qoffer"
+	KindQuestAccept = "qaccept"
+	KindQuest       = "quest"
+)
+
+// InteractRange is how close a player must stand to an NPC to talk to it.
+const InteractRange = 64.0
+
+type QuestOffer struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Giver       string `json:"giver"`
+}
+
+// QuestStatus is a player's progress on one quest: Step of Total objectives
+// are done, and Objective describes the next one.
+type QuestStatus struct {
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	Step      int    `json:"step"`
+	Total     int    `json:"total"`
+	Objective string `json:"objective,omitempty"`
+	Done      bool   `json:"done,omitempty"`
+	RewardXP  int    `json:"rewardXp,omitempty"`
+}
+
+func EncodeQuestOffer(o QuestOffer) string {
+	data, _ := json.Marshal(o)
+	return string(data)
+}
+
+func DecodeQuestOffer(payload string) (QuestOffer, error) {
+	var o QuestOffer
+	if err := json.Unmarshal([]byte(payload), &o); err != nil {
+		return QuestOffer{}, fmt.Errorf("quest offer: %w", err)
+	}
+	return o, nil
+}
+
+func EncodeQuestStatus(s QuestStatus) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+func DecodeQuestStatus(payload string) (QuestStatus, error) {
+	var s QuestStatus
+	if err := json.Unmarshal([]byte(payload), &s); err != nil {
+		return QuestStatus{}, fmt.Errorf("quest status: %w", err)
+	}
+	return s, nil
+}
@@ -0,0 +1,47 @@
+package protocol
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// Resync. The server sends KindResync whenever a player enters a room, on
+// connecting, reconnecting or moving between rooms, with everything the
+// client needs to rebuild its view of the world from scratch: which room
+// and map it is in, the player's own state and the players and entities
+// around them. Clients drop what they knew of the world before and take
+// this in its place, so nothing from an earlier room or connection lingers.
+const KindResync = "resync"
+
+type Resync struct {
+	Room string `json:"room"`
+	// MapHash is the MapHash of the server's map file, empty when it runs
+	// without one. A client whose own copy hashes differently is drawing
+	// a different world from the one the server checks movement against.
+	MapHash  string        `json:"mapHash,omitempty"`
+	Self     PlayerState   `json:"self"`
+	Players  []PlayerState `json:"players"`
+	Entities []Entity      `json:"entities"`
+}
+
+func EncodeResync(r Resync) string {
+	data, _ := json.Marshal(r)
+	return string(data)
+}
+
+func DecodeResync(payload string) (Resync, error) {
+	var r Resync
+	if err := json.Unmarshal([]byte(payload), &r); err != nil {
+		return Resync{}, fmt.Errorf("resync: %w", err)
+	}
+	return r, nil
+}
+
+// MapHash identifies the contents of a map file, for the client and server
+// to check they are playing the same map.
+func MapHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,38 @@
+package protocol
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Session summaries. A client may send KindSession as it quits with what
+// it counted over the session: seconds played, pixels walked, chat lines
+// sent and deaths. The server takes them only as far as it saw for itself.
+
+func EncodeSession(seconds int64, distance float64, chats, deaths int) string {
+	return fmt.Sprintf("%d,%.0f,%d,%d", seconds, math.Round(distance), chats, deaths)
+}
+
+// DecodeSession refuses summaries with negative counts. The deaths are
+// left out, since the server counts those itself.
+func DecodeSession(payload string) (seconds int64, distance float64, chats int, err error) {
+	fields := strings.Split(payload, ",")
+	if len(fields) != 4 {
+		return 0, 0, 0, fmt.Errorf("session: want 4 fields, got %d", len(fields))
+	}
+	if seconds, err = strconv.ParseInt(fields[0], 10, 64); err != nil {
+		return 0, 0, 0, fmt.Errorf("session seconds: %w", err)
+	}
+	if distance, err = ParseFloat(fields[1]); err != nil {
+		return 0, 0, 0, fmt.Errorf("session distance: %w", err)
+	}
+	if chats, err = strconv.Atoi(fields[2]); err != nil {
+		return 0, 0, 0, fmt.Errorf("session chats: %w", err)
+	}
+	if seconds < 0 || distance < 0 || chats < 0 {
+		return 0, 0, 0, fmt.Errorf("session: negative count in %q", payload)
+	}
+	return seconds, distance, chats, nil
+}
@@ -0,0 +1,47 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Vendors. Talking to a vendor NPC opens its shop: the server sends the
+// stock as KindShop, and the player sends KindShopBuy or KindShopSell with
+// an item name to trade one of it. After every trade the server sends the
+// shop again with the player's new gold and inventory. KindShopClose from
+// the player, or an empty KindShop from the server, closes it.
+const (
+	KindShop      = "shop"
+	KindShopBuy   = "buy"
+	KindShopSell  = "sell"
+	KindShopClose = "shopclose"
+)
+
+// ShopItem is one line of a vendor's stock. Buy is what the vendor charges
+// and Sell what it pays; zero means it does not trade that way. Owned is
+// how many the player carries.
+type ShopItem struct {
+	Item  string `json:"item"`
+	Buy   int    `json:"buy,omitempty"`
+	Sell  int    `json:"sell,omitempty"`
+	Owned int    `json:"owned,omitempty"`
+}
+
+type Shop struct {
+	NPC   string     `json:"npc"`
+	Gold  int        `json:"gold"`
+	Items []ShopItem `json:"items"`
+}
+
+func EncodeShop(s Shop) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+func DecodeShop(payload string) (Shop, error) {
+	var s Shop
+	if err := json.Unmarshal([]byte(payload), &s); err != nil {
+		return Shop{}, fmt.Errorf("shop: %w", err)
+	}
+	return s, nil
+}
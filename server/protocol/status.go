@@ -0,0 +1,65 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Status effects. Whenever a player's effects change, as one is applied,
+// stacks or wears off, every player in the room is sent KindStatus with
+// the player's ID and all of their current effects; an empty list clears
+// them. A player entering a room is sent one for each affected player
+// already there.
+const KindStatus = "status"
+
+const (
+	EffectSpeed  = "speed"
+	EffectSlow   = "slow"
+	EffectPoison = "poison"
+	// EffectInvulnerable keeps attacks off a player who just respawned.
+	EffectInvulnerable = "invulnerable"
+)
+
+// speedFactors is how much each stack of an effect scales movement speed.
+var speedFactors = map[string]float64{
+	EffectSpeed: 1.5,
+	EffectSlow:  0.5,
+}
+
+// StatusEffect is an effect with Seconds left to run, applied Stacks times.
+type StatusEffect struct {
+	Kind    string  `json:"kind"`
+	Seconds float64 `json:"seconds"`
+	Stacks  int     `json:"stacks,omitempty"`
+}
+
+type StatusEffects struct {
+	Player  string         `json:"player"`
+	Effects []StatusEffect `json:"effects,omitempty"`
+}
+
+// SpeedFactor is what effects scale a player's movement speed by.
+func SpeedFactor(effects []StatusEffect) float64 {
+	factor := 1.0
+	for _, e := range effects {
+		if f, ok := speedFactors[e.Kind]; ok {
+			for range max(e.Stacks, 1) {
+				factor *= f
+			}
+		}
+	}
+	return factor
+}
+
+func EncodeStatusEffects(s StatusEffects) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+func DecodeStatusEffects(payload string) (StatusEffects, error) {
+	var s StatusEffects
+	if err := json.Unmarshal([]byte(payload), &s); err != nil {
+		return StatusEffects{}, fmt.Errorf("status effects: %w", err)
+	}
+	return s, nil
+}
@@ -0,0 +1,6 @@
+package protocol
+
+// Targeting. A player sends KindTarget with the ID of the player they have
+// picked out, or an empty payload to clear it, so the server knows whom
+// their abilities are aimed at. The target must be in the same room.
+const KindTarget = "target"
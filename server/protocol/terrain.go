@@ -0,0 +1,52 @@
+package protocol
+
+import "math"
+
+// Terrain. A map's terrain array gives each of its cells a Terrain, grass
+// where it gives none, which changes how players move across it: water and
+// mud slow them, and on ice they slide, slow to get going, stop or turn.
+// The server holds reported movement to what the terrain allows, and
+// clients draw players in water swimming.
+type Terrain int
+
+const (
+	TerrainGrass Terrain = iota
+	TerrainWater
+	TerrainMud
+	TerrainIce
+)
+
+// WalkSpeed is how fast players move on grass, in pixels per second.
+const WalkSpeed = 200.0
+
+// iceGrip is how much of the way to the direction they want players on ice
+// turn each second.
+const iceGrip = 2.5
+
+var terrainSpeeds = map[Terrain]float64{
+	TerrainWater: 0.5,
+	TerrainMud:   0.6,
+}
+
+// ValidTerrain reports whether t is one of the terrains above.
+func ValidTerrain(t Terrain) bool {
+	return t >= TerrainGrass && t <= TerrainIce
+}
+
+// Speed is what the terrain scales movement speed by.
+func (t Terrain) Speed() float64 {
+	if f, ok := terrainSpeeds[t]; ok {
+		return f
+	}
+	return 1
+}
+
+// Steer turns a player's movement, moveX, moveY with each in [-1, 1],
+// toward the movement they want over seconds: at once, except on ice.
+func (t Terrain) Steer(moveX, moveY, wantX, wantY, seconds float64) (float64, float64) {
+	if t != TerrainIce {
+		return wantX, wantY
+	}
+	k := math.Min(1, iceGrip*seconds)
+	return moveX + (wantX-moveX)*k, moveY + (wantY-moveY)*k
+}
@@ -0,0 +1,55 @@
+package protocol
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Vehicles. A vehicle is an entity several players ride together, such as
+// a boat, with the seats VehicleSeats gives for its name; the first seat is
+// the driver's. A player boards by sending KindInteract with the vehicle's
+// ID from within InteractRange, taking the first free seat, and gets out by
+// interacting with it again. Whoever drives owns the vehicle, steering it
+// with their movement and sending its moves as KindEntityMove like any
+// owner; the server carries everyone aboard along at their seat's offset
+// and ignores their own state reports until they get out. The room is told
+// who sits where with KindSeat: the vehicle's ID, the seat and the player's
+// ID, empty once the seat is free.
+const KindSeat = "seat"
+
+// VehicleSpeed is how fast drivers steer vehicles, in pixels per second.
+const VehicleSpeed = 160.0
+
+// Seat is where a seat is, relative to its vehicle's position.
+type Seat struct {
+	X, Y float64
+}
+
+// VehicleSeats lists each vehicle's seats, the driver's first.
+var VehicleSeats = map[string][]Seat{
+	"boat": {{48, -12}, {24, -12}, {0, -12}},
+	"cart": {{24, -12}, {0, -12}},
+}
+
+type SeatChange struct {
+	Vehicle string
+	Seat    int
+	Player  string
+}
+
+func EncodeSeat(s SeatChange) string {
+	return fmt.Sprintf("%s,%d,%s", s.Vehicle, s.Seat, s.Player)
+}
+
+func DecodeSeat(payload string) (SeatChange, error) {
+	fields := strings.Split(payload, ",")
+	if len(fields) != 3 {
+		return SeatChange{}, fmt.Errorf("seat: want 3 fields, got %d", len(fields))
+	}
+	seat, err := strconv.Atoi(fields[1])
+	if err != nil || seat < 0 {
+		return SeatChange{}, fmt.Errorf("seat: bad seat %q", fields[1])
+	}
+	return SeatChange{Vehicle: fields[0], Seat: seat, Player: fields[2]}, nil
+}
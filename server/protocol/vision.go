@@ -0,0 +1,32 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Fog of war. The server sends KindVision as a player enters a room, with
+// how far players see there, 0 when they see everything. While the
+// radius is not 0, it is sent again every so often with where the
+// player's party members in the room are, as they may be too far away to
+// be in snapshots. Clients hide what neither the player nor their party
+// members can see, and dim what the player has seen before.
+const KindVision = "vision"
+
+type Vision struct {
+	Radius float64      `json:"radius"`
+	Allies [][2]float64 `json:"allies,omitempty"`
+}
+
+func EncodeVision(v Vision) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+func DecodeVision(payload string) (Vision, error) {
+	var v Vision
+	if err := json.Unmarshal([]byte(payload), &v); err != nil {
+		return Vision{}, fmt.Errorf("vision: %w", err)
+	}
+	return v, nil
+}
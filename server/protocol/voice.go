@@ -0,0 +1,134 @@
+package protocol
+
+import (
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// VoiceRadius is how far a player's voice carries. The server only relays
+// voice to players this close, and clients fade speakers out toward it.
+const VoiceRadius = 600.0
+
+// voiceTagSize is how much of an HMAC-SHA256 each voice packet carries.
+const voiceTagSize = 16
+
+func EncodeVoiceOffer(port int, token, key string) string {
+	return strconv.Itoa(port) + "," + token + "," + key
+}
+
+func DecodeVoiceOffer(payload string) (port int, token, key string, err error) {
+	fields := strings.Split(payload, ",")
+	if len(fields) != 3 || fields[1] == "" || fields[2] == "" {
+		return 0, "", "", fmt.Errorf("voice offer: want port, token and key, got %q", payload)
+	}
+	port, err = strconv.Atoi(fields[0])
+	if err != nil {
+		return 0, "", "", fmt.Errorf("voice port: %w", err)
+	}
+	return port, fields[1], fields[2], nil
+}
+
+// VoiceKeys authenticate voice packets: Up the ones a client sends and Down
+// the ones the server relays to it, so neither can be passed off as the
+// other. Each end makes a NewVoiceKey and sends the other its public half
+// over the game connection, and both derive the same keys from the X25519
+// exchange; datagrams from anyone else fail the check and are dropped.
+type VoiceKeys struct {
+	Up, Down []byte
+}
+
+func NewVoiceKey() (*ecdh.PrivateKey, error) {
+	return ecdh.X25519().GenerateKey(rand.Reader)
+}
+
+// EncodeVoiceKey is the public half of key, for the other end.
+func EncodeVoiceKey(key *ecdh.PrivateKey) string {
+	return hex.EncodeToString(key.PublicKey().Bytes())
+}
+
+// DeriveVoiceKeys completes the exchange with the other end's public half,
+// binding the keys to the session's token.
+func DeriveVoiceKeys(key *ecdh.PrivateKey, peer, token string) (VoiceKeys, error) {
+	raw, err := hex.DecodeString(peer)
+	if err != nil {
+		return VoiceKeys{}, fmt.Errorf("voice key: %w", err)
+	}
+	public, err := ecdh.X25519().NewPublicKey(raw)
+	if err != nil {
+		return VoiceKeys{}, fmt.Errorf("voice key: %w", err)
+	}
+	shared, err := key.ECDH(public)
+	if err != nil {
+		return VoiceKeys{}, fmt.Errorf("voice key: %w", err)
+	}
+	return VoiceKeys{Up: voiceKey(shared, "up", token), Down: voiceKey(shared, "down", token)}, nil
+}
+
+func voiceKey(shared []byte, direction, token string) []byte {
+	mac := hmac.New(sha256.New, shared)
+	mac.Write([]byte("voice " + direction + " " + token))
+	return mac.Sum(nil)
+}
+
+func voiceTag(key, packet []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(packet)
+	return mac.Sum(nil)[:voiceTagSize]
+}
+
+// SealVoicePacket is a copy of packet with its tag under key appended.
+func SealVoicePacket(key, packet []byte) []byte {
+	sealed := make([]byte, 0, len(packet)+voiceTagSize)
+	sealed = append(sealed, packet...)
+	return append(sealed, voiceTag(key, packet)...)
+}
+
+// OpenVoicePacket checks packet's tag under key and returns the packet
+// without it, which aliases packet.
+func OpenVoicePacket(key, packet []byte) ([]byte, error) {
+	if len(packet) < voiceTagSize {
+		return nil, errors.New("voice packet: no tag")
+	}
+	body, tag := packet[:len(packet)-voiceTagSize], packet[len(packet)-voiceTagSize:]
+	if !hmac.Equal(tag, voiceTag(key, body)) {
+		return nil, errors.New("voice packet: bad tag")
+	}
+	return body, nil
+}
+
+// Voice travels over UDP rather than the line protocol, one Opus frame per
+// datagram: a length-prefixed sender, a big-endian sequence number, then the
+// frame. Clients send their voice token as the sender, and the server
+// replaces it with the speaker's player ID when relaying. A packet with an
+// empty frame is a keepalive. On the wire every packet is sealed with a tag
+// under one of its VoiceKeys, and every one a client sends takes the next
+// sequence number, so the server can tell a replayed packet from a new one.
+func EncodeVoicePacket(sender string, seq uint16, frame []byte) []byte {
+	packet := make([]byte, 0, 1+len(sender)+2+len(frame))
+	packet = append(packet, byte(len(sender)))
+	packet = append(packet, sender...)
+	packet = binary.BigEndian.AppendUint16(packet, seq)
+	return append(packet, frame...)
+}
+
+// DecodeVoicePacket splits a voice packet. The frame aliases packet.
+func DecodeVoicePacket(packet []byte) (sender string, seq uint16, frame []byte, err error) {
+	if len(packet) < 1 {
+		return "", 0, nil, errors.New("voice packet: empty")
+	}
+	n := int(packet[0])
+	if len(packet) < 1+n+2 {
+		return "", 0, nil, fmt.Errorf("voice packet: %d bytes is too short", len(packet))
+	}
+	sender = string(packet[1 : 1+n])
+	seq = binary.BigEndian.Uint16(packet[1+n:])
+	return sender, seq, packet[1+n+2:], nil
+}
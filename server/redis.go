@@ -0,0 +1,57 @@
+//go:build redis
+
+package main
+
+// Building with -tags redis links the Redis client so -broker accepts
+// redis:// URLs.
+import (
+	"context"
+
+	"darkzone/MultiTestServer/gameserver"
+	"github.com/redis/go-redis/v9"
+)
+
+func init() {
+	open := func(url string) (gameserver.Broker, error) {
+		opts, err := redis.ParseURL(url)
+		if err != nil {
+			return nil, err
+		}
+		client := redis.NewClient(opts)
+		if err := client.Ping(context.Background()).Err(); err != nil {
+			client.Close()
+			return nil, err
+		}
+		return redisBroker{client}, nil
+	}
+	brokers["redis"] = open
+	brokers["rediss"] = open
+}
+
+type redisBroker struct {
+	client *redis.Client
+}
+
+func (b redisBroker) Publish(subject string, data []byte) error {
+	return b.client.Publish(context.Background(), subject, data).Err()
+}
+
+// Subscribe waits for Redis to confirm the subscription, then delivers
+// messages from its own goroutine until the client is closed.
+func (b redisBroker) Subscribe(subject string, handler func(data []byte)) error {
+	sub := b.client.Subscribe(context.Background(), subject)
+	if _, err := sub.Receive(context.Background()); err != nil {
+		sub.Close()
+		return err
+	}
+	go func() {
+		for m := range sub.Channel() {
+			handler([]byte(m.Payload))
+		}
+	}()
+	return nil
+}
+
+func (b redisBroker) Close() error {
+	return b.client.Close()
+}
@@ -0,0 +1,381 @@
+// Package script runs small Starlark scripts for server gameplay logic, so
+// NPC behaviour, chat commands and join/leave hooks can be changed without
+// rebuilding the server.
+//
+// A script file registers handlers when it loads:
+//
+//	def welcome(event):
+//	    tell("Welcome to %s, %s!" % (event.room, event.player))
+//
+//	on_join(welcome)
+//
+//	def roll(event):
+//	    say("%s rolls the dice: %d" % (event.player, rand(100)))
+//
+//	on_command("/roll", roll)
+//
+//	def patrol(event):
+//	    wander("Guard", 64)
+//
+//	every("5s", patrol)
+//
+// on_join, on_leave, on_command and every register handlers; the actions
+// (say, tell, announce, spawn, despawn, wander, teleport, warp, weather,
+// score and effect) and rand can only be called from one. Handlers get an
+// event with player, id, room, args, x and y; x and y are None when no
+// player fired it. A script's globals are frozen once it has loaded.
+package script
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
+)
+
+const (
+	EventJoin    = "join"
+	EventLeave   = "leave"
+	EventCommand = "command"
+	EventEvery   = "every"
+)
+
+// maxSteps is how much work a script may do loading or in one handler, so
+// a runaway loop cannot stall the room running it.
+const maxSteps = 1_000_000
+
+// Thread-local keys: a loading script's registered triggers and, while a
+// handler runs, the Host it acts on.
+const (
+	triggersKey = "triggers"
+	hostKey     = "host"
+)
+
+// Host performs actions on behalf of a script. The game server implements
+// it per room, bound to the player that fired the trigger, if any.
+type Host interface {
+	Say(text string)
+	Tell(text string)
+	Announce(text string)
+	Spawn(kind, name string, x, y float64)
+	Despawn(name string)
+	Wander(name string, radius float64)
+	Teleport(x, y float64)
+	Warp(room string, x, y float64)
+	SetWeather(weather string) error
+	AddScore(points int)
+	ApplyEffect(kind string, seconds float64) error
+	// Rand returns a number from 1 to n. Rooms draw it from their own
+	// source, so simulations replay it.
+	Rand(n int) int
+}
+
+// number unpacks a Starlark int or float argument, refusing NaN and the
+// infinities as protocol.ParseFloat does.
+type number float64
+
+func (n *number) Unpack(v starlark.Value) error {
+	f, ok := starlark.AsFloat(v)
+	if !ok {
+		return fmt.Errorf("got %s, want number", v.Type())
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return fmt.Errorf("%v is not a finite number", f)
+	}
+	*n = number(f)
+	return nil
+}
+
+// action makes a builtin that only handlers may call, running do with the
+// handler's Host. A nil result is None.
+func action(name string, do func(h Host, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error)) *starlark.Builtin {
+	return starlark.NewBuiltin(name, func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		h, ok := thread.Local(hostKey).(Host)
+		if !ok {
+			return nil, fmt.Errorf("%s: only a handler can call it", b.Name())
+		}
+		result, err := do(h, args, kwargs)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", b.Name(), err)
+		}
+		if result == nil {
+			result = starlark.None
+		}
+		return result, nil
+	})
+}
+
+// text makes an action taking a single string.
+func text(name string, do func(h Host, text string)) *starlark.Builtin {
+	return action(name, func(h Host, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var s string
+		if err := starlark.UnpackArgs(name, args, kwargs, "text", &s); err != nil {
+			return nil, err
+		}
+		do(h, s)
+		return nil, nil
+	})
+}
+
+// register makes a builtin that adds a trigger for event while the script
+// loads, taking the handler after any arguments setup reads.
+func register(name, event string, setup func(t *Trigger, arg string) error) *starlark.Builtin {
+	return starlark.NewBuiltin(name, func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		triggers, ok := thread.Local(triggersKey).(*[]*Trigger)
+		if !ok {
+			return nil, fmt.Errorf("%s: only a script loading can call it", b.Name())
+		}
+		t := &Trigger{Event: event, File: thread.Name}
+		var fn starlark.Callable
+		if setup == nil {
+			if err := starlark.UnpackArgs(name, args, kwargs, "handler", &fn); err != nil {
+				return nil, err
+			}
+		} else {
+			var arg string
+			if err := starlark.UnpackArgs(name, args, kwargs, "name", &arg, "handler", &fn); err != nil {
+				return nil, err
+			}
+			if err := setup(t, arg); err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+		}
+		fn.Freeze()
+		t.fn = fn
+		*triggers = append(*triggers, t)
+		return starlark.None, nil
+	})
+}
+
+var builtins = starlark.StringDict{
+	"on_join":  register("on_join", EventJoin, nil),
+	"on_leave": register("on_leave", EventLeave, nil),
+	"on_command": register("on_command", EventCommand, func(t *Trigger, command string) error {
+		if !strings.HasPrefix(command, "/") || strings.ContainsAny(command, " \t") {
+			return fmt.Errorf("commands look like /name, not %q", command)
+		}
+		t.Command = command
+		return nil
+	}),
+	"every": register("every", EventEvery, func(t *Trigger, interval string) error {
+		d, err := time.ParseDuration(interval)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("bad interval %q", interval)
+		}
+		t.Interval = d
+		return nil
+	}),
+
+	"say":      text("say", Host.Say),
+	"tell":     text("tell", Host.Tell),
+	"announce": text("announce", Host.Announce),
+	"spawn": action("spawn", func(h Host, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var kind, name string
+		var x, y number
+		if err := starlark.UnpackArgs("spawn", args, kwargs, "kind", &kind, "name", &name, "x", &x, "y", &y); err != nil {
+			return nil, err
+		}
+		h.Spawn(kind, name, float64(x), float64(y))
+		return nil, nil
+	}),
+	"despawn": action("despawn", func(h Host, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var name string
+		if err := starlark.UnpackArgs("despawn", args, kwargs, "name", &name); err != nil {
+			return nil, err
+		}
+		h.Despawn(name)
+		return nil, nil
+	}),
+	"wander": action("wander", func(h Host, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var name string
+		var radius number
+		if err := starlark.UnpackArgs("wander", args, kwargs, "name", &name, "radius", &radius); err != nil {
+			return nil, err
+		}
+		h.Wander(name, float64(radius))
+		return nil, nil
+	}),
+	"teleport": action("teleport", func(h Host, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var x, y number
+		if err := starlark.UnpackArgs("teleport", args, kwargs, "x", &x, "y", &y); err != nil {
+			return nil, err
+		}
+		h.Teleport(float64(x), float64(y))
+		return nil, nil
+	}),
+	"warp": action("warp", func(h Host, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var room string
+		var x, y number
+		if err := starlark.UnpackArgs("warp", args, kwargs, "room", &room, "x", &x, "y", &y); err != nil {
+			return nil, err
+		}
+		h.Warp(room, float64(x), float64(y))
+		return nil, nil
+	}),
+	"weather": action("weather", func(h Host, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var weather string
+		if err := starlark.UnpackArgs("weather", args, kwargs, "weather", &weather); err != nil {
+			return nil, err
+		}
+		return nil, h.SetWeather(weather)
+	}),
+	"score": action("score", func(h Host, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var points int
+		if err := starlark.UnpackArgs("score", args, kwargs, "points", &points); err != nil {
+			return nil, err
+		}
+		h.AddScore(points)
+		return nil, nil
+	}),
+	"effect": action("effect", func(h Host, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var kind string
+		var seconds number
+		if err := starlark.UnpackArgs("effect", args, kwargs, "kind", &kind, "seconds", &seconds); err != nil {
+			return nil, err
+		}
+		return nil, h.ApplyEffect(kind, float64(seconds))
+	}),
+	"rand": action("rand", func(h Host, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var n int
+		if err := starlark.UnpackArgs("rand", args, kwargs, "n", &n); err != nil {
+			return nil, err
+		}
+		if n < 1 {
+			return nil, fmt.Errorf("n must be at least 1, not %d", n)
+		}
+		return starlark.MakeInt(h.Rand(n)), nil
+	}),
+}
+
+type Trigger struct {
+	Event    string
+	Command  string
+	Interval time.Duration
+	File     string
+	fn       starlark.Callable
+}
+
+// Context is what a trigger fires with. Player and ID are empty, and
+// Positioned false, when no player fired it.
+type Context struct {
+	Room, Args string
+	Player, ID string
+	X, Y       float64
+	Positioned bool
+}
+
+// Run calls the trigger's handler with an event built from ctx.
+func (t *Trigger) Run(h Host, ctx Context) error {
+	var x, y starlark.Value = starlark.None, starlark.None
+	if ctx.Positioned {
+		x, y = starlark.Float(ctx.X), starlark.Float(ctx.Y)
+	}
+	event := starlarkstruct.FromStringDict(starlark.String("event"), starlark.StringDict{
+		"room":   starlark.String(ctx.Room),
+		"args":   starlark.String(ctx.Args),
+		"player": starlark.String(ctx.Player),
+		"id":     starlark.String(ctx.ID),
+		"x":      x,
+		"y":      y,
+	})
+
+	thread := &starlark.Thread{Name: t.File}
+	thread.SetLocal(hostKey, h)
+	thread.SetMaxExecutionSteps(maxSteps)
+	_, err := starlark.Call(thread, t.fn, starlark.Tuple{event}, nil)
+	return describe(err)
+}
+
+// describe turns a Starlark evaluation error into one carrying its
+// backtrace, which names the script file and line.
+func describe(err error) error {
+	var evalErr *starlark.EvalError
+	if errors.As(err, &evalErr) {
+		return errors.New(evalErr.Backtrace())
+	}
+	return err
+}
+
+// Set is every trigger loaded from a script directory.
+type Set struct {
+	triggers []*Trigger
+}
+
+func (s *Set) On(event string) []*Trigger {
+	if s == nil {
+		return nil
+	}
+	var matched []*Trigger
+	for _, t := range s.triggers {
+		if t.Event == event {
+			matched = append(matched, t)
+		}
+	}
+	return matched
+}
+
+// Command finds the trigger for a chat line such as "/roll 2d6" and returns
+// the text after the command.
+func (s *Set) Command(text string) (*Trigger, string, bool) {
+	if s == nil || !strings.HasPrefix(text, "/") {
+		return nil, "", false
+	}
+	command, rest, _ := strings.Cut(text, " ")
+	for _, t := range s.triggers {
+		if t.Event == EventCommand && t.Command == command {
+			return t, strings.TrimSpace(rest), true
+		}
+	}
+	return nil, "", false
+}
+
+func (s *Set) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.triggers)
+}
+
+// Parse loads one script file and returns the triggers it registered.
+// Errors carry the file name and line number.
+func Parse(file, src string) ([]*Trigger, error) {
+	var triggers []*Trigger
+	thread := &starlark.Thread{Name: file}
+	thread.SetLocal(triggersKey, &triggers)
+	thread.SetMaxExecutionSteps(maxSteps)
+	if _, err := starlark.ExecFileOptions(&syntax.FileOptions{}, thread, file, src, builtins); err != nil {
+		return nil, describe(err)
+	}
+	return triggers, nil
+}
+
+// LoadDir loads every *.star file in dir into one Set.
+func LoadDir(dir string) (*Set, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.star"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	set := &Set{}
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		triggers, err := Parse(filepath.Base(file), string(src))
+		if err != nil {
+			return nil, err
+		}
+		set.triggers = append(set.triggers, triggers...)
+	}
+	return set, nil
+}
@@ -0,0 +1,66 @@
+package script
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// recordingHost keeps what scripts say and rolls a fixed number.
+type recordingHost struct {
+	said []string
+}
+
+func (h *recordingHost) Say(text string)                          { h.said = append(h.said, text) }
+func (h *recordingHost) Tell(text string)                         { h.said = append(h.said, text) }
+func (h *recordingHost) Announce(text string)                     { h.said = append(h.said, text) }
+func (h *recordingHost) Spawn(kind, name string, x, y float64)    {}
+func (h *recordingHost) Despawn(name string)                      {}
+func (h *recordingHost) Wander(name string, radius float64)       {}
+func (h *recordingHost) Teleport(x, y float64)                    {}
+func (h *recordingHost) Warp(room string, x, y float64)           {}
+func (h *recordingHost) SetWeather(weather string) error          { return nil }
+func (h *recordingHost) AddScore(points int)                      {}
+func (h *recordingHost) ApplyEffect(kind string, s float64) error { return nil }
+func (h *recordingHost) Rand(n int) int                           { return 4 }
+
+func TestLobbyScript(t *testing.T) {
+	src, err := os.ReadFile("../scripts/lobby.star")
+	if err != nil {
+		t.Fatal(err)
+	}
+	triggers, err := Parse("lobby.star", string(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := &Set{triggers: triggers}
+
+	roll, _, ok := set.Command("/roll")
+	if !ok {
+		t.Fatal("no /roll command")
+	}
+	h := &recordingHost{}
+	if err := roll.Run(h, Context{Room: "lobby", Player: "Alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Alice rolls 4"}; len(h.said) != 1 || h.said[0] != want[0] {
+		t.Errorf("/roll said %q, want %q", h.said, want)
+	}
+	if n := len(set.On(EventEvery)); n != 1 {
+		t.Errorf("%d timers, want 1", n)
+	}
+}
+
+func TestScriptLimits(t *testing.T) {
+	if _, err := Parse("load.star", `say("hi")`); err == nil || !strings.Contains(err.Error(), "only a handler") {
+		t.Errorf("acting while loading: got %v", err)
+	}
+
+	triggers, err := Parse("spin.star", "def spin(event):\n    for i in range(100000000):\n        pass\n\non_join(spin)\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := triggers[0].Run(&recordingHost{}, Context{}); err == nil {
+		t.Error("a runaway handler ran to the end")
+	}
+}
@@ -0,0 +1,53 @@
+package script
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Watch polls dir and calls reload with a fresh Set whenever a script is
+// added, removed or modified. A script that fails to parse is logged and the
+// previous Set stays in use.
+func Watch(dir string, interval time.Duration, reload func(*Set)) {
+	last := fingerprint(dir)
+	for range time.Tick(interval) {
+		current := fingerprint(dir)
+		if current == last {
+			continue
+		}
+		last = current
+
+		set, err := LoadDir(dir)
+		if err != nil {
+			log.Println("Error reloading scripts:", err)
+			continue
+		}
+		log.Printf("Reloaded %d script triggers from %s", set.Len(), dir)
+		reload(set)
+	}
+}
+
+type dirFingerprint struct {
+	files  int
+	newest time.Time
+	size   int64
+}
+
+func fingerprint(dir string) dirFingerprint {
+	var fp dirFingerprint
+	files, _ := filepath.Glob(filepath.Join(dir, "*.star"))
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		fp.files++
+		fp.size += info.Size()
+		if info.ModTime().After(fp.newest) {
+			fp.newest = info.ModTime()
+		}
+	}
+	return fp
+}
@@ -0,0 +1,132 @@
+// Package spatial indexes positioned values in fixed-size square chunks, so
+// range queries only visit the chunks that overlap the query area.
+package spatial
+
+import "math"
+
+type chunk struct {
+	x, y int
+}
+
+type entry[V any] struct {
+	value V
+	x, y  float64
+	chunk chunk
+}
+
+// Grid maps keys to positioned values. It is not safe for concurrent use;
+// each owner guards it the same way it guarded the map it replaces.
+type Grid[K comparable, V any] struct {
+	size    float64
+	entries map[K]*entry[V]
+	chunks  map[chunk]map[K]*entry[V]
+}
+
+func NewGrid[K comparable, V any](chunkSize float64) *Grid[K, V] {
+	return &Grid[K, V]{
+		size:    chunkSize,
+		entries: make(map[K]*entry[V]),
+		chunks:  make(map[chunk]map[K]*entry[V]),
+	}
+}
+
+func (g *Grid[K, V]) chunkAt(x, y float64) chunk {
+	return chunk{int(math.Floor(x / g.size)), int(math.Floor(y / g.size))}
+}
+
+// Set inserts or replaces the value for key at the given position.
+func (g *Grid[K, V]) Set(key K, value V, x, y float64) {
+	if e, ok := g.entries[key]; ok {
+		e.value = value
+		g.Move(key, x, y)
+		return
+	}
+	e := &entry[V]{value: value, x: x, y: y, chunk: g.chunkAt(x, y)}
+	g.entries[key] = e
+	g.link(key, e)
+}
+
+// Move updates a key's position, relinking it only when it changes chunk.
+func (g *Grid[K, V]) Move(key K, x, y float64) {
+	e, ok := g.entries[key]
+	if !ok {
+		return
+	}
+	e.x, e.y = x, y
+	if c := g.chunkAt(x, y); c != e.chunk {
+		g.unlink(key, e)
+		e.chunk = c
+		g.link(key, e)
+	}
+}
+
+func (g *Grid[K, V]) Remove(key K) {
+	if e, ok := g.entries[key]; ok {
+		g.unlink(key, e)
+		delete(g.entries, key)
+	}
+}
+
+func (g *Grid[K, V]) Get(key K) (V, bool) {
+	e, ok := g.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	return e.value, true
+}
+
+func (g *Grid[K, V]) Len() int {
+	return len(g.entries)
+}
+
+func (g *Grid[K, V]) Each(fn func(K, V)) {
+	for k, e := range g.entries {
+		fn(k, e.value)
+	}
+}
+
+// Near calls fn for every value within radius of (x, y).
+func (g *Grid[K, V]) Near(x, y, radius float64, fn func(K, V)) {
+	min, max := g.chunkAt(x-radius, y-radius), g.chunkAt(x+radius, y+radius)
+	for cy := min.y; cy <= max.y; cy++ {
+		for cx := min.x; cx <= max.x; cx++ {
+			for k, e := range g.chunks[chunk{cx, cy}] {
+				if math.Hypot(e.x-x, e.y-y) <= radius {
+					fn(k, e.value)
+				}
+			}
+		}
+	}
+}
+
+// InRect calls fn for every value inside the axis-aligned rectangle.
+func (g *Grid[K, V]) InRect(x0, y0, x1, y1 float64, fn func(K, V)) {
+	min, max := g.chunkAt(x0, y0), g.chunkAt(x1, y1)
+	for cy := min.y; cy <= max.y; cy++ {
+		for cx := min.x; cx <= max.x; cx++ {
+			for k, e := range g.chunks[chunk{cx, cy}] {
+				if e.x >= x0 && e.x <= x1 && e.y >= y0 && e.y <= y1 {
+					fn(k, e.value)
+				}
+			}
+		}
+	}
+}
+
+func (g *Grid[K, V]) link(key K, e *entry[V]) {
+	c := g.chunks[e.chunk]
+	if c == nil {
+		c = make(map[K]*entry[V])
+		g.chunks[e.chunk] = c
+	}
+	c[key] = e
+}
+
+func (g *Grid[K, V]) unlink(key K, e *entry[V]) {
+	c := g.chunks[e.chunk]
+	delete(c, key)
+	if len(c) == 0 {
+		delete(g.chunks, e.chunk)
+	}
+}
@@ -0,0 +1,4 @@
+package main
+
+// The pure-Go SQLite driver backs -db, so profiles persist without cgo.
+import _ "modernc.org/sqlite"
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"io"
+	"time"
+
+	"darkzone/MultiTestServer/protocol"
+)
+
+// SessionTracker collects local statistics for the current play session
+// purely from bus events, so it needs no hooks in the systems it measures.
+type SessionTracker struct {
+	started  time.Time
+	distance float64
+	chats    int
+	deaths   int
+}
+
+func NewSessionTracker(events *EventBus) *SessionTracker {
+	t := &SessionTracker{started: time.Now()}
+
+	events.Subscribe(EventLocalMoved, func(e Event) {
+		t.distance += e.Payload.(LocalMoved).Distance
+	})
+	events.Subscribe(EventChatSent, func(Event) {
+		t.chats++
+	})
+	events.Subscribe(EventDied, func(Event) {
+		t.deaths++
+	})
+	return t
+}
+
+func (t *SessionTracker) Played() time.Duration {
+	return time.Since(t.started).Round(time.Second)
+}
+
+func (t *SessionTracker) Summary() string {
+	return T("session.summary", t.Played(), t.distance, t.chats, t.deaths)
+}
+
+func (t *SessionTracker) Sync(w io.Writer) error {
+	stats := protocol.EncodeSession(int64(t.Played().Seconds()), t.distance, t.chats, t.deaths)
+	_, err := io.WriteString(w, protocol.Line(protocol.KindSession, stats))
+	return err
+}
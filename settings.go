@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+type AccessibilitySettings struct {
+	HighContrastTiles bool `json:"highContrastTiles"`
+	// HighContrastTags sets names over the world larger, on a backdrop.
+	HighContrastTags bool `json:"highContrastTags"`
+	// Palette names the colors sides and indicators are drawn in, one of
+	// paletteNames.
+	Palette string `json:"palette"`
+	// UIScale sizes the HUD and windows, from minUIScale to maxUIScale.
+	UIScale float64 `json:"uiScale"`
+}
+
+type GameplaySettings struct {
+	// SpectateKiller follows whoever defeated the player for the first few
+	// seconds of the respawn wait.
+	SpectateKiller bool `json:"spectateKiller"`
+}
+
+type VideoSettings struct {
+	VSync      bool `json:"vsync"`
+	Fullscreen bool `json:"fullscreen"`
+	// Scale multiplies the window's size, from 1 to maxWindowScale.
+	Scale int `json:"scale"`
+}
+
+// AudioSettings are volumes from 0 to 1. Voice chat plays at the master
+// volume times its own.
+type AudioSettings struct {
+	Master float64 `json:"master"`
+	Voice  float64 `json:"voice"`
+}
+
+// ControlsSettings are the first player's keys, saved by name.
+type ControlsSettings struct {
+	Up     ebiten.Key `json:"up"`
+	Down   ebiten.Key `json:"down"`
+	Left   ebiten.Key `json:"left"`
+	Right  ebiten.Key `json:"right"`
+	Attack ebiten.Key `json:"attack"`
+	Dash   ebiten.Key `json:"dash"`
+}
+
+func (c ControlsSettings) Keys() KeyboardInput {
+	return KeyboardInput{Up: c.Up, Down: c.Down, Left: c.Left, Right: c.Right, Attack: c.Attack, Dash: c.Dash}
+}
+
+func defaultControlsSettings() ControlsSettings {
+	k := ArrowKeys()
+	return ControlsSettings{Up: k.Up, Down: k.Down, Left: k.Left, Right: k.Right, Attack: k.Attack, Dash: k.Dash}
+}
+
+// NetcodeSettings trade smoothness against latency, for players on very
+// different connections. Times are in milliseconds.
+type NetcodeSettings struct {
+	// InterpolationDelay is how far behind the server clock other players
+	// are drawn; more rides out jitter and loss but shows them later.
+	InterpolationDelay float64 `json:"interpolationDelay"`
+	// MaxExtrapolation is how long other players keep moving on their last
+	// velocity once snapshots stop arriving.
+	MaxExtrapolation float64 `json:"maxExtrapolation"`
+	// Prediction moves the local player as soon as input arrives; without
+	// it the player is drawn where the server last confirmed them.
+	Prediction bool `json:"prediction"`
+}
+
+const (
+	defaultInterpolationDelay = 100.0
+	maxInterpolationDelay     = 500.0
+	defaultMaxExtrapolation   = 250.0
+	maxMaxExtrapolation       = 1000.0
+	maxWindowScale            = 3
+)
+
+func defaultNetcodeSettings() NetcodeSettings {
+	return NetcodeSettings{
+		InterpolationDelay: defaultInterpolationDelay,
+		MaxExtrapolation:   defaultMaxExtrapolation,
+		Prediction:         true,
+	}
+}
+
+// clamp keeps hand-edited values in the range the settings menu offers.
+func (s *Settings) clamp() {
+	n := &s.Netcode
+	n.InterpolationDelay = max(0, min(n.InterpolationDelay, maxInterpolationDelay))
+	n.MaxExtrapolation = max(0, min(n.MaxExtrapolation, maxMaxExtrapolation))
+	s.Video.Scale = max(1, min(s.Video.Scale, maxWindowScale))
+	s.Audio.Master = max(0, min(s.Audio.Master, 1))
+	s.Audio.Voice = max(0, min(s.Audio.Voice, 1))
+	s.Accessibility.UIScale = max(minUIScale, min(s.Accessibility.UIScale, maxUIScale))
+	if _, ok := palettes[s.Accessibility.Palette]; !ok {
+		s.Accessibility.Palette = paletteNames[0]
+	}
+}
+
+type Settings struct {
+	Accessibility AccessibilitySettings `json:"accessibility"`
+	Gameplay      GameplaySettings      `json:"gameplay"`
+	Netcode       NetcodeSettings       `json:"netcode"`
+	Video         VideoSettings         `json:"video"`
+	Audio         AudioSettings         `json:"audio"`
+	Controls      ControlsSettings      `json:"controls"`
+	// Language is the client language; empty follows the OS locale.
+	Language string `json:"language,omitempty"`
+
+	path string
+}
+
+func settingsPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "settings.json"
+	}
+	return filepath.Join(dir, "MultiTest", "settings.json")
+}
+
+// LoadSettings reads the settings file, returning defaults if it does not
+// exist yet.
+func LoadSettings(path string) (*Settings, error) {
+	s := &Settings{
+		Accessibility: AccessibilitySettings{Palette: paletteNames[0], UIScale: 1},
+		Gameplay:      GameplaySettings{SpectateKiller: true},
+		Netcode:       defaultNetcodeSettings(),
+		Video:         VideoSettings{VSync: true, Scale: 1},
+		Audio:         AudioSettings{Master: 1, Voice: 1},
+		Controls:      defaultControlsSettings(),
+		path:          path,
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return s, err
+	}
+	s.clamp()
+	return s, nil
+}
+
+func (s *Settings) Save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0o644)
+}
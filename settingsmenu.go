@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+// settingRow is one adjustable line of the settings menu, shown with the
+// rest of its section. step nudges the value by one notch in direction
+// dir (-1 or 1); a row with key instead is a control, rebound by pressing
+// Enter and then the new key.
+type settingRow struct {
+	section string
+	label   string
+	value   func(s *Settings) string
+	step    func(s *Settings, dir int)
+	key     func(s *Settings) *ebiten.Key
+}
+
+func onOff(on bool) string {
+	if on {
+		return T("settings.on")
+	}
+	return T("settings.off")
+}
+
+func percent(volume float64) string {
+	return fmt.Sprintf("%.0f%%", volume*100)
+}
+
+func keyRow(label string, key func(s *Settings) *ebiten.Key) settingRow {
+	return settingRow{
+		section: "settings.controls",
+		label:   label,
+		value:   func(s *Settings) string { return key(s).String() },
+		key:     key,
+	}
+}
+
+var settingRows = []settingRow{
+	{
+		section: "settings.video",
+		label:   "settings.vsync",
+		value:   func(s *Settings) string { return onOff(s.Video.VSync) },
+		step:    func(s *Settings, _ int) { s.Video.VSync = !s.Video.VSync },
+	},
+	{
+		section: "settings.video",
+		label:   "settings.fullscreen",
+		value:   func(s *Settings) string { return onOff(s.Video.Fullscreen) },
+		step:    func(s *Settings, _ int) { s.Video.Fullscreen = !s.Video.Fullscreen },
+	},
+	{
+		section: "settings.video",
+		label:   "settings.scale",
+		value:   func(s *Settings) string { return fmt.Sprintf("%dx", s.Video.Scale) },
+		step:    func(s *Settings, dir int) { s.Video.Scale += dir },
+	},
+	{
+		section: "settings.audio",
+		label:   "settings.masterVolume",
+		value:   func(s *Settings) string { return percent(s.Audio.Master) },
+		step:    func(s *Settings, dir int) { s.Audio.Master += float64(dir) * 0.1 },
+	},
+	{
+		section: "settings.audio",
+		label:   "settings.voiceVolume",
+		value:   func(s *Settings) string { return percent(s.Audio.Voice) },
+		step:    func(s *Settings, dir int) { s.Audio.Voice += float64(dir) * 0.1 },
+	},
+	keyRow("settings.up", func(s *Settings) *ebiten.Key { return &s.Controls.Up }),
+	keyRow("settings.down", func(s *Settings) *ebiten.Key { return &s.Controls.Down }),
+	keyRow("settings.left", func(s *Settings) *ebiten.Key { return &s.Controls.Left }),
+	keyRow("settings.right", func(s *Settings) *ebiten.Key { return &s.Controls.Right }),
+	keyRow("settings.attack", func(s *Settings) *ebiten.Key { return &s.Controls.Attack }),
+	keyRow("settings.dash", func(s *Settings) *ebiten.Key { return &s.Controls.Dash }),
+	{
+		section: "settings.netcode",
+		label:   "settings.interpolationDelay",
+		value:   func(s *Settings) string { return fmt.Sprintf("%.0f ms", s.Netcode.InterpolationDelay) },
+		step:    func(s *Settings, dir int) { s.Netcode.InterpolationDelay += float64(dir) * 10 },
+	},
+	{
+		section: "settings.netcode",
+		label:   "settings.maxExtrapolation",
+		value:   func(s *Settings) string { return fmt.Sprintf("%.0f ms", s.Netcode.MaxExtrapolation) },
+		step:    func(s *Settings, dir int) { s.Netcode.MaxExtrapolation += float64(dir) * 50 },
+	},
+	{
+		section: "settings.netcode",
+		label:   "settings.prediction",
+		value:   func(s *Settings) string { return onOff(s.Netcode.Prediction) },
+		step:    func(s *Settings, _ int) { s.Netcode.Prediction = !s.Netcode.Prediction },
+	},
+	{
+		section: "settings.gameplay",
+		label:   "settings.spectateKiller",
+		value:   func(s *Settings) string { return onOff(s.Gameplay.SpectateKiller) },
+		step:    func(s *Settings, _ int) { s.Gameplay.SpectateKiller = !s.Gameplay.SpectateKiller },
+	},
+	{
+		section: "settings.accessibility",
+		label:   "settings.palette",
+		value:   func(s *Settings) string { return T("settings.palette." + s.Accessibility.Palette) },
+		step: func(s *Settings, dir int) {
+			i := (slices.Index(paletteNames, s.Accessibility.Palette) + dir + len(paletteNames)) % len(paletteNames)
+			s.Accessibility.Palette = paletteNames[i]
+		},
+	},
+	{
+		section: "settings.accessibility",
+		label:   "settings.uiScale",
+		value:   func(s *Settings) string { return percent(s.Accessibility.UIScale) },
+		step:    func(s *Settings, dir int) { s.Accessibility.UIScale += float64(dir) * uiScaleStep },
+	},
+	{
+		section: "settings.accessibility",
+		label:   "settings.highContrastTags",
+		value:   func(s *Settings) string { return onOff(s.Accessibility.HighContrastTags) },
+		step:    func(s *Settings, _ int) { s.Accessibility.HighContrastTags = !s.Accessibility.HighContrastTags },
+	},
+	{
+		section: "settings.accessibility",
+		label:   "settings.highContrastTiles",
+		value:   func(s *Settings) string { return onOff(s.Accessibility.HighContrastTiles) },
+		step:    func(s *Settings, _ int) { s.Accessibility.HighContrastTiles = !s.Accessibility.HighContrastTiles },
+	},
+}
+
+// SettingsMenu edits the settings in game, layered over play and opened
+// with Escape or F2, or Start on a gamepad. Up and Down pick a row, Left and
+// Right change it, and every change is saved and applied at once.
+type SettingsMenu struct {
+	open     bool
+	row      int
+	settings *Settings
+	// apply puts changed settings into effect.
+	apply func()
+	// rebinding is set while a control waits for its new key.
+	rebinding bool
+	keys      []ebiten.Key
+}
+
+func NewSettingsMenu(settings *Settings, apply func()) *SettingsMenu {
+	return &SettingsMenu{settings: settings, apply: apply}
+}
+
+// Open reports whether the menu is showing; it takes the arrow keys from
+// movement while it is.
+func (m *SettingsMenu) Open() bool {
+	return m.open
+}
+
+// Update handles the menu's keys and gamepad buttons. Escape is left alone
+// while something else is open that it closes first, like chat or a shop;
+// Start opens the menu from a gamepad and Back closes it.
+func (m *SettingsMenu) Update(typing, escapeTaken bool) {
+	if typing {
+		return
+	}
+	if m.rebinding {
+		m.rebind()
+		return
+	}
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyF2), menuPad.Pressed(MenuStart):
+		m.open = !m.open
+	case inpututil.IsKeyJustPressed(ebiten.KeyEscape) && !escapeTaken, menuPad.Pressed(MenuBack) && m.open:
+		m.open = !m.open
+	}
+	if !m.open {
+		return
+	}
+	row := settingRows[m.row]
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyUp), menuPad.Pressed(MenuUp):
+		m.row = (m.row + len(settingRows) - 1) % len(settingRows)
+	case inpututil.IsKeyJustPressed(ebiten.KeyDown), menuPad.Pressed(MenuDown):
+		m.row = (m.row + 1) % len(settingRows)
+	case row.key != nil:
+		m.rebinding = inpututil.IsKeyJustPressed(ebiten.KeyEnter) || menuPad.Pressed(MenuAccept)
+	case inpututil.IsKeyJustPressed(ebiten.KeyLeft), menuPad.Pressed(MenuLeft):
+		m.change(func(s *Settings) { row.step(s, -1) })
+	case inpututil.IsKeyJustPressed(ebiten.KeyRight), menuPad.Pressed(MenuRight):
+		m.change(func(s *Settings) { row.step(s, 1) })
+	}
+}
+
+// rebind binds the control on the current row to the next key pressed;
+// Escape, or Back on a gamepad, leaves it as it was.
+func (m *SettingsMenu) rebind() {
+	if menuPad.Pressed(MenuBack) {
+		m.rebinding = false
+		return
+	}
+	m.keys = inpututil.AppendJustPressedKeys(m.keys[:0])
+	if len(m.keys) == 0 {
+		return
+	}
+	m.rebinding = false
+	if key := m.keys[0]; key != ebiten.KeyEscape {
+		m.change(func(s *Settings) { *settingRows[m.row].key(s) = key })
+	}
+}
+
+func (m *SettingsMenu) change(edit func(s *Settings)) {
+	edit(m.settings)
+	m.settings.clamp()
+	m.apply()
+	if err := m.settings.Save(); err != nil {
+		log.Println("Error saving settings:", err)
+	}
+}
+
+func (m *SettingsMenu) Draw(screen *ebiten.Image) {
+	if !m.open {
+		return
+	}
+	const width, height = 380, 232
+	x, y := (hudWidth-width)/2, (hudHeight-height)/2
+	drawPanel(screen, float64(x), float64(y), width, height)
+
+	// Only the section of the row with focus is shown, so the menu fits
+	// the HUD at any UI scale.
+	var b strings.Builder
+	section := settingRows[m.row].section
+	b.WriteString(menuPad.Hint("settings.title") + "\n\n< " + T(section) + " >\n")
+	for i, row := range settingRows {
+		if row.section != section {
+			continue
+		}
+		cursor := "  "
+		if i == m.row {
+			cursor = "> "
+		}
+		value := row.value(m.settings)
+		if i == m.row && m.rebinding {
+			value = T("settings.pressKey")
+		}
+		fmt.Fprintf(&b, "%s%-24s %s\n", cursor, T(row.label), value)
+	}
+	b.WriteString("\n")
+	help := menuPad.Hint("settings.help")
+	if settingRows[m.row].key != nil {
+		help = menuPad.Hint("settings.rebindHelp")
+	}
+	b.WriteString(help)
+	drawText(screen, b.String(), x+12, y+12, hudText)
+}
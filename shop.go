@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"darkzone/MultiTestServer/protocol"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+const (
+	shopWidth   = 360
+	shopRowGap  = 16
+	shopHeaderH = 48
+)
+
+// ShopWindow lists a vendor's stock with its prices, how many of each item
+// the player carries and their gold. Up and Down pick an item, B buys one
+// and S sells one; Escape closes the shop. Trades are checked by the
+// server, which answers each with the updated shop.
+type ShopWindow struct {
+	shop     *protocol.Shop
+	selected int
+}
+
+func NewShopWindow(events *EventBus) *ShopWindow {
+	s := &ShopWindow{}
+	events.Subscribe(EventShopChanged, func(e Event) {
+		s.shop = e.Payload.(ShopChanged).Shop
+		if s.shop != nil {
+			s.selected = min(s.selected, max(len(s.shop.Items)-1, 0))
+		}
+	})
+	return s
+}
+
+func (s *ShopWindow) Open() bool {
+	return s.shop != nil
+}
+
+// Update handles the shop keys, sending trades on w.
+func (s *ShopWindow) Update(typing bool, w io.Writer) error {
+	if s.shop == nil || typing {
+		return nil
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) || menuPad.Pressed(MenuBack) {
+		s.shop, s.selected = nil, 0
+		_, err := io.WriteString(w, protocol.Line(protocol.KindShopClose, ""))
+		return err
+	}
+	if len(s.shop.Items) == 0 {
+		return nil
+	}
+	item := s.shop.Items[s.selected].Item
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyUp), menuPad.Pressed(MenuUp):
+		s.selected = (s.selected + len(s.shop.Items) - 1) % len(s.shop.Items)
+	case inpututil.IsKeyJustPressed(ebiten.KeyDown), menuPad.Pressed(MenuDown):
+		s.selected = (s.selected + 1) % len(s.shop.Items)
+	case inpututil.IsKeyJustPressed(ebiten.KeyB), menuPad.Pressed(MenuAccept):
+		_, err := io.WriteString(w, protocol.Line(protocol.KindShopBuy, item))
+		return err
+	case inpututil.IsKeyJustPressed(ebiten.KeyS), menuPad.Pressed(MenuAlt):
+		_, err := io.WriteString(w, protocol.Line(protocol.KindShopSell, item))
+		return err
+	}
+	return nil
+}
+
+func (s *ShopWindow) Draw(screen *ebiten.Image) {
+	if s.shop == nil {
+		return
+	}
+	height := shopHeaderH + shopRowGap*(len(s.shop.Items)+2)
+	x, y := (hudWidth-shopWidth)/2, (hudHeight-height)/2
+	drawPanel(screen, float64(x), float64(y), shopWidth, float64(height))
+
+	var b strings.Builder
+	b.WriteString(T("shop.title", s.shop.NPC, s.shop.Gold) + "\n\n")
+	fmt.Fprintf(&b, "  %-14s %6s %6s %6s\n", T("shop.item"), T("shop.buy"), T("shop.sell"), T("shop.owned"))
+	for i, item := range s.shop.Items {
+		marker := "  "
+		if i == s.selected {
+			marker = "> "
+		}
+		fmt.Fprintf(&b, "%s%-14s %6s %6s %6d\n", marker, item.Item, shopPrice(item.Buy), shopPrice(item.Sell), item.Owned)
+	}
+	drawText(screen, b.String(), x+12, y+10, hudText)
+	drawText(screen, menuPad.Hint("shop.help"), x+12, y+height-20, hudText)
+}
+
+// shopPrice shows a price, or a dash for a trade the vendor does not make.
+func shopPrice(price int) string {
+	if price == 0 {
+		return "-"
+	}
+	return fmt.Sprint(price)
+}
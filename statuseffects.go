@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+
+	"darkzone/MultiTestServer/protocol"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+const (
+	effectIconSize = 8
+	buffIconSize   = 20
+	buffIconGap    = 28
+)
+
+// effectIcons are the glyph and colour each effect is drawn with.
+var effectIcons = map[string]struct {
+	glyph string
+	color color.RGBA
+}{
+	protocol.EffectSpeed:        {">", color.RGBA{80, 200, 240, 255}},
+	protocol.EffectSlow:         {"<", color.RGBA{120, 120, 200, 255}},
+	protocol.EffectPoison:       {"P", color.RGBA{120, 200, 60, 255}},
+	protocol.EffectInvulnerable: {"I", color.RGBA{240, 220, 120, 255}},
+}
+
+// StatusEffects tracks the buffs and debuffs the server reports on every
+// player in the room. Each shows as a small icon above the player, and the
+// local player's as a buff bar at the top of the screen with the seconds
+// each has left, counted down between updates.
+type StatusEffects struct {
+	byPlayer map[string][]protocol.StatusEffect
+}
+
+func NewStatusEffects(events *EventBus) *StatusEffects {
+	s := &StatusEffects{byPlayer: make(map[string][]protocol.StatusEffect)}
+	events.Subscribe(EventStatusChanged, func(e Event) {
+		status := e.Payload.(StatusChanged).Status
+		if len(status.Effects) == 0 {
+			delete(s.byPlayer, status.Player)
+			return
+		}
+		s.byPlayer[status.Player] = status.Effects
+	})
+	return s
+}
+
+func (s *StatusEffects) Of(id string) []protocol.StatusEffect {
+	return s.byPlayer[id]
+}
+
+func (s *StatusEffects) Update(deltaTime float64) {
+	for _, effects := range s.byPlayer {
+		for i := range effects {
+			effects[i].Seconds = max(effects[i].Seconds-deltaTime, 0)
+		}
+	}
+}
+
+// DrawIcons draws the effects above each affected player that position
+// can place.
+func (s *StatusEffects) DrawIcons(screen *ebiten.Image, cameraOffset Vector2f, position func(id string) (Vector2f, bool)) {
+	for id, effects := range s.byPlayer {
+		p, ok := position(id)
+		if !ok {
+			continue
+		}
+		x, y := float32(p.X-cameraOffset.X), float32(p.Y-cameraOffset.Y)-44
+		for i, e := range effects {
+			vector.DrawFilledRect(screen, x+float32(i*(effectIconSize+2)), y, effectIconSize, effectIconSize, effectIcons[e.Kind].color, false)
+		}
+	}
+}
+
+// DrawBar draws the local player's effects along the top of the screen.
+func (s *StatusEffects) DrawBar(screen *ebiten.Image, id string) {
+	effects := s.byPlayer[id]
+	x := (hudWidth - len(effects)*buffIconGap) / 2
+	for i, e := range effects {
+		icon := effectIcons[e.Kind]
+		ix := x + i*buffIconGap
+		vector.DrawFilledRect(screen, float32(ix), 8, buffIconSize, buffIconSize, icon.color, false)
+		label := icon.glyph
+		if e.Stacks > 1 {
+			label += fmt.Sprint(e.Stacks)
+		}
+		drawText(screen, label, ix+4, 10, hudText)
+		drawText(screen, T("status.seconds", int(e.Seconds+0.5)), ix, 8+buffIconSize, hudText)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"image/color"
+	"io"
+	"log"
+
+	"darkzone/MultiTestServer/protocol"
+	"darkzone/MultiTestServer/spatial"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+// outlineSource draws only the outline of a sprite: its transparent pixels
+// next to opaque ones, in OutlineColor. The sprite itself is drawn over it
+// as usual.
+const outlineSource = `//kage:unit pixels
+
+package main
+
+var OutlineColor vec4
+
+func Fragment(dstPos vec4, srcPos vec2, color vec4) vec4 {
+	if imageSrc0At(srcPos).a > 0 {
+		return vec4(0)
+	}
+	a := imageSrc0At(srcPos+vec2(1, 0)).a + imageSrc0At(srcPos-vec2(1, 0)).a +
+		imageSrc0At(srcPos+vec2(0, 1)).a + imageSrc0At(srcPos-vec2(0, 1)).a
+	if a > 0 {
+		return OutlineColor
+	}
+	return vec4(0)
+}
+`
+
+var (
+	outlineShader = newOutlineShader()
+	hoverOutline  = color.RGBA{230, 230, 230, 200}
+)
+
+func newOutlineShader() *ebiten.Shader {
+	shader, err := ebiten.NewShader([]byte(outlineSource))
+	if err != nil {
+		log.Fatal("Error compiling outline shader: ", err)
+	}
+	return shader
+}
+
+// drawOutline outlines the sprite src as drawn with op in c, which is
+// premultiplied like every color.RGBA.
+func drawOutline(dst, src *ebiten.Image, op *ebiten.DrawImageOptions, c color.RGBA) {
+	shaderOp := &ebiten.DrawRectShaderOptions{GeoM: op.GeoM}
+	shaderOp.Images[0] = src
+	shaderOp.Uniforms = map[string]any{
+		"OutlineColor": []float32{float32(c.R) / 255, float32(c.G) / 255, float32(c.B) / 255, float32(c.A) / 255},
+	}
+	bounds := src.Bounds()
+	dst.DrawRectShader(bounds.Dx(), bounds.Dy(), outlineShader, shaderOp)
+}
+
+// Targeting outlines the player under the mouse, and picks them out as the
+// local player's target with a click, or clears the target with a click
+// anywhere else. The server is told the target so abilities can aim at
+// it; the target stays outlined until it is cleared or out of sight.
+type Targeting struct {
+	hovered string
+	target  string
+}
+
+func NewTargeting() *Targeting {
+	return &Targeting{}
+}
+
+// Update finds the player under cursor, a world position, or none when
+// onWorld is false, and handles clicks unless blocked, sending target
+// changes on conn.
+func (t *Targeting) Update(cursor Vector2f, onWorld, blocked bool, players *spatial.Grid[string, *RemotePlayer], conn io.Writer) error {
+	t.hovered = ""
+	if onWorld {
+		players.InRect(cursor.X-frameWidth, cursor.Y-frameHeight, cursor.X, cursor.Y+16, func(id string, player *RemotePlayer) {
+			p := player.position
+			if cursor.X >= p.X && cursor.X < p.X+frameWidth && cursor.Y >= p.Y-16 && cursor.Y < p.Y+frameHeight {
+				t.hovered = id
+			}
+		})
+	}
+
+	target := t.target
+	if _, ok := players.Get(target); !ok {
+		target = ""
+	}
+	if onWorld && !blocked && inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		target = t.hovered
+	}
+	if target == t.target {
+		return nil
+	}
+	t.target = target
+	_, err := io.WriteString(conn, protocol.Line(protocol.KindTarget, target))
+	return err
+}
+
+// Outline is the outline the player with the given ID is drawn with; its
+// zero alpha means none.
+func (t *Targeting) Outline(id string) color.RGBA {
+	switch id {
+	case t.target:
+		return activePalette.Target
+	case t.hovered:
+		return hoverOutline
+	}
+	return color.RGBA{}
+}
+
+// cursorWorld is the world position under the mouse in the first player's
+// view, false when the mouse is off that view or the free camera is up.
+func (g *Game) cursorWorld() (Vector2f, bool) {
+	if g.freeCamera.Active {
+		return Vector2f{}, false
+	}
+	local := g.localPlayers[0]
+	width, height := screenWidth, screenHeight
+	if len(g.localPlayers) > 1 {
+		width, height = local.viewport.Bounds().Dx(), local.viewport.Bounds().Dy()
+	}
+	mx, my := ebiten.CursorPosition()
+	if mx < 0 || my < 0 || mx >= width || my >= height {
+		return Vector2f{}, false
+	}
+	center := g.cameraCenter(local)
+	return Vector2f{X: center.X - float64(width)/2 + float64(mx), Y: center.Y - float64(height)/2 + float64(my)}, true
+}
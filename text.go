@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"image/color"
+	"log"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// TextEffect is what is drawn behind text to keep it readable over the
+// world.
+type TextEffect int
+
+const (
+	TextPlain TextEffect = iota
+	// TextShadow drops a shadow down and to the right.
+	TextShadow
+	// TextOutline rings every glyph, for labels over busy backgrounds.
+	TextOutline
+	// TextBackdrop sets the text on a solid box, for the most contrast.
+	TextBackdrop
+)
+
+// TextStyle is how a piece of text is drawn: its size in pixels, whether
+// it is monospaced for tables that line up in columns, its color and
+// effect.
+type TextStyle struct {
+	Size   float64
+	Mono   bool
+	Color  color.RGBA
+	Effect TextEffect
+}
+
+var (
+	regularFont = newFontSource(goregular.TTF)
+	monoFont    = newFontSource(gomono.TTF)
+	textShade   = color.RGBA{0, 0, 0, 220}
+
+	// hudText is the text of the HUD and windows, set 16 pixels apart
+	// line to line like the layouts expect.
+	hudText = TextStyle{Size: 13, Color: color.RGBA{255, 255, 255, 255}, Effect: TextShadow}
+	// tagText labels things in the world, like names over entities.
+	tagText = TextStyle{Size: 11, Color: color.RGBA{255, 255, 255, 255}, Effect: TextOutline}
+	// titleText heads full-screen overlays.
+	titleText = TextStyle{Size: 20, Color: color.RGBA{255, 255, 255, 255}, Effect: TextShadow}
+	// tableText is for columns laid out with padded format verbs.
+	tableText = TextStyle{Size: 11, Mono: true, Color: color.RGBA{255, 255, 255, 255}, Effect: TextShadow}
+)
+
+func newFontSource(ttf []byte) *text.GoTextFaceSource {
+	source, err := text.NewGoTextFaceSource(bytes.NewReader(ttf))
+	if err != nil {
+		log.Fatal("Error loading font: ", err)
+	}
+	return source
+}
+
+func (s TextStyle) face() *text.GoTextFace {
+	source := regularFont
+	if s.Mono {
+		source = monoFont
+	}
+	return &text.GoTextFace{Source: source, Size: s.Size}
+}
+
+// lineHeight is how far apart lines of the style are set.
+func (s TextStyle) lineHeight() float64 {
+	return float64(int(s.Size*1.25 + 0.5))
+}
+
+// drawText draws str, which may span lines, with its top-left at x, y.
+func drawText(dst *ebiten.Image, str string, x, y int, style TextStyle) {
+	face := style.face()
+	draw := func(dx, dy float64, c color.RGBA) {
+		op := &text.DrawOptions{}
+		op.LineSpacing = style.lineHeight()
+		op.GeoM.Translate(float64(x)+dx, float64(y)+dy)
+		op.ColorScale.ScaleWithColor(c)
+		text.Draw(dst, str, face, op)
+	}
+	switch style.Effect {
+	case TextShadow:
+		draw(1, 1, textShade)
+	case TextOutline:
+		for _, d := range [][2]float64{{-1, -1}, {0, -1}, {1, -1}, {-1, 0}, {1, 0}, {-1, 1}, {0, 1}, {1, 1}} {
+			draw(d[0], d[1], textShade)
+		}
+	case TextBackdrop:
+		width, height := text.Measure(str, face, style.lineHeight())
+		vector.DrawFilledRect(dst, float32(x-2), float32(y-1), float32(width+4), float32(height+2), textShade, false)
+	}
+	draw(0, 0, style.Color)
+}
+
+// textWidth is how wide the widest line of str is drawn in the style.
+func textWidth(str string, style TextStyle) float64 {
+	width, _ := text.Measure(str, style.face(), style.lineHeight())
+	return width
+}
+
+// drawCentered draws lines centered across a view width wide, the first
+// one at y.
+func drawCentered(dst *ebiten.Image, lines []string, width, y int, style TextStyle) {
+	for i, line := range lines {
+		x := (width - int(textWidth(line, style))) / 2
+		drawText(dst, line, x, y+i*int(style.lineHeight()), style)
+	}
+}
+
+// wrapText breaks text into lines no wider than width pixels in the style,
+// at spaces, keeping its own line breaks.
+func wrapText(str string, width float64, style TextStyle) string {
+	var b strings.Builder
+	for i, line := range strings.Split(str, "\n") {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		current := ""
+		for j, word := range strings.Fields(line) {
+			switch {
+			case j == 0:
+				current = word
+			case textWidth(current+" "+word, style) > width:
+				b.WriteString(current + "\n")
+				current = word
+			default:
+				current += " " + word
+			}
+		}
+		b.WriteString(current)
+	}
+	return b.String()
+}
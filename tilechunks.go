@@ -0,0 +1,181 @@
+package main
+
+import (
+	"image"
+
+	"darkzone/MultiTestServer/protocol"
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+const (
+	chunkTiles       = 2
+	tileSheetColumns = 400
+)
+
+type tileChunk struct {
+	col, row int
+	baked    bool
+	// staticLayers is how many bottom layers are baked into image. Layers
+	// from the first one holding an animated tile upward are drawn per tile
+	// so animations stay in the right draw order.
+	staticLayers int
+	image        *ebiten.Image
+}
+
+// TileRenderer draws the map in chunks of chunkTiles x chunkTiles tiles.
+// Each chunk's static layers are pre-rendered once into an offscreen image,
+// so a frame costs one DrawImage per visible chunk instead of one per tile.
+// Chunks bake on the task scheduler and draw tile by tile until they are ready.
+type TileRenderer struct {
+	tileMap *TileMap
+	tiles   *ebiten.Image
+	cols    int
+	rows    int
+	chunks  []*tileChunk
+}
+
+func NewTileRenderer(tileMap *TileMap, tiles *ebiten.Image, scheduler *TaskScheduler) *TileRenderer {
+	mapRows := (tileMap.Cells() + tileMap.Width - 1) / tileMap.Width
+	r := &TileRenderer{
+		tileMap: tileMap,
+		tiles:   tiles,
+		cols:    (tileMap.Width + chunkTiles - 1) / chunkTiles,
+		rows:    (mapRows + chunkTiles - 1) / chunkTiles,
+	}
+	for row := 0; row < r.rows; row++ {
+		for col := 0; col < r.cols; col++ {
+			c := &tileChunk{col: col, row: row}
+			r.chunks = append(r.chunks, c)
+			scheduler.Enqueue(func() { r.bake(c) })
+		}
+	}
+	return r
+}
+
+// eachCell calls fn with the map index and chunk-local pixel offset of every
+// cell covered by the chunk.
+func (r *TileRenderer) eachCell(c *tileChunk, fn func(index int, x, y float64)) {
+	for ty := 0; ty < chunkTiles; ty++ {
+		for tx := 0; tx < chunkTiles; tx++ {
+			col := c.col*chunkTiles + tx
+			if col >= r.tileMap.Width {
+				continue
+			}
+			index := (c.row*chunkTiles+ty)*r.tileMap.Width + col
+			fn(index, float64(tx*tileSize), float64(ty*tileSize))
+		}
+	}
+}
+
+func (r *TileRenderer) bake(c *tileChunk) {
+	for _, layer := range r.tileMap.Layers {
+		animated := false
+		r.eachCell(c, func(index int, _, _ float64) {
+			if index < len(layer) {
+				_, ok := r.tileMap.Animations[layer[index]]
+				animated = animated || ok
+			}
+		})
+		if animated {
+			break
+		}
+		c.staticLayers++
+	}
+
+	if c.staticLayers > 0 {
+		c.image = ebiten.NewImage(chunkTiles*tileSize, chunkTiles*tileSize)
+		r.drawLayers(c.image, c, 0, c.staticLayers, Vector2f{}, 0)
+	}
+	c.baked = true
+}
+
+func (r *TileRenderer) drawLayers(target *ebiten.Image, c *tileChunk, from, to int, origin Vector2f, clock float64) {
+	for _, layer := range r.tileMap.Layers[from:to] {
+		r.eachCell(c, func(index int, x, y float64) {
+			if index >= len(layer) || layer[index] < 0 {
+				return
+			}
+			r.drawTile(target, layer[index], origin.X+x, origin.Y+y, clock)
+		})
+	}
+}
+
+// drawTile draws the tile, or the frame of it showing at clock when it is
+// animated, with its top-left at x, y.
+func (r *TileRenderer) drawTile(target *ebiten.Image, tile int, x, y, clock float64) {
+	tile = r.tileMap.ResolveTile(tile, clock)
+	sx := (tile % tileSheetColumns) * tileSize
+	sy := (tile / tileSheetColumns) * tileSize
+
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Translate(x, y)
+	target.DrawImage(r.tiles.SubImage(image.Rect(sx, sy, sx+tileSize, sy+tileSize)).(*ebiten.Image), op)
+}
+
+// Invalidate re-bakes the chunk holding the cell at index, after the map
+// editor changes it.
+func (r *TileRenderer) Invalidate(index int) {
+	col, row := index%r.tileMap.Width/chunkTiles, index/r.tileMap.Width/chunkTiles
+	if col >= r.cols || row >= r.rows {
+		return
+	}
+	c := r.chunks[row*r.cols+col]
+	if c.image != nil {
+		c.image.Deallocate()
+		c.image = nil
+	}
+	c.baked, c.staticLayers = false, 0
+	r.bake(c)
+}
+
+// Draw renders the chunks overlapping the view. clock is the synced server
+// time in seconds, used for animated tiles.
+func (r *TileRenderer) Draw(screen *ebiten.Image, cameraOffset Vector2f, clock float64) {
+	span := float64(chunkTiles * tileSize)
+	bounds := screen.Bounds()
+	minCol := max(0, int(cameraOffset.X/span))
+	minRow := max(0, int(cameraOffset.Y/span))
+	maxCol := min(r.cols-1, int((cameraOffset.X+float64(bounds.Dx()))/span))
+	maxRow := min(r.rows-1, int((cameraOffset.Y+float64(bounds.Dy()))/span))
+
+	for row := minRow; row <= maxRow; row++ {
+		for col := minCol; col <= maxCol; col++ {
+			c := r.chunks[row*r.cols+col]
+			origin := Vector2f{float64(col)*span - cameraOffset.X, float64(row)*span - cameraOffset.Y}
+
+			from := 0
+			if c.baked {
+				from = c.staticLayers
+				if c.image != nil {
+					op := &ebiten.DrawImageOptions{}
+					op.GeoM.Translate(origin.X, origin.Y)
+					screen.DrawImage(c.image, op)
+				}
+			}
+			r.drawLayers(screen, c, from, len(r.tileMap.Layers), origin, clock)
+		}
+	}
+}
+
+// DrawDecks draws the top layer of the bridge cells in view again, over
+// the players and entities passing under them. Players up on the bridges
+// are drawn after.
+func (r *TileRenderer) DrawDecks(screen *ebiten.Image, cameraOffset Vector2f, clock float64) {
+	if len(r.tileMap.Layers) == 0 {
+		return
+	}
+	top := r.tileMap.Layers[len(r.tileMap.Layers)-1]
+	bounds := screen.Bounds()
+	minCol, minRow := max(0, int(cameraOffset.X/tileSize)), max(0, int(cameraOffset.Y/tileSize))
+	maxCol := min(r.tileMap.Width-1, int((cameraOffset.X+float64(bounds.Dx()))/tileSize))
+	maxRow := int((cameraOffset.Y + float64(bounds.Dy())) / tileSize)
+	for row := minRow; row <= maxRow; row++ {
+		for col := minCol; col <= maxCol; col++ {
+			index := row*r.tileMap.Width + col
+			if index >= len(r.tileMap.Elevation) || index >= len(top) || top[index] < 0 || protocol.Elevation(r.tileMap.Elevation[index]) != protocol.ElevationBridge {
+				continue
+			}
+			r.drawTile(screen, top[index], float64(col*tileSize)-cameraOffset.X, float64(row*tileSize)-cameraOffset.Y, clock)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"os"
+	"slices"
+
+	"darkzone/MultiTestServer/protocol"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+)
+
+// ParallaxLayer is a background image that scrolls at Factor times the camera
+// speed: 0 stays fixed on screen, 1 moves with the tiles.
+type ParallaxLayer struct {
+	Image   string  `json:"image"`
+	Factor  float64 `json:"factor"`
+	OffsetY float64 `json:"offsetY"`
+
+	image *ebiten.Image
+}
+
+// TileAnimation cycles a tile through Frames, spending Interval seconds on
+// each one.
+type TileAnimation struct {
+	Frames   []int   `json:"frames"`
+	Interval float64 `json:"interval"`
+}
+
+// TileLight is the light a tile, or an entity, gives off: a pool Radius
+// pixels out from its center, tinted Color.
+type TileLight struct {
+	Radius float64  `json:"radius"`
+	Color  [3]uint8 `json:"color"`
+}
+
+// TileMap is a map file. Layers hold one tile per cell, drawn bottom layer
+// first, with -1 for an empty cell; Collision marks solid cells with 1 and
+// Terrain gives each cell a protocol.Terrain, grass where it has none, and
+// Elevation a protocol.Elevation, ground where it has none.
+// Lights are the tiles, such as torches, that light up the dark.
+type TileMap struct {
+	Width      int                   `json:"width"`
+	Parallax   []ParallaxLayer       `json:"parallax"`
+	Layers     [][]int               `json:"layers"`
+	Animations map[int]TileAnimation `json:"animations"`
+	Lights     map[int]TileLight     `json:"lights"`
+	Collision  []int                 `json:"collision"`
+	Terrain    []int                 `json:"terrain"`
+	Elevation  []int                 `json:"elevation"`
+
+	// hash is the protocol.MapHash of the file, for checking against the
+	// server's map.
+	hash string
+}
+
+func LoadTileMap(path string) (*TileMap, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var m TileMap
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parsing map %s: %w", path, err)
+	}
+	if m.Width <= 0 {
+		return nil, fmt.Errorf("map %s: width must be positive", path)
+	}
+	m.hash = protocol.MapHash(data)
+	for i := range m.Parallax {
+		img, _, err := ebitenutil.NewImageFromFile(m.Parallax[i].Image)
+		if err != nil {
+			return nil, fmt.Errorf("map %s: parallax layer: %w", path, err)
+		}
+		m.Parallax[i].image = img
+	}
+	return &m, nil
+}
+
+// mapKeyOrder is the order Save writes a map file's fields in; fields it
+// does not know, such as the server's spawn points, follow sorted by name.
+var mapKeyOrder = []string{"width", "parallax", "layers", "animations", "lights", "collision"}
+
+// Save writes the map's width, layers and collision back to path, keeping
+// every other field of the file as it was. Each layer goes on its own line
+// so map diffs stay readable.
+func (m *TileMap) Save(path string) error {
+	return m.saveOver(path, path)
+}
+
+// saveOver is Save writing to path, taking the fields it keeps from the map
+// file at original.
+func (m *TileMap) saveOver(original, path string) error {
+	fields := make(map[string]json.RawMessage)
+	if data, err := os.ReadFile(original); err == nil {
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return fmt.Errorf("parsing map %s: %w", original, err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	var layers bytes.Buffer
+	layers.WriteString("[")
+	for i, layer := range m.Layers {
+		row, err := json.Marshal(layer)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			layers.WriteString(",")
+		}
+		layers.WriteString("\n    ")
+		layers.Write(row)
+	}
+	layers.WriteString("\n  ]")
+	fields["layers"] = layers.Bytes()
+	for key, value := range map[string]any{"width": m.Width, "collision": m.Collision} {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		fields[key] = data
+	}
+
+	keys := slices.Clone(mapKeyOrder)
+	for _, key := range slices.Sorted(maps.Keys(fields)) {
+		if !slices.Contains(mapKeyOrder, key) {
+			keys = append(keys, key)
+		}
+	}
+	var out bytes.Buffer
+	out.WriteString("{")
+	for _, key := range keys {
+		value, ok := fields[key]
+		if !ok {
+			continue
+		}
+		if key != "layers" {
+			var compact bytes.Buffer
+			if err := json.Compact(&compact, value); err != nil {
+				return err
+			}
+			value = compact.Bytes()
+		}
+		if out.Len() > 1 {
+			out.WriteString(",")
+		}
+		fmt.Fprintf(&out, "\n  %q: %s", key, value)
+	}
+	out.WriteString("\n}\n")
+	return os.WriteFile(path, out.Bytes(), 0o644)
+}
+
+// ResolveTile returns the frame an animated tile shows at clock seconds. The
+// game passes the synced server clock so every client shows the same frame.
+func (m *TileMap) ResolveTile(tile int, clock float64) int {
+	anim, ok := m.Animations[tile]
+	if !ok || len(anim.Frames) == 0 || anim.Interval <= 0 {
+		return tile
+	}
+	step := int64(clock / anim.Interval)
+	return anim.Frames[step%int64(len(anim.Frames))]
+}
+
+func (m *TileMap) Solid(index int) bool {
+	return index >= 0 && index < len(m.Collision) && m.Collision[index] != 0
+}
+
+// Blocked reports whether a player may not stand at world position (x, y):
+// outside the map, in a cell the map does not cover, or on a solid tile. The
+// server applies the same rule and corrects clients that ignore it.
+func (m *TileMap) Blocked(x, y float64) bool {
+	if x < 0 || y < 0 || int(x/tileSize) >= m.Width {
+		return true
+	}
+	index := int(y/tileSize)*m.Width + int(x/tileSize)
+	return index >= m.Cells() || m.Solid(index)
+}
+
+// TerrainAt is the terrain at world position (x, y), the same rule the
+// server applies to how fast players may move.
+func (m *TileMap) TerrainAt(x, y float64) protocol.Terrain {
+	if x < 0 || y < 0 || int(x/tileSize) >= m.Width {
+		return protocol.TerrainGrass
+	}
+	index := int(y/tileSize)*m.Width + int(x/tileSize)
+	if index >= len(m.Terrain) {
+		return protocol.TerrainGrass
+	}
+	return protocol.Terrain(m.Terrain[index])
+}
+
+// ElevationAt is the elevation at world position (x, y).
+func (m *TileMap) ElevationAt(x, y float64) protocol.Elevation {
+	if x < 0 || y < 0 || int(x/tileSize) >= m.Width {
+		return protocol.ElevationGround
+	}
+	index := int(y/tileSize)*m.Width + int(x/tileSize)
+	if index >= len(m.Elevation) {
+		return protocol.ElevationGround
+	}
+	return protocol.Elevation(m.Elevation[index])
+}
+
+func (m *TileMap) Cells() int {
+	cells := len(m.Collision)
+	for _, layer := range m.Layers {
+		cells = max(cells, len(layer))
+	}
+	return cells
+}
+
+// DrawParallax tiles each parallax image horizontally across the target,
+// offset by its share of the camera movement.
+func (m *TileMap) DrawParallax(target *ebiten.Image, cameraOffset Vector2f) {
+	viewWidth := float64(target.Bounds().Dx())
+	for _, layer := range m.Parallax {
+		width := float64(layer.image.Bounds().Dx())
+		scrollX := cameraOffset.X * layer.Factor
+		y := layer.OffsetY - cameraOffset.Y*layer.Factor
+
+		startX := -math.Mod(scrollX, width)
+		if startX > 0 {
+			startX -= width
+		}
+		for x := startX; x < viewWidth; x += width {
+			op := &ebiten.DrawImageOptions{}
+			op.GeoM.Translate(x, y)
+			target.DrawImage(layer.image, op)
+		}
+	}
+}
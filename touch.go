@@ -0,0 +1,107 @@
+package main
+
+import (
+	"image/color"
+	"math"
+	"runtime"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+const (
+	joystickRadius   = 60.0
+	joystickDeadZone = 0.2
+	attackButtonSize = 40.0
+)
+
+// attackButton is the center of the on-screen attack button.
+var attackButton = Vector2f{screenWidth - 80, screenHeight - 80}
+
+// TouchInput is a floating virtual joystick on the left half of the screen
+// plus an attack button in the bottom-right corner. It falls back to another
+// input source while the joystick is not held, and its controls are only
+// drawn on mobile or once the screen has been touched.
+type TouchInput struct {
+	Fallback InputSource
+
+	used     bool
+	sticking bool
+	stick    ebiten.TouchID
+	origin   Vector2f
+	knob     Vector2f
+	attack   bool
+	touches  []ebiten.TouchID
+}
+
+func NewTouchInput(fallback InputSource) *TouchInput {
+	return &TouchInput{Fallback: fallback, used: runtime.GOOS == "android" || runtime.GOOS == "ios"}
+}
+
+// Update reads this frame's touches. It must run once per frame before
+// Movement and AttackPressed.
+func (t *TouchInput) Update() {
+	t.attack = false
+	t.touches = inpututil.AppendJustPressedTouchIDs(t.touches[:0])
+	for _, id := range t.touches {
+		t.used = true
+		x, y := ebiten.TouchPosition(id)
+		p := Vector2f{float64(x), float64(y)}
+		switch {
+		case math.Hypot(p.X-attackButton.X, p.Y-attackButton.Y) <= attackButtonSize:
+			t.attack = true
+		case !t.sticking && p.X < screenWidth/2:
+			t.sticking, t.stick = true, id
+			t.origin, t.knob = p, p
+		}
+	}
+
+	if !t.sticking {
+		return
+	}
+	if inpututil.IsTouchJustReleased(t.stick) {
+		t.sticking = false
+		return
+	}
+	x, y := ebiten.TouchPosition(t.stick)
+	dx, dy := float64(x)-t.origin.X, float64(y)-t.origin.Y
+	if d := math.Hypot(dx, dy); d > joystickRadius {
+		dx, dy = dx/d*joystickRadius, dy/d*joystickRadius
+	}
+	t.knob = Vector2f{t.origin.X + dx, t.origin.Y + dy}
+}
+
+func (t *TouchInput) Movement() Vector2f {
+	if !t.sticking {
+		return t.Fallback.Movement()
+	}
+	movement := Vector2f{(t.knob.X - t.origin.X) / joystickRadius, (t.knob.Y - t.origin.Y) / joystickRadius}
+	if math.Hypot(movement.X, movement.Y) < joystickDeadZone {
+		return Vector2f{0, 0}
+	}
+	return movement
+}
+
+func (t *TouchInput) AttackPressed() bool {
+	return t.attack || t.Fallback.AttackPressed()
+}
+
+func (t *TouchInput) DashPressed() bool {
+	return t.Fallback.DashPressed()
+}
+
+func (t *TouchInput) Draw(screen *ebiten.Image) {
+	if !t.used {
+		return
+	}
+	if t.sticking {
+		vector.StrokeCircle(screen, float32(t.origin.X), float32(t.origin.Y), joystickRadius, 3, color.RGBA{255, 255, 255, 120}, true)
+		vector.DrawFilledCircle(screen, float32(t.knob.X), float32(t.knob.Y), joystickRadius/2, color.RGBA{255, 255, 255, 160}, true)
+	}
+	fill := color.RGBA{200, 60, 60, 120}
+	if t.attack {
+		fill = color.RGBA{255, 90, 90, 200}
+	}
+	vector.DrawFilledCircle(screen, float32(attackButton.X), float32(attackButton.Y), attackButtonSize, fill, true)
+}
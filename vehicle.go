@@ -0,0 +1,104 @@
+package main
+
+import (
+	"image/color"
+	"slices"
+
+	"darkzone/MultiTestServer/protocol"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+var (
+	hullColor = color.RGBA{110, 70, 40, 255}
+	rimColor  = color.RGBA{160, 110, 60, 255}
+)
+
+// Seating is who sits where in the vehicles around the players, as the
+// server reports it.
+type Seating struct {
+	// seats holds the player IDs in each vehicle's seats by the vehicle's
+	// ID, empty for a free seat.
+	seats map[string][]string
+}
+
+func NewSeating() *Seating {
+	return &Seating{seats: make(map[string][]string)}
+}
+
+func (s *Seating) Set(change protocol.SeatChange) {
+	seats := s.seats[change.Vehicle]
+	for len(seats) <= change.Seat {
+		seats = append(seats, "")
+	}
+	seats[change.Seat] = change.Player
+	s.seats[change.Vehicle] = seats
+}
+
+// Of finds the vehicle and seat the player sits in.
+func (s *Seating) Of(player string) (vehicle string, seat int, ok bool) {
+	for id, seats := range s.seats {
+		if seat := slices.Index(seats, player); seat >= 0 {
+			return id, seat, true
+		}
+	}
+	return "", 0, false
+}
+
+func (s *Seating) Clear() {
+	clear(s.seats)
+}
+
+// steer hands a seated player's movement to the vehicle when they drive
+// it, reporting whether they are seated. Those aboard send no state: the
+// server carries them along with the vehicle.
+func (g *Game) steer(local *LocalPlayer, intent Vector2f) bool {
+	id, seat, ok := g.seating.Of(local.id)
+	if !ok {
+		return false
+	}
+	if e, ok := g.entities.Get(id); ok && seat == 0 {
+		e.steer = intent
+	}
+	local.SetAnim(protocol.AnimIdle)
+	return true
+}
+
+// seatRiders puts every player aboard a vehicle, local or remote, in their
+// seat, so riders move with the vehicle as it is drawn rather than
+// trailing it by a snapshot.
+func (g *Game) seatRiders() {
+	for id, riders := range g.seating.seats {
+		e, ok := g.entities.Get(id)
+		if !ok {
+			continue
+		}
+		seats := protocol.VehicleSeats[e.Name]
+		for seat, player := range riders {
+			if player == "" || seat >= len(seats) {
+				continue
+			}
+			position := Vector2f{e.X + seats[seat].X, e.Y + seats[seat].Y}
+			if local := g.localByID(player); local != nil {
+				local.position = position
+			} else if remote, ok := g.otherPlayers.Get(player); ok {
+				remote.position = position
+				g.otherPlayers.Move(player, position.X, position.Y)
+			}
+		}
+	}
+}
+
+// drawVehicle draws the vehicle's sprite from the atlas, or a plain hull
+// long enough for its seats.
+func (w *WorldEntity) drawVehicle(screen *ebiten.Image, x, y float64) {
+	if w.drawSprite(screen, x, y) {
+		return
+	}
+	length := float32(frameWidth)
+	for _, seat := range protocol.VehicleSeats[w.Name] {
+		length = max(length, float32(seat.X)+frameWidth)
+	}
+	vector.DrawFilledRect(screen, float32(x)-4, float32(y)+8, length+8, 24, hullColor, false)
+	vector.StrokeRect(screen, float32(x)-4, float32(y)+8, length+8, 24, 2, rimColor, false)
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"image/color"
+	"io"
+	"log"
+	"math"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"darkzone/MultiTestServer/protocol"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/audio"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+const (
+	voiceSampleRate = 48000
+	// voiceFrameSamples is one 20 ms Opus frame of mono audio.
+	voiceFrameSamples = voiceSampleRate / 50
+	voiceKeepalive    = 5 * time.Second
+	// A speaker starts playing once voiceJitterFrames are buffered, riding
+	// out uneven packet arrival; past voiceMaxFrames the oldest audio is
+	// dropped so a burst can't build up lasting delay.
+	voiceJitterFrames = 3
+	voiceMaxFrames    = 10
+	voicePlayerBuffer = 60 * time.Millisecond
+)
+
+// voiceBackend captures the microphone and encodes and decodes Opus. It
+// needs cgo libraries, so it is linked in by the voice build tag (see
+// voice_opus.go) and newVoiceBackend stays nil without it.
+type voiceBackend interface {
+	// Capture starts delivering mono frames of voiceFrameSamples from the
+	// default microphone, dropping frames while the channel is full.
+	Capture(frames chan<- []int16) error
+	Encode(pcm []int16) ([]byte, error)
+	NewDecoder() (voiceDecoder, error)
+	Close() error
+}
+
+type voiceDecoder interface {
+	Decode(frame []byte) ([]int16, error)
+}
+
+var newVoiceBackend func() (voiceBackend, error)
+
+type voiceSpeaker struct {
+	decoder voiceDecoder
+	samples []float32
+	playing bool
+	gain    float32
+	seq     uint16
+}
+
+// VoiceChat is push-to-talk proximity voice. Captured frames go to the
+// server over UDP, which relays them to players within
+// protocol.VoiceRadius; incoming speakers are mixed into one audio stream,
+// each fading out with distance from the listener.
+type VoiceChat struct {
+	backend voiceBackend
+	frames  chan []int16
+	talking atomic.Bool
+	player  *audio.Player
+
+	mu       sync.Mutex
+	conn     *net.UDPConn
+	token    string
+	keys     protocol.VoiceKeys
+	seq      uint16
+	speakers map[string]*voiceSpeaker
+}
+
+func NewVoiceChat() (*VoiceChat, error) {
+	if newVoiceBackend == nil {
+		return nil, errors.New("voice chat needs a client built with -tags voice")
+	}
+	backend, err := newVoiceBackend()
+	if err != nil {
+		return nil, err
+	}
+	v := &VoiceChat{
+		backend:  backend,
+		frames:   make(chan []int16, voiceJitterFrames),
+		speakers: make(map[string]*voiceSpeaker),
+	}
+
+	context := audio.CurrentContext()
+	if context == nil {
+		context = audio.NewContext(voiceSampleRate)
+	}
+	if v.player, err = context.NewPlayerF32(voiceMix{v}); err != nil {
+		backend.Close()
+		return nil, err
+	}
+	v.player.SetBufferSize(voicePlayerBuffer)
+	v.player.Play()
+
+	if err := backend.Capture(v.frames); err != nil {
+		v.player.Close()
+		backend.Close()
+		return nil, err
+	}
+	go v.sendLoop()
+	return v, nil
+}
+
+// Connect starts talking to the voice port a server offered, replacing any
+// earlier connection. It completes the key exchange with the server's half,
+// serverKey, sending ours back over game, the game connection.
+func (v *VoiceChat) Connect(addr *net.UDPAddr, token, serverKey string, game io.Writer) error {
+	key, err := protocol.NewVoiceKey()
+	if err != nil {
+		return err
+	}
+	keys, err := protocol.DeriveVoiceKeys(key, serverKey, token)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(game, protocol.Line(protocol.KindVoiceKey, protocol.EncodeVoiceKey(key))); err != nil {
+		return err
+	}
+	conn, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return err
+	}
+	v.mu.Lock()
+	if v.conn != nil {
+		v.conn.Close()
+	}
+	v.conn, v.token, v.keys = conn, token, keys
+	v.mu.Unlock()
+
+	// An empty packet tells the server where to send other players' voice.
+	v.send(nil)
+	go v.receive(conn, keys.Down)
+	return nil
+}
+
+func (v *VoiceChat) Close() error {
+	v.mu.Lock()
+	if v.conn != nil {
+		v.conn.Close()
+	}
+	v.mu.Unlock()
+	v.player.Close()
+	return v.backend.Close()
+}
+
+// SetVolume sets how loud other players' voices play, from 0 to 1.
+func (v *VoiceChat) SetVolume(volume float64) {
+	v.player.SetVolume(volume)
+}
+
+// Update sets whether push-to-talk is held and re-weights every speaker by
+// their distance from the listener; speakers no longer in view are dropped.
+func (v *VoiceChat) Update(talk bool, listener Vector2f, position func(id string) (Vector2f, bool)) {
+	v.talking.Store(talk)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for id, s := range v.speakers {
+		p, ok := position(id)
+		if !ok {
+			delete(v.speakers, id)
+			continue
+		}
+		s.gain = voiceGain(math.Hypot(p.X-listener.X, p.Y-listener.Y))
+	}
+}
+
+// voiceGain fades a speaker out linearly, reaching silence at the radius the
+// server stops relaying at.
+func voiceGain(distance float64) float32 {
+	return float32(max(0, 1-distance/protocol.VoiceRadius))
+}
+
+func (v *VoiceChat) Draw(screen *ebiten.Image) {
+	if !v.talking.Load() {
+		return
+	}
+	x, y := float32(hudWidth-120), float32(hudHeight-28)
+	vector.DrawFilledCircle(screen, x, y+8, 5, color.RGBA{220, 40, 40, 255}, true)
+	drawText(screen, T("voice.talking"), int(x)+10, int(y), tagText)
+}
+
+func (v *VoiceChat) sendLoop() {
+	keepalive := time.NewTicker(voiceKeepalive)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case pcm := <-v.frames:
+			if !v.talking.Load() {
+				continue
+			}
+			frame, err := v.backend.Encode(pcm)
+			if err != nil {
+				log.Println("Error encoding voice:", err)
+				continue
+			}
+			v.send(frame)
+		case <-keepalive.C:
+			v.send(nil)
+		}
+	}
+}
+
+func (v *VoiceChat) send(frame []byte) {
+	v.mu.Lock()
+	conn, token, key := v.conn, v.token, v.keys.Up
+	v.seq++
+	seq := v.seq
+	v.mu.Unlock()
+	if conn == nil {
+		return
+	}
+	packet := protocol.SealVoicePacket(key, protocol.EncodeVoicePacket(token, seq, frame))
+	if _, err := conn.Write(packet); err != nil && !errors.Is(err, net.ErrClosed) {
+		log.Println("Error sending voice:", err)
+	}
+}
+
+// receive decodes relayed voice into each speaker's buffer until conn is
+// closed, dropping packets that fail their tag under key.
+func (v *VoiceChat) receive(conn *net.UDPConn, key []byte) {
+	buf := make([]byte, 1500)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Println("Error reading voice:", err)
+			}
+			return
+		}
+		packet, err := protocol.OpenVoicePacket(key, buf[:n])
+		if err != nil {
+			continue
+		}
+		id, seq, frame, err := protocol.DecodeVoicePacket(packet)
+		if err != nil || len(frame) == 0 {
+			continue
+		}
+		if err := v.receiveFrame(id, seq, frame); err != nil {
+			log.Printf("Error decoding voice from %s: %v", id, err)
+		}
+	}
+}
+
+func (v *VoiceChat) receiveFrame(id string, seq uint16, frame []byte) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	s, ok := v.speakers[id]
+	if !ok {
+		decoder, err := v.backend.NewDecoder()
+		if err != nil {
+			return err
+		}
+		s = &voiceSpeaker{decoder: decoder, seq: seq - 1}
+		v.speakers[id] = s
+	}
+	// Drop late or duplicated packets; sequence numbers wrap.
+	if int16(seq-s.seq) <= 0 {
+		return nil
+	}
+	s.seq = seq
+
+	pcm, err := s.decoder.Decode(frame)
+	if err != nil {
+		return err
+	}
+	for _, sample := range pcm {
+		s.samples = append(s.samples, float32(sample)/math.MaxInt16)
+	}
+	if excess := len(s.samples) - voiceMaxFrames*voiceFrameSamples; excess > 0 {
+		s.samples = s.samples[excess:]
+	}
+	return nil
+}
+
+// voiceMix is the stream the audio player pulls: every speaker's buffered
+// audio, scaled by their gain and summed, as stereo float32 samples. It
+// plays silence when nobody is talking, so it never blocks.
+type voiceMix struct {
+	v *VoiceChat
+}
+
+func (m voiceMix) Read(p []byte) (int, error) {
+	m.v.mu.Lock()
+	defer m.v.mu.Unlock()
+
+	frames := len(p) / 8
+	for _, s := range m.v.speakers {
+		if !s.playing && len(s.samples) >= voiceJitterFrames*voiceFrameSamples {
+			s.playing = true
+		}
+	}
+	for i := 0; i < frames; i++ {
+		var sum float32
+		for _, s := range m.v.speakers {
+			if !s.playing {
+				continue
+			}
+			if len(s.samples) == 0 {
+				s.playing = false
+				continue
+			}
+			sum += s.samples[0] * s.gain
+			s.samples = s.samples[1:]
+		}
+		bits := math.Float32bits(max(-1, min(1, sum)))
+		binary.LittleEndian.PutUint32(p[i*8:], bits)
+		binary.LittleEndian.PutUint32(p[i*8+4:], bits)
+	}
+	return frames * 8, nil
+}
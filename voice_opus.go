@@ -0,0 +1,111 @@
+//go:build voice
+
+package main
+
+// Building with -tags voice links microphone capture (miniaudio, through
+// malgo) and the Opus codec (libopus, through cgo) so -voice works. Add them
+// to the module first with:
+// go get github.com/gen2brain/malgo gopkg.in/hraban/opus.v2
+import (
+	"encoding/binary"
+
+	"github.com/gen2brain/malgo"
+	"gopkg.in/hraban/opus.v2"
+)
+
+// maxOpusFrame bounds one encoded 20 ms voice frame.
+const maxOpusFrame = 1000
+
+func init() {
+	newVoiceBackend = newOpusBackend
+}
+
+type opusBackend struct {
+	context *malgo.AllocatedContext
+	device  *malgo.Device
+	encoder *opus.Encoder
+}
+
+func newOpusBackend() (voiceBackend, error) {
+	encoder, err := opus.NewEncoder(voiceSampleRate, 1, opus.AppVoIP)
+	if err != nil {
+		return nil, err
+	}
+	context, err := malgo.InitContext(nil, malgo.ContextConfig{}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &opusBackend{context: context, encoder: encoder}, nil
+}
+
+func (b *opusBackend) Capture(frames chan<- []int16) error {
+	config := malgo.DefaultDeviceConfig(malgo.Capture)
+	config.Capture.Format = malgo.FormatS16
+	config.Capture.Channels = 1
+	config.SampleRate = voiceSampleRate
+
+	// The device delivers whatever period size it likes; regroup it into
+	// whole Opus frames.
+	var pending []int16
+	onData := func(_, input []byte, _ uint32) {
+		for i := 0; i+1 < len(input); i += 2 {
+			pending = append(pending, int16(binary.LittleEndian.Uint16(input[i:])))
+		}
+		for len(pending) >= voiceFrameSamples {
+			frame := append([]int16(nil), pending[:voiceFrameSamples]...)
+			pending = pending[voiceFrameSamples:]
+			select {
+			case frames <- frame:
+			default:
+			}
+		}
+	}
+
+	device, err := malgo.InitDevice(b.context.Context, config, malgo.DeviceCallbacks{Data: onData})
+	if err != nil {
+		return err
+	}
+	b.device = device
+	return device.Start()
+}
+
+func (b *opusBackend) Encode(pcm []int16) ([]byte, error) {
+	frame := make([]byte, maxOpusFrame)
+	n, err := b.encoder.Encode(pcm, frame)
+	if err != nil {
+		return nil, err
+	}
+	return frame[:n], nil
+}
+
+func (b *opusBackend) NewDecoder() (voiceDecoder, error) {
+	decoder, err := opus.NewDecoder(voiceSampleRate, 1)
+	if err != nil {
+		return nil, err
+	}
+	return opusDecoder{decoder}, nil
+}
+
+func (b *opusBackend) Close() error {
+	if b.device != nil {
+		b.device.Uninit()
+	}
+	if err := b.context.Uninit(); err != nil {
+		return err
+	}
+	b.context.Free()
+	return nil
+}
+
+type opusDecoder struct {
+	decoder *opus.Decoder
+}
+
+func (d opusDecoder) Decode(frame []byte) ([]int16, error) {
+	pcm := make([]int16, voiceFrameSamples)
+	n, err := d.decoder.Decode(frame, pcm)
+	if err != nil {
+		return nil, err
+	}
+	return pcm[:n], nil
+}
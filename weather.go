@@ -0,0 +1,73 @@
+package main
+
+import (
+	"image/color"
+
+	"darkzone/MultiTestServer/protocol"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+var weatherTints = map[protocol.Weather]color.RGBA{
+	protocol.WeatherRain: {20, 30, 60, 60},
+	protocol.WeatherSnow: {200, 210, 235, 40},
+	protocol.WeatherFog:  {170, 170, 180, 130},
+}
+
+// weatherFollower holds the precipitation emitters that track one camera,
+// so every split-screen viewport gets its own rain above it.
+type weatherFollower struct {
+	rain *Emitter
+	snow *Emitter
+}
+
+// Weather renders the zone weather the server puts in each snapshot.
+// Precipitation is particles spawned around each camera; fog or overcast
+// is a translucent tint drawn over the world.
+type Weather struct {
+	current   protocol.Weather
+	followers []weatherFollower
+}
+
+func NewWeather(events *EventBus, particles *ParticleSystem, cameras int) *Weather {
+	w := &Weather{current: protocol.WeatherClear}
+	for i := 0; i < cameras; i++ {
+		f := weatherFollower{
+			rain: particles.Add(NewEmitter(RainEmitterConfig(), Vector2f{})),
+			snow: particles.Add(NewEmitter(SnowEmitterConfig(), Vector2f{})),
+		}
+		f.rain.Active = false
+		f.snow.Active = false
+		w.followers = append(w.followers, f)
+	}
+
+	events.Subscribe(EventWeatherChanged, func(e Event) {
+		w.current = e.Payload.(WeatherChanged).Weather
+		for _, f := range w.followers {
+			f.rain.Active = w.current == protocol.WeatherRain
+			f.snow.Active = w.current == protocol.WeatherSnow
+		}
+	})
+	return w
+}
+
+// Update moves each camera's emitters to follow it: rain spawns just above
+// the view and falls through it, snow drifts in across the whole view.
+func (w *Weather) Update(centers []Vector2f) {
+	for i, f := range w.followers {
+		if i >= len(centers) {
+			break
+		}
+		f.rain.Position = Vector2f{centers[i].X, centers[i].Y - screenHeight/2 - 20}
+		f.snow.Position = centers[i]
+	}
+}
+
+func (w *Weather) Draw(target *ebiten.Image) {
+	tint, ok := weatherTints[w.current]
+	if !ok {
+		return
+	}
+	bounds := target.Bounds()
+	vector.DrawFilledRect(target, 0, 0, float32(bounds.Dx()), float32(bounds.Dy()), tint, false)
+}